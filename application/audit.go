@@ -0,0 +1,104 @@
+package application
+
+import (
+	"context"
+	"time"
+)
+
+type ActorType string
+
+const (
+	// ActorSystem are changes of NATS Tower itself, e.g. the credential renewal
+	ActorSystem    ActorType = "system"
+	ActorUser      ActorType = "user"
+	ActorSuperuser ActorType = "superuser"
+	ActorAPIToken  ActorType = "api_token"
+)
+
+// Actor is who changed a record
+type Actor struct {
+	Type ActorType
+	ID   string
+	// email of users, name of API tokens
+	Name string
+	IP   string
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a context attributing the changes saved with it to the actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor of the context, changes without an actor are made by the system
+func ActorFromContext(ctx context.Context) Actor {
+	if ctx != nil {
+		if actor, ok := ctx.Value(actorContextKey{}).(Actor); ok {
+			return actor
+		}
+	}
+	return Actor{Type: ActorSystem}
+}
+
+type AuditAction string
+
+const (
+	AuditActionCreate AuditAction = "create"
+	AuditActionUpdate AuditAction = "update"
+	AuditActionDelete AuditAction = "delete"
+)
+
+// AuditEntry records a change of an operator, account, user, limits or any of their settings
+type AuditEntry struct {
+	ID         string      `json:"id"`
+	Action     AuditAction `json:"action"`
+	Collection string      `json:"collection"`
+	RecordID   string      `json:"record_id"`
+	// name, description or URL of the record at the time of the change
+	RecordName string `json:"record_name"`
+	// empty for changes outside of an installation, e.g. shared limits
+	InstallationID string                 `json:"installation_id,omitempty"`
+	AccountID      string                 `json:"account_id,omitempty"`
+	ActorType      ActorType              `json:"actor_type"`
+	ActorID        string                 `json:"actor_id,omitempty"`
+	ActorName      string                 `json:"actor_name,omitempty"`
+	IP             string                 `json:"ip,omitempty"`
+	Changes        map[string]AuditChange `json:"changes"`
+	Created        time.Time              `json:"created"`
+}
+
+// AuditChange is the value of a field before and after the change. Seeds, private keys
+// and other secrets are redacted.
+type AuditChange struct {
+	Old any `json:"old,omitempty"`
+	New any `json:"new,omitempty"`
+}
+
+type AuditFilter struct {
+	InstallationID string
+	// if set, only changes within these accounts
+	AccountIDs []string
+	// IncludeShared adds the changes outside of installations, e.g. of shared limits.
+	// They are left out when filtering by accounts.
+	IncludeShared bool
+	// zero for no limit
+	Limit int
+}
+
+// AuditEventSubjectPrefix is the prefix of the subjects the audit events are published on,
+// e.g. tower.audit.account.created
+const AuditEventSubjectPrefix = "tower.audit"
+
+// AuditEvent is published to NATS for the entries of the audit log
+type AuditEvent struct {
+	// object and verb of the subject, e.g. account.created or user.revoked
+	Type string `json:"type"`
+	AuditEntry
+	// revoked public key of user.revoked events
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+func (e AuditEvent) Subject() string {
+	return AuditEventSubjectPrefix + "." + e.Type
+}
@@ -0,0 +1,48 @@
+package application
+
+import "time"
+
+type AccountDriftStatus string
+
+const (
+	// the account is in NATS Tower but not on all servers
+	AccountDriftMissing AccountDriftStatus = "missing"
+	// the servers hold another JWT of the account than NATS Tower
+	AccountDriftStale AccountDriftStatus = "stale"
+	// the account is on the servers but not in NATS Tower
+	AccountDriftUnknown AccountDriftStatus = "unknown"
+)
+
+// AccountDrift is an account whose JWT differs between NATS Tower and the resolvers of the servers
+type AccountDrift struct {
+	PublicKey string
+	// ID of the account in NATS Tower, empty for unknown accounts
+	AccountID string
+	// Name is taken from the JWT of the servers for unknown accounts
+	Name   string
+	Status AccountDriftStatus
+	// names of the servers without the account for missing accounts, or with it for unknown accounts
+	Servers []string
+}
+
+// DriftReport compares the accounts of an installation with the full resolvers of its servers
+type DriftReport struct {
+	InstallationID string
+	// names of the servers which answered
+	Servers  []string
+	Accounts []*AccountDrift
+	// error of the check, the other fields are empty if it is set
+	Error   string
+	Checked time.Time
+}
+
+// Count returns the number of accounts with the status
+func (r *DriftReport) Count(status AccountDriftStatus) int {
+	count := 0
+	for _, account := range r.Accounts {
+		if account.Status == status {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,99 @@
+package application
+
+type Role string
+
+const (
+	// RoleAdmin manages everything, including installations, limits and API tokens
+	RoleAdmin Role = "admin"
+	// RoleInstallationAdmin manages the accounts of an installation
+	RoleInstallationAdmin Role = "installation_admin"
+	// RoleAccountOwner manages the users, exports, imports and signing keys of an account
+	RoleAccountOwner Role = "account_owner"
+	// RoleViewer may read everything within its binding, except credentials
+	RoleViewer Role = "viewer"
+)
+
+var Roles = []Role{RoleAdmin, RoleInstallationAdmin, RoleAccountOwner, RoleViewer}
+
+// RoleBinding grants a role to a user. Admins are bound globally, installation admins
+// to an installation and account owners to an account. Viewers can be bound to either.
+type RoleBinding struct {
+	ID        string
+	UserID    string
+	UserEmail string
+	Role      Role
+	// empty for global bindings, set for account bindings as well
+	InstallationID string
+	AccountID      string
+	AccountName    string
+	// Source is empty for bindings assigned in NATS Tower, otherwise the system managing the binding
+	Source string
+}
+
+// Access holds the role bindings of the logged in user
+type Access struct {
+	// Superusers are admins without a binding
+	Superuser bool
+	Bindings  []RoleBinding
+}
+
+// Global reports whether the user may read (or write) everything
+func (a *Access) Global(write bool) bool {
+	if a.Superuser {
+		return true
+	}
+	for _, binding := range a.Bindings {
+		if binding.InstallationID != "" {
+			continue
+		}
+		if binding.Role == RoleAdmin || (!write && binding.Role == RoleViewer) {
+			return true
+		}
+	}
+	return false
+}
+
+// Installation reports whether the user may read (or write) the installation and all of its accounts
+func (a *Access) Installation(installationID string, write bool) bool {
+	if a.Global(write) {
+		return true
+	}
+	for _, binding := range a.Bindings {
+		if binding.InstallationID != installationID || binding.AccountID != "" {
+			continue
+		}
+		if binding.Role == RoleInstallationAdmin || (!write && binding.Role == RoleViewer) {
+			return true
+		}
+	}
+	return false
+}
+
+// Account reports whether the user may read (or write) the content of the account
+func (a *Access) Account(installationID, accountID string, write bool) bool {
+	if a.Installation(installationID, write) {
+		return true
+	}
+	for _, binding := range a.Bindings {
+		if binding.AccountID != accountID {
+			continue
+		}
+		if binding.Role == RoleAccountOwner || (!write && binding.Role == RoleViewer) {
+			return true
+		}
+	}
+	return false
+}
+
+// InstallationVisible reports whether the user has any role within the installation
+func (a *Access) InstallationVisible(installationID string) bool {
+	if a.Installation(installationID, false) {
+		return true
+	}
+	for _, binding := range a.Bindings {
+		if binding.InstallationID == installationID {
+			return true
+		}
+	}
+	return false
+}
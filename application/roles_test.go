@@ -0,0 +1,110 @@
+package application
+
+import "testing"
+
+func Test_Access(t *testing.T) {
+	tests := []struct {
+		name        string
+		access      Access
+		global      [2]bool
+		inst        [2]bool
+		account     [2]bool
+		otherInst   [2]bool
+		otherAcc    [2]bool
+		instVisible bool
+	}{
+		{
+			name:        "superuser",
+			access:      Access{Superuser: true},
+			global:      [2]bool{true, true},
+			inst:        [2]bool{true, true},
+			account:     [2]bool{true, true},
+			otherInst:   [2]bool{true, true},
+			otherAcc:    [2]bool{true, true},
+			instVisible: true,
+		},
+		{
+			name:        "admin",
+			access:      Access{Bindings: []RoleBinding{{Role: RoleAdmin}}},
+			global:      [2]bool{true, true},
+			inst:        [2]bool{true, true},
+			account:     [2]bool{true, true},
+			otherInst:   [2]bool{true, true},
+			otherAcc:    [2]bool{true, true},
+			instVisible: true,
+		},
+		{
+			name:        "global viewer",
+			access:      Access{Bindings: []RoleBinding{{Role: RoleViewer}}},
+			global:      [2]bool{true, false},
+			inst:        [2]bool{true, false},
+			account:     [2]bool{true, false},
+			otherInst:   [2]bool{true, false},
+			otherAcc:    [2]bool{true, false},
+			instVisible: true,
+		},
+		{
+			name:        "installation admin",
+			access:      Access{Bindings: []RoleBinding{{Role: RoleInstallationAdmin, InstallationID: "i1"}}},
+			inst:        [2]bool{true, true},
+			account:     [2]bool{true, true},
+			otherAcc:    [2]bool{true, true},
+			instVisible: true,
+		},
+		{
+			name:        "installation viewer",
+			access:      Access{Bindings: []RoleBinding{{Role: RoleViewer, InstallationID: "i1"}}},
+			inst:        [2]bool{true, false},
+			account:     [2]bool{true, false},
+			otherAcc:    [2]bool{true, false},
+			instVisible: true,
+		},
+		{
+			name:        "account owner",
+			access:      Access{Bindings: []RoleBinding{{Role: RoleAccountOwner, InstallationID: "i1", AccountID: "a1"}}},
+			account:     [2]bool{true, true},
+			instVisible: true,
+		},
+		{
+			name:        "account viewer",
+			access:      Access{Bindings: []RoleBinding{{Role: RoleViewer, InstallationID: "i1", AccountID: "a1"}}},
+			account:     [2]bool{true, false},
+			instVisible: true,
+		},
+		{
+			name:   "admin role bound to an installation is no global admin",
+			access: Access{Bindings: []RoleBinding{{Role: RoleAdmin, InstallationID: "i1"}}},
+			// only installation admins may write an installation
+			instVisible: true,
+		},
+		{
+			name:   "no bindings",
+			access: Access{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, write := range []bool{false, true} {
+				if got := tt.access.Global(write); got != tt.global[i] {
+					t.Errorf("Global(%v) = %v, want %v", write, got, tt.global[i])
+				}
+				if got := tt.access.Installation("i1", write); got != tt.inst[i] {
+					t.Errorf("Installation(i1, %v) = %v, want %v", write, got, tt.inst[i])
+				}
+				if got := tt.access.Account("i1", "a1", write); got != tt.account[i] {
+					t.Errorf("Account(i1, a1, %v) = %v, want %v", write, got, tt.account[i])
+				}
+				if got := tt.access.Installation("i2", write); got != tt.otherInst[i] {
+					t.Errorf("Installation(i2, %v) = %v, want %v", write, got, tt.otherInst[i])
+				}
+				if got := tt.access.Account("i1", "a2", write); got != tt.otherAcc[i] {
+					t.Errorf("Account(i1, a2, %v) = %v, want %v", write, got, tt.otherAcc[i])
+				}
+			}
+			if got := tt.access.InstallationVisible("i1"); got != tt.instVisible {
+				t.Errorf("InstallationVisible(i1) = %v, want %v", got, tt.instVisible)
+			}
+		})
+	}
+}
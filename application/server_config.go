@@ -0,0 +1,55 @@
+package application
+
+type ResolverType string
+
+const (
+	// the servers store the account JWTs and accept updates from NATS Tower
+	ResolverFull ResolverType = "full"
+	// the servers fetch the account JWTs from the full resolvers of the cluster and keep them for a while
+	ResolverCache ResolverType = "cache"
+	// the account JWTs are preloaded from the config, updates need a config reload
+	ResolverMemory ResolverType = "memory"
+)
+
+// ServerConfigOptions are the parameters of the server configs generated for an installation
+type ServerConfigOptions struct {
+	// ServerNames get one config file each, a cluster is configured for more than one server
+	ServerNames []string
+	ClusterName string
+	// Routes of the cluster, empty routes to all servers of the bundle by their name
+	Routes []string
+
+	ClientPort  int
+	ClusterPort int
+	// monitoring port, 0 disables it
+	HTTPPort int
+	// 0 disables the listener
+	LeafNodePort  int
+	WebsocketPort int
+	MQTTPort      int
+
+	JetStream bool
+	// max bytes of JetStream per server, 0 leaves the decision to the server
+	JetStreamMaxMemory int64
+	JetStreamMaxStore  int64
+
+	ResolverType ResolverType
+
+	// paths of the TLS files on the servers, TLS is disabled without a certificate
+	TLSCert string
+	TLSKey  string
+	TLSCA   string
+	// If true, clients have to present a certificate signed by the CA
+	TLSVerify bool
+}
+
+// ServerConfigFile is a file of a server config bundle
+type ServerConfigFile struct {
+	Name    string
+	Content string
+}
+
+// ServerConfigBundle holds a config per server and a docker-compose file to run them locally
+type ServerConfigBundle struct {
+	Files []ServerConfigFile
+}
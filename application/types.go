@@ -2,6 +2,7 @@ package application
 
 import (
 	"errors"
+	"time"
 )
 
 type OperatorAuth struct {
@@ -15,6 +16,32 @@ type OperatorAuth struct {
 	SigningPrivateKey string
 	SigningSeed       string
 	JWT               string
+	// NextSigningPublicKey is set while a signing key rotation waits for the servers to trust the new key
+	NextSigningPublicKey string
+	// RetiringSigningPublicKey is set while the old signing key waits for all servers to acknowledge the re-signed accounts
+	RetiringSigningPublicKey string
+	// Connection holds the further seed URLs and the TLS settings of the installation
+	Connection OperatorConnection
+	// ResolverMode is ResolverFull or ResolverMemory. Accounts are only pushed to full resolvers,
+	// memory resolvers get the accounts with the resolver_preload of their config.
+	ResolverMode ResolverType
+	// ConfigPath is the file the resolver_preload is written to in memory mode, empty if it is not written
+	ConfigPath string
+	// ConfigReloadRequired is set in memory mode once the accounts changed since the last reload of the servers
+	ConfigReloadRequired bool
+}
+
+// OperatorConnection are the settings NATS Tower and the NATS CLI contexts connect to the servers of an installation with
+type OperatorConnection struct {
+	// SeedURLs are tried in addition to the URL of the installation
+	SeedURLs []string
+	// PEM encoded CA to verify the servers with, empty uses the system CAs
+	TLSCA string
+	// PEM encoded client certificate and key, for servers which verify clients
+	TLSCert string
+	TLSKey  string
+	// If true, the TLS handshake is done before the server sends its INFO (handshake_first in the server config)
+	TLSHandshakeFirst bool
 }
 
 type AccountAuth struct {
@@ -29,6 +56,67 @@ type AccountAuth struct {
 	SigningPrivateKey string
 	SigningSeed       string
 	JWT               string
+	// ReadOnly accounts were imported without a signing seed. NATS Tower can not sign users or updates for them.
+	ReadOnly bool
+}
+
+type AccountPublishStatus string
+
+const (
+	// the servers acknowledged the current JWT of the account
+	AccountPublishPublished AccountPublishStatus = "published"
+	// the change waits for the servers, failed attempts are retried with backoff
+	AccountPublishPending AccountPublishStatus = "pending"
+	// all attempts failed, the account must be published again manually
+	AccountPublishFailed AccountPublishStatus = "failed"
+)
+
+// AccountPublication is the state of pushing the latest change of an account to the servers
+type AccountPublication struct {
+	AccountID string
+	Status    AccountPublishStatus
+	Attempts  int
+	// error of the last attempt
+	Error       string
+	NextAttempt time.Time
+	Updated     time.Time
+}
+
+// ConnectionHealth is the state of the shared connection of NATS Tower to an installation
+type ConnectionHealth struct {
+	// connected, reconnecting, disconnected, ...
+	Status       string
+	ConnectedURL string
+	ServerName   string
+	Reconnects   uint64
+	// error of the last disconnect
+	LastError string
+	// time of the last status change
+	Since time.Time
+}
+
+// AccountSigningKey is an additional signing key of an account
+type AccountSigningKey struct {
+	ID          string
+	AccountID   string
+	Description string
+	PublicKey   string
+	PrivateKey  string
+	Seed        string
+	// Scoped keys can only sign users, which get the permissions of the template.
+	// The permissions and limits of the user itself are ignored.
+	Scoped   bool
+	Role     string
+	Template UserPermissions
+	// Retiring keys were rotated and are removed once the servers in memory mode reloaded their config
+	Retiring bool
+}
+
+type AccountSigningKeyOptions struct {
+	Description string
+	Scoped      bool
+	Role        string
+	Template    UserPermissions
 }
 
 type UserAuth struct {
@@ -41,11 +129,108 @@ type UserAuth struct {
 	Seed        string
 	JWT         string
 	Creds       string
+	BearerToken bool
+	// Lifetime of the JWT, 0 if it does not expire
+	TTL     time.Duration
+	Expires time.Time
+	// ID of the signing key of the account the user is signed with, empty for the account signing key
+	SigningKeyID string
+}
+
+// UserCredential is an entry of the history of the JWTs issued for a user
+type UserCredential struct {
+	ID        string
+	UserID    string
+	PublicKey string
+	JWT       string
+	Issued    time.Time
+	// zero if the JWT does not expire
+	Expires time.Time
+	// created, reissued or rotated
+	Reason string
+	// If true, the JWT is the one currently handed out
+	Current bool
+	// If true, the public key of the JWT was revoked after it was issued
+	Revoked bool
 }
 
 type UserOptions struct {
 	// If true, the user will not require a seed for connecting (MQTT users need that, any username with the JWT as password)
 	BearerToken bool
+	// Limits of a new user, nil keeps the user unlimited
+	Limits *UserLimits
+	// Lifetime of the JWT of a new user, 0 means it does not expire
+	TTL time.Duration
+}
+
+type UserPermissions struct {
+	ID     string
+	UserID string
+	// Subjects the user may (not) publish to
+	PubAllow []string
+	PubDeny  []string
+	// Subjects the user may (not) subscribe to
+	SubAllow []string
+	SubDeny  []string
+	// If true, the user may publish to reply subjects of requests it received
+	AllowResponses bool
+	ResponsesMax   int
+	ResponsesTTL   time.Duration
+}
+
+// UserLimits restrict a single user. -1 means unlimited.
+type UserLimits struct {
+	ID               string
+	UserID           string
+	MaxSubscriptions int64
+	// Max bytes of data in flight and per message
+	MaxData    int64
+	MaxPayload int64
+	// Connection types the user may use (STANDARD, WEBSOCKET, MQTT, LEAFNODE, ...). Empty allows all.
+	ConnectionTypes []string
+	// CIDRs the user may connect from. Empty allows all.
+	Src []string
+	// Time windows the user may connect in. Empty allows all.
+	Times []UserTimeRange
+	// Locale of the time windows, e.g. Europe/Berlin. Empty uses the server time zone.
+	Locale string
+}
+
+// UserTimeRange is a daily time window in the format 15:04:05
+type UserTimeRange struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type AccountExport struct {
+	ID          string
+	AccountID   string
+	AccountName string
+	Name        string
+	Description string
+	Subject     string
+	// "stream" or "service"
+	Type string
+	// If true, importing accounts need an activation token
+	Private bool
+	// Only used for private exports: IDs of the accounts allowed to import the export
+	Importers []string
+	// Only used for services: "Singleton", "Stream" or "Chunked"
+	ResponseType string
+}
+
+type AccountImport struct {
+	ID                string
+	AccountID         string
+	ExportID          string
+	ExportAccountName string
+	Name              string
+	// Subject of the export in the exporting account
+	Subject string
+	// Optional subject the import is mapped to in the importing account
+	LocalSubject string
+	Type         string
+	Private      bool
 }
 
 var (
@@ -57,3 +242,104 @@ const AuthCookieName = "PB-Auth"
 type UserPreferences struct {
 	LastInstallationID string `json:"last_installation_id"`
 }
+
+// ImportReport summarizes the import of an existing installation
+type ImportReport struct {
+	OperatorID       string
+	Accounts         []string
+	ReadOnlyAccounts []string
+	Users            []string
+	// Skipped lists everything that could not be imported, including the reason
+	Skipped []string
+}
+
+// Limits is a named set of account limits. -1 means unlimited.
+type Limits struct {
+	ID      string
+	Name    string
+	Default bool
+
+	MaxConnections         int64
+	MaxLeafNodeConnections int64
+	MaxSubscriptions       int64
+	// Max bytes of data in flight and per message
+	MaxData    int64
+	MaxPayload int64
+	MaxImports int64
+	MaxExports int64
+
+	DisallowWildcardExports bool
+	DisallowBearer          bool
+
+	JetStreamMaxMemory     int64
+	JetStreamMaxDisk       int64
+	JetStreamMaxStreams    int64
+	JetStreamMaxConsumers  int64
+	JetStreamMaxAckPending int64
+	// Max bytes a single stream may use
+	JetStreamMemoryMaxStreamBytes int64
+	JetStreamDiskMaxStreamBytes   int64
+	// If true, streams have to set max bytes
+	JetStreamMaxBytesRequired bool
+
+	// JetStreamTiers are limits per replica tier (R1, R3). If set, they replace the
+	// memory, disk, stream and consumer limits above.
+	JetStreamTiers map[string]JetStreamTierLimits
+}
+
+// JetStreamTierLimits are the JetStream limits of a replica tier. -1 means unlimited.
+type JetStreamTierLimits struct {
+	MaxMemory    int64 `json:"max_memory"`
+	MaxDisk      int64 `json:"max_disk"`
+	MaxStreams   int64 `json:"max_streams"`
+	MaxConsumers int64 `json:"max_consumers"`
+}
+
+var (
+	ErrAPITokenInvalid = errors.New("API token is invalid or expired")
+)
+
+// APIToken grants access to the API. Only a hash of the token is stored.
+type APIToken struct {
+	ID   string
+	Name string
+	// Prefix is the start of the token, to recognize it without storing it
+	Prefix string
+	// ReadOnly tokens may only read
+	ReadOnly bool
+	// If set, the token is restricted to the installation
+	InstallationID string
+	// If set, the token is restricted to the account (and its installation)
+	AccountID   string
+	AccountName string
+	// zero if the token does not expire
+	Expires  time.Time
+	LastUsed time.Time
+	Created  time.Time
+}
+
+type APITokenOptions struct {
+	Name           string
+	ReadOnly       bool
+	InstallationID string
+	AccountID      string
+	// zero if the token does not expire
+	Expires time.Time
+}
+
+var (
+	ErrSetupTokenInvalid = errors.New("link is invalid or expired")
+	ErrMemberExists      = errors.New("a user with this email already exists")
+)
+
+// Member is a user of NATS Tower (not a NATS user)
+type Member struct {
+	ID       string
+	Email    string
+	Verified bool
+	Disabled bool
+	// Invited members have not set their password yet
+	Invited bool
+	Created time.Time
+	Roles   []RoleBinding
+}
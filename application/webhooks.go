@@ -0,0 +1,83 @@
+package application
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type WebhookEvent string
+
+const (
+	WebhookEventAccountCreated WebhookEvent = "account.created"
+	WebhookEventAccountDeleted WebhookEvent = "account.deleted"
+	WebhookEventUserCreated    WebhookEvent = "user.created"
+	WebhookEventUserDeleted    WebhookEvent = "user.deleted"
+	// limits were changed or another limits were assigned to an account
+	WebhookEventLimitsChanged WebhookEvent = "limits.changed"
+	// the key of a user was rotated, credentials issued before are revoked
+	WebhookEventCredentialsRotated WebhookEvent = "user.credentials_rotated"
+)
+
+// WebhookEvents are the events a webhook can subscribe to
+var WebhookEvents = []WebhookEvent{
+	WebhookEventAccountCreated,
+	WebhookEventAccountDeleted,
+	WebhookEventUserCreated,
+	WebhookEventUserDeleted,
+	WebhookEventLimitsChanged,
+	WebhookEventCredentialsRotated,
+}
+
+// Webhook sends the subscribed events to an URL. The payload is signed with the secret.
+type Webhook struct {
+	ID     string
+	Name   string
+	URL    string
+	Events []WebhookEvent
+	// status of the latest delivery, empty if nothing was delivered yet
+	LastDeliveryStatus WebhookDeliveryStatus
+	Created            time.Time
+}
+
+type WebhookOptions struct {
+	Name   string
+	URL    string
+	Events []WebhookEvent
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	// all attempts failed
+	WebhookDeliveryFailed WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is an event sent to a webhook, including its retries
+type WebhookDelivery struct {
+	ID        string
+	WebhookID string
+	Event     WebhookEvent
+	Payload   json.RawMessage
+	Status    WebhookDeliveryStatus
+	Attempts  int
+	// HTTP status of the last attempt, zero if no response was received
+	ResponseStatus int
+	// error of the last attempt
+	Error       string
+	NextAttempt time.Time
+	Created     time.Time
+	Updated     time.Time
+}
+
+// WebhookPayload is the body posted to the webhooks
+type WebhookPayload struct {
+	// ID of the delivery, the same for all attempts
+	ID             string       `json:"id"`
+	Event          WebhookEvent `json:"event"`
+	InstallationID string       `json:"installation_id,omitempty"`
+	AccountID      string       `json:"account_id,omitempty"`
+	Data           any          `json:"data"`
+	Created        time.Time    `json:"created"`
+}
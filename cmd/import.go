@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/spf13/cobra"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/natsauth"
+)
+
+// newImportCommand creates the commands to move an existing installation under NATS Tower
+func newImportCommand(ctx context.Context, logger *slog.Logger, app *pocketbase.PocketBase,
+	keyRing *natsauth.KeyRing, signer natsauth.Signer) *cobra.Command {
+	var opts natsauth.ImportOptions
+	var sysCredsFile, tlsCAFile, tlsCertFile, tlsKeyFile string
+
+	command := &cobra.Command{
+		Use:   "import",
+		Short: "Import an existing NATS installation",
+	}
+	command.PersistentFlags().StringVar(&opts.URL, "url", "", "URL of the installation (defaults to the service URLs of the operator)")
+	command.PersistentFlags().StringVar(&opts.Description, "description", "", "Description of the installation (defaults to the operator name)")
+	command.PersistentFlags().StringVar(&opts.KeysDir, "keys", "", "nsc keys directory to look up seeds in")
+	command.PersistentFlags().StringVar(&sysCredsFile, "sys-creds", "", "Credentials file of a system account user")
+	command.PersistentFlags().StringSliceVar(&opts.Connection.SeedURLs, "seed-url", nil, "Additional URLs of the servers of the installation")
+	command.PersistentFlags().StringVar(&tlsCAFile, "tls-ca", "", "PEM file of the CA to verify the servers with (defaults to the system CAs)")
+	command.PersistentFlags().StringVar(&tlsCertFile, "tls-cert", "", "PEM file of the client certificate, for servers which verify clients")
+	command.PersistentFlags().StringVar(&tlsKeyFile, "tls-key", "", "PEM file of the key of the client certificate")
+	command.PersistentFlags().BoolVar(&opts.Connection.TLSHandshakeFirst, "tls-handshake-first", false, "Do the TLS handshake before the server sends its INFO")
+
+	createModule := func() (*natsauth.NATSAuthModule, error) {
+		if sysCredsFile != "" {
+			creds, err := os.ReadFile(sysCredsFile)
+			if err != nil {
+				return nil, err
+			}
+			opts.SysCreds = string(creds)
+		}
+		// the TLS settings are stored with the operator, so the files are read in
+		for _, file := range []struct {
+			path  string
+			value *string
+		}{
+			{tlsCAFile, &opts.Connection.TLSCA},
+			{tlsCertFile, &opts.Connection.TLSCert},
+			{tlsKeyFile, &opts.Connection.TLSKey},
+		} {
+			if file.path == "" {
+				continue
+			}
+			content, err := os.ReadFile(file.path)
+			if err != nil {
+				return nil, err
+			}
+			*file.value = string(content)
+		}
+		return natsauth.CreateNATSAuthModule(ctx,
+			logger.With(slog.String("module", "NATSAuthModule")),
+			natsauth.NATSAuthModuleConfig{
+				App:     app,
+				KeyRing: keyRing,
+				Signer:  signer,
+			})
+	}
+
+	command.AddCommand(&cobra.Command{
+		Use:   "nsc <operator store directory>",
+		Short: "Import an operator with its accounts and users from a nsc store",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.KeysDir == "" {
+				opts.KeysDir = defaultNSCKeysDir()
+			}
+			natsauthModule, err := createModule()
+			if err != nil {
+				return err
+			}
+			report, err := natsauthModule.ImportFromNSCStore(ctx, args[0], opts)
+			if err != nil {
+				return err
+			}
+			printImportReport(report)
+			return nil
+		},
+	})
+
+	command.AddCommand(&cobra.Command{
+		Use:   "server <operator jwt file>",
+		Short: "Import the accounts of a running installation using its full resolver",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			operatorJWT, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			natsauthModule, err := createModule()
+			if err != nil {
+				return err
+			}
+			report, err := natsauthModule.ImportFromServer(ctx, string(operatorJWT), opts)
+			if err != nil {
+				return err
+			}
+			printImportReport(report)
+			return nil
+		},
+	})
+
+	return command
+}
+
+// defaultNSCKeysDir mirrors the lookup of nsc itself
+func defaultNSCKeysDir() string {
+	if dir := os.Getenv("NKEYS_PATH"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "nats", "nsc", "keys")
+}
+
+func printImportReport(report *application.ImportReport) {
+	fmt.Printf("Imported installation %s\n", report.OperatorID)
+	fmt.Printf("Accounts (%d):\n", len(report.Accounts))
+	for _, account := range report.Accounts {
+		fmt.Printf("  %s\n", account)
+	}
+	fmt.Printf("Read-only accounts (%d):\n", len(report.ReadOnlyAccounts))
+	for _, account := range report.ReadOnlyAccounts {
+		fmt.Printf("  %s\n", account)
+	}
+	fmt.Printf("Users (%d):\n", len(report.Users))
+	for _, user := range report.Users {
+		fmt.Printf("  %s\n", user)
+	}
+	fmt.Printf("Not imported (%d):\n", len(report.Skipped))
+	for _, skipped := range report.Skipped {
+		fmt.Printf("  %s\n", skipped)
+	}
+}
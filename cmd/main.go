@@ -6,10 +6,12 @@ import (
 	"log/slog"
 	"os"
 	"runtime/debug"
+	"time"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 
+	"github.com/nats-tower/nats-tower/interfaces/api"
 	"github.com/nats-tower/nats-tower/interfaces/store"
 	"github.com/nats-tower/nats-tower/interfaces/web/routes"
 	"github.com/nats-tower/nats-tower/natsauth"
@@ -35,6 +37,22 @@ func main() {
 	slog.SetDefault(logger)
 	app := pocketbase.NewWithConfig(pocketbase.Config{})
 
+	keyRing, err := loadKeyRing()
+	if err != nil {
+		logger.ErrorContext(ctx, "Could not load seed encryption keys", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	signer, err := loadSigner()
+	if err != nil {
+		logger.ErrorContext(ctx, "Could not load signer", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	oidcProvider, err := loadOIDCProvider(ctx, logger)
+	if err != nil {
+		logger.ErrorContext(ctx, "Could not load OIDC provider", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
 	info := []any{slog.String("go_version", buildInfo.GoVersion)}
 
 	for _, buildSetting := range buildInfo.Settings {
@@ -122,31 +140,85 @@ func main() {
 			bootstrapURLs = []string{bootstrapURL}
 		}
 
+		// the NATS CLI contexts hold the creds of the users in plaintext,
+		// so with encrypted seeds they are only written if requested explicitly
+		natsCLIContexts := keyRing == nil
+		if value := os.Getenv("NATS_CLI_CONTEXTS"); value != "" {
+			natsCLIContexts = value == "true"
+		}
+		if natsCLIContexts && keyRing != nil {
+			logger.WarnContext(ctx, "NATS CLI contexts are enabled, the creds of the users are written to them in plaintext")
+		}
+
 		natsauthModule, err := natsauth.CreateNATSAuthModule(ctx,
 			logger.With(slog.String("module", "NATSAuthModule")),
 			natsauth.NATSAuthModuleConfig{
-				App:           e.App,
-				BootstrapURLs: bootstrapURLs,
-				APIToken:      os.Getenv("API_TOKEN"),
+				App:                    e.App,
+				BootstrapURLs:          bootstrapURLs,
+				DisableNATSCLIContexts: !natsCLIContexts,
+
+				CredentialRenewalInterval: env.GetDurationEnv(ctx, logger, "CREDENTIAL_RENEWAL_INTERVAL", time.Minute),
+				DriftCheckInterval:        env.GetDurationEnv(ctx, logger, "DRIFT_CHECK_INTERVAL", time.Hour),
+				KeyRing:                   keyRing,
+				Signer:                    signer,
+				AuditEventAccount:         env.GetStringEnv(ctx, logger, "AUDIT_EVENT_ACCOUNT", ""),
+				ResolverConfigDir:         env.GetStringEnv(ctx, logger, "RESOLVER_CONFIG_DIR", ""),
 			})
 		if err != nil {
 			logger.ErrorContext(ctx, "Could not CreateNATSAuthModule", slog.String("error", err.Error()))
 			return err
 		}
 
+		legacyAPIToken := os.Getenv("API_TOKEN")
+		if legacyAPIToken != "" {
+			logger.WarnContext(ctx, "API_TOKEN is deprecated, create scoped API tokens in the UI instead")
+		}
+		err = store.InitAPITokenCollection(e, legacyAPIToken)
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not InitAPITokenCollection", slog.String("error", err.Error()))
+			return err
+		}
+
+		err = store.InitRoleBindingCollection(e)
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not InitRoleBindingCollection", slog.String("error", err.Error()))
+			return err
+		}
+
 		// Register the HTML routes
 		err = routes.RegisterHTMLRoutes(ctx,
 			logger.With(slog.String("module", "NATSAuthModule")),
 			e,
-			natsauthModule)
+			natsauthModule,
+			oidcProvider)
 		if err != nil {
 			logger.ErrorContext(ctx, "Could not RegisterHTMLRoutes", slog.String("error", err.Error()))
 			return err
 		}
 
+		if oidcProvider != nil && oidcProvider.PasswordLoginDisabled() {
+			// users may only log in via the single sign-on, superusers are not affected
+			e.App.OnRecordAuthWithPasswordRequest("users").BindFunc(func(e *core.RecordAuthWithPasswordRequestEvent) error {
+				return e.ForbiddenError("Login with "+oidcProvider.Name()+" instead", nil)
+			})
+		}
+
+		// Register the JSON API routes
+		err = api.RegisterAPIRoutes(ctx,
+			logger.With(slog.String("module", "API")),
+			e)
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not RegisterAPIRoutes", slog.String("error", err.Error()))
+			return err
+		}
+
 		return e.Next()
 	})
 
+	app.RootCmd.AddCommand(newImportCommand(ctx, logger, app, keyRing, signer))
+	app.RootCmd.AddCommand(newEncryptSeedsCommand(ctx, logger, app, keyRing))
+	app.RootCmd.AddCommand(newSignerCommand(ctx, logger))
+
 	if err := app.Start(); err != nil {
 		logger.ErrorContext(ctx, "Could not start app", slog.String("error", err.Error()))
 	}
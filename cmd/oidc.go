@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/nats-tower/nats-tower/interfaces/oidc"
+	"github.com/nats-tower/nats-tower/utils/env"
+)
+
+// loadOIDCProvider configures the single sign-on, nil if OIDC_ISSUER is not set
+func loadOIDCProvider(ctx context.Context, logger *slog.Logger) (*oidc.Provider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	mappings, err := oidc.ParseRoleMappings(os.Getenv("OIDC_ROLE_MAPPING"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OIDC_ROLE_MAPPING: %w", err)
+	}
+
+	return oidc.NewProvider(oidc.Config{
+		Issuer:               issuer,
+		ClientID:             os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:         os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:          env.GetStringEnv(ctx, logger, "OIDC_REDIRECT_URL", ""),
+		Scopes:               strings.Fields(env.GetStringEnv(ctx, logger, "OIDC_SCOPES", "openid email profile")),
+		GroupsClaim:          env.GetStringEnv(ctx, logger, "OIDC_GROUPS_CLAIM", "groups"),
+		Name:                 env.GetStringEnv(ctx, logger, "OIDC_NAME", "SSO"),
+		RoleMappings:         mappings,
+		DisablePasswordLogin: os.Getenv("OIDC_DISABLE_PASSWORD_LOGIN") == "true",
+	})
+}
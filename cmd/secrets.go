@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/spf13/cobra"
+
+	"github.com/nats-tower/nats-tower/natsauth"
+)
+
+// loadKeyRing reads the master keys from SEED_ENCRYPTION_KEY or the file in SEED_ENCRYPTION_KEY_FILE.
+// Both contain base64 encoded 32 byte keys, the first one is used for encryption.
+func loadKeyRing() (*natsauth.KeyRing, error) {
+	keys := os.Getenv("SEED_ENCRYPTION_KEY")
+	if keyFile := os.Getenv("SEED_ENCRYPTION_KEY_FILE"); keyFile != "" {
+		if keys != "" {
+			return nil, fmt.Errorf("only one of SEED_ENCRYPTION_KEY and SEED_ENCRYPTION_KEY_FILE can be set")
+		}
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = string(content)
+	}
+	return natsauth.ParseKeyRing(keys)
+}
+
+// newEncryptSeedsCommand creates the command to encrypt the seeds of an existing database in place
+func newEncryptSeedsCommand(ctx context.Context, logger *slog.Logger, app *pocketbase.PocketBase, keyRing *natsauth.KeyRing) *cobra.Command {
+	return &cobra.Command{
+		Use:   "encrypt-seeds",
+		Short: "Encrypt all seeds and private keys with the current master key",
+		Long: "Encrypts seeds and private keys that are stored in plaintext and re-encrypts the ones " +
+			"encrypted with an older master key. Run it after enabling encryption or rotating the master key.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if keyRing == nil {
+				return fmt.Errorf("SEED_ENCRYPTION_KEY or SEED_ENCRYPTION_KEY_FILE must be set")
+			}
+			// the app is bootstrapped by the root command, the module is not needed to re-encrypt the rows
+			updated, err := natsauth.EncryptSecrets(ctx, logger, app, keyRing)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Encrypted the secrets of %d records\n", updated)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nats-tower/nats-tower/natsauth"
+)
+
+// loadSigner returns the external signer configured with SIGNER_SOCKET or SIGNER_KEYS_DIR, if any
+func loadSigner() (natsauth.Signer, error) {
+	socket := os.Getenv("SIGNER_SOCKET")
+	keysDir := os.Getenv("SIGNER_KEYS_DIR")
+	switch {
+	case socket != "" && keysDir != "":
+		return nil, fmt.Errorf("only one of SIGNER_SOCKET and SIGNER_KEYS_DIR can be set")
+	case socket != "":
+		return natsauth.NewSocketSigner(socket), nil
+	case keysDir != "":
+		return natsauth.FileSigner{KeysDir: keysDir}, nil
+	}
+	return nil, nil
+}
+
+// newSignerCommand creates the command to run a local signing process for SIGNER_SOCKET
+func newSignerCommand(ctx context.Context, logger *slog.Logger) *cobra.Command {
+	var socket string
+	var keysDir string
+
+	command := &cobra.Command{
+		Use:   "signer",
+		Short: "Sign JWTs for NATS Tower with the seeds of a nsc keys directory",
+		Long: "Listens on a unix socket and signs the JWTs of NATS Tower with the seeds of a nsc keys directory. " +
+			"Point SIGNER_SOCKET of NATS Tower to the socket to keep the seeds out of its database.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if keysDir == "" {
+				keysDir = defaultNSCKeysDir()
+			}
+			// a socket left over from a previous run would block the listener
+			if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			listener, err := net.Listen("unix", socket)
+			if err != nil {
+				return err
+			}
+			if err := os.Chmod(socket, 0600); err != nil {
+				listener.Close()
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			go func() {
+				<-ctx.Done()
+				listener.Close()
+			}()
+
+			logger.InfoContext(ctx, "Signer listening...",
+				slog.String("socket", socket),
+				slog.String("keys", keysDir))
+			return natsauth.ServeSigner(ctx, logger, listener, natsauth.FileSigner{KeysDir: keysDir})
+		},
+	}
+	command.Flags().StringVar(&socket, "socket", "nats-tower-signer.sock", "Path of the unix socket to listen on")
+	command.Flags().StringVar(&keysDir, "keys", "", "nsc keys directory with the seeds to sign with (defaults to NKEYS_PATH or the nsc default)")
+	return command
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+	"github.com/nats-tower/nats-tower/natsauth"
+)
+
+func accountFromRecord(e *core.RequestEvent, record *core.Record) (Account, error) {
+	account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(record, "")
+	if err != nil {
+		return Account{}, err
+	}
+	return newAccount(account, record.GetString("operator"), record.GetString("limits"), includeSecrets(e)), nil
+}
+
+func GetAccounts(e *core.RequestEvent, installationID string) error {
+	if _, err := findInstallationRecord(e, installationID); err != nil {
+		return apiError(e, "Installation not found", err)
+	}
+
+	records, err := e.App.FindRecordsByFilter("nats_auth_accounts",
+		"operator = {:operator}", "name", 0, 0,
+		dbx.Params{"operator": installationID})
+	if err != nil {
+		return apiError(e, "Failed to get accounts", err)
+	}
+
+	res := []Account{}
+	for _, record := range records {
+		if token := getAPIToken(e); token != nil && token.AccountID != "" && token.AccountID != record.Id {
+			continue
+		}
+		if access := getAccess(e); access != nil && !access.Account(installationID, record.Id, false) {
+			continue
+		}
+		account, err := accountFromRecord(e, record)
+		if err != nil {
+			return apiError(e, "Failed to get account", err)
+		}
+		res = append(res, account)
+	}
+	return e.JSON(http.StatusOK, res)
+}
+
+func GetAccount(e *core.RequestEvent, installationID, name string) error {
+	record, err := findAccountRecord(e, installationID, name)
+	if err != nil {
+		return apiError(e, "Account not found", err)
+	}
+
+	account, err := accountFromRecord(e, record)
+	if err != nil {
+		return apiError(e, "Failed to get account", err)
+	}
+	return e.JSON(http.StatusOK, account)
+}
+
+// PutAccount creates the account if it does not exist yet and assigns the requested limits.
+// It responds with 201 if the account was created and 200 if it already existed.
+func PutAccount(e *core.RequestEvent, installationID, name string) error {
+	var req UpsertAccountRequest
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+
+	installationRecord, err := findInstallationRecord(e, installationID)
+	if err != nil {
+		return apiError(e, "Installation not found", err)
+	}
+
+	var limitsID string
+	if req.Limits != nil && *req.Limits != "" {
+		limitsRecord, err := findLimitsRecord(e, *req.Limits)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return e.BadRequestError("Limits "+*req.Limits+" not found", err)
+			}
+			return apiError(e, "Failed to find limits", err)
+		}
+		limitsID = limitsRecord.Id
+	}
+
+	status := http.StatusOK
+	if _, err := findAccountRecord(e, installationID, name); errors.Is(err, sql.ErrNoRows) {
+		status = http.StatusCreated
+	} else if err != nil {
+		return apiError(e, "Failed to find account", err)
+	}
+
+	account, err := natsauthModule.UpsertAccountAuth(e.Request.Context(),
+		installationRecord.GetString("url"),
+		name,
+		req.Description,
+		natsauth.UpsertAccountAuthOptions{})
+	if err != nil {
+		return apiError(e, "Failed to upsert account", err)
+	}
+
+	record, err := e.App.FindRecordById("nats_auth_accounts", account.ID)
+	if err != nil {
+		return apiError(e, "Account not found", err)
+	}
+
+	if req.Limits != nil && record.GetString("limits") != limitsID {
+		err = natsauthModule.SetAccountLimits(e.Request.Context(), record.Id, limitsID)
+		if err != nil {
+			return apiError(e, "Failed to set account limits", err)
+		}
+		record, err = e.App.FindRecordById("nats_auth_accounts", account.ID)
+		if err != nil {
+			return apiError(e, "Account not found", err)
+		}
+	}
+
+	res, err := accountFromRecord(e, record)
+	if err != nil {
+		return apiError(e, "Failed to get account", err)
+	}
+	return e.JSON(status, res)
+}
+
+func DeleteAccount(e *core.RequestEvent, installationID, name string) error {
+	record, err := findAccountRecord(e, installationID, name)
+	if err != nil {
+		return apiError(e, "Account not found", err)
+	}
+
+	if err := e.App.DeleteWithContext(e.Request.Context(), record); err != nil {
+		return apiError(e, "Failed to delete account", err)
+	}
+	return e.NoContent(http.StatusNoContent)
+}
+
+func GetAccountLimits(e *core.RequestEvent, installationID, name string) error {
+	record, err := findAccountRecord(e, installationID, name)
+	if err != nil {
+		return apiError(e, "Account not found", err)
+	}
+
+	limits, err := utils.MustGetNATSAuth(e).GetAccountLimits(e.Request.Context(), record.Id)
+	if err != nil {
+		return apiError(e, "Failed to get account limits", err)
+	}
+	return e.JSON(http.StatusOK, newLimits(limits))
+}
+
+func PutAccountLimits(e *core.RequestEvent, installationID, name string) error {
+	var req SetAccountLimitsRequest
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+
+	record, err := findAccountRecord(e, installationID, name)
+	if err != nil {
+		return apiError(e, "Account not found", err)
+	}
+
+	var limitsID string
+	if req.Limits != "" {
+		limitsRecord, err := findLimitsRecord(e, req.Limits)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return e.BadRequestError("Limits "+req.Limits+" not found", err)
+			}
+			return apiError(e, "Failed to find limits", err)
+		}
+		limitsID = limitsRecord.Id
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	if err := natsauthModule.SetAccountLimits(e.Request.Context(), record.Id, limitsID); err != nil {
+		return apiError(e, "Failed to set account limits", err)
+	}
+
+	limits, err := natsauthModule.GetAccountLimits(e.Request.Context(), record.Id)
+	if err != nil {
+		return apiError(e, "Failed to get account limits", err)
+	}
+	return e.JSON(http.StatusOK, newLimits(limits))
+}
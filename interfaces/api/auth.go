@@ -0,0 +1,194 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/store"
+	"github.com/nats-tower/nats-tower/natsauth"
+)
+
+const (
+	apiPrefix = "/api/v1"
+	// apiTokenHeader carries API tokens, the header name is kept from the former API_TOKEN
+	apiTokenHeader = "X-Token"
+	apiTokenKey    = "api_token"
+	apiAccessKey   = "access"
+)
+
+// LoadAPIToken validates the API token of requests outside of the UI.
+// Tokens are only accepted by the versioned API, other routes reject them.
+func LoadAPIToken() func(*core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		value := e.Request.Header.Get(apiTokenHeader)
+		if value == "" {
+			return e.Next()
+		}
+		path := e.Request.URL.Path
+		if path == "/login" || path == "/logout" || strings.HasPrefix(path, "/ui/") {
+			// the UI authenticates with the cookie only
+			return e.Next()
+		}
+
+		token, err := store.FindAPIToken(e.App, value)
+		if errors.Is(err, application.ErrAPITokenInvalid) {
+			return e.UnauthorizedError("The API token is invalid or expired.", nil)
+		}
+		if err != nil {
+			return e.InternalServerError("Failed to check API token", err)
+		}
+
+		if path != apiPrefix && !strings.HasPrefix(path, apiPrefix+"/") {
+			return e.ForbiddenError("API tokens are only accepted by "+apiPrefix+".", nil)
+		}
+
+		e.Set(apiTokenKey, token)
+		return e.Next()
+	}
+}
+
+// RequireAPIAuth allows requests authenticated as a record of one of the collections
+// or with an API token
+func RequireAPIAuth(collectionNames ...string) func(*core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		if e.Auth != nil && slices.Contains(collectionNames, e.Auth.Collection().Name) {
+			return e.Next()
+		}
+		if getAPIToken(e) != nil {
+			return e.Next()
+		}
+		return e.UnauthorizedError("The request requires a valid auth or API token.", nil)
+	}
+}
+
+// RequireAPITokenScope restricts requests with an API token to its scope. Reading seeds and creds
+// with include_secrets=true counts as a change:
+//   - read-only tokens may only read
+//   - installation tokens may only access their installation and read the shared limits
+//   - account tokens may only read their account and manage its users
+func RequireAPITokenScope() func(*core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		token := getAPIToken(e)
+		if token == nil {
+			return e.Next()
+		}
+
+		read := (e.Request.Method == http.MethodGet || e.Request.Method == http.MethodHead) && !includeSecrets(e)
+		if token.ReadOnly && !read {
+			return e.ForbiddenError("The API token is read-only.", nil)
+		}
+		if token.InstallationID == "" {
+			return e.Next()
+		}
+
+		installationID := e.Request.PathValue("installation_id")
+		if installationID == "" {
+			// installation list and shared limits
+			if !read {
+				return e.ForbiddenError("The API token is restricted to an installation.", nil)
+			}
+			return e.Next()
+		}
+		if installationID != token.InstallationID {
+			return e.ForbiddenError("The API token is restricted to another installation.", nil)
+		}
+		if token.AccountID == "" {
+			return e.Next()
+		}
+
+		account := e.Request.PathValue("account")
+		if account == "" {
+			// installation and account list
+			if !read {
+				return e.ForbiddenError("The API token is restricted to an account.", nil)
+			}
+			return e.Next()
+		}
+		if account != token.AccountName {
+			return e.ForbiddenError("The API token is restricted to another account.", nil)
+		}
+		if e.Request.PathValue("user") == "" && e.Request.Method != http.MethodGet && e.Request.Method != http.MethodHead {
+			return e.ForbiddenError("The API token may only manage the users of the account.", nil)
+		}
+		return e.Next()
+	}
+}
+
+// SetAuditActor attributes the changes of the request to the API token or logged in user in the audit log
+func SetAuditActor() func(*core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		actor := natsauth.AuthActor(e.Auth, e.RealIP())
+		if token := getAPIToken(e); token != nil {
+			actor = application.Actor{
+				Type: application.ActorAPIToken,
+				ID:   token.ID,
+				Name: token.Name,
+				IP:   e.RealIP(),
+			}
+		}
+		e.Request = e.Request.WithContext(application.WithActor(e.Request.Context(), actor))
+		return e.Next()
+	}
+}
+
+// RequireAPIRole restricts requests of logged in users to their roles. Reading seeds and creds
+// with include_secrets=true needs the same role as changing the installation or account.
+func RequireAPIRole() func(*core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		if e.Auth == nil {
+			// API tokens are restricted by their scope
+			return e.Next()
+		}
+		access, err := store.GetAccess(e.App, e.Auth)
+		if err != nil {
+			return e.InternalServerError("Failed to load roles", err)
+		}
+		e.Set(apiAccessKey, access)
+
+		write := (e.Request.Method != http.MethodGet && e.Request.Method != http.MethodHead) || includeSecrets(e)
+		installationID := e.Request.PathValue("installation_id")
+		account := e.Request.PathValue("account")
+
+		allowed := false
+		switch {
+		case installationID == "":
+			// installation list and shared limits
+			allowed = !write || access.Global(true)
+		case account == "":
+			// installation and account list, accounts are filtered by the handler
+			allowed = access.InstallationVisible(installationID) && (!write || access.Installation(installationID, true))
+		case e.Request.PathValue("user") == "" && e.Request.Method != http.MethodGet && e.Request.Method != http.MethodHead:
+			// the account itself and its limits belong to the installation
+			allowed = access.Installation(installationID, true)
+		default:
+			record, err := findAccountRecord(e, installationID, account)
+			if err != nil {
+				// unknown accounts are only reported to those who may create them
+				allowed = access.Installation(installationID, false)
+				break
+			}
+			allowed = access.Account(installationID, record.Id, write)
+		}
+		if !allowed {
+			return e.ForbiddenError("You are not allowed to access this resource.", nil)
+		}
+		return e.Next()
+	}
+}
+
+// getAccess returns the roles of the logged in user, nil for requests with an API token
+func getAccess(e *core.RequestEvent) *application.Access {
+	access, _ := e.Get(apiAccessKey).(*application.Access)
+	return access
+}
+
+// getAPIToken returns the API token of the request, nil if it was authenticated otherwise
+func getAPIToken(e *core.RequestEvent) *application.APIToken {
+	token, _ := e.Get(apiTokenKey).(*application.APIToken)
+	return token
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+func Test_RequireAPITokenScope(t *testing.T) {
+	full := &application.APIToken{}
+	readOnly := &application.APIToken{ReadOnly: true}
+	installation := &application.APIToken{InstallationID: "i1"}
+	account := &application.APIToken{InstallationID: "i1", AccountID: "a1", AccountName: "tenant-a"}
+
+	tests := []struct {
+		name         string
+		token        *application.APIToken
+		method       string
+		query        string
+		installation string
+		account      string
+		user         string
+		allowed      bool
+	}{
+		{"full token creates installations", full, http.MethodPost, "", "", "", "", true},
+		{"full token reads secrets", full, http.MethodGet, "?include_secrets=true", "i1", "", "", true},
+		{"read-only token reads", readOnly, http.MethodGet, "", "i1", "tenant-a", "", true},
+		{"read-only token can not change", readOnly, http.MethodPut, "", "i1", "tenant-a", "u1", false},
+		{"read-only token can not read operator secrets", readOnly, http.MethodGet, "?include_secrets=true", "i1", "", "", false},
+		{"read-only token can not read creds", readOnly, http.MethodGet, "?include_secrets=true", "i1", "tenant-a", "u1", false},
+		{"installation token lists installations", installation, http.MethodGet, "", "", "", "", true},
+		{"installation token can not list secrets of all installations", installation, http.MethodGet, "?include_secrets=true", "", "", "", false},
+		{"installation token can not change limits", installation, http.MethodPut, "", "", "", "", false},
+		{"installation token reads its secrets", installation, http.MethodGet, "?include_secrets=true", "i1", "", "", true},
+		{"installation token can not read other installations", installation, http.MethodGet, "", "i2", "", "", false},
+		{"account token lists accounts", account, http.MethodGet, "", "i1", "", "", true},
+		{"account token can not read operator secrets", account, http.MethodGet, "?include_secrets=true", "i1", "", "", false},
+		{"account token reads its account secrets", account, http.MethodGet, "?include_secrets=true", "i1", "tenant-a", "", true},
+		{"account token can not change its account", account, http.MethodPut, "", "i1", "tenant-a", "", false},
+		{"account token manages users", account, http.MethodPut, "", "i1", "tenant-a", "u1", true},
+		{"account token reads creds of its users", account, http.MethodGet, "?include_secrets=true", "i1", "tenant-a", "u1", true},
+		{"account token can not read other accounts", account, http.MethodGet, "", "i1", "tenant-b", "", false},
+		{"no token is left to the roles", nil, http.MethodDelete, "", "i1", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &core.RequestEvent{}
+			e.Request = httptest.NewRequest(tt.method, apiPrefix+"/installations"+tt.query, nil)
+			e.Request.SetPathValue("installation_id", tt.installation)
+			e.Request.SetPathValue("account", tt.account)
+			e.Request.SetPathValue("user", tt.user)
+			if tt.token != nil {
+				e.Set(apiTokenKey, tt.token)
+			}
+
+			err := RequireAPITokenScope()(e)
+			if (err == nil) != tt.allowed {
+				t.Errorf("RequireAPITokenScope() error = %v, allowed %v", err, tt.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+// Installation is the API representation of an operator.
+// Seeds are only set if they were requested with include_secrets=true.
+type Installation struct {
+	ID               string `json:"id"`
+	URL              string `json:"url"`
+	Description      string `json:"description"`
+	PublicKey        string `json:"public_key"`
+	SigningPublicKey string `json:"signing_public_key"`
+	JWT              string `json:"jwt"`
+	// further URLs of the servers besides URL
+	SeedURLs []string `json:"seed_urls"`
+
+	Seed        string `json:"seed,omitempty"`
+	SigningSeed string `json:"signing_seed,omitempty"`
+}
+
+func newInstallation(operator *application.OperatorAuth, includeSecrets bool) Installation {
+	res := Installation{
+		ID:               operator.ID,
+		URL:              operator.URL,
+		Description:      operator.Description,
+		PublicKey:        operator.PublicKey,
+		SigningPublicKey: operator.SigningPublicKey,
+		JWT:              operator.JWT,
+		SeedURLs:         nonNil(operator.Connection.SeedURLs),
+	}
+	if includeSecrets {
+		res.Seed = operator.Seed
+		res.SigningSeed = operator.SigningSeed
+	}
+	return res
+}
+
+type Account struct {
+	ID               string `json:"id"`
+	InstallationID   string `json:"installation_id"`
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	PublicKey        string `json:"public_key"`
+	SigningPublicKey string `json:"signing_public_key"`
+	JWT              string `json:"jwt"`
+	ReadOnly         bool   `json:"read_only"`
+	// ID of the assigned limits, empty if the default limits apply
+	LimitsID string `json:"limits_id"`
+
+	Seed        string `json:"seed,omitempty"`
+	SigningSeed string `json:"signing_seed,omitempty"`
+}
+
+func newAccount(account *application.AccountAuth, installationID, limitsID string, includeSecrets bool) Account {
+	res := Account{
+		ID:               account.ID,
+		InstallationID:   installationID,
+		Name:             account.Name,
+		Description:      account.Description,
+		PublicKey:        account.PublicKey,
+		SigningPublicKey: account.SigningPublicKey,
+		JWT:              account.JWT,
+		ReadOnly:         account.ReadOnly,
+		LimitsID:         limitsID,
+	}
+	if includeSecrets {
+		res.Seed = account.Seed
+		res.SigningSeed = account.SigningSeed
+	}
+	return res
+}
+
+// UpsertAccountRequest is used when the account is created, existing accounts keep their description
+type UpsertAccountRequest struct {
+	Description string `json:"description"`
+	// Name or ID of the limits to assign, nil keeps the current limits and "" applies the default limits
+	Limits *string `json:"limits"`
+}
+
+type User struct {
+	ID          string `json:"id"`
+	AccountID   string `json:"account_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	PublicKey   string `json:"public_key"`
+	JWT         string `json:"jwt"`
+	BearerToken bool   `json:"bearer_token"`
+	// Lifetime of the JWT, empty if it does not expire
+	TTL     string     `json:"ttl"`
+	Expires *time.Time `json:"expires"`
+	// ID of the account signing key the user is signed with, empty for the account signing key
+	SigningKeyID string `json:"signing_key_id"`
+
+	Seed  string `json:"seed,omitempty"`
+	Creds string `json:"creds,omitempty"`
+}
+
+func newUser(user *application.UserAuth, accountID string, includeSecrets bool) User {
+	res := User{
+		ID:           user.ID,
+		AccountID:    accountID,
+		Name:         user.Name,
+		Description:  user.Description,
+		PublicKey:    user.PublicKey,
+		JWT:          user.JWT,
+		BearerToken:  user.BearerToken,
+		SigningKeyID: user.SigningKeyID,
+	}
+	if user.TTL > 0 {
+		res.TTL = user.TTL.String()
+	}
+	if !user.Expires.IsZero() {
+		res.Expires = &user.Expires
+	}
+	if includeSecrets {
+		res.Seed = user.Seed
+		res.Creds = user.Creds
+	}
+	return res
+}
+
+// UpsertUserRequest is used when the user is created, existing users are returned unchanged
+type UpsertUserRequest struct {
+	Description string `json:"description"`
+	BearerToken bool   `json:"bearer_token"`
+	// Lifetime of the JWT like 720h, empty if it does not expire
+	TTL string `json:"ttl"`
+}
+
+type Permissions struct {
+	PubAllow       []string `json:"pub_allow"`
+	PubDeny        []string `json:"pub_deny"`
+	SubAllow       []string `json:"sub_allow"`
+	SubDeny        []string `json:"sub_deny"`
+	AllowResponses bool     `json:"allow_responses"`
+	ResponsesMax   int      `json:"responses_max"`
+	// Duration like 5s, empty for no limit
+	ResponsesTTL string `json:"responses_ttl"`
+}
+
+func newPermissions(permissions *application.UserPermissions) Permissions {
+	res := Permissions{
+		PubAllow:       nonNil(permissions.PubAllow),
+		PubDeny:        nonNil(permissions.PubDeny),
+		SubAllow:       nonNil(permissions.SubAllow),
+		SubDeny:        nonNil(permissions.SubDeny),
+		AllowResponses: permissions.AllowResponses,
+		ResponsesMax:   permissions.ResponsesMax,
+	}
+	if permissions.ResponsesTTL > 0 {
+		res.ResponsesTTL = permissions.ResponsesTTL.String()
+	}
+	return res
+}
+
+func (p Permissions) toApplication() (application.UserPermissions, error) {
+	res := application.UserPermissions{
+		PubAllow:       p.PubAllow,
+		PubDeny:        p.PubDeny,
+		SubAllow:       p.SubAllow,
+		SubDeny:        p.SubDeny,
+		AllowResponses: p.AllowResponses,
+		ResponsesMax:   p.ResponsesMax,
+	}
+	for _, subjects := range [][]string{res.PubAllow, res.PubDeny, res.SubAllow, res.SubDeny} {
+		for _, subject := range subjects {
+			if subject == "" || strings.ContainsAny(subject, " \t\n") {
+				return res, fmt.Errorf("subject '%s' must not be empty or contain whitespace", subject)
+			}
+		}
+	}
+	if p.ResponsesTTL != "" {
+		ttl, err := time.ParseDuration(p.ResponsesTTL)
+		if err != nil {
+			return res, fmt.Errorf("responses_ttl '%s' must look like 5s", p.ResponsesTTL)
+		}
+		res.ResponsesTTL = ttl
+	}
+	return res, nil
+}
+
+// UserLimits restrict a single user. -1 means unlimited.
+type UserLimits struct {
+	MaxSubscriptions int64                       `json:"max_subscriptions"`
+	MaxData          int64                       `json:"max_data"`
+	MaxPayload       int64                       `json:"max_payload"`
+	ConnectionTypes  []string                    `json:"connection_types"`
+	Src              []string                    `json:"src"`
+	Times            []application.UserTimeRange `json:"times"`
+	Locale           string                      `json:"locale"`
+}
+
+func newUserLimits(limits *application.UserLimits) UserLimits {
+	res := UserLimits{
+		MaxSubscriptions: limits.MaxSubscriptions,
+		MaxData:          limits.MaxData,
+		MaxPayload:       limits.MaxPayload,
+		ConnectionTypes:  nonNil(limits.ConnectionTypes),
+		Src:              nonNil(limits.Src),
+		Times:            limits.Times,
+		Locale:           limits.Locale,
+	}
+	if res.Times == nil {
+		res.Times = []application.UserTimeRange{}
+	}
+	return res
+}
+
+func (l UserLimits) toApplication() application.UserLimits {
+	return application.UserLimits{
+		MaxSubscriptions: l.MaxSubscriptions,
+		MaxData:          l.MaxData,
+		MaxPayload:       l.MaxPayload,
+		ConnectionTypes:  l.ConnectionTypes,
+		Src:              l.Src,
+		Times:            l.Times,
+		Locale:           l.Locale,
+	}
+}
+
+// Limits is a named set of account limits. -1 means unlimited.
+type Limits struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Default bool   `json:"default"`
+
+	MaxConnections          int64 `json:"max_connections"`
+	MaxLeafNodeConnections  int64 `json:"max_leafnode_connections"`
+	MaxSubscriptions        int64 `json:"max_subscriptions"`
+	MaxData                 int64 `json:"max_data"`
+	MaxPayload              int64 `json:"max_payload"`
+	MaxImports              int64 `json:"max_imports"`
+	MaxExports              int64 `json:"max_exports"`
+	DisallowWildcardExports bool  `json:"disallow_wildcard_exports"`
+	DisallowBearer          bool  `json:"disallow_bearer"`
+
+	JetStreamMaxMemory            int64 `json:"jetstream_max_memory"`
+	JetStreamMaxDisk              int64 `json:"jetstream_max_disk"`
+	JetStreamMaxStreams           int64 `json:"jetstream_max_streams"`
+	JetStreamMaxConsumers         int64 `json:"jetstream_max_consumers"`
+	JetStreamMaxAckPending        int64 `json:"jetstream_max_ack_pending"`
+	JetStreamMemoryMaxStreamBytes int64 `json:"jetstream_memory_max_stream_bytes"`
+	JetStreamDiskMaxStreamBytes   int64 `json:"jetstream_disk_max_stream_bytes"`
+	JetStreamMaxBytesRequired     bool  `json:"jetstream_max_bytes_required"`
+
+	JetStreamTiers map[string]application.JetStreamTierLimits `json:"jetstream_tiers"`
+}
+
+func newLimits(limits *application.Limits) Limits {
+	res := Limits{
+		ID:                            limits.ID,
+		Name:                          limits.Name,
+		Default:                       limits.Default,
+		MaxConnections:                limits.MaxConnections,
+		MaxLeafNodeConnections:        limits.MaxLeafNodeConnections,
+		MaxSubscriptions:              limits.MaxSubscriptions,
+		MaxData:                       limits.MaxData,
+		MaxPayload:                    limits.MaxPayload,
+		MaxImports:                    limits.MaxImports,
+		MaxExports:                    limits.MaxExports,
+		DisallowWildcardExports:       limits.DisallowWildcardExports,
+		DisallowBearer:                limits.DisallowBearer,
+		JetStreamMaxMemory:            limits.JetStreamMaxMemory,
+		JetStreamMaxDisk:              limits.JetStreamMaxDisk,
+		JetStreamMaxStreams:           limits.JetStreamMaxStreams,
+		JetStreamMaxConsumers:         limits.JetStreamMaxConsumers,
+		JetStreamMaxAckPending:        limits.JetStreamMaxAckPending,
+		JetStreamMemoryMaxStreamBytes: limits.JetStreamMemoryMaxStreamBytes,
+		JetStreamDiskMaxStreamBytes:   limits.JetStreamDiskMaxStreamBytes,
+		JetStreamMaxBytesRequired:     limits.JetStreamMaxBytesRequired,
+		JetStreamTiers:                limits.JetStreamTiers,
+	}
+	if res.JetStreamTiers == nil {
+		res.JetStreamTiers = map[string]application.JetStreamTierLimits{}
+	}
+	return res
+}
+
+func (l Limits) toApplication() application.Limits {
+	return application.Limits{
+		ID:                            l.ID,
+		Name:                          l.Name,
+		Default:                       l.Default,
+		MaxConnections:                l.MaxConnections,
+		MaxLeafNodeConnections:        l.MaxLeafNodeConnections,
+		MaxSubscriptions:              l.MaxSubscriptions,
+		MaxData:                       l.MaxData,
+		MaxPayload:                    l.MaxPayload,
+		MaxImports:                    l.MaxImports,
+		MaxExports:                    l.MaxExports,
+		DisallowWildcardExports:       l.DisallowWildcardExports,
+		DisallowBearer:                l.DisallowBearer,
+		JetStreamMaxMemory:            l.JetStreamMaxMemory,
+		JetStreamMaxDisk:              l.JetStreamMaxDisk,
+		JetStreamMaxStreams:           l.JetStreamMaxStreams,
+		JetStreamMaxConsumers:         l.JetStreamMaxConsumers,
+		JetStreamMaxAckPending:        l.JetStreamMaxAckPending,
+		JetStreamMemoryMaxStreamBytes: l.JetStreamMemoryMaxStreamBytes,
+		JetStreamDiskMaxStreamBytes:   l.JetStreamDiskMaxStreamBytes,
+		JetStreamMaxBytesRequired:     l.JetStreamMaxBytesRequired,
+		JetStreamTiers:                l.JetStreamTiers,
+	}
+}
+
+// SetAccountLimitsRequest assigns limits to an account
+type SetAccountLimitsRequest struct {
+	// Name or ID of the limits, "" applies the default limits
+	Limits string `json:"limits"`
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+)
+
+func GetInstallations(e *core.RequestEvent) error {
+	records, err := e.App.FindRecordsByFilter("nats_auth_operators", "", "url", 0, 0)
+	if err != nil {
+		return apiError(e, "Failed to get installations", err)
+	}
+
+	res := []Installation{}
+	for _, record := range records {
+		if token := getAPIToken(e); token != nil && token.InstallationID != "" && token.InstallationID != record.Id {
+			continue
+		}
+		if access := getAccess(e); access != nil && !access.InstallationVisible(record.Id) {
+			continue
+		}
+		operator, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+		if err != nil {
+			return apiError(e, "Failed to get installation", err)
+		}
+		res = append(res, newInstallation(operator, includeOperatorSecrets(e, operator.ID)))
+	}
+	return e.JSON(http.StatusOK, res)
+}
+
+func GetInstallation(e *core.RequestEvent, installationID string) error {
+	record, err := findInstallationRecord(e, installationID)
+	if err != nil {
+		return apiError(e, "Installation not found", err)
+	}
+
+	operator, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return apiError(e, "Failed to get installation", err)
+	}
+	return e.JSON(http.StatusOK, newInstallation(operator, includeOperatorSecrets(e, operator.ID)))
+}
+
+// includeOperatorSecrets reports whether the operator seeds of the installation were requested
+// and may be read, which needs the same scope or role as changing the installation
+func includeOperatorSecrets(e *core.RequestEvent, installationID string) bool {
+	if !includeSecrets(e) {
+		return false
+	}
+	if token := getAPIToken(e); token != nil {
+		return !token.ReadOnly && token.AccountID == "" &&
+			(token.InstallationID == "" || token.InstallationID == installationID)
+	}
+	if access := getAccess(e); access != nil {
+		return access.Installation(installationID, true)
+	}
+	return false
+}
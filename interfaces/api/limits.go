@@ -0,0 +1,91 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+)
+
+// findLimitsRecord finds limits by name, falling back to the ID
+func findLimitsRecord(e *core.RequestEvent, nameOrID string) (*core.Record, error) {
+	record, err := e.App.FindFirstRecordByFilter("nats_auth_limits",
+		"name = {:name}",
+		dbx.Params{"name": nameOrID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return e.App.FindRecordById("nats_auth_limits", nameOrID)
+	}
+	return record, err
+}
+
+func GetLimits(e *core.RequestEvent) error {
+	limits, err := utils.MustGetNATSAuth(e).GetLimits(e.Request.Context())
+	if err != nil {
+		return apiError(e, "Failed to get limits", err)
+	}
+
+	res := []Limits{}
+	for _, l := range limits {
+		res = append(res, newLimits(l))
+	}
+	return e.JSON(http.StatusOK, res)
+}
+
+func GetLimit(e *core.RequestEvent, name string) error {
+	record, err := findLimitsRecord(e, name)
+	if err != nil {
+		return apiError(e, "Limits not found", err)
+	}
+
+	limits, err := utils.MustGetNATSAuth(e).GetLimitsByID(e.Request.Context(), record.Id)
+	if err != nil {
+		return apiError(e, "Failed to get limits", err)
+	}
+	return e.JSON(http.StatusOK, newLimits(limits))
+}
+
+// PutLimit creates or updates the limits with the name.
+// It responds with 201 if the limits were created and 200 if they were updated.
+func PutLimit(e *core.RequestEvent, name string) error {
+	var req Limits
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+
+	limits := req.toApplication()
+	limits.Name = name
+	limits.ID = ""
+
+	status := http.StatusCreated
+	record, err := e.App.FindFirstRecordByFilter("nats_auth_limits",
+		"name = {:name}",
+		dbx.Params{"name": name})
+	if err == nil {
+		limits.ID = record.Id
+		status = http.StatusOK
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return apiError(e, "Failed to find limits", err)
+	}
+
+	res, err := utils.MustGetNATSAuth(e).UpsertLimits(e.Request.Context(), limits)
+	if err != nil {
+		return e.BadRequestError(err.Error(), err)
+	}
+	return e.JSON(status, newLimits(res))
+}
+
+func DeleteLimit(e *core.RequestEvent, name string) error {
+	record, err := findLimitsRecord(e, name)
+	if err != nil {
+		return apiError(e, "Limits not found", err)
+	}
+
+	if err := utils.MustGetNATSAuth(e).DeleteLimits(e.Request.Context(), record.Id); err != nil {
+		return apiError(e, "Failed to delete limits", err)
+	}
+	return e.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/natsauth"
+)
+
+// RegisterAPIRoutes registers the versioned JSON API under /api/v1.
+// Requests are authenticated with a PocketBase auth token in the Authorization header
+// or with an API token in the X-Token header.
+func RegisterAPIRoutes(ctx context.Context,
+	logger *slog.Logger,
+	e *core.ServeEvent) error {
+
+	e.Router.BindFunc(LoadAPIToken())
+
+	v1 := e.Router.Group(apiPrefix)
+	v1.BindFunc(
+		RequireAPIAuth("_superusers", "users"),
+		RequireAPITokenScope(),
+		RequireAPIRole(),
+		SetAuditActor(),
+	)
+
+	// Installations
+	v1.GET("/installations", GetInstallations)
+	v1.GET("/installations/{installation_id}", func(e *core.RequestEvent) error {
+		return GetInstallation(e, e.Request.PathValue("installation_id"))
+	})
+
+	// Accounts
+	v1.GET("/installations/{installation_id}/accounts", func(e *core.RequestEvent) error {
+		return GetAccounts(e, e.Request.PathValue("installation_id"))
+	})
+	v1.GET("/installations/{installation_id}/accounts/{account}", func(e *core.RequestEvent) error {
+		return GetAccount(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account"))
+	})
+	v1.PUT("/installations/{installation_id}/accounts/{account}", func(e *core.RequestEvent) error {
+		return PutAccount(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account"))
+	})
+	v1.DELETE("/installations/{installation_id}/accounts/{account}", func(e *core.RequestEvent) error {
+		return DeleteAccount(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account"))
+	})
+	v1.GET("/installations/{installation_id}/accounts/{account}/limits", func(e *core.RequestEvent) error {
+		return GetAccountLimits(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account"))
+	})
+	v1.PUT("/installations/{installation_id}/accounts/{account}/limits", func(e *core.RequestEvent) error {
+		return PutAccountLimits(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account"))
+	})
+
+	// Users
+	v1.GET("/installations/{installation_id}/accounts/{account}/users", func(e *core.RequestEvent) error {
+		return GetUsers(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account"))
+	})
+	v1.GET("/installations/{installation_id}/accounts/{account}/users/{user}", func(e *core.RequestEvent) error {
+		return GetUser(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account"), e.Request.PathValue("user"))
+	})
+	v1.PUT("/installations/{installation_id}/accounts/{account}/users/{user}", func(e *core.RequestEvent) error {
+		return PutUser(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account"), e.Request.PathValue("user"))
+	})
+	v1.DELETE("/installations/{installation_id}/accounts/{account}/users/{user}", func(e *core.RequestEvent) error {
+		return DeleteUser(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account"), e.Request.PathValue("user"))
+	})
+	v1.GET("/installations/{installation_id}/accounts/{account}/users/{user}/permissions", func(e *core.RequestEvent) error {
+		return GetUserPermissions(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account"), e.Request.PathValue("user"))
+	})
+	v1.PUT("/installations/{installation_id}/accounts/{account}/users/{user}/permissions", func(e *core.RequestEvent) error {
+		return PutUserPermissions(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account"), e.Request.PathValue("user"))
+	})
+	v1.GET("/installations/{installation_id}/accounts/{account}/users/{user}/limits", func(e *core.RequestEvent) error {
+		return GetUserLimits(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account"), e.Request.PathValue("user"))
+	})
+	v1.PUT("/installations/{installation_id}/accounts/{account}/users/{user}/limits", func(e *core.RequestEvent) error {
+		return PutUserLimits(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account"), e.Request.PathValue("user"))
+	})
+
+	// Limits
+	v1.GET("/limits", GetLimits)
+	v1.GET("/limits/{name}", func(e *core.RequestEvent) error {
+		return GetLimit(e, e.Request.PathValue("name"))
+	})
+	v1.PUT("/limits/{name}", func(e *core.RequestEvent) error {
+		return PutLimit(e, e.Request.PathValue("name"))
+	})
+	v1.DELETE("/limits/{name}", func(e *core.RequestEvent) error {
+		return DeleteLimit(e, e.Request.PathValue("name"))
+	})
+
+	logger.InfoContext(ctx, "Registered API routes", slog.String("prefix", apiPrefix))
+
+	return nil
+}
+
+// includeSecrets reports whether seeds and creds were requested with include_secrets=true
+func includeSecrets(e *core.RequestEvent) bool {
+	return e.Request.URL.Query().Get("include_secrets") == "true"
+}
+
+// apiError maps errors of the natsauth module to API errors
+func apiError(e *core.RequestEvent, message string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, natsauth.ErrNotFound) {
+		return e.NotFoundError(message, err)
+	}
+	e.App.Logger().Error(message, slog.String("error", err.Error()))
+	return e.InternalServerError(message, err)
+}
+
+func findInstallationRecord(e *core.RequestEvent, installationID string) (*core.Record, error) {
+	return e.App.FindRecordById("nats_auth_operators", installationID)
+}
+
+func findAccountRecord(e *core.RequestEvent, installationID, account string) (*core.Record, error) {
+	return e.App.FindFirstRecordByFilter("nats_auth_accounts",
+		"operator = {:operator} && name = {:name}",
+		dbx.Params{"operator": installationID, "name": account})
+}
+
+func findUserRecord(e *core.RequestEvent, installationID, account, user string) (*core.Record, error) {
+	accountRecord, err := findAccountRecord(e, installationID, account)
+	if err != nil {
+		return nil, err
+	}
+	return e.App.FindFirstRecordByFilter("nats_auth_users",
+		"account = {:account} && name = {:name}",
+		dbx.Params{"account": accountRecord.Id, "name": user})
+}
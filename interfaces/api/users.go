@@ -0,0 +1,215 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+	"github.com/nats-tower/nats-tower/natsauth"
+)
+
+func userFromRecord(e *core.RequestEvent, record *core.Record) (User, error) {
+	user, err := utils.MustGetNATSAuth(e).GetUserFromRecord(record, "")
+	if err != nil {
+		return User{}, err
+	}
+	return newUser(user, record.GetString("account"), includeSecrets(e)), nil
+}
+
+func GetUsers(e *core.RequestEvent, installationID, account string) error {
+	accountRecord, err := findAccountRecord(e, installationID, account)
+	if err != nil {
+		return apiError(e, "Account not found", err)
+	}
+
+	records, err := e.App.FindRecordsByFilter("nats_auth_users",
+		"account = {:account}", "name", 0, 0,
+		dbx.Params{"account": accountRecord.Id})
+	if err != nil {
+		return apiError(e, "Failed to get users", err)
+	}
+
+	res := []User{}
+	for _, record := range records {
+		user, err := userFromRecord(e, record)
+		if err != nil {
+			return apiError(e, "Failed to get user", err)
+		}
+		res = append(res, user)
+	}
+	return e.JSON(http.StatusOK, res)
+}
+
+func GetUser(e *core.RequestEvent, installationID, account, name string) error {
+	record, err := findUserRecord(e, installationID, account, name)
+	if err != nil {
+		return apiError(e, "User not found", err)
+	}
+
+	user, err := userFromRecord(e, record)
+	if err != nil {
+		return apiError(e, "Failed to get user", err)
+	}
+	return e.JSON(http.StatusOK, user)
+}
+
+// PutUser creates the user if it does not exist yet. Existing users are returned unchanged.
+// It responds with 201 if the user was created and 200 if it already existed.
+func PutUser(e *core.RequestEvent, installationID, account, name string) error {
+	var req UpsertUserRequest
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl < 0 {
+			return e.BadRequestError("ttl '"+req.TTL+"' must look like 720h", err)
+		}
+	}
+
+	installationRecord, err := findInstallationRecord(e, installationID)
+	if err != nil {
+		return apiError(e, "Installation not found", err)
+	}
+	accountRecord, err := findAccountRecord(e, installationID, account)
+	if err != nil {
+		return apiError(e, "Account not found", err)
+	}
+	if accountRecord.GetBool("read_only") {
+		return e.BadRequestError("Account "+account+" is read-only", nil)
+	}
+
+	status := http.StatusOK
+	if _, err := findUserRecord(e, installationID, account, name); errors.Is(err, sql.ErrNoRows) {
+		status = http.StatusCreated
+	} else if err != nil {
+		return apiError(e, "Failed to find user", err)
+	}
+
+	user, err := utils.MustGetNATSAuth(e).UpsertUserAuth(e.Request.Context(),
+		installationRecord.GetString("url"),
+		account,
+		name,
+		req.Description,
+		application.UserOptions{
+			BearerToken: req.BearerToken,
+			TTL:         ttl,
+		})
+	if err != nil {
+		return apiError(e, "Failed to upsert user", err)
+	}
+
+	record, err := e.App.FindRecordById("nats_auth_users", user.ID)
+	if err != nil {
+		return apiError(e, "User not found", err)
+	}
+
+	res, err := userFromRecord(e, record)
+	if err != nil {
+		return apiError(e, "Failed to get user", err)
+	}
+	return e.JSON(status, res)
+}
+
+func DeleteUser(e *core.RequestEvent, installationID, account, name string) error {
+	installationRecord, err := findInstallationRecord(e, installationID)
+	if err != nil {
+		return apiError(e, "Installation not found", err)
+	}
+	if _, err := findUserRecord(e, installationID, account, name); err != nil {
+		return apiError(e, "User not found", err)
+	}
+
+	err = utils.MustGetNATSAuth(e).DeleteUserAuth(e.Request.Context(),
+		installationRecord.GetString("url"),
+		account,
+		name)
+	if err != nil {
+		return apiError(e, "Failed to delete user", err)
+	}
+	return e.NoContent(http.StatusNoContent)
+}
+
+func GetUserPermissions(e *core.RequestEvent, installationID, account, name string) error {
+	record, err := findUserRecord(e, installationID, account, name)
+	if err != nil {
+		return apiError(e, "User not found", err)
+	}
+
+	permissions, err := utils.MustGetNATSAuth(e).GetUserPermissions(e.Request.Context(), record.Id)
+	if errors.Is(err, natsauth.ErrNotFound) {
+		// users without a permission record may publish and subscribe to everything
+		permissions = &application.UserPermissions{UserID: record.Id}
+	} else if err != nil {
+		return apiError(e, "Failed to get user permissions", err)
+	}
+	return e.JSON(http.StatusOK, newPermissions(permissions))
+}
+
+func PutUserPermissions(e *core.RequestEvent, installationID, account, name string) error {
+	var req Permissions
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+	permissions, err := req.toApplication()
+	if err != nil {
+		return e.BadRequestError(err.Error(), err)
+	}
+
+	record, err := findUserRecord(e, installationID, account, name)
+	if err != nil {
+		return apiError(e, "User not found", err)
+	}
+
+	res, err := utils.MustGetNATSAuth(e).UpsertUserPermissions(e.Request.Context(), record.Id, permissions)
+	if err != nil {
+		return apiError(e, "Failed to update user permissions", err)
+	}
+	return e.JSON(http.StatusOK, newPermissions(res))
+}
+
+func GetUserLimits(e *core.RequestEvent, installationID, account, name string) error {
+	record, err := findUserRecord(e, installationID, account, name)
+	if err != nil {
+		return apiError(e, "User not found", err)
+	}
+
+	limits, err := utils.MustGetNATSAuth(e).GetUserLimits(e.Request.Context(), record.Id)
+	if errors.Is(err, natsauth.ErrNotFound) {
+		limits = natsauth.UnlimitedUserLimits()
+	} else if err != nil {
+		return apiError(e, "Failed to get user limits", err)
+	}
+	return e.JSON(http.StatusOK, newUserLimits(limits))
+}
+
+func PutUserLimits(e *core.RequestEvent, installationID, account, name string) error {
+	var req UserLimits
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+	limits := req.toApplication()
+	if err := natsauth.ValidateUserLimits(limits); err != nil {
+		return e.BadRequestError(err.Error(), err)
+	}
+
+	record, err := findUserRecord(e, installationID, account, name)
+	if err != nil {
+		return apiError(e, "User not found", err)
+	}
+
+	res, err := utils.MustGetNATSAuth(e).UpsertUserLimits(e.Request.Context(), record.Id, limits)
+	if err != nil {
+		return apiError(e, "Failed to update user limits", err)
+	}
+	return e.JSON(http.StatusOK, newUserLimits(res))
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	_ "github.com/pocketbase/pocketbase/migrations"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/natsauth"
+)
+
+const testInstallationURL = "nats://127.0.0.1:4998"
+
+func newTestModule(t *testing.T) (core.App, *natsauth.NATSAuthModule) {
+	app := core.NewBaseApp(core.BaseAppConfig{DataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap app: %v", err)
+	}
+
+	// the app is not reset, the background jobs of the module may still be running a query after the cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	natsModule, err := natsauth.CreateNATSAuthModule(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		natsauth.NATSAuthModuleConfig{
+			App:                    app,
+			BootstrapURLs:          []string{testInstallationURL},
+			DisableNATSCLIContexts: true,
+		})
+	if err != nil {
+		t.Fatalf("Failed to create NatsModule: %v", err)
+	}
+	return app, natsModule
+}
+
+// serveTestRequest calls the handler with a JSON body and decodes the JSON response into res
+func serveTestRequest(t *testing.T, app core.App, natsModule *natsauth.NATSAuthModule,
+	method, path, body string, handle func(e *core.RequestEvent) error, res any) int {
+	e := &core.RequestEvent{App: app}
+	e.Request = httptest.NewRequest(method, path, strings.NewReader(body))
+	e.Request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	e.Response = recorder
+	e.Set("natsauth", natsModule)
+	// a full API token, its scope is checked by the middlewares
+	e.Set(apiTokenKey, &application.APIToken{})
+
+	if err := handle(e); err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	if res != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), res); err != nil {
+			t.Fatalf("Failed to decode the response of %s %s: %v", method, path, err)
+		}
+	}
+	return recorder.Code
+}
+
+func Test_UpsertAccountsAndUsers(t *testing.T) {
+	app, natsModule := newTestModule(t)
+	operator, err := natsModule.GetOperator(context.Background(), testInstallationURL)
+	if err != nil {
+		t.Fatalf("Failed to GetOperator: %v", err)
+	}
+
+	putAccount := func(e *core.RequestEvent) error { return PutAccount(e, operator.ID, "tenant-a") }
+	var created, existing Account
+	if status := serveTestRequest(t, app, natsModule, http.MethodPut, "/", `{"description":"Tenant A"}`, putAccount, &created); status != http.StatusCreated {
+		t.Errorf("Creating the account responded with %d", status)
+	}
+	if status := serveTestRequest(t, app, natsModule, http.MethodPut, "/", `{"description":"Tenant A"}`, putAccount, &existing); status != http.StatusOK {
+		t.Errorf("Upserting the existing account responded with %d", status)
+	}
+	if existing.ID != created.ID || existing.PublicKey != created.PublicKey || existing.Seed != "" {
+		t.Errorf("Upsert returned the account %+v, want %+v", existing, created)
+	}
+
+	putUser := func(e *core.RequestEvent) error { return PutUser(e, operator.ID, "tenant-a", "ci") }
+	var user, existingUser User
+	if status := serveTestRequest(t, app, natsModule, http.MethodPut, "/", `{"ttl":"720h"}`, putUser, &user); status != http.StatusCreated {
+		t.Errorf("Creating the user responded with %d", status)
+	}
+	if user.AccountID != created.ID || user.TTL != "720h0m0s" || user.Expires == nil {
+		t.Errorf("Created user is %+v", user)
+	}
+	// existing users are returned unchanged
+	if status := serveTestRequest(t, app, natsModule, http.MethodPut, "/", `{}`, putUser, &existingUser); status != http.StatusOK {
+		t.Errorf("Upserting the existing user responded with %d", status)
+	}
+	if existingUser.ID != user.ID || existingUser.JWT != user.JWT {
+		t.Errorf("Upsert changed the user to %+v", existingUser)
+	}
+
+	// seeds and creds are only returned on request
+	getUser := func(e *core.RequestEvent) error { return GetUser(e, operator.ID, "tenant-a", "ci") }
+	var withoutSecrets, withSecrets User
+	serveTestRequest(t, app, natsModule, http.MethodGet, "/", "", getUser, &withoutSecrets)
+	if withoutSecrets.Seed != "" || withoutSecrets.Creds != "" {
+		t.Errorf("User secrets were returned without include_secrets")
+	}
+	serveTestRequest(t, app, natsModule, http.MethodGet, "/?include_secrets=true", "", getUser, &withSecrets)
+	if !strings.HasPrefix(withSecrets.Seed, "SU") || !strings.Contains(withSecrets.Creds, withSecrets.JWT) {
+		t.Errorf("User secrets were not returned with include_secrets")
+	}
+	getInstallation := func(e *core.RequestEvent) error { return GetInstallation(e, operator.ID) }
+	var installation Installation
+	serveTestRequest(t, app, natsModule, http.MethodGet, "/", "", getInstallation, &installation)
+	if installation.Seed != "" || installation.SigningSeed != "" || installation.PublicKey != operator.PublicKey {
+		t.Errorf("Installation is %+v", installation)
+	}
+
+	// permissions round trip and re-sign the user
+	putPermissions := func(e *core.RequestEvent) error { return PutUserPermissions(e, operator.ID, "tenant-a", "ci") }
+	getPermissions := func(e *core.RequestEvent) error { return GetUserPermissions(e, operator.ID, "tenant-a", "ci") }
+	var permissions Permissions
+	serveTestRequest(t, app, natsModule, http.MethodGet, "/", "", getPermissions, &permissions)
+	if len(permissions.PubAllow) != 0 || permissions.PubAllow == nil {
+		t.Errorf("Permissions of a user without a permission record are %+v", permissions)
+	}
+	body := `{"pub_allow":["tenant-a.>"],"sub_allow":["tenant-a.>"],"allow_responses":true,"responses_ttl":"5s"}`
+	if status := serveTestRequest(t, app, natsModule, http.MethodPut, "/", body, putPermissions, nil); status != http.StatusOK {
+		t.Errorf("Updating the permissions responded with %d", status)
+	}
+	serveTestRequest(t, app, natsModule, http.MethodGet, "/", "", getPermissions, &permissions)
+	if len(permissions.PubAllow) != 1 || permissions.PubAllow[0] != "tenant-a.>" || permissions.ResponsesTTL != "5s" {
+		t.Errorf("Stored permissions are %+v", permissions)
+	}
+	var resigned User
+	serveTestRequest(t, app, natsModule, http.MethodGet, "/", "", getUser, &resigned)
+	if resigned.JWT == user.JWT {
+		t.Errorf("User was not re-signed with the permissions")
+	}
+}
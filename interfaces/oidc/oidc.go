@@ -0,0 +1,329 @@
+// Package oidc implements the single sign-on of the web UI with a generic OpenID Connect provider.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/auth"
+	"golang.org/x/oauth2"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+// SourceOIDC marks the role bindings derived from the groups of the identity provider
+const SourceOIDC = "oidc"
+
+type Config struct {
+	// Issuer is the URL of the provider, the endpoints are discovered from its openid-configuration
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL of the callback, derived from the request if empty
+	RedirectURL string
+	Scopes      []string
+	// GroupsClaim is the claim of the user info or ID token holding the groups
+	GroupsClaim string
+	// Name of the provider on the login page
+	Name         string
+	RoleMappings []RoleMapping
+	// DisablePasswordLogin only allows the single sign-on in the web UI
+	DisablePasswordLogin bool
+}
+
+// RoleMapping grants a role to the members of a group
+type RoleMapping struct {
+	Group string           `json:"group"`
+	Role  application.Role `json:"role"`
+	// ID, URL or description of the installation
+	Installation string `json:"installation,omitempty"`
+	// name of the account within the installation
+	Account string `json:"account,omitempty"`
+}
+
+// ParseRoleMappings parses the JSON list of role mappings
+func ParseRoleMappings(s string) ([]RoleMapping, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var mappings []RoleMapping
+	if err := json.Unmarshal([]byte(s), &mappings); err != nil {
+		return nil, err
+	}
+	for _, mapping := range mappings {
+		if mapping.Group == "" {
+			return nil, fmt.Errorf("role mapping without group")
+		}
+		if !slices.Contains(application.Roles, mapping.Role) {
+			return nil, fmt.Errorf("unknown role %s of group %s", mapping.Role, mapping.Group)
+		}
+		if mapping.Account != "" && mapping.Installation == "" {
+			return nil, fmt.Errorf("the account of group %s needs an installation", mapping.Group)
+		}
+		if mapping.Role == application.RoleInstallationAdmin && mapping.Installation == "" {
+			return nil, fmt.Errorf("the installation admins of group %s need an installation", mapping.Group)
+		}
+		if mapping.Role == application.RoleAccountOwner && mapping.Account == "" {
+			return nil, fmt.Errorf("the account owners of group %s need an account", mapping.Group)
+		}
+	}
+	return mappings, nil
+}
+
+// Identity is the user returned by the provider
+type Identity struct {
+	Subject string
+	Email   string
+	Groups  []string
+}
+
+type discovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	Issuer                string `json:"issuer"`
+}
+
+type Provider struct {
+	config Config
+
+	mu        sync.Mutex
+	discovery *discovery
+}
+
+func NewProvider(config Config) (*Provider, error) {
+	if config.Issuer == "" || config.ClientID == "" {
+		return nil, fmt.Errorf("the OIDC issuer and client ID are required")
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if config.Name == "" {
+		config.Name = "SSO"
+	}
+	return &Provider{config: config}, nil
+}
+
+// Name is shown on the login page
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// HasRoleMappings reports whether the roles of the users are managed by the provider
+func (p *Provider) HasRoleMappings() bool {
+	return len(p.config.RoleMappings) > 0
+}
+
+func (p *Provider) PasswordLoginDisabled() bool {
+	return p.config.DisablePasswordLogin
+}
+
+// getDiscovery fetches the openid-configuration of the issuer once
+func (p *Provider) getDiscovery(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to discover the OIDC provider: %s", res.Status)
+	}
+
+	var d discovery
+	if err := json.NewDecoder(res.Body).Decode(&d); err != nil {
+		return nil, err
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" {
+		return nil, fmt.Errorf("the OIDC provider has no authorization or token endpoint")
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+func (p *Provider) newAuthProvider(ctx context.Context, redirectURL string) (*auth.OIDC, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.config.RedirectURL != "" {
+		redirectURL = p.config.RedirectURL
+	}
+
+	provider := auth.NewOIDCProvider()
+	provider.SetContext(ctx)
+	provider.SetClientId(p.config.ClientID)
+	provider.SetClientSecret(p.config.ClientSecret)
+	provider.SetRedirectURL(redirectURL)
+	provider.SetScopes(p.config.Scopes)
+	provider.SetAuthURL(d.AuthorizationEndpoint)
+	provider.SetTokenURL(d.TokenEndpoint)
+	provider.SetUserInfoURL(d.UserinfoEndpoint)
+	extra := map[string]any{}
+	if d.JWKSURI != "" {
+		extra["jwksURL"] = d.JWKSURI
+	}
+	if d.Issuer != "" {
+		extra["issuers"] = []string{d.Issuer}
+	}
+	provider.SetExtra(extra)
+	return provider, nil
+}
+
+// AuthURL returns the URL of the provider to log in. The state and verifier have to be kept
+// until the callback.
+func (p *Provider) AuthURL(ctx context.Context, redirectURL, state, verifier string) (string, error) {
+	provider, err := p.newAuthProvider(ctx, redirectURL)
+	if err != nil {
+		return "", err
+	}
+	return provider.BuildAuthURL(state, oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange exchanges the code of the callback for the identity of the user
+func (p *Provider) Exchange(ctx context.Context, redirectURL, code, verifier string) (*Identity, error) {
+	provider, err := p.newAuthProvider(ctx, redirectURL)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := provider.FetchToken(code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+	user, err := provider.FetchAuthUser(token)
+	if err != nil {
+		return nil, err
+	}
+	if user.Email == "" {
+		return nil, fmt.Errorf("the identity provider did not return a verified email")
+	}
+
+	identity := &Identity{
+		Subject: user.Id,
+		Email:   user.Email,
+		Groups:  getGroups(user.RawUser[p.config.GroupsClaim]),
+	}
+	if _, ok := user.RawUser[p.config.GroupsClaim]; !ok {
+		// many providers only put the groups into the ID token
+		if idToken, ok := token.Extra("id_token").(string); ok && idToken != "" {
+			claims, err := p.verifyIDToken(ctx, provider, token)
+			if err != nil {
+				return nil, fmt.Errorf("could not verify the ID token: %w", err)
+			}
+			if claims["sub"] != user.Id {
+				return nil, fmt.Errorf("the ID token belongs to another user")
+			}
+			identity.Groups = getGroups(claims[p.config.GroupsClaim])
+		}
+	}
+	return identity, nil
+}
+
+// verifyIDToken returns the claims of the ID token of the token response.
+// The audience, the issuer and the signature against the JWKS of the provider are checked.
+func (p *Provider) verifyIDToken(ctx context.Context, provider *auth.OIDC, token *oauth2.Token) (map[string]any, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if d.JWKSURI == "" {
+		return nil, fmt.Errorf("the OIDC provider has no jwks_uri")
+	}
+
+	// without a user info URL the OIDC provider reads and verifies the ID token instead
+	verifier := *provider
+	verifier.SetUserInfoURL("")
+	data, err := verifier.FetchRawUserInfo(token)
+	if err != nil {
+		return nil, err
+	}
+	claims := map[string]any{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func getGroups(claim any) []string {
+	var groups []string
+	switch v := claim.(type) {
+	case []any:
+		for _, group := range v {
+			if s, ok := group.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	case string:
+		groups = strings.Fields(strings.ReplaceAll(v, ",", " "))
+	}
+	return groups
+}
+
+// Bindings returns the role bindings of the groups. Mappings of unknown installations or accounts are skipped.
+func (p *Provider) Bindings(app core.App, groups []string) ([]application.RoleBinding, error) {
+	var bindings []application.RoleBinding
+	for _, mapping := range p.config.RoleMappings {
+		if !slices.Contains(groups, mapping.Group) {
+			continue
+		}
+
+		binding := application.RoleBinding{Role: mapping.Role}
+		if mapping.Installation != "" {
+			installations, err := app.FindAllRecords("nats_auth_operators",
+				dbx.Or(
+					dbx.HashExp{"id": mapping.Installation},
+					dbx.HashExp{"url": mapping.Installation},
+					dbx.HashExp{"description": mapping.Installation},
+				))
+			if err != nil {
+				return nil, err
+			}
+			if len(installations) != 1 {
+				app.Logger().Warn("Skipping OIDC role mapping of unknown installation",
+					slog.String("group", mapping.Group),
+					slog.String("installation", mapping.Installation))
+				continue
+			}
+			binding.InstallationID = installations[0].Id
+		}
+		if mapping.Account != "" {
+			accounts, err := app.FindAllRecords("nats_auth_accounts",
+				dbx.HashExp{"operator": binding.InstallationID, "name": mapping.Account})
+			if err != nil {
+				return nil, err
+			}
+			if len(accounts) != 1 {
+				app.Logger().Warn("Skipping OIDC role mapping of unknown account",
+					slog.String("group", mapping.Group),
+					slog.String("account", mapping.Account))
+				continue
+			}
+			binding.AccountID = accounts[0].Id
+		}
+		bindings = append(bindings, binding)
+	}
+	return bindings, nil
+}
@@ -0,0 +1,156 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testClientID = "nats-tower"
+
+// testProvider is an OIDC provider returning the configured user info and ID token
+type testProvider struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	userInfo map[string]any
+	idToken  string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	p := &testProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"userinfo_endpoint":      p.URL + "/userinfo",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     p.idToken,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, p.userInfo)
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]any{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// signIDToken returns an ID token of the provider with the claims, signed with the key
+func (p *testProvider) signIDToken(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": p.URL,
+		"aud": testClientID,
+		"sub": "user-1",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	for k, v := range claims {
+		token.Claims.(jwt.MapClaims)[k] = v
+	}
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign ID token: %v", err)
+	}
+	return signed
+}
+
+func Test_Exchange(t *testing.T) {
+	p := newTestProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	userInfo := map[string]any{"sub": "user-1", "email": "user@test.org", "email_verified": true}
+	userInfoWithGroups := map[string]any{"sub": "user-1", "email": "user@test.org", "email_verified": true,
+		"groups": []string{"admins"}}
+
+	tests := []struct {
+		name     string
+		userInfo map[string]any
+		idToken  string
+		want     []string
+		wantErr  bool
+	}{
+		{"groups of the user info", userInfoWithGroups,
+			p.signIDToken(t, p.key, jwt.MapClaims{"groups": []string{"viewers"}}), []string{"admins"}, false},
+		{"groups of the ID token", userInfo,
+			p.signIDToken(t, p.key, jwt.MapClaims{"groups": []string{"viewers"}}), []string{"viewers"}, false},
+		{"no groups", userInfo, p.signIDToken(t, p.key, nil), nil, false},
+		{"ID token signed with another key", userInfo,
+			p.signIDToken(t, otherKey, jwt.MapClaims{"groups": []string{"admins"}}), nil, true},
+		{"ID token of another client", userInfo,
+			p.signIDToken(t, p.key, jwt.MapClaims{"aud": "other", "groups": []string{"admins"}}), nil, true},
+		{"ID token of another issuer", userInfo,
+			p.signIDToken(t, p.key, jwt.MapClaims{"iss": "https://other.example.com", "groups": []string{"admins"}}), nil, true},
+		{"ID token of another user", userInfo,
+			p.signIDToken(t, p.key, jwt.MapClaims{"sub": "user-2", "groups": []string{"admins"}}), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.userInfo = tt.userInfo
+			p.idToken = tt.idToken
+
+			provider, err := NewProvider(Config{Issuer: p.URL, ClientID: testClientID, ClientSecret: "secret"})
+			if err != nil {
+				t.Fatalf("Failed to NewProvider: %v", err)
+			}
+			identity, err := provider.Exchange(context.Background(), "http://localhost/login/oidc/callback", "code", "verifier")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Exchange() = %+v, want an error", identity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+			if identity.Subject != "user-1" || identity.Email != "user@test.org" {
+				t.Errorf("Exchange() = %+v", identity)
+			}
+			if !slices.Equal(identity.Groups, tt.want) {
+				t.Errorf("Exchange() groups = %v, want %v", identity.Groups, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+const (
+	apiTokenPrefix = "nt_"
+	// LegacyAPITokenName is the name of the token imported from the API_TOKEN variable
+	LegacyAPITokenName = "API_TOKEN"
+	// the last use of a token is written at most once per interval
+	apiTokenLastUsedInterval = time.Minute
+)
+
+// InitAPITokenCollection creates the api_tokens collection. It needs the NATS auth collections,
+// as tokens can be restricted to an installation or account.
+// A legacyToken (the former API_TOKEN) is imported as unrestricted token.
+func InitAPITokenCollection(e *core.ServeEvent, legacyToken string) error {
+	collection, err := e.App.FindCollectionByNameOrId("api_tokens")
+	if errors.Is(err, sql.ErrNoRows) {
+		collection = core.NewBaseCollection("api_tokens")
+	} else if err != nil {
+		return err
+	}
+
+	operatorCollection, err := e.App.FindCollectionByNameOrId("nats_auth_operators")
+	if err != nil {
+		return err
+	}
+	accountCollection, err := e.App.FindCollectionByNameOrId("nats_auth_accounts")
+	if err != nil {
+		return err
+	}
+
+	// tokens are managed in the UI, only admins may access the records directly
+	collection.ListRule = nil
+	collection.ViewRule = nil
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = nil
+	collection.Indexes = types.JSONArray[string]{
+		"create unique index api_tokens_unique_hash on api_tokens (hash)",
+	}
+
+	collection.Fields.Add(&core.TextField{
+		Name:     "name",
+		Required: true,
+	})
+	collection.Fields.Add(&core.TextField{
+		Name:     "hash",
+		Required: true,
+		Hidden:   true,
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "prefix",
+	})
+	collection.Fields.Add(&core.BoolField{
+		Name: "read_only",
+	})
+	collection.Fields.Add(&core.RelationField{
+		Name:          "installation",
+		CollectionId:  operatorCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	collection.Fields.Add(&core.RelationField{
+		Name:          "account",
+		CollectionId:  accountCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	collection.Fields.Add(&core.DateField{
+		Name: "expires",
+	})
+	collection.Fields.Add(&core.DateField{
+		Name: "last_used",
+	})
+	collection.Fields.Add(&core.AutodateField{
+		Name:     "created",
+		OnCreate: true,
+	})
+
+	if err := e.App.Save(collection); err != nil {
+		return err
+	}
+
+	if legacyToken == "" {
+		return nil
+	}
+	_, err = e.App.FindFirstRecordByData("api_tokens", "hash", hashToken(legacyToken))
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("name", LegacyAPITokenName)
+	record.Set("hash", hashToken(legacyToken))
+	record.Set("prefix", tokenPrefix(legacyToken))
+	return e.App.Save(record)
+}
+
+// hashToken hashes a token for storage. Tokens are random, so a plain SHA-256 is sufficient.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokenPrefix(token string) string {
+	if len(token) <= len(apiTokenPrefix)+4 {
+		return ""
+	}
+	return token[:len(apiTokenPrefix)+4]
+}
+
+func getAPITokenFromRecord(app core.App, record *core.Record) (*application.APIToken, error) {
+	token := &application.APIToken{
+		ID:             record.Id,
+		Name:           record.GetString("name"),
+		Prefix:         record.GetString("prefix"),
+		ReadOnly:       record.GetBool("read_only"),
+		InstallationID: record.GetString("installation"),
+		AccountID:      record.GetString("account"),
+		Expires:        record.GetDateTime("expires").Time(),
+		LastUsed:       record.GetDateTime("last_used").Time(),
+		Created:        record.GetDateTime("created").Time(),
+	}
+	if token.AccountID != "" {
+		accountRecord, err := app.FindRecordById("nats_auth_accounts", token.AccountID)
+		if err != nil {
+			return nil, err
+		}
+		token.AccountName = accountRecord.GetString("name")
+		token.InstallationID = accountRecord.GetString("operator")
+	}
+	return token, nil
+}
+
+// GetAPITokens returns all tokens, newest first
+func GetAPITokens(app core.App) ([]*application.APIToken, error) {
+	records, err := app.FindRecordsByFilter("api_tokens", "", "-created", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*application.APIToken
+	for _, record := range records {
+		token, err := getAPITokenFromRecord(app, record)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, token)
+	}
+	return res, nil
+}
+
+// CreateAPIToken creates a new token. The token itself is only returned here and can not be recovered later.
+func CreateAPIToken(app core.App, opts application.APITokenOptions) (string, *application.APIToken, error) {
+	if opts.Name == "" {
+		return "", nil, fmt.Errorf("name is required")
+	}
+	if !opts.Expires.IsZero() && opts.Expires.Before(time.Now()) {
+		return "", nil, fmt.Errorf("expiry must be in the future")
+	}
+
+	collection, err := app.FindCollectionByNameOrId("api_tokens")
+	if err != nil {
+		return "", nil, err
+	}
+
+	installationID := opts.InstallationID
+	if opts.AccountID != "" {
+		accountRecord, err := app.FindRecordById("nats_auth_accounts", opts.AccountID)
+		if err != nil {
+			return "", nil, err
+		}
+		if installationID != "" && installationID != accountRecord.GetString("operator") {
+			return "", nil, fmt.Errorf("account does not belong to the installation")
+		}
+		installationID = accountRecord.GetString("operator")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	value := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	record := core.NewRecord(collection)
+	record.Set("name", opts.Name)
+	record.Set("hash", hashToken(value))
+	record.Set("prefix", tokenPrefix(value))
+	record.Set("read_only", opts.ReadOnly)
+	record.Set("installation", installationID)
+	record.Set("account", opts.AccountID)
+	if !opts.Expires.IsZero() {
+		record.Set("expires", opts.Expires)
+	}
+	if err := app.Save(record); err != nil {
+		return "", nil, err
+	}
+
+	token, err := getAPITokenFromRecord(app, record)
+	if err != nil {
+		return "", nil, err
+	}
+	return value, token, nil
+}
+
+// FindAPIToken returns the token or application.ErrAPITokenInvalid if it is unknown or expired.
+// The last use of the token is recorded.
+func FindAPIToken(app core.App, value string) (*application.APIToken, error) {
+	if value == "" {
+		return nil, application.ErrAPITokenInvalid
+	}
+	record, err := app.FindFirstRecordByData("api_tokens", "hash", hashToken(value))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, application.ErrAPITokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expires := record.GetDateTime("expires").Time()
+	if !expires.IsZero() && expires.Before(now) {
+		return nil, application.ErrAPITokenInvalid
+	}
+
+	if now.Sub(record.GetDateTime("last_used").Time()) > apiTokenLastUsedInterval {
+		record.Set("last_used", now)
+		if err := app.Save(record); err != nil {
+			return nil, err
+		}
+	}
+
+	return getAPITokenFromRecord(app, record)
+}
+
+func DeleteAPIToken(app core.App, id string) error {
+	record, err := app.FindRecordById("api_tokens", id)
+	if err != nil {
+		return err
+	}
+	return app.Delete(record)
+}
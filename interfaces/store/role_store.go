@@ -0,0 +1,246 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+// InitRoleBindingCollection creates the role_bindings collection. It needs the NATS auth collections,
+// as roles are bound to installations and accounts.
+// When the collection is created, all existing users become admins, as they could access everything before.
+func InitRoleBindingCollection(e *core.ServeEvent) error {
+	collection, err := e.App.FindCollectionByNameOrId("role_bindings")
+	created := false
+	if errors.Is(err, sql.ErrNoRows) {
+		collection = core.NewBaseCollection("role_bindings")
+		created = true
+	} else if err != nil {
+		return err
+	}
+
+	userCollection, err := e.App.FindCollectionByNameOrId("users")
+	if err != nil {
+		return err
+	}
+	operatorCollection, err := e.App.FindCollectionByNameOrId("nats_auth_operators")
+	if err != nil {
+		return err
+	}
+	accountCollection, err := e.App.FindCollectionByNameOrId("nats_auth_accounts")
+	if err != nil {
+		return err
+	}
+
+	// bindings are managed in the UI, only admins may access the records directly
+	collection.ListRule = nil
+	collection.ViewRule = nil
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = nil
+
+	var roles []string
+	for _, role := range application.Roles {
+		roles = append(roles, string(role))
+	}
+
+	collection.Fields.Add(&core.RelationField{
+		Name:          "user",
+		Required:      true,
+		CollectionId:  userCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	collection.Fields.Add(&core.SelectField{
+		Name:      "role",
+		Required:  true,
+		Values:    roles,
+		MaxSelect: 1,
+	})
+	collection.Fields.Add(&core.RelationField{
+		Name:          "installation",
+		CollectionId:  operatorCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	collection.Fields.Add(&core.RelationField{
+		Name:          "account",
+		CollectionId:  accountCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	// bindings of the single sign-on are replaced on every login
+	collection.Fields.Add(&core.TextField{
+		Name: "source",
+	})
+
+	if err := e.App.Save(collection); err != nil {
+		return err
+	}
+
+	if !created {
+		return nil
+	}
+	users, err := e.App.FindAllRecords("users")
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		record := core.NewRecord(collection)
+		record.Set("user", user.Id)
+		record.Set("role", string(application.RoleAdmin))
+		if err := e.App.Save(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getRoleBindingFromRecord(app core.App, record *core.Record) (*application.RoleBinding, error) {
+	binding := &application.RoleBinding{
+		ID:             record.Id,
+		UserID:         record.GetString("user"),
+		Role:           application.Role(record.GetString("role")),
+		InstallationID: record.GetString("installation"),
+		AccountID:      record.GetString("account"),
+		Source:         record.GetString("source"),
+	}
+	userRecord, err := app.FindRecordById("users", binding.UserID)
+	if err != nil {
+		return nil, err
+	}
+	binding.UserEmail = userRecord.Email()
+	if binding.AccountID != "" {
+		accountRecord, err := app.FindRecordById("nats_auth_accounts", binding.AccountID)
+		if err != nil {
+			return nil, err
+		}
+		binding.AccountName = accountRecord.GetString("name")
+		binding.InstallationID = accountRecord.GetString("operator")
+	}
+	return binding, nil
+}
+
+// GetAccess returns the roles of the logged in user
+func GetAccess(app core.App, auth *core.Record) (*application.Access, error) {
+	if auth == nil {
+		return &application.Access{}, nil
+	}
+	if auth.Collection().Name == core.CollectionNameSuperusers {
+		return &application.Access{Superuser: true}, nil
+	}
+
+	bindings, err := getRoleBindings(app, dbx.HashExp{"user": auth.Id})
+	if err != nil {
+		return nil, err
+	}
+	access := &application.Access{}
+	for _, binding := range bindings {
+		access.Bindings = append(access.Bindings, *binding)
+	}
+	return access, nil
+}
+
+// GetRoleBindings returns the role bindings of all users
+func GetRoleBindings(app core.App) ([]*application.RoleBinding, error) {
+	return getRoleBindings(app, nil)
+}
+
+func getRoleBindings(app core.App, exp dbx.Expression) ([]*application.RoleBinding, error) {
+	records, err := app.FindAllRecords("role_bindings", exp)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*application.RoleBinding
+	for _, record := range records {
+		binding, err := getRoleBindingFromRecord(app, record)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, binding)
+	}
+	return res, nil
+}
+
+// AddRoleBinding grants a role to a user. Admins are bound globally, installation admins need
+// an installation, account owners an account and viewers may be bound to either.
+func AddRoleBinding(app core.App, binding application.RoleBinding) (*application.RoleBinding, error) {
+	if !slices.Contains(application.Roles, binding.Role) {
+		return nil, fmt.Errorf("unknown role %s", binding.Role)
+	}
+	switch binding.Role {
+	case application.RoleAdmin:
+		binding.InstallationID = ""
+		binding.AccountID = ""
+	case application.RoleInstallationAdmin:
+		if binding.InstallationID == "" {
+			return nil, fmt.Errorf("installation admins need an installation")
+		}
+		binding.AccountID = ""
+	case application.RoleAccountOwner:
+		if binding.AccountID == "" {
+			return nil, fmt.Errorf("account owners need an account")
+		}
+	}
+
+	if binding.AccountID != "" {
+		accountRecord, err := app.FindRecordById("nats_auth_accounts", binding.AccountID)
+		if err != nil {
+			return nil, err
+		}
+		binding.InstallationID = accountRecord.GetString("operator")
+	}
+
+	collection, err := app.FindCollectionByNameOrId("role_bindings")
+	if err != nil {
+		return nil, err
+	}
+	record := core.NewRecord(collection)
+	record.Set("user", binding.UserID)
+	record.Set("role", string(binding.Role))
+	record.Set("installation", binding.InstallationID)
+	record.Set("account", binding.AccountID)
+	record.Set("source", binding.Source)
+	if err := app.Save(record); err != nil {
+		return nil, err
+	}
+	return getRoleBindingFromRecord(app, record)
+}
+
+// SyncRoleBindings replaces the bindings of a user that are managed by the source
+func SyncRoleBindings(app core.App, userID, source string, bindings []application.RoleBinding) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		records, err := txApp.FindAllRecords("role_bindings", dbx.HashExp{"user": userID, "source": source})
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := txApp.Delete(record); err != nil {
+				return err
+			}
+		}
+		for _, binding := range bindings {
+			binding.UserID = userID
+			binding.Source = source
+			if _, err := AddRoleBinding(txApp, binding); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func DeleteRoleBinding(app core.App, id string) error {
+	record, err := app.FindRecordById("role_bindings", id)
+	if err != nil {
+		return err
+	}
+	return app.Delete(record)
+}
@@ -1,6 +1,20 @@
 package store
 
-import "github.com/pocketbase/pocketbase/core"
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+// setupTokenTTL is how long invitation and password reset links are valid
+const setupTokenTTL = 7 * 24 * time.Hour
 
 func InitUserCollection(e *core.ServeEvent) error {
 	collection, err := e.App.FindCollectionByNameOrId("users")
@@ -12,6 +26,202 @@ func InitUserCollection(e *core.ServeEvent) error {
 		Name:    "preferences",
 		MaxSize: 1024 * 1024, // 1MB
 	})
+	collection.Fields.Add(&core.BoolField{
+		Name: "disabled",
+	})
+	// invitation and password reset links, only a hash is stored
+	collection.Fields.Add(&core.TextField{
+		Name:   "setup_hash",
+		Hidden: true,
+	})
+	collection.Fields.Add(&core.DateField{
+		Name:   "setup_expires",
+		Hidden: true,
+	})
+
+	// disabled users may not log in via the PocketBase API either
+	authRule := "disabled = false"
+	collection.AuthRule = &authRule
 
 	return e.App.Save(collection)
 }
+
+func getMemberFromRecord(record *core.Record) *application.Member {
+	return &application.Member{
+		ID:       record.Id,
+		Email:    record.Email(),
+		Verified: record.Verified(),
+		Disabled: record.GetBool("disabled"),
+		Invited:  !record.Verified() && record.GetString("setup_hash") != "",
+		Created:  record.GetDateTime("created").Time(),
+	}
+}
+
+// GetMembers returns all users with their roles
+func GetMembers(app core.App) ([]*application.Member, error) {
+	records, err := app.FindRecordsByFilter("users", "", "email", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := GetRoleBindings(app)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*application.Member
+	for _, record := range records {
+		member := getMemberFromRecord(record)
+		for _, binding := range bindings {
+			if binding.UserID == member.ID {
+				member.Roles = append(member.Roles, *binding)
+			}
+		}
+		res = append(res, member)
+	}
+	return res, nil
+}
+
+// InviteMember creates a user without a usable password. The returned token lets the user
+// set a password via the setup link.
+func InviteMember(app core.App, email string) (string, *application.Member, error) {
+	email = strings.TrimSpace(email)
+	if _, err := app.FindAuthRecordByEmail("users", email); err == nil {
+		return "", nil, application.ErrMemberExists
+	}
+
+	collection, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		return "", nil, err
+	}
+	record := core.NewRecord(collection)
+	record.SetEmail(email)
+	record.SetVerified(false)
+
+	token, err := setSetupToken(record)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := app.Save(record); err != nil {
+		return "", nil, err
+	}
+	return token, getMemberFromRecord(record), nil
+}
+
+// FindOrCreateMember returns the user with the email. Unknown users are created with a random password,
+// they log in via the single sign-on.
+func FindOrCreateMember(app core.App, email string) (*core.Record, bool, error) {
+	record, err := app.FindAuthRecordByEmail("users", email)
+	if err == nil {
+		return record, false, nil
+	}
+
+	collection, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		return nil, false, err
+	}
+	record = core.NewRecord(collection)
+	record.SetEmail(email)
+	record.SetVerified(true)
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, false, err
+	}
+	record.SetPassword(base64.RawURLEncoding.EncodeToString(b))
+	if err := app.Save(record); err != nil {
+		return nil, false, err
+	}
+	return record, true, nil
+}
+
+// ResetMemberPassword replaces the password of a user with a random one and logs the user out.
+// The returned token lets the user set a new password via the setup link.
+func ResetMemberPassword(app core.App, id string) (string, *application.Member, error) {
+	record, err := app.FindRecordById("users", id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token, err := setSetupToken(record)
+	if err != nil {
+		return "", nil, err
+	}
+	record.RefreshTokenKey()
+	if err := app.Save(record); err != nil {
+		return "", nil, err
+	}
+	return token, getMemberFromRecord(record), nil
+}
+
+// setSetupToken sets a random password and a new setup token
+func setSetupToken(record *core.Record) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	record.SetPassword(base64.RawURLEncoding.EncodeToString(b))
+	record.Set("setup_hash", hashToken(token))
+	record.Set("setup_expires", types.NowDateTime().Add(setupTokenTTL))
+	return token, nil
+}
+
+// FindMemberBySetupToken returns the user of an invitation or password reset link
+func FindMemberBySetupToken(app core.App, token string) (*core.Record, error) {
+	if token == "" {
+		return nil, application.ErrSetupTokenInvalid
+	}
+	records, err := app.FindAllRecords("users", dbx.HashExp{"setup_hash": hashToken(token)})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) != 1 {
+		return nil, application.ErrSetupTokenInvalid
+	}
+	record := records[0]
+	if record.GetBool("disabled") || record.GetDateTime("setup_expires").Time().Before(time.Now()) {
+		return nil, application.ErrSetupTokenInvalid
+	}
+	return record, nil
+}
+
+// CompleteSetup sets the password of the user of a setup link. The link can only be used once.
+func CompleteSetup(app core.App, token, password string) (*core.Record, error) {
+	record, err := FindMemberBySetupToken(app, token)
+	if err != nil {
+		return nil, err
+	}
+	record.SetPassword(password)
+	record.SetVerified(true)
+	record.Set("setup_hash", "")
+	record.Set("setup_expires", nil)
+	if err := app.Save(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// SetMemberDisabled disables or enables a user. Disabled users are logged out.
+func SetMemberDisabled(app core.App, id string, disabled bool) (*application.Member, error) {
+	record, err := app.FindRecordById("users", id)
+	if err != nil {
+		return nil, err
+	}
+	record.Set("disabled", disabled)
+	if disabled {
+		record.RefreshTokenKey()
+	}
+	if err := app.Save(record); err != nil {
+		return nil, err
+	}
+	return getMemberFromRecord(record), nil
+}
+
+// IsMemberDisabled reports whether the auth record is a disabled user
+func IsMemberDisabled(record *core.Record) bool {
+	return record != nil && record.Collection().Name == "users" && record.GetBool("disabled")
+}
@@ -5,11 +5,12 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/nats-io/nats-server/v2/server"
-	"github.com/nats-io/nats.go"
+	"github.com/nats-tower/nats-tower/application"
 	"github.com/nats-tower/nats-tower/interfaces/web/utils"
 	"github.com/nats-tower/nats-tower/interfaces/web/views/layouts"
 	"github.com/nats-tower/nats-tower/interfaces/web/views/pages"
@@ -27,7 +28,7 @@ func GetAccounts(e *core.RequestEvent, installationID, selectedAccountID string)
 		return e.Redirect(http.StatusFound, "/installations")
 	}
 
-	installation, err := natsauth.GetOperatorFromRecord(record)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
 	if err != nil {
 		return e.InternalServerError("Failed to get operator from record", err)
 	}
@@ -42,13 +43,23 @@ func GetAccounts(e *core.RequestEvent, installationID, selectedAccountID string)
 		return e.InternalServerError("Failed to find accounts", err)
 	}
 
+	publications, err := utils.MustGetNATSAuth(e).GetAccountPublications(e.Request.Context(), installation.ID)
+	if err != nil {
+		return e.InternalServerError("Failed to get account publications", err)
+	}
+
 	model := pages.AccountsModel{
 		RequestEvent: e,
 		Installation: installation,
+		Publications: publications,
 	}
 
+	access := utils.MustGetAccess(e)
 	for _, account := range accounts {
-		acc, err := natsauth.GetAccountFromRecord(account, installation.URL)
+		if !access.Account(installation.ID, account.Id, false) {
+			continue
+		}
+		acc, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(account, installation.URL)
 		if err != nil {
 			return e.InternalServerError("Failed to get account from record", err)
 		}
@@ -65,6 +76,42 @@ func GetAccounts(e *core.RequestEvent, installationID, selectedAccountID string)
 				Installation:  installation,
 				Account:       cpy,
 				AccountDetail: accountDetails,
+				Publication:   publications[acc.ID],
+			}
+
+			natsauthModule := utils.MustGetNATSAuth(e)
+			model.SelectedAccount.Exports, err = natsauthModule.GetExportsByAccountID(e.Request.Context(), acc.ID)
+			if err != nil {
+				return e.InternalServerError("Failed to find exports", err)
+			}
+			model.SelectedAccount.Imports, err = natsauthModule.GetImportsByAccountID(e.Request.Context(), acc.ID)
+			if err != nil {
+				return e.InternalServerError("Failed to find imports", err)
+			}
+			model.SelectedAccount.Limits, err = natsauthModule.GetAccountLimits(e.Request.Context(), acc.ID)
+			if err != nil {
+				return e.InternalServerError("Failed to get account limits", err)
+			}
+			if len(model.SelectedAccount.Limits.JetStreamTiers) > 0 {
+				model.SelectedAccount.TierUsage = getTierUsage(accountDetails, model.SelectedAccount.Limits)
+			}
+			model.SelectedAccount.SigningKeys, err = natsauthModule.GetAccountSigningKeys(e.Request.Context(), acc.ID)
+			if err != nil {
+				return e.InternalServerError("Failed to get account signing keys", err)
+			}
+			model.SelectedAccount.LimitsID = account.GetString("limits")
+			model.SelectedAccount.AvailableLimits, err = natsauthModule.GetLimits(e.Request.Context())
+			if err != nil {
+				return e.InternalServerError("Failed to get limits", err)
+			}
+			exports, err := natsauthModule.GetExportsByOperatorID(e.Request.Context(), installation.ID)
+			if err != nil {
+				return e.InternalServerError("Failed to find installation exports", err)
+			}
+			for _, export := range exports {
+				if export.AccountID != acc.ID && (!export.Private || slices.Contains(export.Importers, acc.ID)) {
+					model.SelectedAccount.AvailableExports = append(model.SelectedAccount.AvailableExports, export)
+				}
 			}
 
 			users, err := e.App.FindAllRecords("nats_auth_users", dbx.HashExp{
@@ -75,7 +122,7 @@ func GetAccounts(e *core.RequestEvent, installationID, selectedAccountID string)
 			}
 
 			for _, userRecord := range users {
-				user, err := natsauth.GetUserFromRecord(userRecord, installation.URL)
+				user, err := utils.MustGetNATSAuth(e).GetUserFromRecord(userRecord, installation.URL)
 				if err != nil {
 					return e.InternalServerError("Failed to get user from record", err)
 				}
@@ -88,11 +135,19 @@ func GetAccounts(e *core.RequestEvent, installationID, selectedAccountID string)
 	if selectedAccountID != "" && model.SelectedAccount == nil {
 		return e.NotFoundError("Account not found", nil)
 	}
+	if model.SelectedAccount != nil {
+		for _, acc := range model.Accounts {
+			if acc.ID != model.SelectedAccount.Account.ID {
+				model.SelectedAccount.OtherAccounts = append(model.SelectedAccount.OtherAccounts, acc)
+			}
+		}
+	}
 
 	return layouts.WithBase(pages.Accounts(model), layouts.BaseModel{
 		Title:       "NATS Tower - " + installation.Description,
 		Description: "blabla",
 		NavigationModel: layouts.NavigationModel{
+			Access:          utils.MustGetAccess(e),
 			CurrentLocation: "/ui/installations/" + installation.ID + "/accounts",
 			InstallationID:  installation.ID,
 			Swap:            true,
@@ -101,6 +156,24 @@ func GetAccounts(e *core.RequestEvent, installationID, selectedAccountID string)
 	}).Render(e.Request.Context(), e.Response)
 }
 
+// PostAccountPublish pushes the current JWT of the account to the servers again
+func PostAccountPublish(e *core.RequestEvent, installationID, accountID string) error {
+	accountRecord, err := e.App.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		return e.NotFoundError("Account not found", err)
+	}
+	if accountRecord.GetString("operator") != installationID {
+		return e.BadRequestError("Account does not belong to installation", nil)
+	}
+
+	err = utils.MustGetNATSAuth(e).RetryAccountPublish(e.Request.Context(), accountID)
+	if err != nil {
+		return e.InternalServerError("Failed to publish account", err)
+	}
+
+	return GetAccounts(e, installationID, accountID)
+}
+
 type PostAccountRequest struct {
 	Name        string `json:"name" form:"name"`
 	Description string `json:"description" form:"description"`
@@ -132,7 +205,7 @@ func PostAccount(e *core.RequestEvent, installationID string) error {
 		return e.Redirect(http.StatusFound, "/installations")
 	}
 
-	installation, err := natsauth.GetOperatorFromRecord(record)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
 	if err != nil {
 		return e.InternalServerError("Failed to get operator from record", err)
 	}
@@ -163,7 +236,7 @@ func GetDeleteAccountModal(e *core.RequestEvent, installationID, accountID strin
 		return e.Redirect(http.StatusFound, "/installations")
 	}
 
-	installation, err := natsauth.GetOperatorFromRecord(record)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
 	if err != nil {
 		return e.InternalServerError("Failed to get operator from record", err)
 	}
@@ -176,7 +249,7 @@ func GetDeleteAccountModal(e *core.RequestEvent, installationID, accountID strin
 		return e.InternalServerError("Failed to find account record", err)
 	}
 
-	account, err := natsauth.GetAccountFromRecord(accountRecord, installation.URL)
+	account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(accountRecord, installation.URL)
 	if err != nil {
 		return e.InternalServerError("Failed to get account from record", err)
 	}
@@ -201,7 +274,7 @@ func DeleteAccount(e *core.RequestEvent, installationID, accountID string) error
 		return e.InternalServerError("Failed to find account record", err)
 	}
 
-	err = e.App.Delete(record)
+	err = e.App.DeleteWithContext(e.Request.Context(), record)
 	if err != nil {
 		return e.InternalServerError("Failed to delete account", err)
 	}
@@ -217,20 +290,14 @@ type accountDetailResponse struct {
 func getAccountDetails(e *core.RequestEvent, installationID, accountID string) (*server.AccountDetail, error) {
 	natsauthModule := utils.MustGetNATSAuth(e)
 
-	sysUserAuth, err := natsauthModule.GetSysUserByID(e.Request.Context(), installationID)
-	if err != nil {
-		return nil, err
-	}
-
-	nc, err := nats.Connect(sysUserAuth.URL, nats.UserJWTAndSeed(sysUserAuth.JWT, sysUserAuth.Seed))
+	nc, err := natsauthModule.SysConn(e.Request.Context(), installationID)
 	if err != nil {
 		return nil, err
 	}
 
-	defer nc.Close()
-
+	// the stream config is needed to determine the replica tier of the streams
 	respMsg, err := nc.Request(fmt.Sprintf("$SYS.REQ.ACCOUNT.%s.JSZ", accountID),
-		[]byte(`{"streams":true}`), 5*time.Second)
+		[]byte(`{"streams":true,"config":true}`), 5*time.Second)
 	if err != nil {
 		return nil, err
 	}
@@ -251,3 +318,46 @@ func getAccountDetails(e *core.RequestEvent, installationID, accountID string) (
 
 	return resp.Data, nil
 }
+
+// getTierUsage sums up the JetStream usage of the account per replica tier.
+// Storage of replicated streams counts once per replica, like the server does for tiered limits.
+func getTierUsage(detail *server.AccountDetail, limits *application.Limits) []pages.JetStreamTierUsage {
+	usage := map[string]*pages.JetStreamTierUsage{}
+	for tier, tierLimits := range limits.JetStreamTiers {
+		usage[tier] = &pages.JetStreamTierUsage{
+			Tier:   tier,
+			Limits: &tierLimits,
+		}
+	}
+
+	if detail != nil {
+		for _, stream := range detail.Streams {
+			replicas := 1
+			storage := server.FileStorage
+			if stream.Config != nil {
+				replicas = max(stream.Config.Replicas, 1)
+				storage = stream.Config.Storage
+			}
+			tier := fmt.Sprintf("R%d", replicas)
+			if usage[tier] == nil {
+				usage[tier] = &pages.JetStreamTierUsage{Tier: tier}
+			}
+			usage[tier].Streams++
+			usage[tier].Consumers += stream.State.Consumers
+			if storage == server.MemoryStorage {
+				usage[tier].Memory += stream.State.Bytes * uint64(replicas)
+			} else {
+				usage[tier].Store += stream.State.Bytes * uint64(replicas)
+			}
+		}
+	}
+
+	var res []pages.JetStreamTierUsage
+	for _, tierUsage := range usage {
+		res = append(res, *tierUsage)
+	}
+	slices.SortFunc(res, func(a, b pages.JetStreamTierUsage) int {
+		return strings.Compare(a.Tier, b.Tier)
+	})
+	return res
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/web/views/pages"
+)
+
+func Test_getTierUsage(t *testing.T) {
+	r1 := application.JetStreamTierLimits{MaxMemory: 1024, MaxDisk: 2048, MaxStreams: 2, MaxConsumers: 4}
+	r3 := application.JetStreamTierLimits{MaxMemory: -1, MaxDisk: 4096, MaxStreams: 1, MaxConsumers: -1}
+	limits := &application.Limits{
+		JetStreamTiers: map[string]application.JetStreamTierLimits{"R1": r1, "R3": r3},
+	}
+	stream := func(replicas int, storage server.StorageType, bytes uint64, consumers int) server.StreamDetail {
+		return server.StreamDetail{
+			Config: &server.StreamConfig{Replicas: replicas, Storage: storage},
+			State:  server.StreamState{Bytes: bytes, Consumers: consumers},
+		}
+	}
+	detail := &server.AccountDetail{
+		Streams: []server.StreamDetail{
+			stream(1, server.MemoryStorage, 100, 1),
+			stream(0, server.FileStorage, 200, 2),
+			stream(3, server.FileStorage, 300, 3),
+			// streams of a tier without limits are shown as well
+			stream(5, server.MemoryStorage, 10, 0),
+		},
+	}
+
+	want := []pages.JetStreamTierUsage{
+		{Tier: "R1", Memory: 100, Store: 200, Streams: 2, Consumers: 3, Limits: &r1},
+		// storage of replicated streams counts once per replica
+		{Tier: "R3", Store: 900, Streams: 1, Consumers: 3, Limits: &r3},
+		{Tier: "R5", Memory: 50, Streams: 1},
+	}
+	if got := getTierUsage(detail, limits); !reflect.DeepEqual(got, want) {
+		t.Errorf("getTierUsage() = %+v, want %+v", got, want)
+	}
+
+	// without details of the servers only the limits are shown
+	got := getTierUsage(nil, limits)
+	if len(got) != 2 || got[0].Tier != "R1" || got[0].Streams != 0 || got[1].Limits == nil || *got[1].Limits != r3 {
+		t.Errorf("getTierUsage() without details = %+v", got)
+	}
+}
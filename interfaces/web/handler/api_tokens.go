@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/store"
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+	"github.com/nats-tower/nats-tower/interfaces/web/views/layouts"
+	"github.com/nats-tower/nats-tower/interfaces/web/views/pages"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func GetAPITokens(e *core.RequestEvent, installationID string) error {
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find installation",
+			slog.String("id", installationID),
+			slog.String("error", err.Error()))
+		return e.Redirect(http.StatusFound, "/installations")
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	tokens, err := store.GetAPITokens(e.App)
+	if err != nil {
+		return e.InternalServerError("Failed to get API tokens", err)
+	}
+
+	installationRecords, err := e.App.FindAllRecords("nats_auth_operators")
+	if err != nil {
+		return e.InternalServerError("Failed to find installations", err)
+	}
+	installationNames := map[string]string{}
+	for _, installationRecord := range installationRecords {
+		installationNames[installationRecord.Id] = installationRecord.GetString("description")
+		if installationNames[installationRecord.Id] == "" {
+			installationNames[installationRecord.Id] = installationRecord.GetString("url")
+		}
+	}
+
+	model := pages.APITokensModel{
+		RequestEvent:      e,
+		Installation:      installation,
+		Tokens:            tokens,
+		InstallationNames: installationNames,
+	}
+
+	return layouts.WithBase(pages.APITokens(model), layouts.BaseModel{
+		Title:       "NATS Tower - " + installation.Description,
+		Description: "API tokens",
+		NavigationModel: layouts.NavigationModel{
+			Access:          utils.MustGetAccess(e),
+			CurrentLocation: "/ui/installations/" + installation.ID + "/api_tokens",
+			InstallationID:  installation.ID,
+			Swap:            true,
+		},
+		RequestEvent: e,
+	}).Render(e.Request.Context(), e.Response)
+}
+
+func getAPITokenModalModel(e *core.RequestEvent, installationID string) (pages.APITokenModalModel, error) {
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		return pages.APITokenModalModel{}, err
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return pages.APITokenModalModel{}, err
+	}
+
+	accountRecords, err := e.App.FindRecordsByFilter("nats_auth_accounts",
+		"operator = {:installationid}",
+		"name",
+		0,
+		0,
+		dbx.Params{"installationid": installation.ID})
+	if err != nil {
+		return pages.APITokenModalModel{}, err
+	}
+
+	model := pages.APITokenModalModel{
+		RequestEvent: e,
+		Installation: installation,
+	}
+	for _, accountRecord := range accountRecords {
+		account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(accountRecord, installation.URL)
+		if err != nil {
+			return pages.APITokenModalModel{}, err
+		}
+		model.Accounts = append(model.Accounts, account)
+	}
+	return model, nil
+}
+
+func GetAPITokenModal(e *core.RequestEvent, installationID string) error {
+	model, err := getAPITokenModalModel(e, installationID)
+	if err != nil {
+		return e.InternalServerError("Failed to get installation", err)
+	}
+
+	return pages.APITokenModal(model).Render(e.Request.Context(), e.Response)
+}
+
+type PostAPITokenRequest struct {
+	Name     string `json:"name" form:"name"`
+	Scope    string `json:"scope" form:"scope"`
+	ReadOnly string `json:"read_only" form:"read_only"`
+	Expires  string `json:"expires" form:"expires"`
+}
+
+func (req *PostAPITokenRequest) Options(installationID string) (application.APITokenOptions, error) {
+	opts := application.APITokenOptions{
+		Name:     strings.TrimSpace(req.Name),
+		ReadOnly: req.ReadOnly == "true",
+	}
+
+	switch {
+	case req.Scope == "installation":
+		opts.InstallationID = installationID
+	case strings.HasPrefix(req.Scope, "account:"):
+		opts.InstallationID = installationID
+		opts.AccountID = strings.TrimPrefix(req.Scope, "account:")
+	}
+
+	if req.Expires != "" {
+		expires, err := time.ParseInLocation(time.DateOnly, req.Expires, time.Local)
+		if err != nil {
+			return opts, err
+		}
+		// the token is valid until the end of the day
+		opts.Expires = expires.AddDate(0, 0, 1)
+	}
+	return opts, nil
+}
+
+// PostAPIToken creates a token and shows it once in the modal
+func PostAPIToken(e *core.RequestEvent, installationID string) error {
+	var req PostAPITokenRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	model, err := getAPITokenModalModel(e, installationID)
+	if err != nil {
+		return e.InternalServerError("Failed to get installation", err)
+	}
+
+	opts, err := req.Options(installationID)
+	if err != nil {
+		model.Error = "Expiry must be a date"
+		return pages.APITokenModal(model).Render(e.Request.Context(), e.Response)
+	}
+
+	value, token, err := store.CreateAPIToken(e.App, opts)
+	if err != nil {
+		model.Error = err.Error()
+		return pages.APITokenModal(model).Render(e.Request.Context(), e.Response)
+	}
+
+	e.App.Logger().Info("Created API token",
+		slog.String("id", token.ID),
+		slog.String("name", token.Name))
+
+	return pages.APITokenCreatedModal(pages.APITokenCreatedModalModel{
+		RequestEvent: e,
+		Installation: model.Installation,
+		Token:        token,
+		Value:        value,
+	}).Render(e.Request.Context(), e.Response)
+}
+
+func DeleteAPIToken(e *core.RequestEvent, installationID, tokenID string) error {
+	err := store.DeleteAPIToken(e.App, tokenID)
+	if err != nil {
+		return e.InternalServerError("Failed to delete API token", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/api_tokens")
+	return GetAPITokens(e, installationID)
+}
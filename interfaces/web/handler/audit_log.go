@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+	"github.com/nats-tower/nats-tower/interfaces/web/views/layouts"
+	"github.com/nats-tower/nats-tower/interfaces/web/views/pages"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// auditLogPageSize is the number of entries shown in the UI, the export contains all entries
+const auditLogPageSize = 500
+
+// getAuditLogEntries returns the entries of the account query parameter, restricted to the accounts
+// the user may read. Users without a role for the whole installation only see their accounts.
+func getAuditLogEntries(e *core.RequestEvent, installation *application.OperatorAuth, limit int) ([]*application.AuditEntry, []*application.AccountAuth, error) {
+	access := utils.MustGetAccess(e)
+	filter := application.AuditFilter{
+		InstallationID: installation.ID,
+		IncludeShared:  access.Global(false),
+		Limit:          limit,
+	}
+
+	accountRecords, err := e.App.FindRecordsByFilter("nats_auth_accounts",
+		"operator = {:installationid}",
+		"name",
+		0,
+		0,
+		dbx.Params{"installationid": installation.ID})
+	if err != nil {
+		return nil, nil, e.InternalServerError("Failed to find accounts", err)
+	}
+	var accounts []*application.AccountAuth
+	for _, accountRecord := range accountRecords {
+		if !access.Account(installation.ID, accountRecord.Id, false) {
+			continue
+		}
+		account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(accountRecord, installation.URL)
+		if err != nil {
+			return nil, nil, e.InternalServerError("Failed to get account from record", err)
+		}
+		accounts = append(accounts, account)
+	}
+
+	selectedAccountID := e.Request.URL.Query().Get("account")
+	if selectedAccountID != "" {
+		if !slices.ContainsFunc(accounts, func(account *application.AccountAuth) bool {
+			return account.ID == selectedAccountID
+		}) {
+			return nil, nil, e.ForbiddenError("You are not allowed to access this account.", nil)
+		}
+		filter.AccountIDs = []string{selectedAccountID}
+	} else if !access.Installation(installation.ID, false) {
+		if len(accounts) == 0 {
+			return nil, accounts, nil
+		}
+		for _, account := range accounts {
+			filter.AccountIDs = append(filter.AccountIDs, account.ID)
+		}
+	}
+
+	entries, err := utils.MustGetNATSAuth(e).GetAuditLog(e.Request.Context(), filter)
+	if err != nil {
+		return nil, nil, e.InternalServerError("Failed to get audit log", err)
+	}
+	return entries, accounts, nil
+}
+
+func GetAuditLog(e *core.RequestEvent, installationID string) error {
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find installation",
+			slog.String("id", installationID),
+			slog.String("error", err.Error()))
+		return e.Redirect(http.StatusFound, "/installations")
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	entries, accounts, err := getAuditLogEntries(e, installation, auditLogPageSize)
+	if err != nil {
+		return err
+	}
+
+	model := pages.AuditLogModel{
+		RequestEvent:      e,
+		Installation:      installation,
+		Accounts:          accounts,
+		SelectedAccountID: e.Request.URL.Query().Get("account"),
+		Entries:           entries,
+		PageSize:          auditLogPageSize,
+	}
+
+	return layouts.WithBase(pages.AuditLog(model), layouts.BaseModel{
+		Title:       "NATS Tower - " + installation.Description,
+		Description: "Audit log",
+		NavigationModel: layouts.NavigationModel{
+			Access:          utils.MustGetAccess(e),
+			CurrentLocation: "/ui/installations/" + installation.ID + "/audit_log",
+			InstallationID:  installation.ID,
+			Swap:            true,
+		},
+		RequestEvent: e,
+	}).Render(e.Request.Context(), e.Response)
+}
+
+// GetAuditLogExport downloads all entries of the filter as JSON
+func GetAuditLogExport(e *core.RequestEvent, installationID string) error {
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		return e.NotFoundError("Installation not found", err)
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	entries, _, err := getAuditLogEntries(e, installation, 0)
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		entries = []*application.AuditEntry{}
+	}
+
+	e.Response.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="audit-log-%s.json"`, time.Now().Format("2006-01-02")))
+	return e.JSON(http.StatusOK, entries)
+}
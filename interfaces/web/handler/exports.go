@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type PostAccountExportRequest struct {
+	Name        string `json:"name" form:"name"`
+	Description string `json:"description" form:"description"`
+	Subject     string `json:"subject" form:"subject"`
+	Type        string `json:"type" form:"type"`
+	Private     bool   `json:"private" form:"private"`
+	// Importers are the IDs of the accounts allowed to import a private export
+	Importers    []string `json:"importers" form:"importers"`
+	ResponseType string   `json:"response_type" form:"response_type"`
+}
+
+func (req *PostAccountExportRequest) Valid() error {
+	if req.Name == "" {
+		return fmt.Errorf("Name is required")
+	}
+	if req.Subject == "" {
+		return fmt.Errorf("Subject is required")
+	}
+	if req.Type != "stream" && req.Type != "service" {
+		return fmt.Errorf("Type must be stream or service")
+	}
+	return nil
+}
+
+func PostAccountExport(e *core.RequestEvent, installationID, accountID string) error {
+	var req PostAccountExportRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	if err := req.Valid(); err != nil {
+		return e.BadRequestError("Invalid request", err)
+	}
+
+	accountRecord, err := e.App.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		return e.InternalServerError("Failed to find account record", err)
+	}
+	if accountRecord.GetString("operator") != installationID {
+		return e.BadRequestError("Account does not belong to installation", nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	_, err = natsauthModule.UpsertAccountExport(e.Request.Context(), accountID,
+		application.AccountExport{
+			Name:         req.Name,
+			Description:  req.Description,
+			Subject:      req.Subject,
+			Type:         req.Type,
+			Private:      req.Private,
+			Importers:    req.Importers,
+			ResponseType: req.ResponseType,
+		})
+	if err != nil {
+		return e.InternalServerError("Failed to upsert export", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/accounts/"+accountID)
+	return GetAccounts(e, installationID, accountID)
+}
+
+func DeleteAccountExport(e *core.RequestEvent, installationID, accountID, exportID string) error {
+	exportRecord, err := e.App.FindRecordById("nats_auth_exports", exportID)
+	if err != nil {
+		return e.InternalServerError("Failed to find export record", err)
+	}
+	if exportRecord.GetString("account") != accountID {
+		return e.BadRequestError("Export does not belong to account", nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	err = natsauthModule.DeleteAccountExport(e.Request.Context(), exportID)
+	if err != nil {
+		return e.InternalServerError("Failed to delete export", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/accounts/"+accountID)
+	return GetAccounts(e, installationID, accountID)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type PostAccountImportRequest struct {
+	Name         string `json:"name" form:"name"`
+	ExportID     string `json:"export" form:"export"`
+	LocalSubject string `json:"local_subject" form:"local_subject"`
+}
+
+func (req *PostAccountImportRequest) Valid() error {
+	if req.Name == "" {
+		return fmt.Errorf("Name is required")
+	}
+	if req.ExportID == "" {
+		return fmt.Errorf("Export is required")
+	}
+	return nil
+}
+
+func PostAccountImport(e *core.RequestEvent, installationID, accountID string) error {
+	var req PostAccountImportRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	if err := req.Valid(); err != nil {
+		return e.BadRequestError("Invalid request", err)
+	}
+
+	accountRecord, err := e.App.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		return e.InternalServerError("Failed to find account record", err)
+	}
+	if accountRecord.GetString("operator") != installationID {
+		return e.BadRequestError("Account does not belong to installation", nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	_, err = natsauthModule.UpsertAccountImport(e.Request.Context(), accountID,
+		application.AccountImport{
+			Name:         req.Name,
+			ExportID:     req.ExportID,
+			LocalSubject: req.LocalSubject,
+		})
+	if err != nil {
+		return e.BadRequestError("Failed to upsert import", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/accounts/"+accountID)
+	return GetAccounts(e, installationID, accountID)
+}
+
+func DeleteAccountImport(e *core.RequestEvent, installationID, accountID, importID string) error {
+	importRecord, err := e.App.FindRecordById("nats_auth_imports", importID)
+	if err != nil {
+		return e.InternalServerError("Failed to find import record", err)
+	}
+	if importRecord.GetString("account") != accountID {
+		return e.BadRequestError("Import does not belong to account", nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	err = natsauthModule.DeleteAccountImport(e.Request.Context(), importID)
+	if err != nil {
+		return e.InternalServerError("Failed to delete import", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/accounts/"+accountID)
+	return GetAccounts(e, installationID, accountID)
+}
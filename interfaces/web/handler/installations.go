@@ -1,17 +1,22 @@
 package handler
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
 	"github.com/pocketbase/pocketbase/core"
 
+	"github.com/nats-tower/nats-tower/application"
 	"github.com/nats-tower/nats-tower/interfaces/web/utils"
 	"github.com/nats-tower/nats-tower/interfaces/web/views/layouts"
 	"github.com/nats-tower/nats-tower/interfaces/web/views/pages"
@@ -28,7 +33,7 @@ func GetInstallation(e *core.RequestEvent, installationID string) error {
 		return e.Redirect(http.StatusFound, "/installations")
 	}
 
-	installation, err := natsauth.GetOperatorFromRecord(record)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
 	if err != nil {
 		return e.InternalServerError("Failed to get operator from record", err)
 	}
@@ -36,6 +41,10 @@ func GetInstallation(e *core.RequestEvent, installationID string) error {
 	model := pages.InstallationModel{
 		RequestEvent: e,
 		Installation: installation,
+		Drift: pages.InstallationDriftModel{
+			Installation: installation,
+			Report:       utils.MustGetNATSAuth(e).GetAccountDriftReport(e.Request.Context(), installation.ID),
+		},
 	}
 
 	model.ServerInfos, err = getClusterInfo(e, installation.ID)
@@ -47,11 +56,16 @@ func GetInstallation(e *core.RequestEvent, installationID string) error {
 			Error: err,
 		}
 	}
+	model.Connection = utils.MustGetNATSAuth(e).GetSysConnHealth(e.Request.Context(), installation.ID)
+	if installation.ResolverMode == application.ResolverMemory {
+		model.Preload = getInstallationPreload(e, installation)
+	}
 
 	return layouts.WithBase(pages.Installation(model), layouts.BaseModel{
 		Title:       "NATS Tower - " + installation.Description,
 		Description: "blabla",
 		NavigationModel: layouts.NavigationModel{
+			Access:          utils.MustGetAccess(e),
 			CurrentLocation: "/ui/installations/" + installationID,
 			InstallationID:  installationID,
 			Swap:            true,
@@ -114,7 +128,7 @@ func PostInstallation(e *core.RequestEvent) error {
 	record.Set("url", req.URL)
 	record.Set("description", req.Description)
 
-	err = e.App.Save(record)
+	err = e.App.SaveWithContext(e.Request.Context(), record)
 	if err != nil {
 		e.App.Logger().Error("Failed to save record",
 			slog.String("error", err.Error()))
@@ -128,7 +142,7 @@ func PostInstallation(e *core.RequestEvent) error {
 	record.Set("name", "SYS")
 	record.Set("description", fmt.Sprintf("System account for %s at %s", req.Description, req.URL))
 
-	err = e.App.Save(record)
+	err = e.App.SaveWithContext(e.Request.Context(), record)
 	if err != nil {
 		e.App.Logger().Error("Failed to save account record",
 			slog.String("error", err.Error()))
@@ -142,7 +156,7 @@ func PostInstallation(e *core.RequestEvent) error {
 	record.Set("name", "sys")
 	record.Set("description", fmt.Sprintf("System user for %s at %s", req.Description, req.URL))
 
-	err = e.App.Save(record)
+	err = e.App.SaveWithContext(e.Request.Context(), record)
 	if err != nil {
 		e.App.Logger().Error("Failed to save user record",
 			slog.String("error", err.Error()))
@@ -154,18 +168,11 @@ func PostInstallation(e *core.RequestEvent) error {
 func getClusterInfo(e *core.RequestEvent, installationID string) ([]*server.ServerStatsMsg, error) {
 	natsauthModule := utils.MustGetNATSAuth(e)
 
-	sysUserAuth, err := natsauthModule.GetSysUserByID(e.Request.Context(), installationID)
-	if err != nil {
-		return nil, err
-	}
-
-	nc, err := nats.Connect(sysUserAuth.URL, nats.UserJWTAndSeed(sysUserAuth.JWT, sysUserAuth.Seed))
+	nc, err := natsauthModule.SysConn(e.Request.Context(), installationID)
 	if err != nil {
 		return nil, err
 	}
 
-	defer nc.Close()
-
 	var serverInfos []*server.ServerStatsMsg
 
 	_, err = natsauth.RequestMultiple(e.Request.Context(),
@@ -211,8 +218,12 @@ func GetInstallations(e *core.RequestEvent) error {
 		RequestEvent: e,
 	}
 
+	access := utils.MustGetAccess(e)
 	for _, installation := range installations {
-		operator, err := natsauth.GetOperatorFromRecord(installation)
+		if !access.InstallationVisible(installation.Id) {
+			continue
+		}
+		operator, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(installation)
 		if err != nil {
 			return e.InternalServerError("Failed to get operator from record", err)
 		}
@@ -224,6 +235,7 @@ func GetInstallations(e *core.RequestEvent) error {
 		Description:  "blabla",
 		NoNavigation: true,
 		NavigationModel: layouts.NavigationModel{
+			Access:          utils.MustGetAccess(e),
 			CurrentLocation: "/ui/installations",
 		},
 		RequestEvent: e,
@@ -240,7 +252,7 @@ func GetDeleteInstallationModal(e *core.RequestEvent, installationID string) err
 		return e.Redirect(http.StatusFound, "/installations")
 	}
 
-	installation, err := natsauth.GetOperatorFromRecord(record)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
 	if err != nil {
 		return e.InternalServerError("Failed to get operator from record", err)
 	}
@@ -254,6 +266,19 @@ func GetDeleteInstallationModal(e *core.RequestEvent, installationID string) err
 }
 
 func GetInstallationSettingsModal(e *core.RequestEvent, installationID string) error {
+	return renderInstallationSettingsModal(e, installationID, installationSettingsResult{})
+}
+
+// installationSettingsResult is the outcome of the last action in the settings modal
+type installationSettingsResult struct {
+	rotationError     string
+	connectionError   string
+	connectionMessage string
+	resolverError     string
+	resolverMessage   string
+}
+
+func renderInstallationSettingsModal(e *core.RequestEvent, installationID string, result installationSettingsResult) error {
 
 	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
 	if err != nil {
@@ -263,56 +288,139 @@ func GetInstallationSettingsModal(e *core.RequestEvent, installationID string) e
 		return e.Redirect(http.StatusFound, "/installations")
 	}
 
-	installation, err := natsauth.GetOperatorFromRecord(record)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
 	if err != nil {
 		return e.InternalServerError("Failed to get operator from record", err)
 	}
 
 	natsauthModule := utils.MustGetNATSAuth(e)
-	account, _, err := natsauthModule.GetSysAccountAndUserByID(e.Request.Context(), installationID)
-
+	serverConfigOptions := natsauth.DefaultServerConfigOptions()
+	if installation.ResolverMode == application.ResolverMemory {
+		serverConfigOptions.ResolverType = application.ResolverMemory
+	}
+	bundle, err := natsauthModule.GenerateServerConfigBundle(e.Request.Context(), installationID, serverConfigOptions)
 	if err != nil {
-		return e.InternalServerError("Failed to get system account and user", err)
+		return e.InternalServerError("Failed to generate server config", err)
 	}
 
 	model := pages.InstallationSettingsModalModel{
-		RequestEvent: e,
-		Installation: installation,
-		SimpleConfig: fmt.Sprintf(`port = 4224
+		RequestEvent:        e,
+		Installation:        installation,
+		OperatorConfig:      fmt.Sprintf("operator = %s", installation.JWT),
+		RotationError:       result.rotationError,
+		ConnectionError:     result.connectionError,
+		ConnectionMessage:   result.connectionMessage,
+		ResolverError:       result.resolverError,
+		ResolverMessage:     result.resolverMessage,
+		SimpleConfig:        bundle.Files[0].Content,
+		ServerConfigOptions: serverConfigOptions,
+	}
 
-jetstream {
-    store_dir = "jetstream"
+	return pages.InstallationSettingsModal(model).Render(e.Request.Context(), e.Response)
 }
 
-resolver: {
-    type: full
-    # Directory in which account jwt will be stored
-    dir: './jwt'
-    # In order to support jwt deletion, set to true
-    # If the resolver type is full delete will rename the jwt.
-    # This is to allow manual restoration in case of inadvertent deletion.
-    # To restore a jwt, remove the added suffix .delete and restart or send a reload signal.
-    # To free up storage you must manually delete files with the suffix .delete.
-    allow_delete: true
-    # Interval at which a nats-server with a nats based account resolver will compare
-    # it's state with one random nats based account resolver in the cluster and if needed,
-    # exchange jwt and converge on the same set of jwt.
-    interval: "2m"
-    # limit on the number of jwt stored, will reject new jwt once limit is hit.
-    limit: 1000
+// PostInstallationSigningKeyRotation advances the rotation of the operator signing key by one step
+func PostInstallationSigningKeyRotation(e *core.RequestEvent, installationID, step string) error {
+	natsauthModule := utils.MustGetNATSAuth(e)
+
+	var err error
+	switch step {
+	case "start":
+		_, err = natsauthModule.StartOperatorSigningKeyRotation(e.Request.Context(), installationID)
+	case "complete":
+		_, err = natsauthModule.CompleteOperatorSigningKeyRotation(e.Request.Context(), installationID)
+	case "retire":
+		_, err = natsauthModule.RetireOperatorSigningKey(e.Request.Context(), installationID)
+	default:
+		return e.NotFoundError("Unknown rotation step", nil)
+	}
+
+	rotationError := ""
+	if err != nil {
+		e.App.Logger().Error("Failed to rotate operator signing key",
+			slog.String("id", installationID),
+			slog.String("step", step),
+			slog.String("error", err.Error()))
+		rotationError = err.Error()
+	}
+	return renderInstallationSettingsModal(e, installationID, installationSettingsResult{rotationError: rotationError})
 }
 
-operator = %s
+type PostInstallationConnectionRequest struct {
+	SeedURLs          string `json:"seed_urls" form:"seed_urls"`
+	TLSCA             string `json:"tls_ca" form:"tls_ca"`
+	TLSCert           string `json:"tls_cert" form:"tls_cert"`
+	TLSKey            string `json:"tls_key" form:"tls_key"`
+	TLSHandshakeFirst bool   `json:"tls_handshake_first" form:"tls_handshake_first"`
+}
+
+// PostInstallationConnection stores the seed URLs and TLS settings of the installation
+func PostInstallationConnection(e *core.RequestEvent, installationID string) error {
+	var req PostInstallationConnectionRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
 
-system_account = %s
+	natsauthModule := utils.MustGetNATSAuth(e)
+	_, err = natsauthModule.UpdateOperatorConnection(e.Request.Context(), installationID, application.OperatorConnection{
+		SeedURLs:          splitLines(req.SeedURLs),
+		TLSCA:             strings.TrimSpace(req.TLSCA),
+		TLSCert:           strings.TrimSpace(req.TLSCert),
+		TLSKey:            strings.TrimSpace(req.TLSKey),
+		TLSHandshakeFirst: req.TLSHandshakeFirst,
+	})
 
-resolver_preload = {
-  %s: %s
+	result := installationSettingsResult{connectionMessage: "Connection settings saved."}
+	if err != nil {
+		e.App.Logger().Error("Failed to update connection settings",
+			slog.String("id", installationID),
+			slog.String("error", err.Error()))
+		result = installationSettingsResult{connectionError: err.Error()}
+	}
+	return renderInstallationSettingsModal(e, installationID, result)
 }
-`, installation.JWT, account.PublicKey, account.PublicKey, account.JWT),
+
+// PostInstallationDrift checks the accounts of the installation for drift or repairs it
+func PostInstallationDrift(e *core.RequestEvent, installationID, action string) error {
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		return e.NotFoundError("Installation not found", err)
 	}
 
-	return pages.InstallationSettingsModal(model).Render(e.Request.Context(), e.Response)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	model := pages.InstallationDriftModel{
+		Installation: installation,
+	}
+	switch action {
+	case "check":
+		// failed checks are part of the report
+		_, _ = natsauthModule.CheckAccountDrift(e.Request.Context(), installationID)
+	case "repush":
+		err = natsauthModule.RepushAccounts(e.Request.Context(), installationID)
+		if err == nil {
+			model.Message = "All accounts were queued for publishing. Check again in a moment."
+		}
+	case "prune":
+		err = natsauthModule.PruneUnknownAccounts(e.Request.Context(), installationID)
+	default:
+		return e.NotFoundError("Unknown drift action", nil)
+	}
+	if err != nil {
+		e.App.Logger().Error("Failed to repair account drift",
+			slog.String("id", installationID),
+			slog.String("action", action),
+			slog.String("error", err.Error()))
+		model.Error = err.Error()
+	}
+
+	model.Report = natsauthModule.GetAccountDriftReport(e.Request.Context(), installationID)
+	return pages.InstallationDrift(model).Render(e.Request.Context(), e.Response)
 }
 
 func DeleteInstallation(e *core.RequestEvent, installationID string) error {
@@ -324,7 +432,7 @@ func DeleteInstallation(e *core.RequestEvent, installationID string) error {
 		return e.InternalServerError("Failed to find operator record", err)
 	}
 
-	err = e.App.Delete(record)
+	err = e.App.DeleteWithContext(e.Request.Context(), record)
 	if err != nil {
 		return e.InternalServerError("Failed to delete operator record", err)
 	}
@@ -362,3 +470,179 @@ func PostInstallationID(e *core.RequestEvent) error {
 	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+prefs.LastInstallationID)
 	return GetInstallation(e, req.InstallationID)
 }
+
+type PostInstallationServerConfigRequest struct {
+	ServerNames        string `json:"server_names" form:"server_names"`
+	ClusterName        string `json:"cluster_name" form:"cluster_name"`
+	Routes             string `json:"routes" form:"routes"`
+	ClientPort         string `json:"client_port" form:"client_port"`
+	ClusterPort        string `json:"cluster_port" form:"cluster_port"`
+	HTTPPort           string `json:"http_port" form:"http_port"`
+	LeafNodePort       string `json:"leafnode_port" form:"leafnode_port"`
+	WebsocketPort      string `json:"websocket_port" form:"websocket_port"`
+	MQTTPort           string `json:"mqtt_port" form:"mqtt_port"`
+	JetStream          string `json:"jetstream" form:"jetstream"`
+	JetStreamMaxMemory string `json:"jetstream_max_memory" form:"jetstream_max_memory"`
+	JetStreamMaxStore  string `json:"jetstream_max_store" form:"jetstream_max_store"`
+	ResolverType       string `json:"resolver_type" form:"resolver_type"`
+	TLSCert            string `json:"tls_cert" form:"tls_cert"`
+	TLSKey             string `json:"tls_key" form:"tls_key"`
+	TLSCA              string `json:"tls_ca" form:"tls_ca"`
+	TLSVerify          string `json:"tls_verify" form:"tls_verify"`
+}
+
+func (req *PostInstallationServerConfigRequest) Options() (application.ServerConfigOptions, error) {
+	res := application.ServerConfigOptions{
+		ServerNames:  splitLines(req.ServerNames),
+		ClusterName:  strings.TrimSpace(req.ClusterName),
+		Routes:       splitLines(req.Routes),
+		JetStream:    req.JetStream == "true",
+		ResolverType: application.ResolverType(req.ResolverType),
+		TLSCert:      strings.TrimSpace(req.TLSCert),
+		TLSKey:       strings.TrimSpace(req.TLSKey),
+		TLSCA:        strings.TrimSpace(req.TLSCA),
+		TLSVerify:    req.TLSVerify == "true",
+	}
+
+	ports := []struct {
+		label string
+		value string
+		res   *int
+	}{
+		{"Client port", req.ClientPort, &res.ClientPort},
+		{"Cluster port", req.ClusterPort, &res.ClusterPort},
+		{"Monitoring port", req.HTTPPort, &res.HTTPPort},
+		{"Leafnode port", req.LeafNodePort, &res.LeafNodePort},
+		{"Websocket port", req.WebsocketPort, &res.WebsocketPort},
+		{"MQTT port", req.MQTTPort, &res.MQTTPort},
+	}
+	for _, port := range ports {
+		value := strings.TrimSpace(port.value)
+		if value == "" {
+			continue
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return res, fmt.Errorf("%s: must be a number", port.label)
+		}
+		*port.res = v
+	}
+
+	sizes := []struct {
+		label string
+		value string
+		res   *int64
+	}{
+		{"JetStream memory", req.JetStreamMaxMemory, &res.JetStreamMaxMemory},
+		{"JetStream storage", req.JetStreamMaxStore, &res.JetStreamMaxStore},
+	}
+	for _, size := range sizes {
+		value := strings.TrimSpace(size.value)
+		if value == "" {
+			continue
+		}
+		v, err := utils.ParseBytes(value)
+		if err != nil {
+			return res, fmt.Errorf("%s: must be a size like 512MB", size.label)
+		}
+		*size.res = v
+	}
+	return res, nil
+}
+
+// PostInstallationServerConfig downloads the server configs of the installation as a zip file
+func PostInstallationServerConfig(e *core.RequestEvent, installationID string) error {
+	var req PostInstallationServerConfigRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	// the form is downloaded without htmx, so the reason has to be part of the message
+	opts, err := req.Options()
+	if err != nil {
+		return e.BadRequestError("Invalid server config: "+err.Error(), nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	bundle, err := natsauthModule.GenerateServerConfigBundle(e.Request.Context(), installationID, opts)
+	if err != nil {
+		return e.BadRequestError("Invalid server config: "+err.Error(), nil)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range bundle.Files {
+		w, err := zw.Create(file.Name)
+		if err != nil {
+			return e.InternalServerError("Failed to create bundle", err)
+		}
+		if _, err := w.Write([]byte(file.Content)); err != nil {
+			return e.InternalServerError("Failed to create bundle", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return e.InternalServerError("Failed to create bundle", err)
+	}
+
+	e.Response.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="nats-server-config-%s.zip"`, installationID))
+	return e.Blob(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+func getInstallationPreload(e *core.RequestEvent, installation *application.OperatorAuth) pages.InstallationPreloadModel {
+	model := pages.InstallationPreloadModel{
+		Installation: installation,
+	}
+	preload, err := utils.MustGetNATSAuth(e).GetResolverPreload(e.Request.Context(), installation.ID)
+	if err != nil {
+		model.Error = err.Error()
+	}
+	model.Preload = preload
+	return model
+}
+
+type PostInstallationResolverRequest struct {
+	ResolverMode string `json:"resolver_mode" form:"resolver_mode"`
+	ConfigPath   string `json:"config_path" form:"config_path"`
+}
+
+// PostInstallationResolver stores the resolver mode of the installation
+func PostInstallationResolver(e *core.RequestEvent, installationID string) error {
+	var req PostInstallationResolverRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	installation, err := natsauthModule.UpdateOperatorResolver(e.Request.Context(), installationID,
+		application.ResolverType(req.ResolverMode), strings.TrimSpace(req.ConfigPath))
+
+	result := installationSettingsResult{resolverMessage: "Resolver saved."}
+	if err == nil && installation.ResolverMode == application.ResolverMemory {
+		result.resolverMessage = "Resolver saved. Reload the config of the servers with the resolver preload of the dashboard."
+	}
+	if err != nil {
+		e.App.Logger().Error("Failed to update resolver",
+			slog.String("id", installationID),
+			slog.String("error", err.Error()))
+		result = installationSettingsResult{resolverError: err.Error()}
+	}
+	return renderInstallationSettingsModal(e, installationID, result)
+}
+
+// PostInstallationResolverReloaded confirms that the servers reloaded the resolver preload
+func PostInstallationResolverReloaded(e *core.RequestEvent, installationID string) error {
+	natsauthModule := utils.MustGetNATSAuth(e)
+	err := natsauthModule.ConfirmResolverConfigReload(e.Request.Context(), installationID)
+	if err != nil {
+		return e.InternalServerError("Failed to confirm reload", err)
+	}
+
+	installation, err := natsauthModule.GetOperatorByID(e.Request.Context(), installationID)
+	if err != nil {
+		return e.InternalServerError("Failed to get installation", err)
+	}
+	return pages.InstallationResolverPreload(getInstallationPreload(e, installation)).Render(e.Request.Context(), e.Response)
+}
@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+	"github.com/nats-tower/nats-tower/interfaces/web/views/layouts"
+	"github.com/nats-tower/nats-tower/interfaces/web/views/pages"
+	"github.com/nats-tower/nats-tower/natsauth"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func GetLimits(e *core.RequestEvent, installationID string) error {
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find installation",
+			slog.String("id", installationID),
+			slog.String("error", err.Error()))
+		return e.Redirect(http.StatusFound, "/installations")
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	limits, err := natsauthModule.GetLimits(e.Request.Context())
+	if err != nil {
+		return e.InternalServerError("Failed to get limits", err)
+	}
+
+	model := pages.LimitsModel{
+		RequestEvent: e,
+		Installation: installation,
+		Limits:       limits,
+	}
+
+	return layouts.WithBase(pages.Limits(model), layouts.BaseModel{
+		Title:       "NATS Tower - " + installation.Description,
+		Description: "Limits",
+		NavigationModel: layouts.NavigationModel{
+			Access:          utils.MustGetAccess(e),
+			CurrentLocation: "/ui/installations/" + installation.ID + "/limits",
+			InstallationID:  installation.ID,
+			Swap:            true,
+		},
+		RequestEvent: e,
+	}).Render(e.Request.Context(), e.Response)
+}
+
+// GetLimitModal renders the form for a new (limitID "new") or existing limit record
+func GetLimitModal(e *core.RequestEvent, installationID, limitID string) error {
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find installation",
+			slog.String("id", installationID),
+			slog.String("error", err.Error()))
+		return e.Redirect(http.StatusFound, "/installations")
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	limits := natsauth.UnlimitedLimits()
+	limits.Name = ""
+	if limitID != "new" {
+		natsauthModule := utils.MustGetNATSAuth(e)
+		limits, err = natsauthModule.GetLimitsByID(e.Request.Context(), limitID)
+		if err != nil {
+			return e.NotFoundError("Limits not found", err)
+		}
+	}
+
+	model := pages.LimitModalModel{
+		RequestEvent: e,
+		Installation: installation,
+		Limits:       limits,
+	}
+
+	return pages.LimitModal(model).Render(e.Request.Context(), e.Response)
+}
+
+type PostLimitRequest struct {
+	ID      string `json:"id" form:"id"`
+	Name    string `json:"name" form:"name"`
+	Default string `json:"default" form:"default"`
+
+	MaxConnections          string `json:"max_connections" form:"max_connections"`
+	MaxLeafNodeConnections  string `json:"max_leafnode_connections" form:"max_leafnode_connections"`
+	MaxSubscriptions        string `json:"max_subscriptions" form:"max_subscriptions"`
+	MaxData                 string `json:"max_data" form:"max_data"`
+	MaxPayload              string `json:"max_payload" form:"max_payload"`
+	MaxImports              string `json:"max_imports" form:"max_imports"`
+	MaxExports              string `json:"max_exports" form:"max_exports"`
+	DisallowWildcardExports string `json:"disallow_wildcard_exports" form:"disallow_wildcard_exports"`
+	DisallowBearer          string `json:"disallow_bearer" form:"disallow_bearer"`
+
+	JetStreamMaxMemory            string `json:"jetstream_max_memory" form:"jetstream_max_memory"`
+	JetStreamMaxDisk              string `json:"jetstream_max_disk" form:"jetstream_max_disk"`
+	JetStreamMaxStreams           string `json:"jetstream_max_streams" form:"jetstream_max_streams"`
+	JetStreamMaxConsumers         string `json:"jetstream_max_consumers" form:"jetstream_max_consumers"`
+	JetStreamMaxAckPending        string `json:"jetstream_max_ack_pending" form:"jetstream_max_ack_pending"`
+	JetStreamMemoryMaxStreamBytes string `json:"jetstream_memory_max_stream_bytes" form:"jetstream_memory_max_stream_bytes"`
+	JetStreamDiskMaxStreamBytes   string `json:"jetstream_disk_max_stream_bytes" form:"jetstream_disk_max_stream_bytes"`
+	JetStreamMaxBytesRequired     string `json:"jetstream_max_bytes_required" form:"jetstream_max_bytes_required"`
+
+	JetStreamTiered string `json:"jetstream_tiered" form:"jetstream_tiered"`
+	// JetStreamTiers are read from the jetstream_tiers.<tier>.<limit> form fields
+	JetStreamTiers map[string]PostLimitTier `json:"jetstream_tiers" form:"-"`
+}
+
+type PostLimitTier struct {
+	MaxMemory    string `json:"max_memory"`
+	MaxDisk      string `json:"max_disk"`
+	MaxStreams   string `json:"max_streams"`
+	MaxConsumers string `json:"max_consumers"`
+}
+
+// bindTiers reads the per tier form fields, which can not be bound to a struct directly
+func (req *PostLimitRequest) bindTiers(r *http.Request) {
+	if req.JetStreamTiers != nil {
+		return
+	}
+	req.JetStreamTiers = map[string]PostLimitTier{}
+	for _, tier := range natsauth.JetStreamTiers {
+		prefix := "jetstream_tiers." + tier + "."
+		req.JetStreamTiers[tier] = PostLimitTier{
+			MaxMemory:    r.PostFormValue(prefix + "max_memory"),
+			MaxDisk:      r.PostFormValue(prefix + "max_disk"),
+			MaxStreams:   r.PostFormValue(prefix + "max_streams"),
+			MaxConsumers: r.PostFormValue(prefix + "max_consumers"),
+		}
+	}
+}
+
+func (req *PostLimitRequest) Limits() (application.Limits, error) {
+	res := application.Limits{
+		ID:                        req.ID,
+		Name:                      strings.TrimSpace(req.Name),
+		Default:                   req.Default == "true",
+		DisallowWildcardExports:   req.DisallowWildcardExports == "true",
+		DisallowBearer:            req.DisallowBearer == "true",
+		JetStreamMaxBytesRequired: req.JetStreamMaxBytesRequired == "true",
+	}
+	if res.Name == "" {
+		return res, fmt.Errorf("Name is required")
+	}
+
+	err := parseLimitFields([]limitField{
+		{"Connections", req.MaxConnections, false, &res.MaxConnections},
+		{"Leaf node connections", req.MaxLeafNodeConnections, false, &res.MaxLeafNodeConnections},
+		{"Subscriptions", req.MaxSubscriptions, false, &res.MaxSubscriptions},
+		{"Data", req.MaxData, true, &res.MaxData},
+		{"Payload", req.MaxPayload, true, &res.MaxPayload},
+		{"Imports", req.MaxImports, false, &res.MaxImports},
+		{"Exports", req.MaxExports, false, &res.MaxExports},
+		{"JetStream memory", req.JetStreamMaxMemory, true, &res.JetStreamMaxMemory},
+		{"JetStream disk", req.JetStreamMaxDisk, true, &res.JetStreamMaxDisk},
+		{"Streams", req.JetStreamMaxStreams, false, &res.JetStreamMaxStreams},
+		{"Consumers", req.JetStreamMaxConsumers, false, &res.JetStreamMaxConsumers},
+		{"Max ack pending", req.JetStreamMaxAckPending, false, &res.JetStreamMaxAckPending},
+		{"Memory per stream", req.JetStreamMemoryMaxStreamBytes, true, &res.JetStreamMemoryMaxStreamBytes},
+		{"Disk per stream", req.JetStreamDiskMaxStreamBytes, true, &res.JetStreamDiskMaxStreamBytes},
+	})
+	if err != nil {
+		return res, err
+	}
+
+	if req.JetStreamTiered == "true" {
+		res.JetStreamTiers = map[string]application.JetStreamTierLimits{}
+		for tier, tierReq := range req.JetStreamTiers {
+			var tierLimits application.JetStreamTierLimits
+			err := parseLimitFields([]limitField{
+				{tier + " memory", tierReq.MaxMemory, true, &tierLimits.MaxMemory},
+				{tier + " disk", tierReq.MaxDisk, true, &tierLimits.MaxDisk},
+				{tier + " streams", tierReq.MaxStreams, false, &tierLimits.MaxStreams},
+				{tier + " consumers", tierReq.MaxConsumers, false, &tierLimits.MaxConsumers},
+			})
+			if err != nil {
+				return res, err
+			}
+			res.JetStreamTiers[tier] = tierLimits
+		}
+	}
+	return res, nil
+}
+
+type limitField struct {
+	label string
+	value string
+	bytes bool
+	res   *int64
+}
+
+func parseLimitFields(fields []limitField) error {
+	for _, field := range fields {
+		v, err := parseLimit(field.value, field.bytes)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field.label, err)
+		}
+		*field.res = v
+	}
+	return nil
+}
+
+// parseLimit parses a limit form value. Empty values and "unlimited" are -1.
+func parseLimit(s string, bytes bool) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "-1" || strings.EqualFold(s, "unlimited") {
+		return -1, nil
+	}
+	var v int64
+	var err error
+	if bytes {
+		v, err = utils.ParseBytes(s)
+		if err != nil {
+			return 0, fmt.Errorf("must be a size like 512MB")
+		}
+	} else {
+		v, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("must be a number")
+		}
+	}
+	if v < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return v, nil
+}
+
+func PostLimit(e *core.RequestEvent, installationID string) error {
+	var req PostLimitRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+	req.bindTiers(e.Request)
+
+	limits, err := req.Limits()
+	if err != nil {
+		return e.BadRequestError("Invalid request", err)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	_, err = natsauthModule.UpsertLimits(e.Request.Context(), limits)
+	if err != nil {
+		return e.BadRequestError("Failed to save limits", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/limits")
+	return GetLimits(e, installationID)
+}
+
+func DeleteLimit(e *core.RequestEvent, installationID, limitID string) error {
+	natsauthModule := utils.MustGetNATSAuth(e)
+	err := natsauthModule.DeleteLimits(e.Request.Context(), limitID)
+	if err != nil {
+		return e.InternalServerError("Failed to delete limits", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/limits")
+	return GetLimits(e, installationID)
+}
+
+type PostAccountLimitsRequest struct {
+	LimitsID string `json:"limits" form:"limits"`
+}
+
+func PostAccountLimits(e *core.RequestEvent, installationID, accountID string) error {
+	var req PostAccountLimitsRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	accountRecord, err := e.App.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		return e.InternalServerError("Failed to find account record", err)
+	}
+	if accountRecord.GetString("operator") != installationID {
+		return e.BadRequestError("Account does not belong to installation", nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	err = natsauthModule.SetAccountLimits(e.Request.Context(), accountID, req.LimitsID)
+	if err != nil {
+		return e.InternalServerError("Failed to set account limits", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/accounts/"+accountID)
+	return GetAccounts(e, installationID, accountID)
+}
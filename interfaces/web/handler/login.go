@@ -3,6 +3,7 @@ package handler
 import (
 	"log/slog"
 
+	"github.com/nats-tower/nats-tower/interfaces/store"
 	"github.com/nats-tower/nats-tower/interfaces/web/utils"
 	"github.com/nats-tower/nats-tower/interfaces/web/views/layouts"
 	"github.com/nats-tower/nats-tower/interfaces/web/views/pages"
@@ -10,7 +11,20 @@ import (
 )
 
 func GetLogin(e *core.RequestEvent) error {
-	return layouts.WithBase(pages.Login(), layouts.BaseModel{
+	return renderLogin(e, "")
+}
+
+func renderLogin(e *core.RequestEvent, loginError string) error {
+	model := pages.LoginModel{
+		PasswordLoginEnabled: true,
+		Error:                loginError,
+	}
+	if provider := utils.GetOIDCProvider(e); provider != nil {
+		model.OIDCName = provider.Name()
+		model.PasswordLoginEnabled = !provider.PasswordLoginDisabled()
+	}
+
+	return layouts.WithBase(pages.Login(model), layouts.BaseModel{
 		Title:        "NATS - Tower - Login",
 		Description:  "Login to NATS Tower",
 		NoNavigation: true,
@@ -38,6 +52,9 @@ func PostLogin(e *core.RequestEvent) error {
 	if err := req.valid(); err != nil {
 		return e.BadRequestError("Invalid request", err)
 	}
+	if provider := utils.GetOIDCProvider(e); provider != nil && provider.PasswordLoginDisabled() {
+		return e.ForbiddenError("Login with "+provider.Name()+" instead", nil)
+	}
 
 	// Login logic here
 	record, err := e.App.FindAuthRecordByEmail("users", req.Email)
@@ -51,17 +68,30 @@ func PostLogin(e *core.RequestEvent) error {
 		return e.UnauthorizedError("Invalid email or password", nil)
 	}
 
+	if store.IsMemberDisabled(record) {
+		e.App.Logger().Error("User is disabled", slog.String("email", req.Email))
+		return e.UnauthorizedError("Invalid email or password", nil)
+	}
+
 	err = utils.SetAuthToken(e, record)
 	if err != nil {
 		e.App.Logger().Error("Failed to set auth token", slog.String("error", err.Error()))
 		return e.InternalServerError("Failed to set auth token", err)
 	}
 
+	// the login is not part of the UI group, load what middlewares.RequireRole provides there
+	access, err := store.GetAccess(e.App, record)
+	if err != nil {
+		return e.InternalServerError("Failed to load roles", err)
+	}
+	e.Auth = record
+	e.Set("access", access)
+
 	prefs := utils.MustGetUserPreferences(record)
 
 	// if user has a last_installation_id, redirect to the respective installation page
 	// if not, redirect to installations page
-	if prefs.LastInstallationID == "" {
+	if prefs.LastInstallationID == "" || !access.InstallationVisible(prefs.LastInstallationID) {
 		e.Response.Header().Set("HX-Redirect", "/ui/installations")
 		return GetInstallations(e)
 	}
@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/store"
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+	"github.com/nats-tower/nats-tower/interfaces/web/views/layouts"
+	"github.com/nats-tower/nats-tower/interfaces/web/views/pages"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+)
+
+func GetMembers(e *core.RequestEvent, installationID string) error {
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find installation",
+			slog.String("id", installationID),
+			slog.String("error", err.Error()))
+		return e.Redirect(http.StatusFound, "/installations")
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	members, err := store.GetMembers(e.App)
+	if err != nil {
+		return e.InternalServerError("Failed to get users", err)
+	}
+
+	model := pages.MembersModel{
+		RequestEvent: e,
+		Installation: installation,
+		Members:      members,
+	}
+
+	return layouts.WithBase(pages.Members(model), layouts.BaseModel{
+		Title:       "NATS Tower - " + installation.Description,
+		Description: "Members",
+		NavigationModel: layouts.NavigationModel{
+			Access:          utils.MustGetAccess(e),
+			CurrentLocation: "/ui/installations/" + installation.ID + "/members",
+			InstallationID:  installation.ID,
+			Swap:            true,
+		},
+		RequestEvent: e,
+	}).Render(e.Request.Context(), e.Response)
+}
+
+func GetMemberInviteModal(e *core.RequestEvent, installationID string) error {
+	model, err := getRoleModalModel(e, installationID)
+	if err != nil {
+		return e.InternalServerError("Failed to get installation", err)
+	}
+
+	return pages.MemberInviteModal(model).Render(e.Request.Context(), e.Response)
+}
+
+type PostMemberRequest struct {
+	Email string `json:"email" form:"email"`
+	Role  string `json:"role" form:"role"`
+	Scope string `json:"scope" form:"scope"`
+}
+
+// PostMember invites a user and assigns the initial role
+func PostMember(e *core.RequestEvent, installationID string) error {
+	var req PostMemberRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	model, err := getRoleModalModel(e, installationID)
+	if err != nil {
+		return e.InternalServerError("Failed to get installation", err)
+	}
+
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		model.Error = "Email is invalid"
+		return pages.MemberInviteModal(model).Render(e.Request.Context(), e.Response)
+	}
+
+	token, member, err := store.InviteMember(e.App, req.Email)
+	if err != nil {
+		model.Error = err.Error()
+		return pages.MemberInviteModal(model).Render(e.Request.Context(), e.Response)
+	}
+
+	if req.Role != "" {
+		roleReq := PostRoleRequest{User: member.ID, Role: req.Role, Scope: req.Scope}
+		_, err = store.AddRoleBinding(e.App, roleReq.Binding(installationID))
+		if err != nil {
+			return e.InternalServerError("Failed to add role", err)
+		}
+	}
+
+	e.App.Logger().Info("Invited user",
+		slog.String("email", member.Email))
+
+	return renderSetupLinkModal(e, installationID, member, token, "invite")
+}
+
+// PostMemberReset replaces the password of a user with a link to set a new one
+func PostMemberReset(e *core.RequestEvent, installationID, memberID string) error {
+	token, member, err := store.ResetMemberPassword(e.App, memberID)
+	if err != nil {
+		return e.InternalServerError("Failed to reset password", err)
+	}
+
+	e.App.Logger().Info("Reset password of user",
+		slog.String("email", member.Email))
+
+	return renderSetupLinkModal(e, installationID, member, token, "reset")
+}
+
+// renderSetupLinkModal shows the setup link and sends it by mail, if SMTP is configured
+func renderSetupLinkModal(e *core.RequestEvent, installationID string, member *application.Member, token, purpose string) error {
+	link := setupLink(e, token)
+
+	model := pages.SetupLinkModalModel{
+		RequestEvent:   e,
+		InstallationID: installationID,
+		Member:         member,
+		Link:           link,
+		Purpose:        purpose,
+	}
+
+	if e.App.Settings().SMTP.Enabled {
+		err := sendSetupMail(e.App, member.Email, link, purpose)
+		if err != nil {
+			e.App.Logger().Error("Failed to send mail",
+				slog.String("email", member.Email),
+				slog.String("error", err.Error()))
+			model.MailError = err.Error()
+		} else {
+			model.Mailed = true
+		}
+	}
+
+	return pages.SetupLinkModal(model).Render(e.Request.Context(), e.Response)
+}
+
+// setupLink returns the absolute link to set a password, based on the application URL of the settings.
+// The host of the request is not used, it can be set by anyone sending the request.
+func setupLink(e *core.RequestEvent, token string) string {
+	return strings.TrimRight(e.App.Settings().Meta.AppURL, "/") + "/setup?token=" + url.QueryEscape(token)
+}
+
+func sendSetupMail(app core.App, email, link, purpose string) error {
+	subject := "Reset your NATS Tower password"
+	text := "Your password was reset. Set a new password to log in again:"
+	if purpose == "invite" {
+		subject = "You have been invited to NATS Tower"
+		text = "You have been invited to NATS Tower. Set a password to log in:"
+	}
+
+	return app.NewMailClient().Send(&mailer.Message{
+		From: mail.Address{
+			Name:    app.Settings().Meta.SenderName,
+			Address: app.Settings().Meta.SenderAddress,
+		},
+		To:      []mail.Address{{Address: email}},
+		Subject: subject,
+		HTML:    fmt.Sprintf(`<p>%s</p><p><a href="%s">%s</a></p>`, text, link, link),
+	})
+}
+
+func PostMemberDisabled(e *core.RequestEvent, installationID, memberID string, disabled bool) error {
+	if disabled && e.Auth.Id == memberID {
+		return e.BadRequestError("You cannot disable yourself", nil)
+	}
+
+	member, err := store.SetMemberDisabled(e.App, memberID, disabled)
+	if err != nil {
+		return e.InternalServerError("Failed to update user", err)
+	}
+
+	e.App.Logger().Info("Updated user",
+		slog.String("email", member.Email),
+		slog.Bool("disabled", member.Disabled))
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/members")
+	return GetMembers(e, installationID)
+}
+
+func GetSetup(e *core.RequestEvent) error {
+	token := e.Request.URL.Query().Get("token")
+	model := pages.SetupModel{
+		Token: token,
+	}
+	record, err := store.FindMemberBySetupToken(e.App, token)
+	if err != nil {
+		model.Error = application.ErrSetupTokenInvalid.Error()
+	} else {
+		model.Email = record.Email()
+	}
+
+	return layouts.WithBase(pages.Setup(model), layouts.BaseModel{
+		Title:        "NATS - Tower - Set password",
+		Description:  "Set your NATS Tower password",
+		NoNavigation: true,
+		NavigationModel: layouts.NavigationModel{
+			CurrentLocation: "/setup",
+		},
+		RequestEvent: e,
+	}).Render(e.Request.Context(), e.Response)
+}
+
+type PostSetupRequest struct {
+	Token           string `json:"token" form:"token"`
+	Password        string `json:"password" form:"password"`
+	PasswordConfirm string `json:"password_confirm" form:"password_confirm"`
+}
+
+// PostSetup sets the password of an invitation or password reset link and logs the user in
+func PostSetup(e *core.RequestEvent) error {
+	var req PostSetupRequest
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	model := pages.SetupModel{
+		Token: req.Token,
+	}
+	record, err := store.FindMemberBySetupToken(e.App, req.Token)
+	if err != nil {
+		model.Error = application.ErrSetupTokenInvalid.Error()
+		return pages.Setup(model).Render(e.Request.Context(), e.Response)
+	}
+	model.Email = record.Email()
+
+	switch {
+	case len(req.Password) < 8:
+		model.Error = "The password must have at least 8 characters"
+	case req.Password != req.PasswordConfirm:
+		model.Error = "The passwords do not match"
+	}
+	if model.Error != "" {
+		return pages.Setup(model).Render(e.Request.Context(), e.Response)
+	}
+
+	record, err = store.CompleteSetup(e.App, req.Token, req.Password)
+	if err != nil {
+		model.Error = err.Error()
+		return pages.Setup(model).Render(e.Request.Context(), e.Response)
+	}
+
+	err = utils.SetAuthToken(e, record)
+	if err != nil {
+		return e.InternalServerError("Failed to set auth token", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/")
+	return e.NoContent(http.StatusOK)
+}
@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func Test_setupLink(t *testing.T) {
+	app, natsModule := newTestModule(t)
+	app.Settings().Meta.AppURL = "https://tower.example.com/"
+
+	e := newTestRequestEvent(app, natsModule, http.MethodPost, "/ui/installations/i1/members")
+	e.Request.Host = "attacker.example.com"
+	e.Request.Header.Set("X-Forwarded-Proto", "http")
+
+	want := "https://tower.example.com/setup?token=a%2Bb"
+	if got := setupLink(e, "a+b"); got != want {
+		t.Errorf("setupLink() = %q, want %q", got, want)
+	}
+}
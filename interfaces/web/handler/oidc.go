@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"golang.org/x/oauth2"
+
+	"github.com/nats-tower/nats-tower/interfaces/oidc"
+	"github.com/nats-tower/nats-tower/interfaces/store"
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+)
+
+const (
+	oidcStateCookie    = "oidc_state"
+	oidcVerifierCookie = "oidc_verifier"
+	oidcCookiePath     = "/login/oidc"
+	// time to log in at the identity provider
+	oidcCookieMaxAge = 10 * time.Minute
+)
+
+func oidcRedirectURL(e *core.RequestEvent) string {
+	return utils.BaseURL(e) + "/login/oidc/callback"
+}
+
+func setOIDCCookie(e *core.RequestEvent, name, value string, maxAge time.Duration) {
+	e.SetCookie(&http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     oidcCookiePath,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		// the callback is a top level navigation from the identity provider
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// GetOIDCLogin redirects to the identity provider
+func GetOIDCLogin(e *core.RequestEvent) error {
+	provider := utils.GetOIDCProvider(e)
+	if provider == nil {
+		return e.NotFoundError("Single sign-on is not configured", nil)
+	}
+
+	state := security.RandomString(32)
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := provider.AuthURL(e.Request.Context(), oidcRedirectURL(e), state, verifier)
+	if err != nil {
+		e.App.Logger().Error("Failed to build OIDC auth URL", slog.String("error", err.Error()))
+		return renderLogin(e, "The identity provider is not available")
+	}
+
+	setOIDCCookie(e, oidcStateCookie, state, oidcCookieMaxAge)
+	setOIDCCookie(e, oidcVerifierCookie, verifier, oidcCookieMaxAge)
+	return e.Redirect(http.StatusFound, authURL)
+}
+
+// GetOIDCCallback logs in the user returned by the identity provider. Unknown users are created
+// and the roles of the mapped groups replace the roles of the previous login.
+func GetOIDCCallback(e *core.RequestEvent) error {
+	provider := utils.GetOIDCProvider(e)
+	if provider == nil {
+		return e.NotFoundError("Single sign-on is not configured", nil)
+	}
+
+	stateCookie, stateErr := e.Request.Cookie(oidcStateCookie)
+	verifierCookie, verifierErr := e.Request.Cookie(oidcVerifierCookie)
+	setOIDCCookie(e, oidcStateCookie, "", -1)
+	setOIDCCookie(e, oidcVerifierCookie, "", -1)
+
+	query := e.Request.URL.Query()
+	if query.Get("error") != "" {
+		e.App.Logger().Error("OIDC login failed",
+			slog.String("error", query.Get("error")),
+			slog.String("description", query.Get("error_description")))
+		return renderLogin(e, "The login was rejected by the identity provider")
+	}
+	if stateErr != nil || verifierErr != nil || !security.Equal(stateCookie.Value, query.Get("state")) {
+		return renderLogin(e, "The login expired, please try again")
+	}
+
+	identity, err := provider.Exchange(e.Request.Context(), oidcRedirectURL(e), query.Get("code"), verifierCookie.Value)
+	if err != nil {
+		e.App.Logger().Error("Failed to exchange OIDC code", slog.String("error", err.Error()))
+		return renderLogin(e, "The login at the identity provider failed")
+	}
+
+	record, created, err := store.FindOrCreateMember(e.App, identity.Email)
+	if err != nil {
+		return e.InternalServerError("Failed to find user", err)
+	}
+	if created {
+		e.App.Logger().Info("Created user of OIDC login",
+			slog.String("email", identity.Email),
+			slog.String("subject", identity.Subject))
+	}
+	if store.IsMemberDisabled(record) {
+		e.App.Logger().Error("User is disabled", slog.String("email", identity.Email))
+		return renderLogin(e, "Your user is disabled")
+	}
+
+	if provider.HasRoleMappings() {
+		bindings, err := provider.Bindings(e.App, identity.Groups)
+		if err != nil {
+			return e.InternalServerError("Failed to map groups to roles", err)
+		}
+		err = store.SyncRoleBindings(e.App, record.Id, oidc.SourceOIDC, bindings)
+		if err != nil {
+			return e.InternalServerError("Failed to update roles", err)
+		}
+	}
+
+	err = utils.SetAuthToken(e, record)
+	if err != nil {
+		return e.InternalServerError("Failed to set auth token", err)
+	}
+
+	e.App.Logger().Info("OIDC login",
+		slog.String("email", identity.Email),
+		slog.Any("groups", identity.Groups))
+	return e.Redirect(http.StatusFound, "/ui/")
+}
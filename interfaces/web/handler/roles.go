@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/store"
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+	"github.com/nats-tower/nats-tower/interfaces/web/views/layouts"
+	"github.com/nats-tower/nats-tower/interfaces/web/views/pages"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func GetRoles(e *core.RequestEvent, installationID string) error {
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find installation",
+			slog.String("id", installationID),
+			slog.String("error", err.Error()))
+		return e.Redirect(http.StatusFound, "/installations")
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	bindings, err := store.GetRoleBindings(e.App)
+	if err != nil {
+		return e.InternalServerError("Failed to get role bindings", err)
+	}
+
+	installationRecords, err := e.App.FindAllRecords("nats_auth_operators")
+	if err != nil {
+		return e.InternalServerError("Failed to find installations", err)
+	}
+	installationNames := map[string]string{}
+	for _, installationRecord := range installationRecords {
+		installationNames[installationRecord.Id] = installationRecord.GetString("description")
+		if installationNames[installationRecord.Id] == "" {
+			installationNames[installationRecord.Id] = installationRecord.GetString("url")
+		}
+	}
+
+	model := pages.RolesModel{
+		RequestEvent:      e,
+		Installation:      installation,
+		Bindings:          bindings,
+		InstallationNames: installationNames,
+	}
+
+	return layouts.WithBase(pages.Roles(model), layouts.BaseModel{
+		Title:       "NATS Tower - " + installation.Description,
+		Description: "Roles",
+		NavigationModel: layouts.NavigationModel{
+			Access:          utils.MustGetAccess(e),
+			CurrentLocation: "/ui/installations/" + installation.ID + "/roles",
+			InstallationID:  installation.ID,
+			Swap:            true,
+		},
+		RequestEvent: e,
+	}).Render(e.Request.Context(), e.Response)
+}
+
+func getRoleModalModel(e *core.RequestEvent, installationID string) (pages.RoleModalModel, error) {
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		return pages.RoleModalModel{}, err
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return pages.RoleModalModel{}, err
+	}
+
+	accountRecords, err := e.App.FindRecordsByFilter("nats_auth_accounts",
+		"operator = {:installationid}",
+		"name",
+		0,
+		0,
+		dbx.Params{"installationid": installation.ID})
+	if err != nil {
+		return pages.RoleModalModel{}, err
+	}
+
+	userRecords, err := e.App.FindRecordsByFilter("users", "", "email", 0, 0)
+	if err != nil {
+		return pages.RoleModalModel{}, err
+	}
+
+	model := pages.RoleModalModel{
+		RequestEvent: e,
+		Installation: installation,
+		Users:        userRecords,
+		UserID:       e.Request.URL.Query().Get("user"),
+	}
+	for _, accountRecord := range accountRecords {
+		account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(accountRecord, installation.URL)
+		if err != nil {
+			return pages.RoleModalModel{}, err
+		}
+		model.Accounts = append(model.Accounts, account)
+	}
+	return model, nil
+}
+
+func GetRoleModal(e *core.RequestEvent, installationID string) error {
+	model, err := getRoleModalModel(e, installationID)
+	if err != nil {
+		return e.InternalServerError("Failed to get installation", err)
+	}
+
+	return pages.RoleModal(model).Render(e.Request.Context(), e.Response)
+}
+
+type PostRoleRequest struct {
+	User  string `json:"user" form:"user"`
+	Role  string `json:"role" form:"role"`
+	Scope string `json:"scope" form:"scope"`
+}
+
+func (req *PostRoleRequest) Binding(installationID string) application.RoleBinding {
+	binding := application.RoleBinding{
+		UserID: req.User,
+		Role:   application.Role(req.Role),
+	}
+
+	switch {
+	case req.Scope == "installation":
+		binding.InstallationID = installationID
+	case strings.HasPrefix(req.Scope, "account:"):
+		binding.InstallationID = installationID
+		binding.AccountID = strings.TrimPrefix(req.Scope, "account:")
+	}
+	return binding
+}
+
+func PostRole(e *core.RequestEvent, installationID string) error {
+	var req PostRoleRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	binding, err := store.AddRoleBinding(e.App, req.Binding(installationID))
+	if err != nil {
+		model, modelErr := getRoleModalModel(e, installationID)
+		if modelErr != nil {
+			return e.InternalServerError("Failed to get installation", modelErr)
+		}
+		model.Error = err.Error()
+		return pages.RoleModal(model).Render(e.Request.Context(), e.Response)
+	}
+
+	e.App.Logger().Info("Added role",
+		slog.String("user", binding.UserEmail),
+		slog.String("role", string(binding.Role)))
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/roles")
+	return GetRoles(e, installationID)
+}
+
+func DeleteRole(e *core.RequestEvent, installationID, roleID string) error {
+	err := store.DeleteRoleBinding(e.App, roleID)
+	if err != nil {
+		return e.InternalServerError("Failed to delete role", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/roles")
+	return GetRoles(e, installationID)
+}
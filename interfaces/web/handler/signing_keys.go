@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type PostAccountSigningKeyRequest struct {
+	Description string `json:"description" form:"description"`
+	Scoped      bool   `json:"scoped" form:"scoped"`
+	Role        string `json:"role" form:"role"`
+	// permission template of scoped keys
+	PubAllow       string `json:"pub_allow" form:"pub_allow"`
+	PubDeny        string `json:"pub_deny" form:"pub_deny"`
+	SubAllow       string `json:"sub_allow" form:"sub_allow"`
+	SubDeny        string `json:"sub_deny" form:"sub_deny"`
+	AllowResponses string `json:"allow_responses" form:"allow_responses"`
+	ResponsesMax   string `json:"responses_max" form:"responses_max"`
+	ResponsesTTL   string `json:"responses_ttl" form:"responses_ttl"`
+}
+
+func (req *PostAccountSigningKeyRequest) Options() (application.AccountSigningKeyOptions, error) {
+	res := application.AccountSigningKeyOptions{
+		Description: req.Description,
+		Scoped:      req.Scoped,
+		Role:        req.Role,
+	}
+	if !req.Scoped {
+		return res, nil
+	}
+	if req.Role == "" {
+		return res, fmt.Errorf("Role is required for scoped signing keys")
+	}
+
+	permissions := PostUserPermissionsRequest{
+		PubAllow:       req.PubAllow,
+		PubDeny:        req.PubDeny,
+		SubAllow:       req.SubAllow,
+		SubDeny:        req.SubDeny,
+		AllowResponses: req.AllowResponses,
+		ResponsesMax:   req.ResponsesMax,
+		ResponsesTTL:   req.ResponsesTTL,
+	}
+	template, err := permissions.Permissions()
+	if err != nil {
+		return res, err
+	}
+	res.Template = template
+	return res, nil
+}
+
+func PostAccountSigningKey(e *core.RequestEvent, installationID, accountID string) error {
+	var req PostAccountSigningKeyRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	opts, err := req.Options()
+	if err != nil {
+		return e.BadRequestError("Invalid request", err)
+	}
+
+	accountRecord, err := e.App.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		return e.InternalServerError("Failed to find account record", err)
+	}
+	if accountRecord.GetString("operator") != installationID {
+		return e.BadRequestError("Account does not belong to installation", nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	_, err = natsauthModule.AddAccountSigningKey(e.Request.Context(), accountID, opts)
+	if err != nil {
+		return e.InternalServerError("Failed to add signing key", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/accounts/"+accountID)
+	return GetAccounts(e, installationID, accountID)
+}
+
+func DeleteAccountSigningKey(e *core.RequestEvent, installationID, accountID, keyID string) error {
+	keyRecord, err := e.App.FindRecordById("nats_auth_account_signing_keys", keyID)
+	if err != nil {
+		return e.InternalServerError("Failed to find signing key record", err)
+	}
+	if keyRecord.GetString("account") != accountID {
+		return e.BadRequestError("Signing key does not belong to account", nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	err = natsauthModule.DeleteAccountSigningKey(e.Request.Context(), keyID)
+	if err != nil {
+		return e.BadRequestError("Failed to delete signing key", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/accounts/"+accountID)
+	return GetAccounts(e, installationID, accountID)
+}
+
+// PostAccountSigningKeyRotate rotates a signing key of the account, an empty keyID rotates the account signing key
+func PostAccountSigningKeyRotate(e *core.RequestEvent, installationID, accountID, keyID string) error {
+	accountRecord, err := e.App.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		return e.InternalServerError("Failed to find account record", err)
+	}
+	if accountRecord.GetString("operator") != installationID {
+		return e.BadRequestError("Account does not belong to installation", nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	err = natsauthModule.RotateAccountSigningKey(e.Request.Context(), accountID, keyID)
+	if err != nil {
+		return e.InternalServerError("Failed to rotate signing key", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/accounts/"+accountID)
+	return GetAccounts(e, installationID, accountID)
+}
+
+type PostUserSigningKeyRequest struct {
+	SigningKey string `json:"signing_key" form:"signing_key"`
+}
+
+func PostUserSigningKey(e *core.RequestEvent, installationID, accountID, userID string) error {
+	var req PostUserSigningKeyRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	userRecord, err := e.App.FindRecordById("nats_auth_users", userID)
+	if err != nil {
+		return e.InternalServerError("Failed to find user record", err)
+	}
+	if userRecord.GetString("account") != accountID {
+		return e.NotFoundError("User not found", nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	_, err = natsauthModule.SetUserSigningKey(e.Request.Context(), userID, req.SigningKey)
+	if err != nil {
+		return e.InternalServerError("Failed to set user signing key", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/accounts/"+accountID+"/users")
+	return GetUsers(e, installationID, accountID)
+}
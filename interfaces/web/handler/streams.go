@@ -9,7 +9,6 @@ import (
 	"strings"
 
 	"github.com/nats-io/nats-server/v2/server"
-	"github.com/nats-io/nats.go"
 	"github.com/nats-tower/nats-tower/interfaces/web/utils"
 	"github.com/nats-tower/nats-tower/interfaces/web/views/layouts"
 	"github.com/nats-tower/nats-tower/interfaces/web/views/pages"
@@ -26,7 +25,7 @@ func GetStreams(e *core.RequestEvent, installationID, accountID string) error {
 		return e.Redirect(http.StatusFound, "/installations")
 	}
 
-	installation, err := natsauth.GetOperatorFromRecord(record)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
 	if err != nil {
 		return e.InternalServerError("Failed to get operator from record", err)
 	}
@@ -36,7 +35,7 @@ func GetStreams(e *core.RequestEvent, installationID, accountID string) error {
 		return e.InternalServerError("Failed to find accounts", err)
 	}
 
-	account, err := natsauth.GetAccountFromRecord(accountRecord, installation.URL)
+	account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(accountRecord, installation.URL)
 	if err != nil {
 		return e.InternalServerError("Failed to get account from record", err)
 	}
@@ -57,6 +56,7 @@ func GetStreams(e *core.RequestEvent, installationID, accountID string) error {
 		Title:       "NATS Tower - " + installation.Description,
 		Description: "blabla",
 		NavigationModel: layouts.NavigationModel{
+			Access:          utils.MustGetAccess(e),
 			CurrentLocation: "/ui/installations/" + installation.ID + "/accounts/" + account.ID + "/streams",
 			InstallationID:  installation.ID,
 			AccountID:       account.ID,
@@ -82,14 +82,6 @@ func StreamStreamList(e *core.RequestEvent, eventChannel chan *SSEEvent) {
 	}
 	natsauthModule := utils.MustGetNATSAuth(e)
 
-	sysUserAuth, err := natsauthModule.GetSysUserByID(e.Request.Context(), installationID)
-	if err != nil {
-		WriteSSEEvent(e.Request.Context(), eventChannel, &SSEEvent{
-			Error: err,
-		})
-		return
-	}
-
 	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
 	if err != nil {
 		e.App.Logger().Error("Failed to find installation",
@@ -101,7 +93,7 @@ func StreamStreamList(e *core.RequestEvent, eventChannel chan *SSEEvent) {
 		return
 	}
 
-	installation, err := natsauth.GetOperatorFromRecord(record)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
 	if err != nil {
 		WriteSSEEvent(e.Request.Context(), eventChannel, &SSEEvent{
 			Error: err,
@@ -117,7 +109,7 @@ func StreamStreamList(e *core.RequestEvent, eventChannel chan *SSEEvent) {
 		return
 	}
 
-	account, err := natsauth.GetAccountFromRecord(accountRecord, installation.URL)
+	account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(accountRecord, installation.URL)
 	if err != nil {
 		WriteSSEEvent(e.Request.Context(), eventChannel, &SSEEvent{
 			Error: err,
@@ -125,14 +117,13 @@ func StreamStreamList(e *core.RequestEvent, eventChannel chan *SSEEvent) {
 		return
 	}
 
-	nc, err := nats.Connect(sysUserAuth.URL, nats.UserJWTAndSeed(sysUserAuth.JWT, sysUserAuth.Seed))
+	nc, err := natsauthModule.SysConn(e.Request.Context(), installationID)
 	if err != nil {
 		WriteSSEEvent(e.Request.Context(), eventChannel, &SSEEvent{
 			Error: err,
 		})
 		return
 	}
-	defer nc.Close()
 
 	msgChannel, err := natsauth.RequestMultipleChannel(e.Request.Context(),
 		nc,
@@ -212,14 +203,6 @@ func StreamStreamCount(e *core.RequestEvent, eventChannel chan *SSEEvent) {
 	}
 	natsauthModule := utils.MustGetNATSAuth(e)
 
-	sysUserAuth, err := natsauthModule.GetSysUserByID(e.Request.Context(), installationID)
-	if err != nil {
-		WriteSSEEvent(e.Request.Context(), eventChannel, &SSEEvent{
-			Error: err,
-		})
-		return
-	}
-
 	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
 	if err != nil {
 		e.App.Logger().Error("Failed to find installation",
@@ -231,7 +214,7 @@ func StreamStreamCount(e *core.RequestEvent, eventChannel chan *SSEEvent) {
 		return
 	}
 
-	installation, err := natsauth.GetOperatorFromRecord(record)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
 	if err != nil {
 		WriteSSEEvent(e.Request.Context(), eventChannel, &SSEEvent{
 			Error: err,
@@ -247,7 +230,7 @@ func StreamStreamCount(e *core.RequestEvent, eventChannel chan *SSEEvent) {
 		return
 	}
 
-	account, err := natsauth.GetAccountFromRecord(accountRecord, installation.URL)
+	account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(accountRecord, installation.URL)
 	if err != nil {
 		WriteSSEEvent(e.Request.Context(), eventChannel, &SSEEvent{
 			Error: err,
@@ -255,14 +238,13 @@ func StreamStreamCount(e *core.RequestEvent, eventChannel chan *SSEEvent) {
 		return
 	}
 
-	nc, err := nats.Connect(sysUserAuth.URL, nats.UserJWTAndSeed(sysUserAuth.JWT, sysUserAuth.Seed))
+	nc, err := natsauthModule.SysConn(e.Request.Context(), installationID)
 	if err != nil {
 		WriteSSEEvent(e.Request.Context(), eventChannel, &SSEEvent{
 			Error: err,
 		})
 		return
 	}
-	defer nc.Close()
 
 	msgChannel, err := natsauth.RequestMultipleChannel(e.Request.Context(),
 		nc,
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/nats-tower/nats-tower/application"
 	"github.com/nats-tower/nats-tower/interfaces/web/utils"
@@ -23,7 +26,7 @@ func GetUsers(e *core.RequestEvent, installationID, accountID string) error {
 		return e.Redirect(http.StatusFound, "/installations")
 	}
 
-	installation, err := natsauth.GetOperatorFromRecord(record)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
 	if err != nil {
 		return e.InternalServerError("Failed to get operator from record", err)
 	}
@@ -33,7 +36,7 @@ func GetUsers(e *core.RequestEvent, installationID, accountID string) error {
 		return e.InternalServerError("Failed to find accounts", err)
 	}
 
-	account, err := natsauth.GetAccountFromRecord(accountRecord, installation.URL)
+	account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(accountRecord, installation.URL)
 	if err != nil {
 		return e.InternalServerError("Failed to get account from record", err)
 	}
@@ -52,7 +55,7 @@ func GetUsers(e *core.RequestEvent, installationID, accountID string) error {
 	}
 
 	for _, userRecord := range users {
-		user, err := natsauth.GetUserFromRecord(userRecord, installation.URL)
+		user, err := utils.MustGetNATSAuth(e).GetUserFromRecord(userRecord, installation.URL)
 		if err != nil {
 			return e.InternalServerError("Failed to get user from record", err)
 		}
@@ -63,6 +66,7 @@ func GetUsers(e *core.RequestEvent, installationID, accountID string) error {
 		Title:       "NATS Tower - " + installation.Description,
 		Description: "blabla",
 		NavigationModel: layouts.NavigationModel{
+			Access:          utils.MustGetAccess(e),
 			CurrentLocation: "/ui/installations/" + installation.ID + "/accounts/" + account.ID + "/users",
 			InstallationID:  installation.ID,
 			AccountID:       account.ID,
@@ -75,15 +79,35 @@ func GetUsers(e *core.RequestEvent, installationID, accountID string) error {
 type PostUserRequest struct {
 	Name        string `json:"name" form:"name"`
 	Description string `json:"description" form:"description"`
+	TTL         string `json:"ttl" form:"ttl"`
 }
 
 func (req *PostUserRequest) Valid() error {
 	if req.Name == "" {
 		return fmt.Errorf("Name is required")
 	}
+	if _, err := parseTTL(req.TTL); err != nil {
+		return err
+	}
 	return nil
 }
 
+// parseTTL parses the lifetime of user credentials, empty means no expiry
+func parseTTL(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("Lifetime '%s' must look like 720h", s)
+	}
+	if ttl < 0 {
+		return 0, fmt.Errorf("Lifetime must not be negative")
+	}
+	return ttl, nil
+}
+
 func PostUser(e *core.RequestEvent, installationID, accountID string) error {
 	var req PostUserRequest
 	err := e.BindBody(&req)
@@ -94,6 +118,7 @@ func PostUser(e *core.RequestEvent, installationID, accountID string) error {
 	if err := req.Valid(); err != nil {
 		return e.BadRequestError("Invalid request", err)
 	}
+	ttl, _ := parseTTL(req.TTL)
 
 	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
 	if err != nil {
@@ -103,7 +128,7 @@ func PostUser(e *core.RequestEvent, installationID, accountID string) error {
 		return e.Redirect(http.StatusFound, "/installations")
 	}
 
-	installation, err := natsauth.GetOperatorFromRecord(record)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
 	if err != nil {
 		return e.InternalServerError("Failed to get operator from record", err)
 	}
@@ -116,7 +141,7 @@ func PostUser(e *core.RequestEvent, installationID, accountID string) error {
 		return e.Redirect(http.StatusFound, "/installations")
 	}
 
-	account, err := natsauth.GetAccountFromRecord(accountRecord, installation.URL)
+	account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(accountRecord, installation.URL)
 	if err != nil {
 		return e.InternalServerError("Failed to get operator from record", err)
 	}
@@ -127,7 +152,9 @@ func PostUser(e *core.RequestEvent, installationID, accountID string) error {
 		account.Name,
 		req.Name,
 		req.Description,
-		application.UserOptions{})
+		application.UserOptions{
+			TTL: ttl,
+		})
 	if err != nil {
 		return e.InternalServerError("Failed to upsert user auth", err)
 	}
@@ -146,7 +173,7 @@ func GetDeleteUserModal(e *core.RequestEvent, installationID, accountID, userID
 		return e.Redirect(http.StatusFound, "/installations")
 	}
 
-	installation, err := natsauth.GetOperatorFromRecord(record)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
 	if err != nil {
 		return e.InternalServerError("Failed to get operator from record", err)
 	}
@@ -159,7 +186,7 @@ func GetDeleteUserModal(e *core.RequestEvent, installationID, accountID, userID
 		return e.InternalServerError("Failed to find account record", err)
 	}
 
-	account, err := natsauth.GetAccountFromRecord(accountRecord, installation.URL)
+	account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(accountRecord, installation.URL)
 	if err != nil {
 		return e.InternalServerError("Failed to get account from record", err)
 	}
@@ -172,7 +199,11 @@ func GetDeleteUserModal(e *core.RequestEvent, installationID, accountID, userID
 		return e.InternalServerError("Failed to find user record", err)
 	}
 
-	user, err := natsauth.GetUserFromRecord(userRecord, installation.URL)
+	if userRecord.GetString("account") != accountID {
+		return e.NotFoundError("User not found", nil)
+	}
+
+	user, err := utils.MustGetNATSAuth(e).GetUserFromRecord(userRecord, installation.URL)
 	if err != nil {
 		return e.InternalServerError("Failed to get user from record", err)
 	}
@@ -198,7 +229,11 @@ func DeleteUser(e *core.RequestEvent, installationID, accountID, userID string)
 		return e.InternalServerError("Failed to find user record", err)
 	}
 
-	err = e.App.Delete(record)
+	if record.GetString("account") != accountID {
+		return e.NotFoundError("User not found", nil)
+	}
+
+	err = e.App.DeleteWithContext(e.Request.Context(), record)
 	if err != nil {
 		return e.InternalServerError("Failed to delete user", err)
 	}
@@ -216,7 +251,7 @@ func GetUserCredentialsModal(e *core.RequestEvent, installationID, accountID, us
 		return e.Redirect(http.StatusFound, "/installations")
 	}
 
-	installation, err := natsauth.GetOperatorFromRecord(record)
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
 	if err != nil {
 		return e.InternalServerError("Failed to get operator from record", err)
 	}
@@ -229,15 +264,412 @@ func GetUserCredentialsModal(e *core.RequestEvent, installationID, accountID, us
 		return e.InternalServerError("Failed to find user record", err)
 	}
 
-	user, err := natsauth.GetUserFromRecord(userRecord, installation.URL)
+	if userRecord.GetString("account") != accountID {
+		return e.NotFoundError("User not found", nil)
+	}
+
+	user, err := utils.MustGetNATSAuth(e).GetUserFromRecord(userRecord, installation.URL)
 	if err != nil {
 		return e.InternalServerError("Failed to get user from record", err)
 	}
 
+	accountRecord, err := e.App.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find account",
+			slog.String("id", accountID),
+			slog.String("error", err.Error()))
+		return e.InternalServerError("Failed to find account record", err)
+	}
+
+	account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(accountRecord, installation.URL)
+	if err != nil {
+		return e.InternalServerError("Failed to get account from record", err)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	credentials, err := natsauthModule.GetUserCredentials(e.Request.Context(), user.ID)
+	if err != nil {
+		return e.InternalServerError("Failed to get user credentials", err)
+	}
+
 	model := pages.UserCredentialsModalModel{
 		RequestEvent: e,
+		Installation: installation,
+		Account:      account,
 		User:         user,
+		Credentials:  credentials,
 	}
 
 	return pages.UserCredentialsModal(model).Render(e.Request.Context(), e.Response)
 }
+
+type PostUserTTLRequest struct {
+	TTL string `json:"ttl" form:"ttl"`
+}
+
+func PostUserTTL(e *core.RequestEvent, installationID, accountID, userID string) error {
+	var req PostUserTTLRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	ttl, err := parseTTL(req.TTL)
+	if err != nil {
+		return e.BadRequestError("Invalid request", err)
+	}
+
+	userRecord, err := e.App.FindRecordById("nats_auth_users", userID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find user",
+			slog.String("id", userID),
+			slog.String("error", err.Error()))
+		return e.InternalServerError("Failed to find user record", err)
+	}
+
+	if userRecord.GetString("account") != accountID {
+		return e.NotFoundError("User not found", nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	_, err = natsauthModule.SetUserTTL(e.Request.Context(), userRecord.Id, ttl)
+	if err != nil {
+		return e.InternalServerError("Failed to set user credential lifetime", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/accounts/"+accountID+"/users")
+	return GetUsers(e, installationID, accountID)
+}
+
+func PostUserRotate(e *core.RequestEvent, installationID, accountID, userID string) error {
+	userRecord, err := e.App.FindRecordById("nats_auth_users", userID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find user",
+			slog.String("id", userID),
+			slog.String("error", err.Error()))
+		return e.InternalServerError("Failed to find user record", err)
+	}
+
+	if userRecord.GetString("account") != accountID {
+		return e.NotFoundError("User not found", nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	_, err = natsauthModule.RotateUserKey(e.Request.Context(), userRecord.Id)
+	if err != nil {
+		return e.InternalServerError("Failed to rotate user key", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/accounts/"+accountID+"/users")
+	return GetUsers(e, installationID, accountID)
+}
+
+func GetUserPermissionsModal(e *core.RequestEvent, installationID, accountID, userID string) error {
+
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find installation",
+			slog.String("id", installationID),
+			slog.String("error", err.Error()))
+		return e.Redirect(http.StatusFound, "/installations")
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	accountRecord, err := e.App.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find account",
+			slog.String("id", accountID),
+			slog.String("error", err.Error()))
+		return e.InternalServerError("Failed to find account record", err)
+	}
+
+	account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(accountRecord, installation.URL)
+	if err != nil {
+		return e.InternalServerError("Failed to get account from record", err)
+	}
+
+	userRecord, err := e.App.FindRecordById("nats_auth_users", userID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find user",
+			slog.String("id", userID),
+			slog.String("error", err.Error()))
+		return e.InternalServerError("Failed to find user record", err)
+	}
+
+	if userRecord.GetString("account") != accountID {
+		return e.NotFoundError("User not found", nil)
+	}
+
+	user, err := utils.MustGetNATSAuth(e).GetUserFromRecord(userRecord, installation.URL)
+	if err != nil {
+		return e.InternalServerError("Failed to get user from record", err)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	permissions, err := natsauthModule.GetUserPermissions(e.Request.Context(), user.ID)
+	if err != nil && err != natsauth.ErrNotFound {
+		return e.InternalServerError("Failed to get user permissions", err)
+	}
+	if permissions == nil {
+		permissions = &application.UserPermissions{
+			UserID: user.ID,
+		}
+	}
+
+	signingKeys, err := natsauthModule.GetAccountSigningKeys(e.Request.Context(), account.ID)
+	if err != nil {
+		return e.InternalServerError("Failed to get account signing keys", err)
+	}
+
+	model := pages.UserPermissionsModalModel{
+		RequestEvent: e,
+		Installation: installation,
+		Account:      account,
+		User:         user,
+		Permissions:  permissions,
+		SigningKeys:  signingKeys,
+	}
+
+	return pages.UserPermissionsModal(model).Render(e.Request.Context(), e.Response)
+}
+
+type PostUserPermissionsRequest struct {
+	PubAllow       string `json:"pub_allow" form:"pub_allow"`
+	PubDeny        string `json:"pub_deny" form:"pub_deny"`
+	SubAllow       string `json:"sub_allow" form:"sub_allow"`
+	SubDeny        string `json:"sub_deny" form:"sub_deny"`
+	AllowResponses string `json:"allow_responses" form:"allow_responses"`
+	ResponsesMax   string `json:"responses_max" form:"responses_max"`
+	ResponsesTTL   string `json:"responses_ttl" form:"responses_ttl"`
+}
+
+func (req *PostUserPermissionsRequest) Permissions() (application.UserPermissions, error) {
+	res := application.UserPermissions{
+		PubAllow:       splitLines(req.PubAllow),
+		PubDeny:        splitLines(req.PubDeny),
+		SubAllow:       splitLines(req.SubAllow),
+		SubDeny:        splitLines(req.SubDeny),
+		AllowResponses: req.AllowResponses == "true",
+	}
+
+	for _, subjects := range [][]string{res.PubAllow, res.PubDeny, res.SubAllow, res.SubDeny} {
+		for _, subject := range subjects {
+			if strings.ContainsAny(subject, " \t") {
+				return res, fmt.Errorf("Subject '%s' must not contain whitespace", subject)
+			}
+		}
+	}
+
+	if req.ResponsesMax != "" {
+		max, err := strconv.Atoi(req.ResponsesMax)
+		if err != nil {
+			return res, fmt.Errorf("Max responses must be a number")
+		}
+		res.ResponsesMax = max
+	}
+
+	if req.ResponsesTTL != "" {
+		ttl, err := time.ParseDuration(req.ResponsesTTL)
+		if err != nil {
+			return res, fmt.Errorf("Response TTL must be a duration like 5s")
+		}
+		res.ResponsesTTL = ttl
+	}
+	return res, nil
+}
+
+// splitLines turns the content of a textarea into a list (one entry per line)
+func splitLines(s string) []string {
+	var res []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		res = append(res, line)
+	}
+	return res
+}
+
+func PostUserPermissions(e *core.RequestEvent, installationID, accountID, userID string) error {
+	var req PostUserPermissionsRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	permissions, err := req.Permissions()
+	if err != nil {
+		return e.BadRequestError("Invalid request", err)
+	}
+
+	userRecord, err := e.App.FindRecordById("nats_auth_users", userID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find user",
+			slog.String("id", userID),
+			slog.String("error", err.Error()))
+		return e.InternalServerError("Failed to find user record", err)
+	}
+
+	if userRecord.GetString("account") != accountID {
+		return e.NotFoundError("User not found", nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	_, err = natsauthModule.UpsertUserPermissions(e.Request.Context(), userRecord.Id, permissions)
+	if err != nil {
+		return e.InternalServerError("Failed to upsert user permissions", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/accounts/"+accountID+"/users")
+	return GetUsers(e, installationID, accountID)
+}
+
+func GetUserLimitsModal(e *core.RequestEvent, installationID, accountID, userID string) error {
+
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find installation",
+			slog.String("id", installationID),
+			slog.String("error", err.Error()))
+		return e.Redirect(http.StatusFound, "/installations")
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	accountRecord, err := e.App.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find account",
+			slog.String("id", accountID),
+			slog.String("error", err.Error()))
+		return e.InternalServerError("Failed to find account record", err)
+	}
+
+	account, err := utils.MustGetNATSAuth(e).GetAccountFromRecord(accountRecord, installation.URL)
+	if err != nil {
+		return e.InternalServerError("Failed to get account from record", err)
+	}
+
+	userRecord, err := e.App.FindRecordById("nats_auth_users", userID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find user",
+			slog.String("id", userID),
+			slog.String("error", err.Error()))
+		return e.InternalServerError("Failed to find user record", err)
+	}
+
+	if userRecord.GetString("account") != accountID {
+		return e.NotFoundError("User not found", nil)
+	}
+
+	user, err := utils.MustGetNATSAuth(e).GetUserFromRecord(userRecord, installation.URL)
+	if err != nil {
+		return e.InternalServerError("Failed to get user from record", err)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	limits, err := natsauthModule.GetUserLimits(e.Request.Context(), user.ID)
+	if err != nil && err != natsauth.ErrNotFound {
+		return e.InternalServerError("Failed to get user limits", err)
+	}
+	if limits == nil {
+		limits = natsauth.UnlimitedUserLimits()
+		limits.UserID = user.ID
+	}
+
+	model := pages.UserLimitsModalModel{
+		RequestEvent:    e,
+		Installation:    installation,
+		Account:         account,
+		User:            user,
+		Limits:          limits,
+		ConnectionTypes: natsauth.UserConnectionTypes,
+	}
+
+	return pages.UserLimitsModal(model).Render(e.Request.Context(), e.Response)
+}
+
+type PostUserLimitsRequest struct {
+	MaxSubscriptions string   `json:"max_subscriptions" form:"max_subscriptions"`
+	MaxData          string   `json:"max_data" form:"max_data"`
+	MaxPayload       string   `json:"max_payload" form:"max_payload"`
+	ConnectionTypes  []string `json:"connection_types" form:"connection_types"`
+	Src              string   `json:"src" form:"src"`
+	Times            string   `json:"times" form:"times"`
+	Locale           string   `json:"locale" form:"locale"`
+}
+
+func (req *PostUserLimitsRequest) Limits() (application.UserLimits, error) {
+	res := application.UserLimits{
+		ConnectionTypes: req.ConnectionTypes,
+		Src:             splitLines(req.Src),
+		Locale:          strings.TrimSpace(req.Locale),
+	}
+
+	err := parseLimitFields([]limitField{
+		{"Subscriptions", req.MaxSubscriptions, false, &res.MaxSubscriptions},
+		{"Data", req.MaxData, true, &res.MaxData},
+		{"Payload", req.MaxPayload, true, &res.MaxPayload},
+	})
+	if err != nil {
+		return res, err
+	}
+
+	// one time window per line, e.g. 08:00:00-18:00:00
+	for _, line := range splitLines(req.Times) {
+		start, end, ok := strings.Cut(line, "-")
+		if !ok {
+			return res, fmt.Errorf("Time window '%s' must look like 08:00:00-18:00:00", line)
+		}
+		res.Times = append(res.Times, application.UserTimeRange{
+			Start: strings.TrimSpace(start),
+			End:   strings.TrimSpace(end),
+		})
+	}
+
+	if err := natsauth.ValidateUserLimits(res); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+func PostUserLimits(e *core.RequestEvent, installationID, accountID, userID string) error {
+	var req PostUserLimitsRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	limits, err := req.Limits()
+	if err != nil {
+		return e.BadRequestError("Invalid request", err)
+	}
+
+	userRecord, err := e.App.FindRecordById("nats_auth_users", userID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find user",
+			slog.String("id", userID),
+			slog.String("error", err.Error()))
+		return e.InternalServerError("Failed to find user record", err)
+	}
+
+	if userRecord.GetString("account") != accountID {
+		return e.NotFoundError("User not found", nil)
+	}
+
+	natsauthModule := utils.MustGetNATSAuth(e)
+	_, err = natsauthModule.UpsertUserLimits(e.Request.Context(), userRecord.Id, limits)
+	if err != nil {
+		return e.InternalServerError("Failed to upsert user limits", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/accounts/"+accountID+"/users")
+	return GetUsers(e, installationID, accountID)
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/natsauth"
+	"github.com/pocketbase/pocketbase/core"
+	_ "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+const testInstallationURL = "nats://127.0.0.1:4999"
+
+func newTestModule(t *testing.T) (core.App, *natsauth.NATSAuthModule) {
+	app := core.NewBaseApp(core.BaseAppConfig{DataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap app: %v", err)
+	}
+
+	// the app is not reset, the background jobs of the module may still be running a query after the cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	natsModule, err := natsauth.CreateNATSAuthModule(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		natsauth.NATSAuthModuleConfig{
+			App:                    app,
+			BootstrapURLs:          []string{testInstallationURL},
+			DisableNATSCLIContexts: true,
+		})
+	if err != nil {
+		t.Fatalf("Failed to create NatsModule: %v", err)
+	}
+	return app, natsModule
+}
+
+func newTestRequestEvent(app core.App, natsModule *natsauth.NATSAuthModule, method, path string) *core.RequestEvent {
+	e := &core.RequestEvent{App: app}
+	e.Request = httptest.NewRequest(method, path, nil)
+	e.Response = httptest.NewRecorder()
+	e.Set("natsauth", natsModule)
+	return e
+}
+
+func Test_UserHandlersCheckAccount(t *testing.T) {
+	app, natsModule := newTestModule(t)
+	ctx := context.Background()
+
+	operator, err := natsModule.GetOperator(ctx, testInstallationURL)
+	if err != nil {
+		t.Fatalf("Failed to GetOperator: %v", err)
+	}
+	sysUser, err := natsModule.GetSysUserByID(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to GetSysUser: %v", err)
+	}
+	account, err := natsModule.UpsertAccountAuth(ctx, testInstallationURL, "A", "", natsauth.UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	user, err := natsModule.UpsertUserAuth(ctx, testInstallationURL, "A", "a-user", "", application.UserOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertUserAuth: %v", err)
+	}
+
+	handlers := map[string]func(e *core.RequestEvent, installationID, accountID, userID string) error{
+		"GetUserCredentialsModal": GetUserCredentialsModal,
+		"GetDeleteUserModal":      GetDeleteUserModal,
+		"GetUserPermissionsModal": GetUserPermissionsModal,
+		"GetUserLimitsModal":      GetUserLimitsModal,
+		"DeleteUser":              DeleteUser,
+	}
+	for name, handle := range handlers {
+		t.Run(name, func(t *testing.T) {
+			// the SYS user does not belong to account A
+			e := newTestRequestEvent(app, natsModule, http.MethodGet, "/")
+			err := handle(e, operator.ID, account.ID, sysUser.ID)
+			var apiErr *router.ApiError
+			if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+				t.Fatalf("Expected not found for a user of another account, got %v", err)
+			}
+		})
+	}
+
+	if _, err := app.FindRecordById("nats_auth_users", sysUser.ID); err != nil {
+		t.Fatalf("SYS user was deleted through another account: %v", err)
+	}
+
+	e := newTestRequestEvent(app, natsModule, http.MethodGet, "/")
+	if err := GetUserCredentialsModal(e, operator.ID, account.ID, user.ID); err != nil {
+		t.Fatalf("Failed to show the credentials of a user of the account: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+	"github.com/nats-tower/nats-tower/interfaces/web/views/layouts"
+	"github.com/nats-tower/nats-tower/interfaces/web/views/pages"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// webhookDeliveriesPageSize is the number of deliveries shown for a webhook
+const webhookDeliveriesPageSize = 100
+
+func GetWebhooks(e *core.RequestEvent, installationID string) error {
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find installation",
+			slog.String("id", installationID),
+			slog.String("error", err.Error()))
+		return e.Redirect(http.StatusFound, "/installations")
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	webhooks, err := utils.MustGetNATSAuth(e).GetWebhooks(e.Request.Context())
+	if err != nil {
+		return e.InternalServerError("Failed to get webhooks", err)
+	}
+
+	model := pages.WebhooksModel{
+		RequestEvent: e,
+		Installation: installation,
+		Webhooks:     webhooks,
+	}
+
+	return layouts.WithBase(pages.Webhooks(model), layouts.BaseModel{
+		Title:       "NATS Tower - " + installation.Description,
+		Description: "Webhooks",
+		NavigationModel: layouts.NavigationModel{
+			Access:          utils.MustGetAccess(e),
+			CurrentLocation: "/ui/installations/" + installation.ID + "/webhooks",
+			InstallationID:  installation.ID,
+			Swap:            true,
+		},
+		RequestEvent: e,
+	}).Render(e.Request.Context(), e.Response)
+}
+
+func GetWebhookModal(e *core.RequestEvent, installationID string) error {
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		return e.InternalServerError("Failed to get installation", err)
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	return pages.WebhookModal(pages.WebhookModalModel{
+		RequestEvent: e,
+		Installation: installation,
+	}).Render(e.Request.Context(), e.Response)
+}
+
+type PostWebhookRequest struct {
+	Name   string   `json:"name" form:"name"`
+	URL    string   `json:"url" form:"url"`
+	Events []string `json:"events" form:"events"`
+}
+
+func (req *PostWebhookRequest) Options() application.WebhookOptions {
+	opts := application.WebhookOptions{
+		Name: strings.TrimSpace(req.Name),
+		URL:  strings.TrimSpace(req.URL),
+	}
+	for _, event := range req.Events {
+		opts.Events = append(opts.Events, application.WebhookEvent(event))
+	}
+	return opts
+}
+
+// PostWebhook creates a webhook and shows its secret once in the modal
+func PostWebhook(e *core.RequestEvent, installationID string) error {
+	var req PostWebhookRequest
+	err := e.BindBody(&req)
+	if err != nil {
+		return e.BadRequestError("Bad request", err)
+	}
+
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		return e.InternalServerError("Failed to get installation", err)
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	webhook, secret, err := utils.MustGetNATSAuth(e).CreateWebhook(e.Request.Context(), req.Options())
+	if err != nil {
+		return pages.WebhookModal(pages.WebhookModalModel{
+			RequestEvent: e,
+			Installation: installation,
+			Error:        err.Error(),
+		}).Render(e.Request.Context(), e.Response)
+	}
+
+	e.App.Logger().Info("Created webhook",
+		slog.String("id", webhook.ID),
+		slog.String("name", webhook.Name))
+
+	return pages.WebhookCreatedModal(pages.WebhookCreatedModalModel{
+		RequestEvent: e,
+		Installation: installation,
+		Webhook:      webhook,
+		Secret:       secret,
+	}).Render(e.Request.Context(), e.Response)
+}
+
+func DeleteWebhook(e *core.RequestEvent, installationID, webhookID string) error {
+	err := utils.MustGetNATSAuth(e).DeleteWebhook(e.Request.Context(), webhookID)
+	if err != nil {
+		return e.InternalServerError("Failed to delete webhook", err)
+	}
+
+	e.Response.Header().Set("HX-Redirect", "/ui/installations/"+installationID+"/webhooks")
+	return GetWebhooks(e, installationID)
+}
+
+// GetWebhookDeliveries shows the delivery log of a webhook
+func GetWebhookDeliveries(e *core.RequestEvent, installationID, webhookID string) error {
+	record, err := e.App.FindRecordById("nats_auth_operators", installationID)
+	if err != nil {
+		e.App.Logger().Error("Failed to find installation",
+			slog.String("id", installationID),
+			slog.String("error", err.Error()))
+		return e.Redirect(http.StatusFound, "/installations")
+	}
+
+	installation, err := utils.MustGetNATSAuth(e).GetOperatorFromRecord(record)
+	if err != nil {
+		return e.InternalServerError("Failed to get operator from record", err)
+	}
+
+	natsAuth := utils.MustGetNATSAuth(e)
+	webhook, err := natsAuth.GetWebhookByID(e.Request.Context(), webhookID)
+	if err != nil {
+		return e.NotFoundError("Webhook not found", err)
+	}
+
+	deliveries, err := natsAuth.GetWebhookDeliveries(e.Request.Context(), webhookID, webhookDeliveriesPageSize)
+	if err != nil {
+		return e.InternalServerError("Failed to get webhook deliveries", err)
+	}
+
+	model := pages.WebhookDeliveriesModel{
+		RequestEvent: e,
+		Installation: installation,
+		Webhook:      webhook,
+		Deliveries:   deliveries,
+	}
+
+	return layouts.WithBase(pages.WebhookDeliveries(model), layouts.BaseModel{
+		Title:       "NATS Tower - " + installation.Description,
+		Description: "Webhook " + webhook.Name,
+		NavigationModel: layouts.NavigationModel{
+			Access:          utils.MustGetAccess(e),
+			CurrentLocation: "/ui/installations/" + installation.ID + "/webhooks",
+			InstallationID:  installation.ID,
+			Swap:            true,
+		},
+		RequestEvent: e,
+	}).Render(e.Request.Context(), e.Response)
+}
+
+func PostWebhookRedelivery(e *core.RequestEvent, installationID, webhookID, deliveryID string) error {
+	err := utils.MustGetNATSAuth(e).RedeliverWebhookDelivery(e.Request.Context(), deliveryID)
+	if err != nil {
+		return e.InternalServerError("Failed to redeliver webhook", err)
+	}
+
+	return GetWebhookDeliveries(e, installationID, webhookID)
+}
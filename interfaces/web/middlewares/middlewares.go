@@ -3,9 +3,12 @@ package middlewares
 import (
 	"net/http"
 	"slices"
+	"strings"
 
 	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/store"
 	"github.com/nats-tower/nats-tower/interfaces/web/utils"
+	"github.com/nats-tower/nats-tower/natsauth"
 	"github.com/pocketbase/pocketbase/core"
 )
 
@@ -49,6 +52,15 @@ func RequireAuth(optCollectionNames ...string) func(*core.RequestEvent) error {
 	}
 }
 
+// SetAuditActor attributes the changes of the request to the logged in user in the audit log
+func SetAuditActor() func(*core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		actor := natsauth.AuthActor(e.Auth, e.RealIP())
+		e.Request = e.Request.WithContext(application.WithActor(e.Request.Context(), actor))
+		return e.Next()
+	}
+}
+
 func RequireLastInstallationID() func(*core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
 		userPreferences, err := utils.GetUserPreferences(e)
@@ -62,3 +74,78 @@ func RequireLastInstallationID() func(*core.RequestEvent) error {
 		return e.Next()
 	}
 }
+
+// RequireRole loads the roles of the user and checks them against the installation and account of the route.
+// Reading requires a role within the installation or account, everything else a role that may write.
+func RequireRole() func(*core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		access, err := store.GetAccess(e.App, e.Auth)
+		if err != nil {
+			return e.InternalServerError("Failed to load roles", err)
+		}
+		e.Set("access", access)
+
+		installationID := e.Request.PathValue("installation_id")
+		accountID := e.Request.PathValue("account_id")
+		if e.Request.URL.Path == "/ui/events" {
+			installationID = e.Request.URL.Query().Get("installation_id")
+			accountID = e.Request.URL.Query().Get("account_id")
+		}
+
+		if accountID != "" {
+			accountRecord, err := e.App.FindRecordById("nats_auth_accounts", accountID)
+			if err != nil || accountRecord.GetString("operator") != installationID {
+				return e.NotFoundError("Account not found", err)
+			}
+		}
+
+		if !isAllowed(e, access, installationID, accountID) {
+			return e.ForbiddenError("You are not allowed to access this page.", nil)
+		}
+		return e.Next()
+	}
+}
+
+func isAllowed(e *core.RequestEvent, access *application.Access, installationID, accountID string) bool {
+	write := e.Request.Method != http.MethodGet
+	path := e.Request.URL.Path
+
+	if installationID == "" {
+		// installation list, creating installations
+		return !write || access.Global(true)
+	}
+
+	if accountID != "" {
+		rest := strings.TrimPrefix(path, "/ui/installations/"+installationID+"/accounts/"+accountID)
+		switch {
+		case rest == "" && !write:
+			return access.Account(installationID, accountID, false)
+		case rest == "" || rest == "/delete" || rest == "/limits":
+			// the account itself belongs to the installation
+			return access.Installation(installationID, true)
+		case strings.HasSuffix(rest, "/credentials"):
+			// shows seeds and creds
+			return access.Account(installationID, accountID, true)
+		}
+		return access.Account(installationID, accountID, write)
+	}
+
+	rest := strings.TrimPrefix(path, "/ui/installations/"+installationID)
+	switch {
+	case rest == "/delete" || (rest == "" && e.Request.Method == http.MethodDelete):
+		return access.Global(true)
+	case strings.HasPrefix(rest, "/limits") || strings.HasPrefix(rest, "/api_tokens") || strings.HasPrefix(rest, "/webhooks") || strings.HasPrefix(rest, "/roles") || strings.HasPrefix(rest, "/members"):
+		// shared by all installations
+		return access.Global(write)
+	case rest == "/settings":
+		// shows the operator configuration and key rotation
+		return access.Installation(installationID, true)
+	case rest == "" && e.Request.Method == http.MethodPost:
+		// selects the installation
+		return access.InstallationVisible(installationID)
+	case (rest == "" || rest == "/accounts" || strings.HasPrefix(rest, "/audit_log")) && !write:
+		// accounts and audit log entries are filtered by the handler
+		return access.InstallationVisible(installationID)
+	}
+	return access.Installation(installationID, write)
+}
@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func Test_isAllowed(t *testing.T) {
+	owner := &application.Access{Bindings: []application.RoleBinding{
+		{Role: application.RoleAccountOwner, InstallationID: "i1", AccountID: "a1"},
+	}}
+	viewer := &application.Access{Bindings: []application.RoleBinding{
+		{Role: application.RoleViewer, InstallationID: "i1"},
+	}}
+	installationAdmin := &application.Access{Bindings: []application.RoleBinding{
+		{Role: application.RoleInstallationAdmin, InstallationID: "i1"},
+	}}
+
+	tests := []struct {
+		name      string
+		access    *application.Access
+		method    string
+		path      string
+		accountID string
+		want      bool
+	}{
+		{"owner reads its account", owner, http.MethodGet, "/ui/installations/i1/accounts/a1", "a1", true},
+		{"owner can not edit its account", owner, http.MethodPost, "/ui/installations/i1/accounts/a1", "a1", false},
+		{"owner can not delete its account", owner, http.MethodGet, "/ui/installations/i1/accounts/a1/delete", "a1", false},
+		{"owner creates users", owner, http.MethodPost, "/ui/installations/i1/accounts/a1/users", "a1", true},
+		{"owner reads creds of its users", owner, http.MethodGet, "/ui/installations/i1/accounts/a1/users/u1/credentials", "a1", true},
+		{"owner can not read other accounts", owner, http.MethodGet, "/ui/installations/i1/accounts/a2", "a2", false},
+		{"owner can not read creds of other accounts", owner, http.MethodGet, "/ui/installations/i1/accounts/a2/users/u2/credentials", "a2", false},
+		{"owner can not delete users of other accounts", owner, http.MethodDelete, "/ui/installations/i1/accounts/a2/users/u2", "a2", false},
+		{"owner lists the accounts", owner, http.MethodGet, "/ui/installations/i1/accounts", "", true},
+		{"owner can not open the settings", owner, http.MethodGet, "/ui/installations/i1/settings", "", false},
+		{"viewer reads users", viewer, http.MethodGet, "/ui/installations/i1/accounts/a1/users", "a1", true},
+		{"viewer can not read creds", viewer, http.MethodGet, "/ui/installations/i1/accounts/a1/users/u1/credentials", "a1", false},
+		{"viewer can not create users", viewer, http.MethodPost, "/ui/installations/i1/accounts/a1/users", "a1", false},
+		{"viewer can not open the settings", viewer, http.MethodGet, "/ui/installations/i1/settings", "", false},
+		{"viewer can not read other installations", viewer, http.MethodGet, "/ui/installations/i2", "", false},
+		{"installation admin edits accounts", installationAdmin, http.MethodPost, "/ui/installations/i1/accounts/a1", "a1", true},
+		{"installation admin opens the settings", installationAdmin, http.MethodGet, "/ui/installations/i1/settings", "", true},
+		{"installation admin can not delete the installation", installationAdmin, http.MethodGet, "/ui/installations/i1/delete", "", false},
+		{"installation admin can not manage limits", installationAdmin, http.MethodPost, "/ui/installations/i1/limits", "", false},
+		{"installation admin can not create installations", installationAdmin, http.MethodPost, "/ui/installations", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &core.RequestEvent{}
+			e.Request = httptest.NewRequest(tt.method, tt.path, nil)
+
+			installationID := "i1"
+			if tt.path == "/ui/installations" {
+				installationID = ""
+			} else if tt.path == "/ui/installations/i2" {
+				installationID = "i2"
+			}
+			if got := isAllowed(e, tt.access, installationID, tt.accountID); got != tt.want {
+				t.Errorf("isAllowed(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
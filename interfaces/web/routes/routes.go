@@ -7,6 +7,7 @@ import (
 
 	"github.com/pocketbase/pocketbase/core"
 
+	"github.com/nats-tower/nats-tower/interfaces/oidc"
 	"github.com/nats-tower/nats-tower/interfaces/web/handler"
 	"github.com/nats-tower/nats-tower/interfaces/web/middlewares"
 	"github.com/nats-tower/nats-tower/interfaces/web/utils"
@@ -16,11 +17,15 @@ import (
 func RegisterHTMLRoutes(ctx context.Context,
 	logger *slog.Logger,
 	e *core.ServeEvent,
-	natsauthModule *natsauth.NATSAuthModule) error {
+	natsauthModule *natsauth.NATSAuthModule,
+	oidcProvider *oidc.Provider) error {
 
 	e.Router.BindFunc(func(e *core.RequestEvent) error {
 		// global middleware to inject stores, connections, etc
 		e.Set("natsauth", natsauthModule)
+		if oidcProvider != nil {
+			e.Set("oidc", oidcProvider)
+		}
 		return e.Next()
 	})
 
@@ -36,12 +41,18 @@ func RegisterHTMLRoutes(ctx context.Context,
 
 	e.Router.POST("/login", handler.PostLogin)
 	e.Router.POST("/logout", handler.PostLogout)
+	e.Router.GET("/login/oidc", handler.GetOIDCLogin)
+	e.Router.GET("/login/oidc/callback", handler.GetOIDCCallback)
+	e.Router.GET("/setup", handler.GetSetup)
+	e.Router.POST("/setup", handler.PostSetup)
 
 	uiGroup := e.Router.Group("/ui")
 
 	uiGroup.BindFunc(
 		middlewares.LoadAuthContextFromCookie(),
 		middlewares.RequireAuth("_superusers", "users"),
+		middlewares.RequireRole(),
+		middlewares.SetAuditActor(),
 	)
 
 	uiGroup.GET("/", func(e *core.RequestEvent) error {
@@ -49,7 +60,7 @@ func RegisterHTMLRoutes(ctx context.Context,
 
 		// if user has a last_installation_id, redirect to the respective installation page
 		// if not, redirect to installations page
-		if prefs.LastInstallationID == "" {
+		if prefs.LastInstallationID == "" || !utils.MustGetAccess(e).InstallationVisible(prefs.LastInstallationID) {
 			e.Response.Header().Set("HX-Redirect", "/ui/installations")
 			return e.Redirect(http.StatusFound, "/ui/installations")
 		}
@@ -74,6 +85,24 @@ func RegisterHTMLRoutes(ctx context.Context,
 	uiGroup.GET("/installations/{installation_id}/settings", func(e *core.RequestEvent) error {
 		return handler.GetInstallationSettingsModal(e, e.Request.PathValue("installation_id"))
 	})
+	uiGroup.POST("/installations/{installation_id}/signing_key/{step}", func(e *core.RequestEvent) error {
+		return handler.PostInstallationSigningKeyRotation(e, e.Request.PathValue("installation_id"), e.Request.PathValue("step"))
+	})
+	uiGroup.POST("/installations/{installation_id}/connection", func(e *core.RequestEvent) error {
+		return handler.PostInstallationConnection(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/resolver", func(e *core.RequestEvent) error {
+		return handler.PostInstallationResolver(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/resolver/reloaded", func(e *core.RequestEvent) error {
+		return handler.PostInstallationResolverReloaded(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/server_config", func(e *core.RequestEvent) error {
+		return handler.PostInstallationServerConfig(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/drift/{action}", func(e *core.RequestEvent) error {
+		return handler.PostInstallationDrift(e, e.Request.PathValue("installation_id"), e.Request.PathValue("action"))
+	})
 	uiGroup.POST("/installations/{installation_id}", handler.PostInstallationID)
 
 	// Accounts
@@ -92,6 +121,132 @@ func RegisterHTMLRoutes(ctx context.Context,
 	uiGroup.GET("/installations/{installation_id}/accounts/{account_id}/delete", func(e *core.RequestEvent) error {
 		return handler.GetDeleteAccountModal(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"))
 	})
+	uiGroup.POST("/installations/{installation_id}/accounts/{account_id}/publish", func(e *core.RequestEvent) error {
+		return handler.PostAccountPublish(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"))
+	})
+
+	uiGroup.POST("/installations/{installation_id}/accounts/{account_id}/limits", func(e *core.RequestEvent) error {
+		return handler.PostAccountLimits(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"))
+	})
+
+	// Audit log
+	uiGroup.GET("/installations/{installation_id}/audit_log", func(e *core.RequestEvent) error {
+		return handler.GetAuditLog(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.GET("/installations/{installation_id}/audit_log/export", func(e *core.RequestEvent) error {
+		return handler.GetAuditLogExport(e, e.Request.PathValue("installation_id"))
+	})
+
+	// Limits
+	uiGroup.GET("/installations/{installation_id}/limits", func(e *core.RequestEvent) error {
+		return handler.GetLimits(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/limits", func(e *core.RequestEvent) error {
+		return handler.PostLimit(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.GET("/installations/{installation_id}/limits/{limit_id}", func(e *core.RequestEvent) error {
+		return handler.GetLimitModal(e, e.Request.PathValue("installation_id"), e.Request.PathValue("limit_id"))
+	})
+	uiGroup.DELETE("/installations/{installation_id}/limits/{limit_id}", func(e *core.RequestEvent) error {
+		return handler.DeleteLimit(e, e.Request.PathValue("installation_id"), e.Request.PathValue("limit_id"))
+	})
+
+	// API tokens
+	uiGroup.GET("/installations/{installation_id}/api_tokens", func(e *core.RequestEvent) error {
+		return handler.GetAPITokens(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/api_tokens", func(e *core.RequestEvent) error {
+		return handler.PostAPIToken(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.GET("/installations/{installation_id}/api_tokens/new", func(e *core.RequestEvent) error {
+		return handler.GetAPITokenModal(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.DELETE("/installations/{installation_id}/api_tokens/{token_id}", func(e *core.RequestEvent) error {
+		return handler.DeleteAPIToken(e, e.Request.PathValue("installation_id"), e.Request.PathValue("token_id"))
+	})
+
+	// Webhooks
+	uiGroup.GET("/installations/{installation_id}/webhooks", func(e *core.RequestEvent) error {
+		return handler.GetWebhooks(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/webhooks", func(e *core.RequestEvent) error {
+		return handler.PostWebhook(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.GET("/installations/{installation_id}/webhooks/new", func(e *core.RequestEvent) error {
+		return handler.GetWebhookModal(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.GET("/installations/{installation_id}/webhooks/{webhook_id}", func(e *core.RequestEvent) error {
+		return handler.GetWebhookDeliveries(e, e.Request.PathValue("installation_id"), e.Request.PathValue("webhook_id"))
+	})
+	uiGroup.DELETE("/installations/{installation_id}/webhooks/{webhook_id}", func(e *core.RequestEvent) error {
+		return handler.DeleteWebhook(e, e.Request.PathValue("installation_id"), e.Request.PathValue("webhook_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/webhooks/{webhook_id}/deliveries/{delivery_id}/redeliver", func(e *core.RequestEvent) error {
+		return handler.PostWebhookRedelivery(e, e.Request.PathValue("installation_id"),
+			e.Request.PathValue("webhook_id"), e.Request.PathValue("delivery_id"))
+	})
+
+	// Roles
+	uiGroup.GET("/installations/{installation_id}/roles", func(e *core.RequestEvent) error {
+		return handler.GetRoles(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/roles", func(e *core.RequestEvent) error {
+		return handler.PostRole(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.GET("/installations/{installation_id}/roles/new", func(e *core.RequestEvent) error {
+		return handler.GetRoleModal(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.DELETE("/installations/{installation_id}/roles/{role_id}", func(e *core.RequestEvent) error {
+		return handler.DeleteRole(e, e.Request.PathValue("installation_id"), e.Request.PathValue("role_id"))
+	})
+
+	// Members
+	uiGroup.GET("/installations/{installation_id}/members", func(e *core.RequestEvent) error {
+		return handler.GetMembers(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/members", func(e *core.RequestEvent) error {
+		return handler.PostMember(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.GET("/installations/{installation_id}/members/new", func(e *core.RequestEvent) error {
+		return handler.GetMemberInviteModal(e, e.Request.PathValue("installation_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/members/{member_id}/reset", func(e *core.RequestEvent) error {
+		return handler.PostMemberReset(e, e.Request.PathValue("installation_id"), e.Request.PathValue("member_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/members/{member_id}/disable", func(e *core.RequestEvent) error {
+		return handler.PostMemberDisabled(e, e.Request.PathValue("installation_id"), e.Request.PathValue("member_id"), true)
+	})
+	uiGroup.POST("/installations/{installation_id}/members/{member_id}/enable", func(e *core.RequestEvent) error {
+		return handler.PostMemberDisabled(e, e.Request.PathValue("installation_id"), e.Request.PathValue("member_id"), false)
+	})
+
+	// Exports and imports
+	uiGroup.POST("/installations/{installation_id}/accounts/{account_id}/exports", func(e *core.RequestEvent) error {
+		return handler.PostAccountExport(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"))
+	})
+	uiGroup.DELETE("/installations/{installation_id}/accounts/{account_id}/exports/{export_id}", func(e *core.RequestEvent) error {
+		return handler.DeleteAccountExport(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"), e.Request.PathValue("export_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/accounts/{account_id}/imports", func(e *core.RequestEvent) error {
+		return handler.PostAccountImport(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"))
+	})
+	uiGroup.DELETE("/installations/{installation_id}/accounts/{account_id}/imports/{import_id}", func(e *core.RequestEvent) error {
+		return handler.DeleteAccountImport(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"), e.Request.PathValue("import_id"))
+	})
+
+	// Signing keys
+	uiGroup.POST("/installations/{installation_id}/accounts/{account_id}/signing_keys", func(e *core.RequestEvent) error {
+		return handler.PostAccountSigningKey(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/accounts/{account_id}/signing_keys/rotate", func(e *core.RequestEvent) error {
+		return handler.PostAccountSigningKeyRotate(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"), "")
+	})
+	uiGroup.POST("/installations/{installation_id}/accounts/{account_id}/signing_keys/{key_id}/rotate", func(e *core.RequestEvent) error {
+		return handler.PostAccountSigningKeyRotate(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"), e.Request.PathValue("key_id"))
+	})
+	uiGroup.DELETE("/installations/{installation_id}/accounts/{account_id}/signing_keys/{key_id}", func(e *core.RequestEvent) error {
+		return handler.DeleteAccountSigningKey(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"), e.Request.PathValue("key_id"))
+	})
 
 	// Users
 	uiGroup.GET("/installations/{installation_id}/accounts/{account_id}/users", func(e *core.RequestEvent) error {
@@ -109,6 +264,27 @@ func RegisterHTMLRoutes(ctx context.Context,
 	uiGroup.GET("/installations/{installation_id}/accounts/{account_id}/users/{user_id}/credentials", func(e *core.RequestEvent) error {
 		return handler.GetUserCredentialsModal(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"), e.Request.PathValue("user_id"))
 	})
+	uiGroup.POST("/installations/{installation_id}/accounts/{account_id}/users/{user_id}/ttl", func(e *core.RequestEvent) error {
+		return handler.PostUserTTL(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"), e.Request.PathValue("user_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/accounts/{account_id}/users/{user_id}/rotate", func(e *core.RequestEvent) error {
+		return handler.PostUserRotate(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"), e.Request.PathValue("user_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/accounts/{account_id}/users/{user_id}/signing_key", func(e *core.RequestEvent) error {
+		return handler.PostUserSigningKey(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"), e.Request.PathValue("user_id"))
+	})
+	uiGroup.GET("/installations/{installation_id}/accounts/{account_id}/users/{user_id}/permissions", func(e *core.RequestEvent) error {
+		return handler.GetUserPermissionsModal(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"), e.Request.PathValue("user_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/accounts/{account_id}/users/{user_id}/permissions", func(e *core.RequestEvent) error {
+		return handler.PostUserPermissions(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"), e.Request.PathValue("user_id"))
+	})
+	uiGroup.GET("/installations/{installation_id}/accounts/{account_id}/users/{user_id}/limits", func(e *core.RequestEvent) error {
+		return handler.GetUserLimitsModal(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"), e.Request.PathValue("user_id"))
+	})
+	uiGroup.POST("/installations/{installation_id}/accounts/{account_id}/users/{user_id}/limits", func(e *core.RequestEvent) error {
+		return handler.PostUserLimits(e, e.Request.PathValue("installation_id"), e.Request.PathValue("account_id"), e.Request.PathValue("user_id"))
+	})
 
 	// Streams
 	uiGroup.GET("/installations/{installation_id}/accounts/{account_id}/streams", func(e *core.RequestEvent) error {
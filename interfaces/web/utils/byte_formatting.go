@@ -3,6 +3,7 @@ package utils
 import (
 	"math"
 	"strconv"
+	"strings"
 )
 
 // Copyright © 2015 Jaime Pillora <dev@jpillora.com>
@@ -46,3 +47,25 @@ func ToPrecision(n, p float64) float64 {
 func round(n float64) float64 {
 	return math.Floor(n + 0.5)
 }
+
+// ParseBytes converts a byte string like "512MB" or "1.5GB" back into a byte count.
+// Scales are powers of 1000 just like the ones of ToStringSigBytesPerKB with 1000 bytes per KB.
+func ParseBytes(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+
+	multiplier := 1.0
+	for i, scale := range scaleStrings[1:] {
+		if strings.HasSuffix(s, strings.TrimSuffix(scale, "B")) {
+			s = strings.TrimSuffix(s, strings.TrimSuffix(scale, "B"))
+			multiplier = math.Pow(1000, float64(i+1))
+			break
+		}
+	}
+
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(f * multiplier), nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 
 	"github.com/nats-tower/nats-tower/application"
+	"github.com/nats-tower/nats-tower/interfaces/oidc"
 	"github.com/nats-tower/nats-tower/natsauth"
 )
 
@@ -26,6 +27,30 @@ func MustGetNATSAuth(e *core.RequestEvent) *natsauth.NATSAuthModule {
 	return natsauthModule
 }
 
+// GetOIDCProvider returns the single sign-on provider, nil if it is not configured
+func GetOIDCProvider(e *core.RequestEvent) *oidc.Provider {
+	provider, _ := e.Get("oidc").(*oidc.Provider)
+	return provider
+}
+
+// BaseURL returns the scheme and host of the request, as seen by the browser
+func BaseURL(e *core.RequestEvent) string {
+	scheme := "http"
+	if e.Request.TLS != nil || e.Request.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + e.Request.Host
+}
+
+// MustGetAccess returns the roles of the logged in user, loaded by middlewares.RequireRole
+func MustGetAccess(e *core.RequestEvent) *application.Access {
+	access, ok := e.Get("access").(*application.Access)
+	if !ok {
+		panic("access not found")
+	}
+	return access
+}
+
 func SetAuthToken(e *core.RequestEvent, user *core.Record) error {
 	s, tokenErr := user.NewAuthToken()
 	if tokenErr != nil {
@@ -121,6 +121,7 @@ func Streams(m StreamsModel) templ.Component {
 		}
 		if !utils.RequestsFullPage(m.RequestEvent) {
 			templ_7745c5c3_Err = layouts.Navigation(layouts.NavigationModel{
+				Access:          utils.MustGetAccess(m.RequestEvent),
 				CurrentLocation: "/ui/installations/" + m.Installation.ID + "/accounts/" + m.Account.ID + "/streams",
 				InstallationID:  m.Installation.ID,
 				AccountID:       m.Account.ID,
@@ -171,7 +172,7 @@ func StreamList(m StreamListModel) templ.Component {
 			var templ_7745c5c3_Var8 string
 			templ_7745c5c3_Var8, templ_7745c5c3_Err = templ.JoinStringErrs(stream.Name)
 			if templ_7745c5c3_Err != nil {
-				return templ.Error{Err: templ_7745c5c3_Err, FileName: `interfaces/web/views/pages/streams.templ`, Line: 86, Col: 51}
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `interfaces/web/views/pages/streams.templ`, Line: 87, Col: 51}
 			}
 			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var8))
 			if templ_7745c5c3_Err != nil {
@@ -184,7 +185,7 @@ func StreamList(m StreamListModel) templ.Component {
 			var templ_7745c5c3_Var9 string
 			templ_7745c5c3_Var9, templ_7745c5c3_Err = templ.JoinStringErrs(fmt.Sprintf("%d messages - %s - %d subjects - %d consumers - Last message at %s", stream.State.Msgs, utils.ToStringSigBytesPerKB(stream.State.Bytes, 3, 1000), stream.State.NumSubjects, len(stream.Consumer), stream.State.LastTime.Format(time.RFC3339Nano)))
 			if templ_7745c5c3_Err != nil {
-				return templ.Error{Err: templ_7745c5c3_Err, FileName: `interfaces/web/views/pages/streams.templ`, Line: 88, Col: 261}
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `interfaces/web/views/pages/streams.templ`, Line: 89, Col: 261}
 			}
 			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var9))
 			if templ_7745c5c3_Err != nil {
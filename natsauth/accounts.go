@@ -2,30 +2,36 @@ package natsauth
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log/slog"
 	"time"
 
 	jwt "github.com/nats-io/jwt/v2"
-	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nkeys"
 	"github.com/nats-tower/nats-tower/application"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 )
 
-func GetAccountFromRecord(record *core.Record, url string) (*application.AccountAuth, error) {
+func (m *NATSAuthModule) GetAccountFromRecord(record *core.Record, url string) (*application.AccountAuth, error) {
+	secrets, err := m.keyRing.getSecrets(record, "private_key", "seed", "sign_private_key", "sign_seed")
+	if err != nil {
+		return nil, err
+	}
 	return &application.AccountAuth{
 		ID:                record.Id,
 		URL:               url,
 		Description:       record.GetString("description"),
 		PublicKey:         record.GetString("public_key"),
-		PrivateKey:        record.GetString("private_key"),
-		Seed:              record.GetString("seed"),
+		PrivateKey:        secrets["private_key"],
+		Seed:              secrets["seed"],
 		SigningPublicKey:  record.GetString("sign_public_key"),
-		SigningPrivateKey: record.GetString("sign_private_key"),
-		SigningSeed:       record.GetString("sign_seed"),
+		SigningPrivateKey: secrets["sign_private_key"],
+		SigningSeed:       secrets["sign_seed"],
 		JWT:               record.GetString("jwt"),
 		Name:              record.GetString("name"),
+		ReadOnly:          record.GetBool("read_only"),
 	}, nil
 }
 
@@ -52,7 +58,7 @@ func (m *NATSAuthModule) getSysAccountByURL(ctx context.Context, dao core.App, u
 		return nil, ErrNotFound
 	}
 
-	return GetAccountFromRecord(accountRecord[0], url)
+	return m.GetAccountFromRecord(accountRecord[0], url)
 }
 
 func (m *NATSAuthModule) GetSysAccountByID(ctx context.Context,
@@ -80,7 +86,7 @@ func (m *NATSAuthModule) getSysAccountByID(_ context.Context,
 		return nil, err
 	}
 
-	return GetAccountFromRecord(accountRecord[0], operatorRecord.GetString("url"))
+	return m.GetAccountFromRecord(accountRecord[0], operatorRecord.GetString("url"))
 }
 
 type UpsertAccountAuthOptions struct {
@@ -157,7 +163,7 @@ func (m *NATSAuthModule) UpsertAccountAuth(ctx context.Context,
 			accountClaims.Limits.JetStreamLimits.DiskStorage = -1
 			accountClaims.Limits.JetStreamLimits.MemoryStorage = -1
 
-			operatorKP, err := nkeys.FromSeed([]byte(operator.SigningSeed))
+			operatorKP, err := m.signer.KeyPair(ctx, txDao, operator.SigningPublicKey)
 			if err != nil {
 				return err
 			}
@@ -172,12 +178,17 @@ func (m *NATSAuthModule) UpsertAccountAuth(ctx context.Context,
 			record.Set("description", description)
 			record.Set("operator", operator.ID)
 			record.Set("public_key", pubKey)
-			record.Set("private_key", string(privateKey))
-			record.Set("seed", string(seed))
 			record.Set("sign_public_key", signPubKey)
-			record.Set("sign_private_key", string(signPrivateKey))
-			record.Set("sign_seed", string(signSeed))
 			record.Set("jwt", jwtValue)
+			err = m.keyRing.setSecrets(record, map[string]string{
+				"private_key":      string(privateKey),
+				"seed":             string(seed),
+				"sign_private_key": string(signPrivateKey),
+				"sign_seed":        string(signSeed),
+			})
+			if err != nil {
+				return err
+			}
 
 			logger.InfoContext(ctx, "Creating account...")
 
@@ -187,7 +198,7 @@ func (m *NATSAuthModule) UpsertAccountAuth(ctx context.Context,
 					return err
 				}
 			} else {
-				if err := txDao.Save(record); err != nil {
+				if err := txDao.SaveWithContext(ctx, record); err != nil {
 					logger.ErrorContext(ctx, "Could not save account", slog.String("error", err.Error()))
 					return err
 				}
@@ -206,14 +217,18 @@ func (m *NATSAuthModule) UpsertAccountAuth(ctx context.Context,
 		} else {
 			// exists
 			logger.InfoContext(ctx, "Account already exists...")
+			secrets, err := m.keyRing.getSecrets(accRecords[0], "private_key", "seed", "sign_private_key", "sign_seed")
+			if err != nil {
+				return err
+			}
 			res.ID = accRecords[0].Id
 			res.URL = url
 			res.PublicKey = accRecords[0].GetString("public_key")
-			res.PrivateKey = accRecords[0].GetString("private_key")
-			res.Seed = accRecords[0].GetString("seed")
+			res.PrivateKey = secrets["private_key"]
+			res.Seed = secrets["seed"]
 			res.SigningPublicKey = accRecords[0].GetString("sign_public_key")
-			res.SigningPrivateKey = accRecords[0].GetString("sign_private_key")
-			res.SigningSeed = accRecords[0].GetString("sign_seed")
+			res.SigningPrivateKey = secrets["sign_private_key"]
+			res.SigningSeed = secrets["sign_seed"]
 			res.JWT = accRecords[0].GetString("jwt")
 			res.Name = accRecords[0].GetString("name")
 			res.Description = accRecords[0].GetString("description")
@@ -262,34 +277,7 @@ func (m *NATSAuthModule) PublishAccount(ctx context.Context, url string, name st
 
 func (m *NATSAuthModule) publishAccountRecord(ctx context.Context, dao core.App, record *core.Record) error {
 	logger := m.logger.With(slog.String("name", record.GetString("name")), slog.String("operator", record.GetString("operator")))
-	// 1. find system user for same operator
-	sysAccountRecord, err := dao.FindAllRecords("nats_auth_accounts",
-		dbx.HashExp{
-			"operator": record.GetString("operator"),
-			"name":     "SYS",
-		})
-	if err != nil {
-		logger.ErrorContext(ctx, "Could not find SYS account(error)", slog.String("error", err.Error()))
-		return err
-	}
-	if len(sysAccountRecord) == 0 {
-		logger.ErrorContext(ctx, "Could not find SYS account for operator")
-		return ErrNotFound
-	}
-	sysUserRecord, err := dao.FindAllRecords("nats_auth_users",
-		dbx.HashExp{
-			"account": sysAccountRecord[0].Id,
-			"name":    "sys",
-		})
-	if err != nil {
-		logger.ErrorContext(ctx, "Could not find sys user(error)", slog.String("error", err.Error()))
-		return err
-	}
-	if len(sysUserRecord) == 0 {
-		logger.ErrorContext(ctx, "Could not find sys user for operator")
-		return ErrNotFound
-	}
-	// 2. find operator url for same operator
+	// 1. find operator url for same operator
 	operatorRecord, err := dao.FindRecordById("nats_auth_operators", record.GetString("operator"))
 	if err != nil {
 		logger.ErrorContext(ctx, "Could not find operator(error)", slog.String("error", err.Error()))
@@ -298,91 +286,83 @@ func (m *NATSAuthModule) publishAccountRecord(ctx context.Context, dao core.App,
 
 	logger = logger.With(slog.String("operator_url", operatorRecord.GetString("url")), slog.String("public_key", record.GetString("public_key")))
 
+	if resolverMode(operatorRecord) == application.ResolverMemory {
+		// memory resolvers do not accept updates, the account reaches them with the next config reload
+		logger.InfoContext(ctx, "Memory resolver, updating resolver preload instead of publishing account...")
+		return m.markResolverConfigChanged(ctx, dao, operatorRecord)
+	}
+
 	logger.InfoContext(ctx, "Publishing account...")
-	// 3. open nats connection and send account
-	nc, err := nats.Connect(operatorRecord.GetString("url"),
-		nats.UserJWTAndSeed(sysUserRecord[0].GetString("jwt"),
-			sysUserRecord[0].GetString("seed")))
+	// 2. get the shared nats connection of the system user of the same operator
+	nc, err := m.connectSysUser(ctx, dao, operatorRecord)
 	if err != nil {
-		logger.ErrorContext(ctx, "Could not connect to operator", slog.String("error", err.Error()))
 		return err
 	}
-	defer nc.Close()
-	// 4. send account
+	// 3. send account
 	resp, err := nc.Request("$SYS.REQ.CLAIMS.UPDATE", []byte(record.GetString("jwt")), 5*time.Second)
 	if err != nil {
 		logger.ErrorContext(ctx, "Could not send account to operator", slog.String("error", err.Error()))
 		return err
 	}
+	if err := claimsResponseError(resp.Data); err != nil {
+		logger.ErrorContext(ctx, "Account was rejected", slog.String("error", err.Error()))
+		return err
+	}
 	logger.InfoContext(ctx, "Account published", slog.String("response", string(resp.Data)))
 	return nil
 }
 
-func (m *NATSAuthModule) publishAccountRecordRemoval(ctx context.Context, dao core.App, record *core.Record) error {
-	logger := m.logger.With(slog.String("name", record.GetString("name")), slog.String("operator", record.GetString("operator")))
-	// 1. find system user for same operator
-	sysAccountRecord, err := dao.FindAllRecords("nats_auth_accounts",
-		dbx.HashExp{
-			"operator": record.GetString("operator"),
-			"name":     "SYS",
-		})
-	if err != nil {
-		logger.ErrorContext(ctx, "Could not find SYS account(error)", slog.String("error", err.Error()))
-		return err
-	}
-	if len(sysAccountRecord) == 0 {
-		logger.ErrorContext(ctx, "Could not find SYS account for operator")
-		return ErrNotFound
-	}
-	sysUserRecord, err := dao.FindAllRecords("nats_auth_users",
-		dbx.HashExp{
-			"account": sysAccountRecord[0].Id,
-			"name":    "sys",
-		})
-	if err != nil {
-		logger.ErrorContext(ctx, "Could not find sys user(error)", slog.String("error", err.Error()))
-		return err
-	}
-	if len(sysUserRecord) == 0 {
-		logger.ErrorContext(ctx, "Could not find sys user for operator")
-		return ErrNotFound
-	}
-	// 2. find operator url for same operator
-	operatorRecord, err := dao.FindRecordById("nats_auth_operators", record.GetString("operator"))
-	if err != nil {
-		logger.ErrorContext(ctx, "Could not find operator(error)", slog.String("error", err.Error()))
-		return err
-	}
+// publishAccountRemoval deletes the accounts with the public keys from the servers of the operator
+func (m *NATSAuthModule) publishAccountRemoval(ctx context.Context, dao core.App, operatorRecord *core.Record, publicKeys ...string) error {
+	logger := m.logger.With(slog.Any("public_keys", publicKeys),
+		slog.String("operator", operatorRecord.Id),
+		slog.String("operator_url", operatorRecord.GetString("url")))
 
-	logger = logger.With(slog.String("operator_url", operatorRecord.GetString("url")))
+	if resolverMode(operatorRecord) == application.ResolverMemory {
+		logger.InfoContext(ctx, "Memory resolver, updating resolver preload instead of deleting account...")
+		return m.markResolverConfigChanged(ctx, dao, operatorRecord)
+	}
 
 	logger.InfoContext(ctx, "Deleting account...")
-	// 3. open nats connection and send account
-	nc, err := nats.Connect(operatorRecord.GetString("url"),
-		nats.UserJWTAndSeed(sysUserRecord[0].GetString("jwt"),
-			sysUserRecord[0].GetString("seed")))
+	// 1. get the shared nats connection of the system user of the same operator
+	nc, err := m.connectSysUser(ctx, dao, operatorRecord)
 	if err != nil {
-		logger.ErrorContext(ctx, "Could not connect to operator", slog.String("error", err.Error()))
 		return err
 	}
-	defer nc.Close()
-	// 4. send account removal
-	claim := jwt.NewGenericClaims(operatorRecord.GetString("public_key"))
-	claim.Data["accounts"] = []string{record.GetString("public_key")}
-
-	operatorKP, err := nkeys.FromSeed([]byte(operatorRecord.GetString("sign_seed")))
+	// 2. send account removal
+	operatorKP, err := m.signingKeyPair(ctx, dao, operatorRecord, "sign_public_key")
 	if err != nil {
 		return err
 	}
+	// the servers only accept removals which are self signed by an operator key
+	claim := jwt.NewGenericClaims(operatorRecord.GetString("sign_public_key"))
+	claim.Data["accounts"] = publicKeys
+
 	pruneJwt, err := claim.Encode(operatorKP)
 	if err != nil {
 		logger.ErrorContext(ctx, "Could not connect to operator", slog.String("error", err.Error()))
 		return err
 	}
-	_, err = nc.Request("$SYS.REQ.CLAIMS.DELETE", []byte(pruneJwt), 5*time.Second)
+	resp, err := nc.Request("$SYS.REQ.CLAIMS.DELETE", []byte(pruneJwt), 5*time.Second)
 	if err != nil {
 		logger.ErrorContext(ctx, "Could not delete account from operator", slog.String("error", err.Error()))
 		return err
 	}
+	if err := claimsResponseError(resp.Data); err != nil {
+		logger.ErrorContext(ctx, "Account removal was rejected", slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// claimsResponseError returns the error a server responded with to a claims update or delete
+func claimsResponseError(data []byte) error {
+	var resp accountUpdateResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s: %s", resp.Server.Name, resp.Error.Description)
+	}
 	return nil
 }
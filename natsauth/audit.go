@@ -0,0 +1,372 @@
+package natsauth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+// auditedCollections are the collections whose changes are recorded in the audit log
+var auditedCollections = []string{
+	"nats_auth_operators",
+	"nats_auth_accounts",
+	"nats_auth_account_signing_keys",
+	"nats_auth_users",
+	"nats_auth_limits",
+	"nats_auth_permissions",
+	"nats_auth_user_limits",
+	"nats_auth_exports",
+	"nats_auth_imports",
+}
+
+// auditRedacted replaces the values of secrets in the audit log
+const auditRedacted = "[redacted]"
+
+func initAuditLogCollection(_ context.Context,
+	app core.App,
+	_ *slog.Logger) (*core.Collection, error) {
+
+	collection, err := app.FindCollectionByNameOrId("audit_log")
+
+	if err == sql.ErrNoRows {
+		collection = core.NewBaseCollection("audit_log")
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// the audit log is read in the UI, only admins may access the records directly.
+	// Nobody may change it.
+	collection.ListRule = nil
+	collection.ViewRule = nil
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = nil
+	collection.Indexes = types.JSONArray[string]{
+		"create index audit_log_created on audit_log (created)",
+		"create index audit_log_installation on audit_log (installation)",
+		"create index audit_log_account on audit_log (account)",
+		"create index audit_log_events_pending on audit_log (events_pending)",
+	}
+
+	addOrUpdateField(collection, &core.SelectField{
+		Name:     "action",
+		Required: true,
+		Values: []string{
+			string(application.AuditActionCreate),
+			string(application.AuditActionUpdate),
+			string(application.AuditActionDelete),
+		},
+		MaxSelect: 1,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "collection",
+		Required: true,
+	})
+	// no relations, the log outlives the records
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "record",
+		Required: true,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name: "record_name",
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name: "installation",
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name: "account",
+	})
+	addOrUpdateField(collection, &core.SelectField{
+		Name:     "actor_type",
+		Required: true,
+		Values: []string{
+			string(application.ActorSystem),
+			string(application.ActorUser),
+			string(application.ActorSuperuser),
+			string(application.ActorAPIToken),
+		},
+		MaxSelect: 1,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name: "actor_id",
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name: "actor_name",
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name: "ip",
+	})
+	addOrUpdateField(collection, &core.JSONField{
+		Name:    "changes",
+		MaxSize: 1024 * 1024, // 1MB
+	})
+	// set while the audit events of the entry wait to be published
+	addOrUpdateField(collection, &core.BoolField{
+		Name: "events_pending",
+	})
+	addOrUpdateField(collection, &core.AutodateField{
+		Name:     "created",
+		OnCreate: true,
+	})
+
+	// validate and submit (internally it calls app.SaveCollection(collection) in a transaction)
+	if err := app.Save(collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+// AuthActor returns the logged in user or superuser as actor
+func AuthActor(auth *core.Record, ip string) application.Actor {
+	if auth == nil {
+		return application.Actor{Type: application.ActorSystem, IP: ip}
+	}
+	actor := application.Actor{
+		Type: application.ActorUser,
+		ID:   auth.Id,
+		Name: auth.Email(),
+		IP:   ip,
+	}
+	if auth.IsSuperuser() {
+		actor.Type = application.ActorSuperuser
+	}
+	return actor
+}
+
+// bindAuditHooks records the changes of the audited collections. The entries are written
+// with the app of the change, so they are rolled back with its transaction.
+// The execute hooks run after the validation and before the success hooks, whose
+// errors (e.g. an unreachable NATS server) do not undo the change.
+func (m *NATSAuthModule) bindAuditHooks() {
+	m.cfg.App.OnRecordCreateExecute(auditedCollections...).BindFunc(m.auditRecordEvent)
+	m.cfg.App.OnRecordUpdateExecute(auditedCollections...).BindFunc(m.auditRecordEvent)
+	m.cfg.App.OnRecordDeleteExecute(auditedCollections...).BindFunc(m.auditRecordEvent)
+
+	// the record API of PocketBase saves without the context of the request,
+	// so the actor is looked up by the record instead
+	m.cfg.App.OnRecordCreateRequest(auditedCollections...).BindFunc(m.auditRecordRequest)
+	m.cfg.App.OnRecordUpdateRequest(auditedCollections...).BindFunc(m.auditRecordRequest)
+	m.cfg.App.OnRecordDeleteRequest(auditedCollections...).BindFunc(m.auditRecordRequest)
+}
+
+func (m *NATSAuthModule) auditRecordRequest(e *core.RecordRequestEvent) error {
+	m.requestActors.Store(e.Record, AuthActor(e.Auth, e.RealIP()))
+	defer m.requestActors.Delete(e.Record)
+	return e.Next()
+}
+
+func (m *NATSAuthModule) auditRecordEvent(e *core.RecordEvent) error {
+	var before map[string]auditValue
+	var installationID, accountID, name string
+	switch e.Type {
+	case core.ModelEventTypeUpdate:
+		before = auditValues(e.Record.Original())
+	case core.ModelEventTypeDelete:
+		before = auditValues(e.Record)
+		// the parents of deleted records may be deleted as well
+		installationID, accountID, name = auditScope(e.App, e.Record)
+	}
+
+	if err := e.Next(); err != nil {
+		return err
+	}
+
+	var after map[string]auditValue
+	if e.Type != core.ModelEventTypeDelete {
+		after = auditValues(e.Record)
+		installationID, accountID, name = auditScope(e.App, e.Record)
+	}
+	changes := auditChanges(before, after)
+	if e.Type == core.ModelEventTypeUpdate && len(changes) == 0 {
+		return nil
+	}
+
+	actor := application.ActorFromContext(e.Context)
+	if actor.Type == application.ActorSystem {
+		if requestActor, ok := m.requestActors.Load(e.Record); ok {
+			actor = requestActor.(application.Actor)
+		}
+	}
+
+	record := core.NewRecord(m.AuditLogCollection)
+	record.Set("action", e.Type)
+	record.Set("collection", e.Record.Collection().Name)
+	record.Set("record", e.Record.Id)
+	record.Set("record_name", name)
+	record.Set("installation", installationID)
+	record.Set("account", accountID)
+	record.Set("actor_type", string(actor.Type))
+	record.Set("actor_id", actor.ID)
+	record.Set("actor_name", actor.Name)
+	record.Set("ip", actor.IP)
+	record.Set("changes", changes)
+	record.Set("events_pending", m.cfg.AuditEventAccount != "" && installationID != "" &&
+		auditEventObjects[e.Record.Collection().Name] != "")
+	if err := e.App.SaveWithContext(e.Context, record); err != nil {
+		m.logger.ErrorContext(e.Context, "Could not write audit log",
+			slog.String("collection", e.Record.Collection().Name),
+			slog.String("record_id", e.Record.Id),
+			slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// auditValue is the JSON value of a field. Secrets are redacted, but still compared to detect rotations.
+type auditValue struct {
+	value   json.RawMessage
+	compare string
+}
+
+// auditValues returns the values of the fields of a record
+func auditValues(record *core.Record) map[string]auditValue {
+	values := map[string]auditValue{}
+	secrets := secretFields[record.Collection().Name]
+	for _, field := range record.Collection().Fields {
+		name := field.GetName()
+		if name == core.FieldNameId || field.Type() == core.FieldTypeAutodate {
+			continue
+		}
+		raw, err := json.Marshal(record.Get(name))
+		if err != nil {
+			continue
+		}
+		value := auditValue{value: raw, compare: string(raw)}
+		if (field.GetHidden() || slices.Contains(secrets, name)) && record.GetString(name) != "" {
+			value.value, _ = json.Marshal(auditRedacted)
+		}
+		values[name] = value
+	}
+	return values
+}
+
+func (v auditValue) empty() bool {
+	switch v.compare {
+	case `""`, `null`, `0`, `false`, `[]`, `{}`:
+		return true
+	}
+	return false
+}
+
+// auditChanges returns the changed fields. Empty fields of created and deleted records are left out.
+func auditChanges(before, after map[string]auditValue) map[string]application.AuditChange {
+	changes := map[string]application.AuditChange{}
+	for name, value := range after {
+		old, ok := before[name]
+		switch {
+		case before == nil:
+			if !value.empty() {
+				changes[name] = application.AuditChange{New: value.value}
+			}
+		case !ok:
+			changes[name] = application.AuditChange{New: value.value}
+		case old.compare != value.compare:
+			changes[name] = application.AuditChange{Old: old.value, New: value.value}
+		}
+	}
+	if after == nil {
+		for name, value := range before {
+			if !value.empty() {
+				changes[name] = application.AuditChange{Old: value.value}
+			}
+		}
+	}
+	return changes
+}
+
+// auditScope returns the installation and account of a record with a name to recognize it.
+// Records of deleted parents have no scope.
+func auditScope(app core.App, record *core.Record) (string, string, string) {
+	name := record.GetString("name")
+	switch record.Collection().Name {
+	case "nats_auth_operators":
+		name = record.GetString("description")
+		if name == "" {
+			name = record.GetString("url")
+		}
+		return record.Id, "", name
+	case "nats_auth_accounts":
+		return record.GetString("operator"), record.Id, name
+	case "nats_auth_limits":
+		return "", "", name
+	case "nats_auth_permissions", "nats_auth_user_limits":
+		userRecord, err := app.FindRecordById("nats_auth_users", record.GetString("user"))
+		if err != nil {
+			return "", "", ""
+		}
+		record = userRecord
+		name = userRecord.GetString("name")
+	}
+	if name == "" {
+		name = record.GetString("description")
+	}
+
+	accountRecord, err := app.FindRecordById("nats_auth_accounts", record.GetString("account"))
+	if err != nil {
+		return "", record.GetString("account"), name
+	}
+	return accountRecord.GetString("operator"), accountRecord.Id, name
+}
+
+func getAuditEntryFromRecord(record *core.Record) *application.AuditEntry {
+	entry := &application.AuditEntry{
+		ID:             record.Id,
+		Action:         application.AuditAction(record.GetString("action")),
+		Collection:     record.GetString("collection"),
+		RecordID:       record.GetString("record"),
+		RecordName:     record.GetString("record_name"),
+		InstallationID: record.GetString("installation"),
+		AccountID:      record.GetString("account"),
+		ActorType:      application.ActorType(record.GetString("actor_type")),
+		ActorID:        record.GetString("actor_id"),
+		ActorName:      record.GetString("actor_name"),
+		IP:             record.GetString("ip"),
+		Created:        record.GetDateTime("created").Time(),
+	}
+	_ = record.UnmarshalJSONField("changes", &entry.Changes)
+	return entry
+}
+
+// GetAuditLog returns the audit log entries of the filter, newest first
+func (m *NATSAuthModule) GetAuditLog(_ context.Context, filter application.AuditFilter) ([]*application.AuditEntry, error) {
+	query := m.cfg.App.RecordQuery("audit_log").
+		OrderBy("created DESC", "rowid DESC")
+
+	if filter.InstallationID != "" {
+		if filter.IncludeShared && len(filter.AccountIDs) == 0 {
+			query = query.AndWhere(dbx.In("installation", filter.InstallationID, ""))
+		} else {
+			query = query.AndWhere(dbx.HashExp{"installation": filter.InstallationID})
+		}
+	}
+	if len(filter.AccountIDs) > 0 {
+		accountIDs := make([]any, 0, len(filter.AccountIDs))
+		for _, accountID := range filter.AccountIDs {
+			accountIDs = append(accountIDs, accountID)
+		}
+		query = query.AndWhere(dbx.In("account", accountIDs...))
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(int64(filter.Limit))
+	}
+
+	records := []*core.Record{}
+	if err := query.All(&records); err != nil {
+		return nil, err
+	}
+
+	var res []*application.AuditEntry
+	for _, record := range records {
+		res = append(res, getAuditEntryFromRecord(record))
+	}
+	return res, nil
+}
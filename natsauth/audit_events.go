@@ -0,0 +1,304 @@
+package natsauth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+// auditEventObjects are the objects in the subjects of the audit events by collection
+var auditEventObjects = map[string]string{
+	"nats_auth_operators":            "installation",
+	"nats_auth_accounts":             "account",
+	"nats_auth_account_signing_keys": "signing_key",
+	"nats_auth_users":                "user",
+	"nats_auth_limits":               "limits",
+	"nats_auth_permissions":          "permissions",
+	"nats_auth_user_limits":          "user_limits",
+	"nats_auth_exports":              "export",
+	"nats_auth_imports":              "import",
+}
+
+var auditEventVerbs = map[application.AuditAction]string{
+	application.AuditActionCreate: "created",
+	application.AuditActionUpdate: "updated",
+	application.AuditActionDelete: "deleted",
+}
+
+const (
+	// auditEventPollInterval is the interval in which the pending events are retried
+	auditEventPollInterval = 10 * time.Second
+	// auditEventBatchSize is the number of audit log entries read at once
+	auditEventBatchSize = 100
+	// auditEventUserTTL is the lifetime of the users issued to publish the audit events.
+	// Their connections are replaced before the user expires.
+	auditEventUserTTL         = time.Hour
+	auditEventUserRenewBefore = 5 * time.Minute
+)
+
+// auditEventConn is the connection of the user publishing the audit events of an installation
+type auditEventConn struct {
+	nc *nats.Conn
+	// connection settings and signing key of the account the user was issued with
+	settings   string
+	signingKey string
+	expires    time.Time
+}
+
+// getAuditEvents returns the events of an audit log entry. Revocations in an account update
+// are published as user.revoked in addition to the account.updated event.
+func getAuditEvents(entry *application.AuditEntry) []application.AuditEvent {
+	object, ok := auditEventObjects[entry.Collection]
+	if !ok {
+		return nil
+	}
+	events := []application.AuditEvent{{
+		Type:       object + "." + auditEventVerbs[entry.Action],
+		AuditEntry: *entry,
+	}}
+
+	change, ok := entry.Changes["revocations"]
+	if entry.Collection != "nats_auth_accounts" || !ok {
+		return events
+	}
+	before, _ := change.Old.(map[string]any)
+	after, _ := change.New.(map[string]any)
+	var publicKeys []string
+	for publicKey, revokedAt := range after {
+		if before[publicKey] != revokedAt {
+			publicKeys = append(publicKeys, publicKey)
+		}
+	}
+	slices.Sort(publicKeys)
+	for _, publicKey := range publicKeys {
+		events = append(events, application.AuditEvent{
+			Type:       "user.revoked",
+			AuditEntry: *entry,
+			PublicKey:  publicKey,
+		})
+	}
+	return events
+}
+
+// bindAuditEventHooks wakes the publisher for new audit log entries with events. The events are published
+// in the background after the change is committed, so an unreachable NATS server does not fail the change.
+func (m *NATSAuthModule) bindAuditEventHooks() {
+	m.cfg.App.OnRecordAfterCreateSuccess("audit_log").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetBool("events_pending") {
+			select {
+			case m.auditEventWake <- struct{}{}:
+			default:
+			}
+		}
+		return e.Next()
+	})
+}
+
+// runAuditEventPublisher publishes the pending audit events until the context is done.
+// The connections of the publisher are only used by it.
+func (m *NATSAuthModule) runAuditEventPublisher(ctx context.Context) {
+	ticker := time.NewTicker(auditEventPollInterval)
+	defer ticker.Stop()
+
+	conns := map[string]*auditEventConn{}
+	defer func() {
+		for _, conn := range conns {
+			conn.nc.Close()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.auditEventWake:
+		}
+		if err := m.publishPendingAuditEvents(ctx, conns); err != nil {
+			m.logger.ErrorContext(ctx, "Could not publish audit events",
+				slog.String("error", err.Error()))
+		}
+	}
+}
+
+// publishPendingAuditEvents publishes the events of the pending audit log entries in their order.
+// If an installation can not be reached, its entries stay pending and are retried with the next poll,
+// the other installations go on. An entry with several events may publish some of them twice.
+func (m *NATSAuthModule) publishPendingAuditEvents(ctx context.Context, conns map[string]*auditEventConn) error {
+	failed := []any{}
+	for {
+		var records []*core.Record
+		err := m.cfg.App.RecordQuery("audit_log").
+			AndWhere(dbx.HashExp{"events_pending": true}).
+			AndWhere(dbx.NotIn("installation", failed...)).
+			OrderBy("created ASC", "id ASC").
+			Limit(auditEventBatchSize).
+			All(&records)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			if ctx.Err() != nil {
+				return nil
+			}
+			installationID := record.GetString("installation")
+			if slices.Contains(failed, any(installationID)) {
+				continue
+			}
+			if err := m.publishAuditEntryEvents(ctx, conns, record); err != nil {
+				m.logger.ErrorContext(ctx, "Could not publish audit event, retrying later",
+					slog.String("installation_id", installationID),
+					slog.String("audit_id", record.Id),
+					slog.String("error", err.Error()))
+				failed = append(failed, installationID)
+				continue
+			}
+			record.Set("events_pending", false)
+			if err := m.cfg.App.UnsafeWithoutHooks().SaveWithContext(ctx, record); err != nil {
+				return err
+			}
+		}
+		if len(records) < auditEventBatchSize {
+			return nil
+		}
+	}
+}
+
+// publishAuditEntryEvents publishes the events of an audit log entry into the audit event account of its installation.
+// Entries outside of installations and of installations without the account are skipped.
+func (m *NATSAuthModule) publishAuditEntryEvents(ctx context.Context, conns map[string]*auditEventConn,
+	record *core.Record) error {
+	events := getAuditEvents(getAuditEntryFromRecord(record))
+	if len(events) == 0 || record.GetString("installation") == "" {
+		return nil
+	}
+	operatorRecord, err := m.cfg.App.FindRecordById("nats_auth_operators", record.GetString("installation"))
+	if errors.Is(err, sql.ErrNoRows) {
+		// the installation was deleted
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	accountRecords, err := m.cfg.App.FindAllRecords("nats_auth_accounts",
+		dbx.HashExp{
+			"operator": operatorRecord.Id,
+			"name":     m.cfg.AuditEventAccount,
+		})
+	if err != nil {
+		return err
+	}
+	if len(accountRecords) == 0 {
+		m.logger.DebugContext(ctx, "Installation has no audit event account, skipping events",
+			slog.String("installation_id", operatorRecord.Id),
+			slog.String("account", m.cfg.AuditEventAccount))
+		return nil
+	}
+
+	var nc *nats.Conn
+	if accountRecords[0].GetString("name") == "SYS" {
+		nc, err = m.connectSysUser(ctx, m.cfg.App, operatorRecord)
+	} else {
+		nc, err = m.auditEventUserConn(ctx, conns, operatorRecord, accountRecords[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if err := nc.Publish(event.Subject(), data); err != nil {
+			return err
+		}
+	}
+	return nc.Flush()
+}
+
+// auditEventUserConn returns the connection of the audit event user of an installation.
+// A new user is connected if there is none yet, it expires soon or the settings or the account signing key changed.
+func (m *NATSAuthModule) auditEventUserConn(ctx context.Context, conns map[string]*auditEventConn,
+	operatorRecord, accountRecord *core.Record) (*nats.Conn, error) {
+	settings := connectionSettings(operatorRecord)
+	signingKey := accountRecord.GetString("sign_public_key")
+
+	conn, ok := conns[operatorRecord.Id]
+	if ok && conn.settings == settings && conn.signingKey == signingKey &&
+		time.Now().Before(conn.expires) && conn.nc.IsConnected() {
+		return conn.nc, nil
+	}
+	if ok {
+		conn.nc.Close()
+		delete(conns, operatorRecord.Id)
+	}
+
+	expires := time.Now().Add(auditEventUserTTL)
+	nc, err := m.connectAuditEventUser(ctx, m.cfg.App, operatorRecord, accountRecord, expires)
+	if err != nil {
+		return nil, err
+	}
+	conns[operatorRecord.Id] = &auditEventConn{
+		nc:         nc,
+		settings:   settings,
+		signingKey: signingKey,
+		expires:    expires.Add(-auditEventUserRenewBefore),
+	}
+	return nc, nil
+}
+
+// connectAuditEventUser connects to the NATS servers of the operator as a user of the account
+// until it expires, which may only publish audit events
+func (m *NATSAuthModule) connectAuditEventUser(ctx context.Context, dao core.App,
+	operatorRecord, accountRecord *core.Record, expires time.Time) (*nats.Conn, error) {
+	accountKP, err := m.signingKeyPair(ctx, dao, accountRecord, "sign_public_key")
+	if err != nil {
+		return nil, err
+	}
+	userKP, err := nkeys.CreateUser()
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := userKP.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	seed, err := userKP.Seed()
+	if err != nil {
+		return nil, err
+	}
+
+	userClaims := jwt.NewUserClaims(pubKey)
+	userClaims.Name = "nats-tower-audit"
+	userClaims.IssuerAccount = accountRecord.GetString("public_key")
+	userClaims.Expires = expires.Unix()
+	userClaims.Pub.Allow.Add(application.AuditEventSubjectPrefix + ".>")
+	userClaims.Sub.Deny.Add(">")
+	userJWT, err := userClaims.Encode(accountKP)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := m.connectOptions(operatorRecord)
+	if err != nil {
+		return nil, err
+	}
+	return nats.Connect(serverURLs(operatorRecord), append(opts,
+		nats.UserJWTAndSeed(userJWT, string(seed)),
+		nats.Name("nats-tower-audit"),
+		// events are retried from the audit log instead of being buffered while disconnected
+		nats.ReconnectBufSize(-1))...)
+}
@@ -0,0 +1,116 @@
+package natsauth
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/dbx"
+)
+
+func Test_AuditEventPublishing(t *testing.T) {
+	const url = "nats://127.0.0.1:14245"
+	ctx := context.Background()
+	natsModule := newTestModuleWithConfig(t, NATSAuthModuleConfig{
+		BootstrapURLs:     []string{url},
+		AuditEventAccount: "AUDIT",
+	})
+	ns := startTestServer(t, natsModule, url, 14245)
+
+	auditAccount, err := natsModule.UpsertAccountAuth(ctx, url, "AUDIT", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	waitForPublication(t, natsModule, auditAccount.ID)
+	listener, err := natsModule.UpsertUserAuth(ctx, url, "AUDIT", "listener", "", application.UserOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertUserAuth: %v", err)
+	}
+	nc, err := nats.Connect(url, nats.UserJWTAndSeed(listener.JWT, listener.Seed),
+		nats.MaxReconnects(-1), nats.ReconnectWait(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(nc.Close)
+	events := make(chan application.AuditEvent, 100)
+	if _, err := nc.Subscribe(application.AuditEventSubjectPrefix+".account.created", func(msg *nats.Msg) {
+		var event application.AuditEvent
+		if err := json.Unmarshal(msg.Data, &event); err == nil {
+			events <- event
+		}
+	}); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	waitForEvent := func(name string) {
+		timeout := time.After(20 * time.Second)
+		for {
+			select {
+			case event := <-events:
+				if event.RecordName == name {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("Event of account %s was not published", name)
+			}
+		}
+	}
+	pendingEntries := func(name string) int {
+		records, err := natsModule.cfg.App.FindAllRecords("audit_log", dbx.HashExp{
+			"collection":     "nats_auth_accounts",
+			"record_name":    name,
+			"events_pending": true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to find audit log entries: %v", err)
+		}
+		return len(records)
+	}
+
+	if _, err := natsModule.UpsertAccountAuth(ctx, url, "B", "", UpsertAccountAuthOptions{}); err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	waitForEvent("B")
+
+	// events of changes while the servers are down stay pending and are published once they are back
+	ns.Shutdown()
+	if _, err := natsModule.UpsertAccountAuth(ctx, url, "C", "", UpsertAccountAuthOptions{}); err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if pendingEntries("C") == 0 {
+		t.Fatalf("Audit log entry of account C is not pending")
+	}
+
+	startTestServer(t, natsModule, url, 14245)
+	auditAccountRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_accounts", auditAccount.ID)
+	if err != nil {
+		t.Fatalf("Failed to find account: %v", err)
+	}
+	if err := natsModule.publishAccountChange(ctx, natsModule.cfg.App, auditAccountRecord, accountPublishUpdate); err != nil {
+		t.Fatalf("Failed to publish account: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for !nc.IsConnected() || nc.Flush() != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("Listener did not reconnect: %s", nc.Status())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	// retry without waiting for the next poll
+	natsModule.auditEventWake <- struct{}{}
+	waitForEvent("C")
+	deadline = time.Now().Add(5 * time.Second)
+	for pendingEntries("C") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Audit log entry of account C is still pending")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
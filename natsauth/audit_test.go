@@ -0,0 +1,103 @@
+package natsauth
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func Test_auditChanges(t *testing.T) {
+	collection := core.NewBaseCollection("nats_auth_users")
+	collection.Fields.Add(&core.TextField{Name: "name"})
+	collection.Fields.Add(&core.TextField{Name: "description"})
+	collection.Fields.Add(&core.TextField{Name: "seed"})
+	collection.Fields.Add(&core.TextField{Name: "token", Hidden: true})
+
+	newRecord := func(values map[string]any) *core.Record {
+		record := core.NewRecord(collection)
+		record.Id = "u1"
+		for k, v := range values {
+			record.Set(k, v)
+		}
+		return record
+	}
+	user := newRecord(map[string]any{"name": "u", "seed": "SUSEED1", "token": "secret"})
+	rotated := newRecord(map[string]any{"name": "u", "seed": "SUSEED2", "token": "secret"})
+	renamed := newRecord(map[string]any{"name": "v", "seed": "SUSEED1", "token": "secret"})
+
+	tests := []struct {
+		name   string
+		before *core.Record
+		after  *core.Record
+		want   map[string]application.AuditChange
+	}{
+		{"create leaves out empty fields", nil, user, map[string]application.AuditChange{
+			"name":  {New: json.RawMessage(`"u"`)},
+			"seed":  {New: json.RawMessage(`"[redacted]"`)},
+			"token": {New: json.RawMessage(`"[redacted]"`)},
+		}},
+		{"rotated seed is recorded redacted", user, rotated, map[string]application.AuditChange{
+			"seed": {Old: json.RawMessage(`"[redacted]"`), New: json.RawMessage(`"[redacted]"`)},
+		}},
+		{"unchanged seed is left out", user, renamed, map[string]application.AuditChange{
+			"name": {Old: json.RawMessage(`"u"`), New: json.RawMessage(`"v"`)},
+		}},
+		{"no changes", user, user, map[string]application.AuditChange{}},
+		{"delete leaves out empty fields", user, nil, map[string]application.AuditChange{
+			"name":  {Old: json.RawMessage(`"u"`)},
+			"seed":  {Old: json.RawMessage(`"[redacted]"`)},
+			"token": {Old: json.RawMessage(`"[redacted]"`)},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before, after map[string]auditValue
+			if tt.before != nil {
+				before = auditValues(tt.before)
+			}
+			if tt.after != nil {
+				after = auditValues(tt.after)
+			}
+			got, _ := json.Marshal(auditChanges(before, after))
+			want, _ := json.Marshal(tt.want)
+			if string(got) != string(want) {
+				t.Errorf("auditChanges() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func Test_AuditLogRedactsSecrets(t *testing.T) {
+	const url = "nats://127.0.0.1:14239"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+
+	if _, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{}); err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	user, err := natsModule.UpsertUserAuth(ctx, url, "A", "u", "", application.UserOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertUserAuth: %v", err)
+	}
+
+	records, err := natsModule.cfg.App.FindAllRecords("audit_log", dbx.HashExp{"record": user.ID})
+	if err != nil || len(records) == 0 {
+		t.Fatalf("User was not audited: %v", err)
+	}
+	for _, record := range records {
+		changes := record.GetString("changes")
+		for _, secret := range []string{user.Seed, user.PrivateKey, user.Creds} {
+			if strings.Contains(changes, secret) {
+				t.Errorf("Audit log contains a secret of the user: %s", changes)
+			}
+		}
+		if !strings.Contains(changes, auditRedacted) {
+			t.Errorf("Audit log does not contain the redacted secrets: %s", changes)
+		}
+	}
+}
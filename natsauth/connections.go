@@ -0,0 +1,361 @@
+package natsauth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/jsm.go/natscontext"
+	"github.com/nats-io/nats.go"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+// sysConn is the shared connection of the sys user of an operator
+type sysConn struct {
+	nc *nats.Conn
+	// connection settings and JWT the connection was made with, it is replaced once they change
+	settings string
+	jwt      string
+
+	mu sync.Mutex
+	// last status change and the error that caused it
+	since   time.Time
+	lastErr string
+}
+
+func (c *sysConn) setStatus(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.since = time.Now()
+	if err != nil {
+		c.lastErr = err.Error()
+	}
+}
+
+// SysConn returns the shared connection of the sys user of an operator.
+// It reconnects by itself and must not be closed by the caller.
+func (m *NATSAuthModule) SysConn(ctx context.Context, operatorID string) (*nats.Conn, error) {
+	operatorRecord, err := m.cfg.App.FindRecordById("nats_auth_operators", operatorID)
+	if err != nil {
+		return nil, err
+	}
+	return m.connectSysUser(ctx, m.cfg.App, operatorRecord)
+}
+
+// GetSysConnHealth returns the state of the shared connection of an operator, nil if there is none
+func (m *NATSAuthModule) GetSysConnHealth(_ context.Context, operatorID string) *application.ConnectionHealth {
+	m.sysConnsMu.Lock()
+	conn, ok := m.sysConns[operatorID]
+	m.sysConnsMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return &application.ConnectionHealth{
+		Status:       strings.ToLower(conn.nc.Status().String()),
+		ConnectedURL: conn.nc.ConnectedUrlRedacted(),
+		ServerName:   conn.nc.ConnectedServerName(),
+		Reconnects:   conn.nc.Stats().Reconnects,
+		LastError:    conn.lastErr,
+		Since:        conn.since,
+	}
+}
+
+// connectSysUser returns the shared connection of the sys user of the SYS account of the operator.
+// A new connection is made if there is none yet or the URL or the sys user changed.
+func (m *NATSAuthModule) connectSysUser(ctx context.Context, dao core.App, operatorRecord *core.Record) (*nats.Conn, error) {
+	logger := m.logger.With(slog.String("operator_url", operatorRecord.GetString("url")))
+	sysAccountRecord, err := dao.FindAllRecords("nats_auth_accounts",
+		dbx.HashExp{
+			"operator": operatorRecord.Id,
+			"name":     "SYS",
+		})
+	if err != nil {
+		logger.ErrorContext(ctx, "Could not find SYS account(error)", slog.String("error", err.Error()))
+		return nil, err
+	}
+	if len(sysAccountRecord) == 0 {
+		logger.ErrorContext(ctx, "Could not find SYS account for operator")
+		return nil, ErrNotFound
+	}
+	sysUserRecord, err := dao.FindAllRecords("nats_auth_users",
+		dbx.HashExp{
+			"account": sysAccountRecord[0].Id,
+			"name":    "sys",
+		})
+	if err != nil {
+		logger.ErrorContext(ctx, "Could not find sys user(error)", slog.String("error", err.Error()))
+		return nil, err
+	}
+	if len(sysUserRecord) == 0 {
+		logger.ErrorContext(ctx, "Could not find sys user for operator")
+		return nil, ErrNotFound
+	}
+
+	settings := connectionSettings(operatorRecord)
+	userJWT := sysUserRecord[0].GetString("jwt")
+
+	// one dial per operator at a time, the others wait for its connection
+	dial := m.sysConnDial(operatorRecord.Id)
+	dial.Lock()
+	defer dial.Unlock()
+
+	m.sysConnsMu.Lock()
+	conn, ok := m.sysConns[operatorRecord.Id]
+	if ok && conn.settings == settings && conn.jwt == userJWT && !conn.nc.IsClosed() {
+		m.sysConnsMu.Unlock()
+		return conn.nc, nil
+	}
+	if ok {
+		logger.InfoContext(ctx, "Connection settings or sys user changed, replacing connection")
+		conn.nc.Close()
+		delete(m.sysConns, operatorRecord.Id)
+	}
+	m.sysConnsMu.Unlock()
+
+	sysUserSeed, err := m.keyRing.getSecret(sysUserRecord[0], "seed")
+	if err != nil {
+		return nil, err
+	}
+	opts, err := m.connectOptions(operatorRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	conn = &sysConn{
+		settings: settings,
+		jwt:      userJWT,
+		since:    time.Now(),
+	}
+	// the connection outlives the request that made it
+	connCtx := m.ctx
+	nc, err := nats.Connect(serverURLs(operatorRecord), append(opts,
+		nats.UserJWTAndSeed(userJWT, sysUserSeed),
+		nats.Name("nats-tower"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			logger.WarnContext(connCtx, "Sys user disconnected", slog.Any("error", err))
+			conn.setStatus(err)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logger.InfoContext(connCtx, "Sys user reconnected", slog.String("server", nc.ConnectedUrlRedacted()))
+			conn.setStatus(nil)
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			conn.setStatus(err)
+		}))...)
+	if err != nil {
+		logger.ErrorContext(ctx, "Could not connect to operator", slog.String("error", err.Error()))
+		return nil, err
+	}
+	conn.nc = nc
+
+	m.sysConnsMu.Lock()
+	defer m.sysConnsMu.Unlock()
+	if m.ctx.Err() != nil {
+		// closeSysConns already ran
+		nc.Close()
+		return nil, m.ctx.Err()
+	}
+	m.sysConns[operatorRecord.Id] = conn
+	return nc, nil
+}
+
+// sysConnDial returns the lock of the dials of the shared connection of an operator
+func (m *NATSAuthModule) sysConnDial(operatorID string) *sync.Mutex {
+	m.sysConnsMu.Lock()
+	defer m.sysConnsMu.Unlock()
+	dial, ok := m.sysConnDials[operatorID]
+	if !ok {
+		dial = &sync.Mutex{}
+		m.sysConnDials[operatorID] = dial
+	}
+	return dial
+}
+
+// closeSysConn closes the shared connection of an operator, the next use connects again.
+// If settings or a JWT are given, the connection is only closed if it was made with others.
+func (m *NATSAuthModule) closeSysConn(operatorID, settings, userJWT string) {
+	m.sysConnsMu.Lock()
+	defer m.sysConnsMu.Unlock()
+	conn, ok := m.sysConns[operatorID]
+	if !ok || (settings != "" && conn.settings == settings) || (userJWT != "" && conn.jwt == userJWT) {
+		return
+	}
+	conn.nc.Close()
+	delete(m.sysConns, operatorID)
+}
+
+// bindSysConnHooks closes the shared connection when the connection settings of the operator or its sys user change
+func (m *NATSAuthModule) bindSysConnHooks() {
+	m.cfg.App.OnRecordAfterUpdateSuccess("nats_auth_operators").BindFunc(func(e *core.RecordEvent) error {
+		m.closeSysConn(e.Record.Id, connectionSettings(e.Record), "")
+		return e.Next()
+	})
+	m.cfg.App.OnRecordAfterDeleteSuccess("nats_auth_operators").BindFunc(func(e *core.RecordEvent) error {
+		m.closeSysConn(e.Record.Id, "", "")
+		return e.Next()
+	})
+
+	sysUserChanged := func(e *core.RecordEvent, userJWT string) error {
+		if e.Record.GetString("name") != "sys" {
+			return e.Next()
+		}
+		accountRecord, err := e.App.FindRecordById("nats_auth_accounts", e.Record.GetString("account"))
+		if err == nil && accountRecord.GetString("name") == "SYS" {
+			m.closeSysConn(accountRecord.GetString("operator"), "", userJWT)
+		}
+		return e.Next()
+	}
+	m.cfg.App.OnRecordAfterUpdateSuccess("nats_auth_users").BindFunc(func(e *core.RecordEvent) error {
+		return sysUserChanged(e, e.Record.GetString("jwt"))
+	})
+	m.cfg.App.OnRecordAfterDeleteSuccess("nats_auth_users").BindFunc(func(e *core.RecordEvent) error {
+		return sysUserChanged(e, "")
+	})
+}
+
+// closeSysConns closes all shared connections once the context is done
+func (m *NATSAuthModule) closeSysConns(ctx context.Context) {
+	<-ctx.Done()
+	m.sysConnsMu.Lock()
+	defer m.sysConnsMu.Unlock()
+	for operatorID, conn := range m.sysConns {
+		conn.nc.Close()
+		delete(m.sysConns, operatorID)
+	}
+}
+
+// serverURLs returns the URL and the seed URLs of an operator in the comma separated form of nats.Connect
+func serverURLs(operatorRecord *core.Record) string {
+	urls := append([]string{operatorRecord.GetString("url")}, operatorRecord.GetStringSlice("seed_urls")...)
+	return strings.Join(urls, ",")
+}
+
+// connectionSettings returns all settings a connection to the operator is made with, to notice changes of them
+func connectionSettings(operatorRecord *core.Record) string {
+	return strings.Join([]string{
+		serverURLs(operatorRecord),
+		operatorRecord.GetString("tls_ca"),
+		operatorRecord.GetString("tls_cert"),
+		operatorRecord.GetString("tls_key"),
+		fmt.Sprint(operatorRecord.GetBool("tls_handshake_first")),
+	}, "\n")
+}
+
+// connectOptions returns the TLS options of the connections to the servers of an operator
+func (m *NATSAuthModule) connectOptions(operatorRecord *core.Record) ([]nats.Option, error) {
+	operator, err := m.GetOperatorFromRecord(operatorRecord)
+	if err != nil {
+		return nil, err
+	}
+	return connectionOptions(operator.Connection)
+}
+
+// connectionOptions returns the TLS options of a connection with the connection settings
+func connectionOptions(conn application.OperatorConnection) ([]nats.Option, error) {
+	config, err := tlsConfig(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []nats.Option
+	if config != nil {
+		opts = append(opts, nats.Secure(config))
+	}
+	if conn.TLSHandshakeFirst {
+		opts = append(opts, nats.TLSHandshakeFirst())
+	}
+	return opts, nil
+}
+
+// tlsConfig returns the TLS config of the connection settings, nil if neither a CA nor a client certificate is set
+func tlsConfig(conn application.OperatorConnection) (*tls.Config, error) {
+	if conn.TLSCA == "" && conn.TLSCert == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if conn.TLSCA != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(conn.TLSCA)) {
+			return nil, fmt.Errorf("CA does not contain a PEM encoded certificate")
+		}
+		config.RootCAs = pool
+	}
+	if conn.TLSCert != "" {
+		cert, err := tls.X509KeyPair([]byte(conn.TLSCert), []byte(conn.TLSKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate or key: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// natsContextTLSOptions writes the TLS files of the operator next to the creds of the user
+// and returns the options of the NATS CLI context to use them
+func (m *NATSAuthModule) natsContextTLSOptions(dir, userID string, operatorRecord *core.Record) ([]natscontext.Option, error) {
+	operator, err := m.GetOperatorFromRecord(operatorRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []natscontext.Option
+	files := []struct {
+		content string
+		suffix  string
+		option  func(string) natscontext.Option
+	}{
+		{operator.Connection.TLSCA, "ca.pem", natscontext.WithCA},
+		{operator.Connection.TLSCert, "cert.pem", natscontext.WithCertificate},
+		{operator.Connection.TLSKey, "key.pem", natscontext.WithKey},
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, fmt.Sprintf("%s-%s", userID, file.suffix))
+		if file.content == "" {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			continue
+		}
+		if err := os.WriteFile(path, []byte(file.content), 0600); err != nil {
+			return nil, err
+		}
+		opts = append(opts, file.option(path))
+	}
+	if operator.Connection.TLSHandshakeFirst {
+		opts = append(opts, natscontext.WithTLSHandshakeFirst())
+	}
+	return opts, nil
+}
+
+// validateServerURL checks that the URL is a NATS URL with a host
+func validateServerURL(serverURL string) error {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", serverURL, err)
+	}
+	switch u.Scheme {
+	case "nats", "tls", "ws", "wss":
+	default:
+		return fmt.Errorf("invalid URL %q: scheme must be nats, tls, ws or wss", serverURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid URL %q: host is missing", serverURL)
+	}
+	return nil
+}
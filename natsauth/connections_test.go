@@ -0,0 +1,117 @@
+package natsauth
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_SysConnDialsPerOperator(t *testing.T) {
+	// accepts connections but never sends the INFO of a server, so dials hang until they time out
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+
+	hangingURL := "nats://" + ln.Addr().String()
+	const url = "nats://127.0.0.1:14232"
+	ctx := context.Background()
+	natsModule := newTestModule(t, hangingURL, url)
+	startTestServer(t, natsModule, url, 14232)
+
+	hanging, err := natsModule.GetOperator(ctx, hangingURL)
+	if err != nil {
+		t.Fatalf("Failed to GetOperator: %v", err)
+	}
+	operator, err := natsModule.GetOperator(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to GetOperator: %v", err)
+	}
+
+	hangingErr := make(chan error, 1)
+	go func() {
+		_, err := natsModule.SysConn(ctx, hanging.ID)
+		hangingErr <- err
+	}()
+	// let the hanging dial start
+	time.Sleep(200 * time.Millisecond)
+
+	start := time.Now()
+	nc, err := natsModule.SysConn(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Connecting waited %s for the dial of another operator", elapsed)
+	}
+	if !nc.IsConnected() {
+		t.Errorf("Connection is %s", nc.Status())
+	}
+
+	if err := <-hangingErr; err == nil {
+		t.Errorf("Connecting to a server which does not answer succeeded")
+	}
+	if health := natsModule.GetSysConnHealth(ctx, hanging.ID); health != nil {
+		t.Errorf("Failed dial left a connection: %+v", health)
+	}
+}
+
+func Test_ConnectionTLS(t *testing.T) {
+	// the URL of the installation is down, the server is only reachable by its seed URL
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	url := "tls://" + ln.Addr().String()
+	_ = ln.Close()
+
+	ctx := context.Background()
+	certs := newTestTLS(t)
+	natsModule := newTestModule(t, url)
+	operator, err := natsModule.GetOperator(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to GetOperator: %v", err)
+	}
+	conn := certs.connection()
+	conn.SeedURLs = []string{"tls://127.0.0.1:14244"}
+	if _, err := natsModule.UpdateOperatorConnection(ctx, operator.ID, conn); err != nil {
+		t.Fatalf("Failed to UpdateOperatorConnection: %v", err)
+	}
+	startTestServer(t, natsModule, url, 14244, certs.serverOptions(t))
+
+	// accounts are published through the shared connection of the sys user
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "AUDIT", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	waitForPublication(t, natsModule, account.ID)
+
+	operatorRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_operators", operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to find operator: %v", err)
+	}
+	accountRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_accounts", account.ID)
+	if err != nil {
+		t.Fatalf("Failed to find account: %v", err)
+	}
+	nc, err := natsModule.connectAuditEventUser(ctx, natsModule.cfg.App, operatorRecord, accountRecord,
+		time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to connect the audit event user: %v", err)
+	}
+	defer nc.Close()
+	if nc.ConnectedUrl() != "tls://127.0.0.1:14244" || !nc.TLSRequired() {
+		t.Errorf("Audit event user is connected to %s", nc.ConnectedUrlRedacted())
+	}
+}
@@ -0,0 +1,291 @@
+package natsauth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	jwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// userCredentialHistoryLimit is the number of JWTs kept in the credential history of each user.
+// Renewed JWTs are added to the history as well, so older entries are deleted.
+const userCredentialHistoryLimit = 50
+
+// applyUserTTL sets the expiry of the user claims according to the ttl of the user record
+func applyUserTTL(record *core.Record, userClaims *jwt.UserClaims) {
+	ttl := time.Duration(record.GetInt("ttl")) * time.Millisecond
+	if ttl <= 0 {
+		userClaims.Expires = 0
+		record.Set("expires", "")
+		return
+	}
+	expires := time.Now().Add(ttl)
+	userClaims.Expires = expires.Unix()
+	record.Set("expires", expires)
+}
+
+// getAccountRevocations returns the revoked user public keys of an account with the unix time of the revocation
+func getAccountRevocations(record *core.Record) map[string]int64 {
+	revocations := map[string]int64{}
+	_ = record.UnmarshalJSONField("revocations", &revocations)
+	if revocations == nil {
+		revocations = map[string]int64{}
+	}
+	return revocations
+}
+
+// addUserCredential adds the current JWT of a user record to the credential history
+func (m *NATSAuthModule) addUserCredential(dao core.App, record *core.Record, reason string) error {
+	userClaims, err := jwt.DecodeUserClaims(record.GetString("jwt"))
+	if err != nil {
+		return err
+	}
+
+	credentialRecord := core.NewRecord(m.NATSUserCredentialCollection)
+	credentialRecord.Set("user", record.Id)
+	credentialRecord.Set("public_key", userClaims.Subject)
+	credentialRecord.Set("jwt", record.GetString("jwt"))
+	credentialRecord.Set("issued", time.Unix(userClaims.IssuedAt, 0))
+	if userClaims.Expires > 0 {
+		credentialRecord.Set("expires", time.Unix(userClaims.Expires, 0))
+	}
+	credentialRecord.Set("reason", reason)
+	if err := dao.Save(credentialRecord); err != nil {
+		return err
+	}
+
+	_, err = dao.DB().NewQuery(`DELETE FROM nats_auth_user_credentials
+		WHERE user = {:user} AND id NOT IN (
+			SELECT id FROM nats_auth_user_credentials WHERE user = {:user}
+			ORDER BY issued DESC, created DESC LIMIT {:limit})`).
+		Bind(dbx.Params{"user": record.Id, "limit": userCredentialHistoryLimit}).
+		Execute()
+	return err
+}
+
+// GetUserCredentials returns the history of the JWTs issued for a user, newest first
+func (m *NATSAuthModule) GetUserCredentials(_ context.Context, userID string) ([]*application.UserCredential, error) {
+	userRecord, err := m.cfg.App.FindRecordById("nats_auth_users", userID)
+	if err != nil {
+		return nil, err
+	}
+	accountRecord, err := m.cfg.App.FindRecordById("nats_auth_accounts", userRecord.GetString("account"))
+	if err != nil {
+		return nil, err
+	}
+	revocations := getAccountRevocations(accountRecord)
+
+	credentialRecords, err := m.cfg.App.FindRecordsByFilter("nats_auth_user_credentials",
+		"user = {:user}",
+		"-issued,-created",
+		0,
+		0,
+		dbx.Params{"user": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*application.UserCredential
+	for _, credentialRecord := range credentialRecords {
+		credential := &application.UserCredential{
+			ID:        credentialRecord.Id,
+			UserID:    userID,
+			PublicKey: credentialRecord.GetString("public_key"),
+			JWT:       credentialRecord.GetString("jwt"),
+			Issued:    credentialRecord.GetDateTime("issued").Time(),
+			Expires:   credentialRecord.GetDateTime("expires").Time(),
+			Reason:    credentialRecord.GetString("reason"),
+			Current:   credentialRecord.GetString("jwt") == userRecord.GetString("jwt"),
+		}
+		if revokedAt, ok := revocations[credential.PublicKey]; ok {
+			credential.Revoked = credential.Issued.Unix() <= revokedAt
+		}
+		res = append(res, credential)
+	}
+	return res, nil
+}
+
+// SetUserTTL changes the lifetime of the user JWT and re-issues it. A ttl of 0 disables the expiry.
+func (m *NATSAuthModule) SetUserTTL(ctx context.Context, userID string, ttl time.Duration) (*application.UserAuth, error) {
+	if ttl < 0 {
+		return nil, fmt.Errorf("ttl must not be negative")
+	}
+
+	var res *application.UserAuth
+	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		userRecord, err := txDao.FindRecordById("nats_auth_users", userID)
+		if err != nil {
+			return err
+		}
+
+		userRecord.Set("ttl", ttl.Milliseconds())
+		if err := m.signUserRecord(ctx, txDao, userRecord); err != nil {
+			return err
+		}
+		// triggers the user update hook which refreshes the nats context and the history
+		if err := txDao.SaveWithContext(ctx, userRecord); err != nil {
+			return err
+		}
+
+		res, err = m.GetUserFromRecord(userRecord, "")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// RotateUserKey replaces the nkey of a user. The old public key is revoked in the account,
+// so credentials issued before the rotation stop working.
+func (m *NATSAuthModule) RotateUserKey(ctx context.Context, userID string) (*application.UserAuth, error) {
+	var res *application.UserAuth
+	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		userRecord, err := txDao.FindRecordById("nats_auth_users", userID)
+		if err != nil {
+			return err
+		}
+		accountRecord, err := txDao.FindRecordById("nats_auth_accounts", userRecord.GetString("account"))
+		if err != nil {
+			return err
+		}
+		if accountRecord.GetBool("read_only") {
+			return fmt.Errorf("account %s is read-only", accountRecord.GetString("name"))
+		}
+
+		userKP, err := nkeys.CreateUser()
+		if err != nil {
+			return err
+		}
+		pubKey, err := userKP.PublicKey()
+		if err != nil {
+			return err
+		}
+		privateKey, err := userKP.PrivateKey()
+		if err != nil {
+			return err
+		}
+		seed, err := userKP.Seed()
+		if err != nil {
+			return err
+		}
+
+		oldPubKey := userRecord.GetString("public_key")
+
+		m.logger.InfoContext(ctx, "Rotating user key...",
+			slog.String("user_id", userID),
+			slog.String("old_public_key", oldPubKey),
+			slog.String("public_key", pubKey))
+
+		userRecord.Set("public_key", pubKey)
+		err = m.keyRing.setSecrets(userRecord, map[string]string{
+			"private_key": string(privateKey),
+			"seed":        string(seed),
+		})
+		if err != nil {
+			return err
+		}
+		if err := m.signUserRecord(ctx, txDao, userRecord); err != nil {
+			return err
+		}
+		if err := txDao.SaveWithContext(ctx, userRecord); err != nil {
+			return err
+		}
+
+		revocations := getAccountRevocations(accountRecord)
+		revocations[oldPubKey] = time.Now().Unix()
+		accountRecord.Set("revocations", revocations)
+		// triggers the account update hook which re-signs and publishes the account
+		if err := txDao.SaveWithContext(ctx, accountRecord); err != nil {
+			return err
+		}
+
+		res, err = m.GetUserFromRecord(userRecord, "")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// renewUserCredentials re-issues the JWTs of all users which expire within a third of their ttl
+func (m *NATSAuthModule) renewUserCredentials(ctx context.Context) error {
+	userRecords, err := m.cfg.App.FindRecordsByFilter("nats_auth_users", "ttl > 0", "", 0, 0)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, userRecord := range userRecords {
+		ttl := time.Duration(userRecord.GetInt("ttl")) * time.Millisecond
+		expires := userRecord.GetDateTime("expires").Time()
+		if !expires.IsZero() && expires.Sub(now) > ttl/3 {
+			continue
+		}
+
+		logger := m.logger.With(slog.String("user_id", userRecord.Id))
+
+		accountRecord, err := m.cfg.App.FindRecordById("nats_auth_accounts", userRecord.GetString("account"))
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not find account for user",
+				slog.String("error", err.Error()))
+			continue
+		}
+		signingRecord, signingField, err := userSigningKey(m.cfg.App, accountRecord, userRecord)
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not find signing key for user",
+				slog.String("error", err.Error()))
+			continue
+		}
+		canSign, err := m.canSign(ctx, m.cfg.App, signingRecord, signingField)
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not check account signing key",
+				slog.String("error", err.Error()))
+			continue
+		}
+		if !canSign {
+			logger.InfoContext(ctx, "Signing key of user has no seed. Skipping user renewal...")
+			continue
+		}
+
+		logger.InfoContext(ctx, "Renewing user credentials...",
+			slog.Time("expires", expires))
+
+		if err := m.signUserRecord(ctx, m.cfg.App, userRecord); err != nil {
+			logger.ErrorContext(ctx, "Could not sign user",
+				slog.String("error", err.Error()))
+			continue
+		}
+		if err := m.cfg.App.SaveWithContext(ctx, userRecord); err != nil {
+			logger.ErrorContext(ctx, "Could not save user",
+				slog.String("error", err.Error()))
+			continue
+		}
+	}
+	return nil
+}
+
+// runCredentialRenewal renews expiring user credentials until the context is done
+func (m *NATSAuthModule) runCredentialRenewal(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.renewUserCredentials(ctx); err != nil {
+				m.logger.ErrorContext(ctx, "Could not renew user credentials",
+					slog.String("error", err.Error()))
+			}
+		}
+	}
+}
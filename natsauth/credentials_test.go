@@ -0,0 +1,106 @@
+package natsauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/dbx"
+)
+
+func Test_RenewUserCredentialsWithSigningKey(t *testing.T) {
+	const url = "nats://127.0.0.1:14235"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+	app := natsModule.cfg.App
+
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	user, err := natsModule.UpsertUserAuth(ctx, url, "A", "u", "", application.UserOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to UpsertUserAuth: %v", err)
+	}
+	key, err := natsModule.AddAccountSigningKey(ctx, account.ID, application.AccountSigningKeyOptions{})
+	if err != nil {
+		t.Fatalf("Failed to AddAccountSigningKey: %v", err)
+	}
+	if _, err := natsModule.SetUserSigningKey(ctx, user.ID, key.ID); err != nil {
+		t.Fatalf("Failed to SetUserSigningKey: %v", err)
+	}
+
+	// the seed of the account signing key is held elsewhere, the user is still renewed with its own key
+	accountRecord, err := app.FindRecordById("nats_auth_accounts", account.ID)
+	if err != nil {
+		t.Fatalf("Failed to find account: %v", err)
+	}
+	accountRecord.Set("sign_private_key", "")
+	accountRecord.Set("sign_seed", "")
+	if err := app.UnsafeWithoutHooks().Save(accountRecord); err != nil {
+		t.Fatalf("Failed to save account: %v", err)
+	}
+
+	userRecord, err := app.FindRecordById("nats_auth_users", user.ID)
+	if err != nil {
+		t.Fatalf("Failed to find user: %v", err)
+	}
+	userRecord.Set("expires", time.Now().Add(time.Minute))
+	if err := app.UnsafeWithoutHooks().Save(userRecord); err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+
+	if err := natsModule.renewUserCredentials(ctx); err != nil {
+		t.Fatalf("Failed to renewUserCredentials: %v", err)
+	}
+
+	userRecord, err = app.FindRecordById("nats_auth_users", user.ID)
+	if err != nil {
+		t.Fatalf("Failed to find user: %v", err)
+	}
+	if userRecord.GetDateTime("expires").Time().Before(time.Now().Add(30 * time.Minute)) {
+		t.Fatalf("User was not renewed, expires %s", userRecord.GetDateTime("expires"))
+	}
+	claims, err := jwt.DecodeUserClaims(userRecord.GetString("jwt"))
+	if err != nil {
+		t.Fatalf("Failed to DecodeUserClaims: %v", err)
+	}
+	if claims.Issuer != key.PublicKey {
+		t.Errorf("User is signed by %s, want %s", claims.Issuer, key.PublicKey)
+	}
+}
+
+func Test_UserCredentialHistoryLimit(t *testing.T) {
+	const url = "nats://127.0.0.1:14236"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+	app := natsModule.cfg.App
+
+	if _, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{}); err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	user, err := natsModule.UpsertUserAuth(ctx, url, "A", "u", "", application.UserOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertUserAuth: %v", err)
+	}
+	userRecord, err := app.FindRecordById("nats_auth_users", user.ID)
+	if err != nil {
+		t.Fatalf("Failed to find user: %v", err)
+	}
+
+	for i := 0; i < userCredentialHistoryLimit+5; i++ {
+		if err := natsModule.addUserCredential(app, userRecord, "reissued"); err != nil {
+			t.Fatalf("Failed to addUserCredential: %v", err)
+		}
+	}
+
+	credentials, err := app.FindAllRecords("nats_auth_user_credentials", dbx.HashExp{"user": user.ID})
+	if err != nil {
+		t.Fatalf("Failed to find credentials: %v", err)
+	}
+	if len(credentials) != userCredentialHistoryLimit {
+		t.Errorf("History has %d entries, want %d", len(credentials), userCredentialHistoryLimit)
+	}
+}
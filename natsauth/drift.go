@@ -0,0 +1,289 @@
+package natsauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+type claimsListResponse struct {
+	Server struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"server"`
+	Data  []string `json:"data"`
+	Error *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// GetAccountDriftReport returns the latest drift report of an operator, nil if it was not checked yet
+func (m *NATSAuthModule) GetAccountDriftReport(_ context.Context, operatorID string) *application.DriftReport {
+	report, ok := m.driftReports.Load(operatorID)
+	if !ok {
+		return nil
+	}
+	return report.(*application.DriftReport)
+}
+
+// CheckAccountDrift compares the account JWTs of an operator with the full resolvers of its servers.
+// The report is kept for GetAccountDriftReport, also if the check failed.
+func (m *NATSAuthModule) CheckAccountDrift(ctx context.Context, operatorID string) (*application.DriftReport, error) {
+	report, err := m.checkAccountDrift(ctx, operatorID)
+	if err != nil {
+		report = &application.DriftReport{
+			InstallationID: operatorID,
+			Error:          err.Error(),
+			Checked:        time.Now(),
+		}
+	}
+	m.driftReports.Store(operatorID, report)
+	return report, err
+}
+
+// RepushAccounts queues the JWTs of all accounts of an operator for its servers
+func (m *NATSAuthModule) RepushAccounts(ctx context.Context, operatorID string) error {
+	return m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		accountRecords, err := txDao.FindAllRecords("nats_auth_accounts",
+			dbx.HashExp{
+				"operator": operatorID,
+			})
+		if err != nil {
+			return err
+		}
+		for _, accountRecord := range accountRecords {
+			if accountRecord.GetString("jwt") == "" {
+				continue
+			}
+			if _, err := m.queueAccountPublish(ctx, txDao, accountRecord, accountPublishUpdate, time.Now()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PruneUnknownAccounts deletes the accounts which are not in NATS Tower from the servers of an operator.
+// The accounts are checked again right before, so accounts created since the last check are kept.
+func (m *NATSAuthModule) PruneUnknownAccounts(ctx context.Context, operatorID string) error {
+	report, err := m.CheckAccountDrift(ctx, operatorID)
+	if err != nil {
+		return err
+	}
+	var publicKeys []string
+	for _, account := range report.Accounts {
+		if account.Status == application.AccountDriftUnknown {
+			publicKeys = append(publicKeys, account.PublicKey)
+		}
+	}
+	if len(publicKeys) == 0 {
+		return nil
+	}
+
+	operatorRecord, err := m.cfg.App.FindRecordById("nats_auth_operators", operatorID)
+	if err != nil {
+		return err
+	}
+	if err := m.publishAccountRemoval(ctx, m.cfg.App, operatorRecord, publicKeys...); err != nil {
+		return err
+	}
+
+	_, err = m.CheckAccountDrift(ctx, operatorID)
+	return err
+}
+
+func (m *NATSAuthModule) checkAccountDrift(ctx context.Context, operatorID string) (*application.DriftReport, error) {
+	operatorRecord, err := m.cfg.App.FindRecordById("nats_auth_operators", operatorID)
+	if err != nil {
+		return nil, err
+	}
+	if resolverMode(operatorRecord) == application.ResolverMemory {
+		return nil, fmt.Errorf("memory resolvers can not be checked for drift")
+	}
+	accountRecords, err := m.cfg.App.FindAllRecords("nats_auth_accounts",
+		dbx.HashExp{
+			"operator": operatorID,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	nc, err := m.connectSysUser(ctx, m.cfg.App, operatorRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	// public keys of the accounts in the resolver of every server, by server name
+	resolvers := map[string]map[string]bool{}
+	var failures []string
+	err = requestAll(nc, "$SYS.REQ.CLAIMS.LIST", nil, serverDiscoveryTimeout, func(msg *nats.Msg) bool {
+		var resp claimsListResponse
+		if err := json.Unmarshal(msg.Data, &resp); err != nil || resp.Server.Name == "" {
+			return false
+		}
+		if resp.Error != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", resp.Server.Name, resp.Error.Description))
+			return false
+		}
+		publicKeys := map[string]bool{}
+		for _, publicKey := range resp.Data {
+			publicKeys[publicKey] = true
+		}
+		resolvers[resp.Server.Name] = publicKeys
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 {
+		return nil, fmt.Errorf("listing the accounts failed: %s", strings.Join(failures, ", "))
+	}
+	if len(resolvers) == 0 {
+		return nil, fmt.Errorf("no NATS server with a full resolver answered")
+	}
+
+	report := &application.DriftReport{
+		InstallationID: operatorID,
+		Checked:        time.Now(),
+	}
+	for server := range resolvers {
+		report.Servers = append(report.Servers, server)
+	}
+	slices.Sort(report.Servers)
+
+	known := map[string]bool{}
+	for _, accountRecord := range accountRecords {
+		publicKey := accountRecord.GetString("public_key")
+		known[publicKey] = true
+		if accountRecord.GetString("jwt") == "" {
+			continue
+		}
+
+		drift := &application.AccountDrift{
+			PublicKey: publicKey,
+			AccountID: accountRecord.Id,
+			Name:      accountRecord.GetString("name"),
+		}
+		for _, server := range report.Servers {
+			if !resolvers[server][publicKey] {
+				drift.Servers = append(drift.Servers, server)
+			}
+		}
+		if len(drift.Servers) > 0 {
+			drift.Status = application.AccountDriftMissing
+			report.Accounts = append(report.Accounts, drift)
+			continue
+		}
+
+		jwts, err := lookupAccountJWTs(nc, publicKey, len(report.Servers))
+		if err != nil {
+			return nil, err
+		}
+		for _, accountJWT := range jwts {
+			if accountJWT != accountRecord.GetString("jwt") {
+				drift.Status = application.AccountDriftStale
+				report.Accounts = append(report.Accounts, drift)
+				break
+			}
+		}
+	}
+
+	unknown := map[string][]string{}
+	for _, server := range report.Servers {
+		for publicKey := range resolvers[server] {
+			if !known[publicKey] {
+				unknown[publicKey] = append(unknown[publicKey], server)
+			}
+		}
+	}
+	var unknownKeys []string
+	for publicKey := range unknown {
+		unknownKeys = append(unknownKeys, publicKey)
+	}
+	slices.Sort(unknownKeys)
+	for _, publicKey := range unknownKeys {
+		drift := &application.AccountDrift{
+			PublicKey: publicKey,
+			Status:    application.AccountDriftUnknown,
+			Servers:   unknown[publicKey],
+		}
+		slices.Sort(drift.Servers)
+		jwts, err := lookupAccountJWTs(nc, publicKey, len(drift.Servers))
+		if err != nil {
+			return nil, err
+		}
+		if len(jwts) > 0 {
+			if claims, err := jwt.DecodeAccountClaims(jwts[0]); err == nil {
+				drift.Name = claims.Name
+			}
+		}
+		report.Accounts = append(report.Accounts, drift)
+	}
+	return report, nil
+}
+
+// lookupAccountJWTs returns the JWTs of an account in the resolvers of the servers.
+// Servers without the account answer without a JWT, they are skipped.
+func lookupAccountJWTs(nc *nats.Conn, publicKey string, servers int) ([]string, error) {
+	var jwts []string
+	responses := 0
+	err := requestAll(nc, fmt.Sprintf("$SYS.REQ.ACCOUNT.%s.CLAIMS.LOOKUP", publicKey), nil, serverDiscoveryTimeout, func(msg *nats.Msg) bool {
+		responses++
+		if len(msg.Data) > 0 {
+			jwts = append(jwts, string(msg.Data))
+		}
+		return responses >= servers
+	})
+	return jwts, err
+}
+
+// runDriftCheck checks all operators for drift in the interval until the context is done
+func (m *NATSAuthModule) runDriftCheck(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			operatorRecords, err := m.cfg.App.FindAllRecords("nats_auth_operators")
+			if err != nil {
+				m.logger.ErrorContext(ctx, "Could not find operators for drift check",
+					slog.String("error", err.Error()))
+				continue
+			}
+			for _, operatorRecord := range operatorRecords {
+				if resolverMode(operatorRecord) == application.ResolverMemory {
+					continue
+				}
+				logger := m.logger.With(slog.String("operator_id", operatorRecord.Id),
+					slog.String("url", operatorRecord.GetString("url")))
+				report, err := m.CheckAccountDrift(ctx, operatorRecord.Id)
+				if err != nil {
+					logger.WarnContext(ctx, "Could not check accounts for drift",
+						slog.String("error", err.Error()))
+					continue
+				}
+				if len(report.Accounts) > 0 {
+					logger.WarnContext(ctx, "Accounts on the servers differ from NATS Tower",
+						slog.Int("missing", report.Count(application.AccountDriftMissing)),
+						slog.Int("stale", report.Count(application.AccountDriftStale)),
+						slog.Int("unknown", report.Count(application.AccountDriftUnknown)))
+				}
+			}
+		}
+	}
+}
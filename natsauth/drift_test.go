@@ -0,0 +1,153 @@
+package natsauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/nats-tower/nats-tower/application"
+)
+
+func Test_AccountDrift(t *testing.T) {
+	const url = "nats://127.0.0.1:14253"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+	startTestServer(t, natsModule, url, 14253)
+
+	operator, err := natsModule.GetOperator(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to GetOperator: %v", err)
+	}
+	operatorRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_operators", operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to find operator: %v", err)
+	}
+	accounts := map[string]*application.AccountAuth{}
+	for _, name := range []string{"A", "B", "C"} {
+		account, err := natsModule.UpsertAccountAuth(ctx, url, name, "", UpsertAccountAuthOptions{})
+		if err != nil {
+			t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+		}
+		waitForPublication(t, natsModule, account.ID)
+		accounts[name] = account
+	}
+
+	report, err := natsModule.CheckAccountDrift(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to CheckAccountDrift: %v", err)
+	}
+	if len(report.Servers) != 1 || len(report.Accounts) != 0 {
+		t.Fatalf("Report of the published accounts is %+v", report)
+	}
+
+	// B is removed from the servers
+	if err := natsModule.publishAccountRemoval(ctx, natsModule.cfg.App, operatorRecord, accounts["B"].PublicKey); err != nil {
+		t.Fatalf("Failed to remove account B: %v", err)
+	}
+
+	// C is changed without publishing it
+	signingKey, err := natsModule.signer.KeyPair(ctx, natsModule.cfg.App, operator.SigningPublicKey)
+	if err != nil {
+		t.Fatalf("Failed to get the operator signing key: %v", err)
+	}
+	accountRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_accounts", accounts["C"].ID)
+	if err != nil {
+		t.Fatalf("Failed to find account: %v", err)
+	}
+	claims, err := jwt.DecodeAccountClaims(accountRecord.GetString("jwt"))
+	if err != nil {
+		t.Fatalf("Failed to DecodeAccountClaims: %v", err)
+	}
+	claims.Tags.Add("changed")
+	changedJWT, err := claims.Encode(signingKey)
+	if err != nil {
+		t.Fatalf("Failed to encode account: %v", err)
+	}
+	accountRecord.Set("jwt", changedJWT)
+	if err := natsModule.cfg.App.UnsafeWithoutHooks().Save(accountRecord); err != nil {
+		t.Fatalf("Failed to save account: %v", err)
+	}
+
+	// X is only known to the servers
+	kp, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownKey, _ := kp.PublicKey()
+	unknownClaims := jwt.NewAccountClaims(unknownKey)
+	unknownClaims.Name = "X"
+	unknownJWT, err := unknownClaims.Encode(signingKey)
+	if err != nil {
+		t.Fatalf("Failed to encode account: %v", err)
+	}
+	nc, err := natsModule.SysConn(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to SysConn: %v", err)
+	}
+	resp, err := nc.Request("$SYS.REQ.CLAIMS.UPDATE", []byte(unknownJWT), 5*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to push account X: %v", err)
+	}
+	if err := claimsResponseError(resp.Data); err != nil {
+		t.Fatalf("Account X was rejected: %v", err)
+	}
+
+	report, err = natsModule.CheckAccountDrift(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to CheckAccountDrift: %v", err)
+	}
+	drifts := map[string]*application.AccountDrift{}
+	for _, drift := range report.Accounts {
+		drifts[drift.Name] = drift
+	}
+	if len(drifts) != 3 {
+		t.Errorf("Report has the accounts %v, want B, C and X", drifts)
+	}
+	for name, status := range map[string]application.AccountDriftStatus{
+		"B": application.AccountDriftMissing,
+		"C": application.AccountDriftStale,
+		"X": application.AccountDriftUnknown,
+	} {
+		if drift := drifts[name]; drift == nil || drift.Status != status {
+			t.Errorf("Account %s has the drift %+v, want %s", name, drift, status)
+		}
+	}
+	if drift := drifts["X"]; drift != nil && (drift.PublicKey != unknownKey || drift.AccountID != "" || len(drift.Servers) != 1) {
+		t.Errorf("Unknown account is %+v", drift)
+	}
+	if natsModule.GetAccountDriftReport(ctx, operator.ID) != report {
+		t.Errorf("Latest report was not kept")
+	}
+
+	// re-pushing the accounts fixes the missing and stale accounts
+	if err := natsModule.RepushAccounts(ctx, operator.ID); err != nil {
+		t.Fatalf("Failed to RepushAccounts: %v", err)
+	}
+	for _, name := range []string{"B", "C"} {
+		waitForPublication(t, natsModule, accounts[name].ID)
+	}
+	report, err = natsModule.CheckAccountDrift(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to CheckAccountDrift: %v", err)
+	}
+	if len(report.Accounts) != 1 || report.Accounts[0].Status != application.AccountDriftUnknown {
+		t.Errorf("Report after the re-push has the accounts %+v, want only X", report.Accounts)
+	}
+
+	if err := natsModule.PruneUnknownAccounts(ctx, operator.ID); err != nil {
+		t.Fatalf("Failed to PruneUnknownAccounts: %v", err)
+	}
+	if report := natsModule.GetAccountDriftReport(ctx, operator.ID); report.Error != "" || len(report.Accounts) != 0 {
+		t.Errorf("Report after the prune is %+v", report)
+	}
+
+	// memory resolvers can not be listed
+	if _, err := natsModule.UpdateOperatorResolver(ctx, operator.ID, application.ResolverMemory, ""); err != nil {
+		t.Fatalf("Failed to UpdateOperatorResolver: %v", err)
+	}
+	if _, err := natsModule.CheckAccountDrift(ctx, operator.ID); err == nil {
+		t.Errorf("Drift check of a memory resolver succeeded")
+	}
+}
@@ -0,0 +1,217 @@
+package natsauth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	jwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func GetExportFromRecord(record *core.Record) *application.AccountExport {
+	return &application.AccountExport{
+		ID:           record.Id,
+		AccountID:    record.GetString("account"),
+		Name:         record.GetString("name"),
+		Description:  record.GetString("description"),
+		Subject:      record.GetString("subject"),
+		Type:         record.GetString("type"),
+		Private:      record.GetBool("private"),
+		Importers:    record.GetStringSlice("importers"),
+		ResponseType: record.GetString("response_type"),
+	}
+}
+
+func (m *NATSAuthModule) GetExportsByAccountID(_ context.Context, accountID string) ([]*application.AccountExport, error) {
+	exportRecords, err := m.cfg.App.FindAllRecords("nats_auth_exports",
+		dbx.HashExp{
+			"account": accountID,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*application.AccountExport
+	for _, exportRecord := range exportRecords {
+		res = append(res, GetExportFromRecord(exportRecord))
+	}
+	return res, nil
+}
+
+// GetExportsByOperatorID returns the exports of all accounts of an operator (installation)
+func (m *NATSAuthModule) GetExportsByOperatorID(_ context.Context, operatorID string) ([]*application.AccountExport, error) {
+	accountRecords, err := m.cfg.App.FindAllRecords("nats_auth_accounts",
+		dbx.HashExp{
+			"operator": operatorID,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*application.AccountExport
+	for _, accountRecord := range accountRecords {
+		exportRecords, err := m.cfg.App.FindAllRecords("nats_auth_exports",
+			dbx.HashExp{
+				"account": accountRecord.Id,
+			})
+		if err != nil {
+			return nil, err
+		}
+		for _, exportRecord := range exportRecords {
+			export := GetExportFromRecord(exportRecord)
+			export.AccountName = accountRecord.GetString("name")
+			res = append(res, export)
+		}
+	}
+	return res, nil
+}
+
+// UpsertAccountExport creates or updates the export with the same name in the account.
+// The account JWTs are updated through the record hooks.
+func (m *NATSAuthModule) UpsertAccountExport(ctx context.Context,
+	accountID string, export application.AccountExport) (*application.AccountExport, error) {
+	logger := m.logger.With(slog.String("account_id", accountID), slog.String("name", export.Name))
+
+	if export.Type != "stream" && export.Type != "service" {
+		return nil, fmt.Errorf("export type must be stream or service")
+	}
+	if export.Subject == "" {
+		return nil, fmt.Errorf("export subject is required")
+	}
+
+	var res *application.AccountExport
+	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		accountRecord, err := txDao.FindRecordById("nats_auth_accounts", accountID)
+		if err != nil {
+			return err
+		}
+		importers, err := exportImporters(txDao, accountRecord, export)
+		if err != nil {
+			return err
+		}
+
+		exportRecords, err := txDao.FindAllRecords("nats_auth_exports",
+			dbx.HashExp{
+				"account": accountID,
+				"name":    export.Name,
+			})
+		if err != nil {
+			return err
+		}
+
+		var record *core.Record
+		if len(exportRecords) == 0 {
+			logger.InfoContext(ctx, "Creating export...")
+			record = core.NewRecord(m.NATSExportCollection)
+			record.Set("account", accountID)
+			record.Set("name", export.Name)
+		} else {
+			logger.InfoContext(ctx, "Updating export...")
+			record = exportRecords[0]
+		}
+
+		record.Set("description", export.Description)
+		record.Set("subject", export.Subject)
+		record.Set("type", export.Type)
+		record.Set("private", export.Private)
+		record.Set("importers", importers)
+		if export.Type == "service" {
+			record.Set("response_type", export.ResponseType)
+		} else {
+			record.Set("response_type", "")
+		}
+
+		if err := txDao.SaveWithContext(ctx, record); err != nil {
+			logger.ErrorContext(ctx, "Could not save export", slog.String("error", err.Error()))
+			return err
+		}
+		res = GetExportFromRecord(record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// exportImporters validates the accounts allowed to import the export.
+// Only private exports have importers, they have to be other accounts of the same operator.
+func exportImporters(dao core.App, accountRecord *core.Record, export application.AccountExport) ([]string, error) {
+	if !export.Private {
+		return []string{}, nil
+	}
+	importers := []string{}
+	for _, importerID := range export.Importers {
+		if importerID == "" || slices.Contains(importers, importerID) {
+			continue
+		}
+		importerRecord, err := dao.FindRecordById("nats_auth_accounts", importerID)
+		if err != nil {
+			return nil, fmt.Errorf("importing account %s not found: %w", importerID, err)
+		}
+		if importerRecord.Id == accountRecord.Id {
+			return nil, fmt.Errorf("an account can not import its own export")
+		}
+		if importerRecord.GetString("operator") != accountRecord.GetString("operator") {
+			return nil, fmt.Errorf("importing account %s belongs to a different installation", importerRecord.GetString("name"))
+		}
+		importers = append(importers, importerRecord.Id)
+	}
+	return importers, nil
+}
+
+// canImportExport reports if the account may import the export. Public exports can be
+// imported by all accounts, private exports only by the accounts allowed by the exporter.
+func canImportExport(exportRecord *core.Record, accountID string) bool {
+	return !exportRecord.GetBool("private") || slices.Contains(exportRecord.GetStringSlice("importers"), accountID)
+}
+
+func (m *NATSAuthModule) DeleteAccountExport(ctx context.Context, exportID string) error {
+	record, err := m.cfg.App.FindRecordById("nats_auth_exports", exportID)
+	if err != nil {
+		return err
+	}
+	m.logger.InfoContext(ctx, "Deleting export...",
+		slog.String("account_id", record.GetString("account")),
+		slog.String("name", record.GetString("name")))
+	return m.cfg.App.DeleteWithContext(ctx, record)
+}
+
+// getAccountExports transforms the exports stored for an account into jwt.Exports
+func (m *NATSAuthModule) getAccountExports(_ context.Context, dao core.App, accRec *core.Record) (jwt.Exports, error) {
+	var exports jwt.Exports
+	if accRec.GetString("name") == "SYS" {
+		exports = append(exports, systemAccountExports()...)
+	}
+
+	exportRecords, err := dao.FindAllRecords("nats_auth_exports",
+		dbx.HashExp{
+			"account": accRec.Id,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, exportRecord := range exportRecords {
+		export := &jwt.Export{
+			Name:     exportRecord.GetString("name"),
+			Subject:  jwt.Subject(exportRecord.GetString("subject")),
+			Type:     jwt.Stream,
+			TokenReq: exportRecord.GetBool("private"),
+			Info: jwt.Info{
+				Description: exportRecord.GetString("description"),
+			},
+		}
+		if exportRecord.GetString("type") == "service" {
+			export.Type = jwt.Service
+			export.ResponseType = jwt.ResponseType(exportRecord.GetString("response_type"))
+		}
+		exports = append(exports, export)
+	}
+
+	return exports, nil
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 )
 
-func generateOperatorRecord(_ context.Context,
+func (m *NATSAuthModule) generateOperatorRecord(_ context.Context,
 	record *core.Record,
 	url string) (*core.Record, error) {
 	// create operator
@@ -61,19 +61,24 @@ func generateOperatorRecord(_ context.Context,
 
 	record.Set("url", url)
 	record.Set("public_key", pubKey)
-	record.Set("private_key", string(privateKey))
-	record.Set("seed", string(seed))
 	record.Set("sign_public_key", signPubKey)
-	record.Set("sign_private_key", string(signPrivateKey))
-	record.Set("sign_seed", string(signSeed))
 	record.Set("jwt", jwtValue)
+	err = m.keyRing.setSecrets(record, map[string]string{
+		"private_key":      string(privateKey),
+		"seed":             string(seed),
+		"sign_private_key": string(signPrivateKey),
+		"sign_seed":        string(signSeed),
+	})
+	if err != nil {
+		return nil, err
+	}
 	return record, nil
 }
 
-func generateAccountRecord(_ context.Context,
+func (m *NATSAuthModule) generateAccountRecord(_ context.Context,
 	record *core.Record,
-	operatorID,
-	operatorSigningSeed,
+	operatorID string,
+	operatorKP nkeys.KeyPair,
 	name,
 	description string,
 	limits jwt.OperatorLimits) (*core.Record, error) {
@@ -123,35 +128,11 @@ func generateAccountRecord(_ context.Context,
 
 	if name == "SYS" {
 		// Sys Account does NOT use JetStream instead has some exports!
-		accountClaims.Exports = jwt.Exports{&jwt.Export{
-			Name:                 "account-monitoring-services",
-			Subject:              "$SYS.REQ.ACCOUNT.*.*",
-			Type:                 jwt.Service,
-			ResponseType:         jwt.ResponseTypeStream,
-			AccountTokenPosition: 4,
-			Info: jwt.Info{
-				Description: `Request account specific monitoring services for: SUBSZ, CONNZ, LEAFZ, JSZ and INFO`,
-				InfoURL:     "https://docs.nats.io/nats-server/configuration/sys_accounts",
-			},
-		}, &jwt.Export{
-			Name:                 "account-monitoring-streams",
-			Subject:              "$SYS.ACCOUNT.*.>",
-			Type:                 jwt.Stream,
-			AccountTokenPosition: 3,
-			Info: jwt.Info{
-				Description: `Account specific monitoring stream`,
-				InfoURL:     "https://docs.nats.io/nats-server/configuration/sys_accounts",
-			},
-		}}
+		accountClaims.Exports = systemAccountExports()
 	} else {
 		accountClaims.Limits = limits
 	}
 
-	operatorKP, err := nkeys.FromSeed([]byte(operatorSigningSeed))
-	if err != nil {
-		return nil, err
-	}
-
 	jwtValue, err := accountClaims.Encode(operatorKP)
 	if err != nil {
 		return nil, err
@@ -161,18 +142,23 @@ func generateAccountRecord(_ context.Context,
 	record.Set("description", description)
 	record.Set("operator", operatorID)
 	record.Set("public_key", pubKey)
-	record.Set("private_key", string(privateKey))
-	record.Set("seed", string(seed))
 	record.Set("sign_public_key", signPubKey)
-	record.Set("sign_private_key", string(signPrivateKey))
-	record.Set("sign_seed", string(signSeed))
 	record.Set("jwt", jwtValue)
+	err = m.keyRing.setSecrets(record, map[string]string{
+		"private_key":      string(privateKey),
+		"seed":             string(seed),
+		"sign_private_key": string(signPrivateKey),
+		"sign_seed":        string(signSeed),
+	})
+	if err != nil {
+		return nil, err
+	}
 	return record, nil
 }
 
-func generateUserRecord(_ context.Context,
+func (m *NATSAuthModule) generateUserRecord(_ context.Context,
 	record *core.Record,
-	accountID, accountPubKey, accountSigningSeed string, name string) (*core.Record, error) {
+	accountID, accountPubKey string, accountKP nkeys.KeyPair, name string) (*core.Record, error) {
 	// create user
 	userKP, err := nkeys.CreateUser()
 	if err != nil {
@@ -196,14 +182,10 @@ func generateUserRecord(_ context.Context,
 	userClaims := jwt.NewUserClaims(pubKey)
 	userClaims.Name = name
 	userClaims.IssuerAccount = accountPubKey
+	applyUserTTL(record, userClaims)
 
-	// TODO move limits to separate collection
-	// TODO move permissions to separate collection
-
-	accountKP, err := nkeys.FromSeed([]byte(accountSigningSeed))
-	if err != nil {
-		return nil, err
-	}
+	// permissions and limits are stored in nats_auth_permissions and nats_auth_user_limits
+	// and applied by signUserRecord
 
 	jwtValue, err := userClaims.Encode(accountKP)
 	if err != nil {
@@ -217,9 +199,39 @@ func generateUserRecord(_ context.Context,
 	record.Set("name", name)
 	record.Set("account", accountID)
 	record.Set("public_key", pubKey)
-	record.Set("private_key", string(privateKey))
-	record.Set("seed", string(seed))
 	record.Set("jwt", jwtValue)
-	record.Set("creds", creds)
+	err = m.keyRing.setSecrets(record, map[string]string{
+		"private_key": string(privateKey),
+		"seed":        string(seed),
+		"creds":       string(creds),
+	})
+	if err != nil {
+		return nil, err
+	}
 	return record, nil
 }
+
+// systemAccountExports are the exports every SYS account carries so other accounts
+// can import their monitoring services and streams.
+func systemAccountExports() jwt.Exports {
+	return jwt.Exports{&jwt.Export{
+		Name:                 "account-monitoring-services",
+		Subject:              "$SYS.REQ.ACCOUNT.*.*",
+		Type:                 jwt.Service,
+		ResponseType:         jwt.ResponseTypeStream,
+		AccountTokenPosition: 4,
+		Info: jwt.Info{
+			Description: `Request account specific monitoring services for: SUBSZ, CONNZ, LEAFZ, JSZ and INFO`,
+			InfoURL:     "https://docs.nats.io/nats-server/configuration/sys_accounts",
+		},
+	}, &jwt.Export{
+		Name:                 "account-monitoring-streams",
+		Subject:              "$SYS.ACCOUNT.*.>",
+		Type:                 jwt.Stream,
+		AccountTokenPosition: 3,
+		Info: jwt.Info{
+			Description: `Account specific monitoring stream`,
+			InfoURL:     "https://docs.nats.io/nats-server/configuration/sys_accounts",
+		},
+	}}
+}
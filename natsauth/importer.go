@@ -0,0 +1,604 @@
+package natsauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type ImportOptions struct {
+	// URL of the installation. Defaults to the first service URL of the operator JWT.
+	URL         string
+	Description string
+	// KeysDir is a nsc keys directory (the one containing keys/ and creds/).
+	// Seeds found in it are stored with the imported operator, accounts and users.
+	KeysDir string
+	// SysCreds are the credentials of a user of the system account.
+	// They are stored as the sys user NATS Tower uses to talk to the servers.
+	SysCreds string
+	// Connection are the seed URLs and TLS settings to connect to the servers.
+	// They are stored with the imported operator.
+	Connection application.OperatorConnection
+}
+
+// importedAccount is an account JWT together with the users found for it
+type importedAccount struct {
+	JWT   string
+	Users []importedUser
+}
+
+type importedUser struct {
+	JWT  string
+	Seed string
+	// Name overrides the name in the user JWT
+	Name string
+}
+
+// ImportFromNSCStore imports the operator stored in an nsc store directory
+// (e.g. ~/.local/share/nats/nsc/stores/<operator>) with all its accounts and users.
+// Existing keys are kept, nothing is published to the servers.
+func (m *NATSAuthModule) ImportFromNSCStore(ctx context.Context,
+	operatorDir string, opts ImportOptions) (*application.ImportReport, error) {
+	report := &application.ImportReport{}
+
+	operatorJWTs, err := filepath.Glob(filepath.Join(operatorDir, "*.jwt"))
+	if err != nil {
+		return nil, err
+	}
+	if len(operatorJWTs) != 1 {
+		return nil, fmt.Errorf("expected exactly one operator JWT in %s, found %d", operatorDir, len(operatorJWTs))
+	}
+	operatorJWT, err := os.ReadFile(operatorJWTs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	accountDirs, err := filepath.Glob(filepath.Join(operatorDir, "accounts", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []importedAccount
+	for _, accountDir := range accountDirs {
+		name := filepath.Base(accountDir)
+		accountJWT, err := os.ReadFile(filepath.Join(accountDir, name+".jwt"))
+		if err != nil {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("account %s: %s", name, err.Error()))
+			continue
+		}
+		account := importedAccount{
+			JWT: string(accountJWT),
+		}
+
+		userJWTs, err := filepath.Glob(filepath.Join(accountDir, "users", "*.jwt"))
+		if err != nil {
+			return nil, err
+		}
+		for _, userJWTFile := range userJWTs {
+			userJWT, err := os.ReadFile(userJWTFile)
+			if err != nil {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("user %s/%s: %s", name, filepath.Base(userJWTFile), err.Error()))
+				continue
+			}
+			account.Users = append(account.Users, importedUser{
+				JWT: string(userJWT),
+			})
+		}
+		accounts = append(accounts, account)
+	}
+
+	err = m.importInstallation(ctx, string(operatorJWT), accounts, opts, report)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ImportFromServer imports the accounts known to the resolver of a running installation.
+// The operator JWT can not be queried from the servers and has to be passed in,
+// opts.SysCreds are required to list and look up the accounts.
+// Users are not stored on the servers and are therefore not imported.
+func (m *NATSAuthModule) ImportFromServer(ctx context.Context,
+	operatorJWT string, opts ImportOptions) (*application.ImportReport, error) {
+	report := &application.ImportReport{}
+
+	if opts.SysCreds == "" {
+		return nil, fmt.Errorf("sys user credentials are required to import from a server")
+	}
+
+	url := opts.URL
+	if url == "" {
+		operatorClaims, err := jwt.DecodeOperatorClaims(operatorJWT)
+		if err != nil {
+			return nil, err
+		}
+		if len(operatorClaims.OperatorServiceURLs) == 0 {
+			return nil, fmt.Errorf("no URL given and the operator JWT contains no service URLs")
+		}
+		url = operatorClaims.OperatorServiceURLs[0]
+		opts.URL = url
+	}
+
+	sysUserJWT, err := jwt.ParseDecoratedJWT([]byte(opts.SysCreds))
+	if err != nil {
+		return nil, err
+	}
+	sysUserKP, err := jwt.ParseDecoratedNKey([]byte(opts.SysCreds))
+	if err != nil {
+		return nil, err
+	}
+	sysUserSeed, err := sysUserKP.Seed()
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger.InfoContext(ctx, "Listing accounts of installation...", slog.String("url", url))
+
+	connectOpts, err := connectionOptions(opts.Connection)
+	if err != nil {
+		return nil, err
+	}
+	urls := strings.Join(append([]string{url}, opts.Connection.SeedURLs...), ",")
+	nc, err := nats.Connect(urls, append(connectOpts, nats.UserJWTAndSeed(sysUserJWT, string(sysUserSeed)))...)
+	if err != nil {
+		return nil, err
+	}
+	defer nc.Close()
+
+	resp, err := nc.Request("$SYS.REQ.CLAIMS.LIST", nil, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("could not list accounts (is a full nats resolver configured?): %w", err)
+	}
+
+	listResponse := struct {
+		Data []string `json:"data"`
+	}{}
+	err = json.Unmarshal(resp.Data, &listResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []importedAccount
+	for _, publicKey := range listResponse.Data {
+		resp, err := nc.Request(fmt.Sprintf("$SYS.REQ.ACCOUNT.%s.CLAIMS.LOOKUP", publicKey), nil, 5*time.Second)
+		if err != nil {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("account %s: %s", publicKey, err.Error()))
+			continue
+		}
+		if len(resp.Data) == 0 {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("account %s: not found in resolver", publicKey))
+			continue
+		}
+		accounts = append(accounts, importedAccount{
+			JWT: string(resp.Data),
+		})
+	}
+
+	report.Skipped = append(report.Skipped, "users: users are not stored on the servers, only the sys user was imported")
+
+	err = m.importInstallation(ctx, operatorJWT, accounts, opts, report)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// importInstallation creates the operator, account and user records of an existing installation.
+// Keys are taken over as they are, seeds are looked up in opts.KeysDir.
+// Accounts without a signing seed are marked as read-only.
+func (m *NATSAuthModule) importInstallation(ctx context.Context,
+	operatorJWT string, accounts []importedAccount, opts ImportOptions, report *application.ImportReport) error {
+	operatorClaims, err := jwt.DecodeOperatorClaims(operatorJWT)
+	if err != nil {
+		return err
+	}
+
+	url := opts.URL
+	if url == "" {
+		if len(operatorClaims.OperatorServiceURLs) == 0 {
+			return fmt.Errorf("no URL given and the operator JWT contains no service URLs")
+		}
+		url = operatorClaims.OperatorServiceURLs[0]
+	}
+	description := opts.Description
+	if description == "" {
+		description = operatorClaims.Name
+	}
+
+	for _, seedURL := range opts.Connection.SeedURLs {
+		if err := validateServerURL(seedURL); err != nil {
+			return err
+		}
+	}
+	if _, err := tlsConfig(opts.Connection); err != nil {
+		return err
+	}
+
+	logger := m.logger.With(slog.String("url", url), slog.String("operator", operatorClaims.Subject))
+	keys := importKeyStore(opts.KeysDir)
+	systemAccount := operatorClaims.SystemAccount
+
+	if opts.SysCreds != "" {
+		sysUserJWT, err := jwt.ParseDecoratedJWT([]byte(opts.SysCreds))
+		if err != nil {
+			return err
+		}
+		sysUserKP, err := jwt.ParseDecoratedNKey([]byte(opts.SysCreds))
+		if err != nil {
+			return err
+		}
+		sysUserSeed, err := sysUserKP.Seed()
+		if err != nil {
+			return err
+		}
+		sysUserClaims, err := jwt.DecodeUserClaims(sysUserJWT)
+		if err != nil {
+			return err
+		}
+		sysAccount := sysUserClaims.IssuerAccount
+		if sysAccount == "" {
+			sysAccount = sysUserClaims.Issuer
+		}
+		if systemAccount == "" {
+			// operators created by NATS Tower do not name their system account
+			systemAccount = sysAccount
+		}
+		if sysAccount != systemAccount {
+			return fmt.Errorf("sys credentials do not belong to the system account of the operator")
+		}
+
+		for i := range accounts {
+			accountClaims, err := jwt.DecodeAccountClaims(accounts[i].JWT)
+			if err != nil || accountClaims.Subject != sysAccount {
+				continue
+			}
+			// the sys credentials replace a user with the same key
+			var users []importedUser
+			for _, user := range accounts[i].Users {
+				userClaims, err := jwt.DecodeUserClaims(user.JWT)
+				if err == nil && userClaims.Subject == sysUserClaims.Subject {
+					continue
+				}
+				users = append(users, user)
+			}
+			accounts[i].Users = append(users, importedUser{
+				JWT:  sysUserJWT,
+				Seed: string(sysUserSeed),
+				Name: "sys",
+			})
+		}
+	}
+
+	return m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		existing, err := txDao.FindAllRecords("nats_auth_operators",
+			dbx.Or(
+				dbx.HashExp{"url": url},
+				dbx.HashExp{"public_key": operatorClaims.Subject},
+			))
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			return fmt.Errorf("installation %s is already managed by NATS Tower", url)
+		}
+
+		operatorRecord := core.NewRecord(m.NATSOperatorCollection)
+		operatorRecord.Set("url", url)
+		operatorRecord.Set("description", description)
+		operatorRecord.Set("public_key", operatorClaims.Subject)
+		operatorRecord.Set("jwt", operatorJWT)
+		operatorRecord.Set("seed_urls", nonNilStrings(opts.Connection.SeedURLs))
+		operatorRecord.Set("tls_ca", opts.Connection.TLSCA)
+		operatorRecord.Set("tls_cert", opts.Connection.TLSCert)
+		operatorRecord.Set("tls_handshake_first", opts.Connection.TLSHandshakeFirst)
+		if err := m.keyRing.setSecret(operatorRecord, "tls_key", opts.Connection.TLSKey); err != nil {
+			return err
+		}
+		err = m.setImportedKeys(operatorRecord, keys, operatorClaims.Subject, operatorClaims.SigningKeys)
+		if err != nil {
+			return err
+		}
+		if operatorRecord.GetString("sign_seed") == "" {
+			report.Skipped = append(report.Skipped, "operator: no seed found, accounts can not be created or updated")
+		}
+
+		logger.InfoContext(ctx, "Importing operator...")
+		if err := txDao.SaveWithContext(ctx, operatorRecord); err != nil {
+			logger.ErrorContext(ctx, "Could not save operator", slog.String("error", err.Error()))
+			return err
+		}
+		report.OperatorID = operatorRecord.Id
+
+		for _, account := range accounts {
+			accountClaims, err := jwt.DecodeAccountClaims(account.JWT)
+			if err != nil {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("account: %s", err.Error()))
+				continue
+			}
+			if accountClaims.Issuer != operatorClaims.Subject && !operatorClaims.SigningKeys.Contains(accountClaims.Issuer) {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("account %s: not issued by operator %s", accountClaims.Name, operatorClaims.Name))
+				continue
+			}
+
+			name := accountClaims.Name
+			accountDescription := accountClaims.Description
+			if accountClaims.Subject == systemAccount && name != "SYS" {
+				// NATS Tower finds the system account by its name
+				accountDescription = fmt.Sprintf("Imported system account %s", name)
+				name = "SYS"
+			}
+
+			accountRecord := core.NewRecord(m.NATSAccountCollection)
+			accountRecord.Set("name", name)
+			accountRecord.Set("description", accountDescription)
+			accountRecord.Set("operator", operatorRecord.Id)
+			accountRecord.Set("public_key", accountClaims.Subject)
+			accountRecord.Set("jwt", account.JWT)
+			err = m.setImportedKeys(accountRecord, keys, accountClaims.Subject, accountClaims.SigningKeys.Keys())
+			if err != nil {
+				return err
+			}
+			// users are always signed with a signing key, see generateUserRecord
+			if accountRecord.GetString("sign_public_key") == accountClaims.Subject {
+				accountRecord.Set("sign_public_key", "")
+				accountRecord.Set("sign_private_key", "")
+				accountRecord.Set("sign_seed", "")
+			}
+			readOnly := accountRecord.GetString("sign_seed") == ""
+			accountRecord.Set("read_only", readOnly)
+
+			logger.InfoContext(ctx, "Importing account...", slog.String("name", name), slog.Bool("read_only", readOnly))
+			// the account is already known to the servers, so the hooks
+			// must neither generate new keys nor publish it
+			if err := saveImportedRecord(txDao, accountRecord); err != nil {
+				logger.ErrorContext(ctx, "Could not save account", slog.String("error", err.Error()))
+				return err
+			}
+			report.Accounts = append(report.Accounts, name)
+			if readOnly {
+				report.ReadOnlyAccounts = append(report.ReadOnlyAccounts, name)
+			}
+			if name != "SYS" && (len(accountClaims.Exports) > 0 || len(accountClaims.Imports) > 0) {
+				report.Skipped = append(report.Skipped,
+					fmt.Sprintf("account %s: exports and imports stay in the imported JWT but are not managed by NATS Tower", name))
+			}
+
+			for _, user := range account.Users {
+				err := m.importUser(ctx, txDao, keys, accountRecord, accountClaims, user, report)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		sysAccount, err := m.getSysAccountByID(ctx, txDao, operatorRecord.Id)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		if err == ErrNotFound {
+			report.Skipped = append(report.Skipped, "operator: system account not found")
+			return nil
+		}
+		sysUsers, err := txDao.FindAllRecords("nats_auth_users",
+			dbx.HashExp{
+				"account": sysAccount.ID,
+				"name":    "sys",
+			})
+		if err != nil {
+			return err
+		}
+		if len(sysUsers) == 0 {
+			report.Skipped = append(report.Skipped, "operator: no sys user found, pass the sys credentials to manage the servers")
+		}
+
+		return nil
+	})
+}
+
+func (m *NATSAuthModule) importUser(ctx context.Context, dao core.App, keys importKeyStore,
+	accountRecord *core.Record, accountClaims *jwt.AccountClaims, user importedUser, report *application.ImportReport) error {
+	userClaims, err := jwt.DecodeUserClaims(user.JWT)
+	if err != nil {
+		report.Skipped = append(report.Skipped, fmt.Sprintf("user of account %s: %s", accountClaims.Name, err.Error()))
+		return nil
+	}
+	name := user.Name
+	if name == "" {
+		name = userClaims.Name
+	}
+	accountName := accountRecord.GetString("name")
+
+	issuerAccount := userClaims.IssuerAccount
+	if issuerAccount == "" {
+		issuerAccount = userClaims.Issuer
+	}
+	if issuerAccount != accountClaims.Subject {
+		report.Skipped = append(report.Skipped, fmt.Sprintf("user %s/%s: not issued by the account", accountName, name))
+		return nil
+	}
+
+	seed := user.Seed
+	if seed == "" {
+		seed = keys.seed(userClaims.Subject)
+	}
+	if seed == "" {
+		report.Skipped = append(report.Skipped, fmt.Sprintf("user %s/%s: no seed found", accountName, name))
+		return nil
+	}
+
+	userKP, err := nkeys.FromSeed([]byte(seed))
+	if err != nil {
+		return err
+	}
+	privateKey, err := userKP.PrivateKey()
+	if err != nil {
+		return err
+	}
+	creds, err := jwt.FormatUserConfig(user.JWT, []byte(seed))
+	if err != nil {
+		return err
+	}
+
+	userRecord := core.NewRecord(m.NATSUserCollection)
+	userRecord.Set("name", name)
+	userRecord.Set("account", accountRecord.Id)
+	userRecord.Set("bearer", userClaims.BearerToken)
+	userRecord.Set("public_key", userClaims.Subject)
+	userRecord.Set("jwt", user.JWT)
+	err = m.keyRing.setSecrets(userRecord, map[string]string{
+		"private_key": string(privateKey),
+		"seed":        seed,
+		"creds":       string(creds),
+	})
+	if err != nil {
+		return err
+	}
+
+	m.logger.InfoContext(ctx, "Importing user...", slog.String("account", accountName), slog.String("name", name))
+	// public_key is set, so the hooks keep the keys and only create the nats context
+	if err := dao.SaveWithContext(ctx, userRecord); err != nil {
+		m.logger.ErrorContext(ctx, "Could not save user", slog.String("error", err.Error()))
+		return err
+	}
+	report.Users = append(report.Users, accountName+"/"+name)
+
+	// the permissions and limits are already part of the imported JWT, do not re-sign it
+	if err := m.importUserPermissions(dao, userRecord, userClaims); err != nil {
+		return err
+	}
+	return m.importUserLimits(dao, userRecord, userClaims)
+}
+
+func (m *NATSAuthModule) importUserPermissions(dao core.App, userRecord *core.Record, userClaims *jwt.UserClaims) error {
+	perms := userClaims.Permissions
+	if len(perms.Pub.Allow) == 0 && len(perms.Pub.Deny) == 0 &&
+		len(perms.Sub.Allow) == 0 && len(perms.Sub.Deny) == 0 && perms.Resp == nil {
+		return nil
+	}
+
+	permissionRecord := core.NewRecord(m.NATSPermissionCollection)
+	permissionRecord.Set("user", userRecord.Id)
+	permissionRecord.Set("pub_allow", nonNilStrings(perms.Pub.Allow))
+	permissionRecord.Set("pub_deny", nonNilStrings(perms.Pub.Deny))
+	permissionRecord.Set("sub_allow", nonNilStrings(perms.Sub.Allow))
+	permissionRecord.Set("sub_deny", nonNilStrings(perms.Sub.Deny))
+	if perms.Resp != nil {
+		permissionRecord.Set("allow_responses", true)
+		permissionRecord.Set("responses_max", perms.Resp.MaxMsgs)
+		permissionRecord.Set("responses_ttl", perms.Resp.Expires.Milliseconds())
+	}
+	return saveImportedRecord(dao, permissionRecord)
+}
+
+func (m *NATSAuthModule) importUserLimits(dao core.App, userRecord *core.Record, userClaims *jwt.UserClaims) error {
+	if userClaims.Limits.IsUnlimited() && len(userClaims.AllowedConnectionTypes) == 0 {
+		return nil
+	}
+
+	times := []application.UserTimeRange{}
+	for _, timeRange := range userClaims.Limits.Times {
+		times = append(times, application.UserTimeRange{
+			Start: timeRange.Start,
+			End:   timeRange.End,
+		})
+	}
+
+	limitRecord := core.NewRecord(m.NATSUserLimitCollection)
+	limitRecord.Set("user", userRecord.Id)
+	limitRecord.Set("max_subscriptions", userClaims.Limits.Subs)
+	limitRecord.Set("max_data", userClaims.Limits.Data)
+	limitRecord.Set("max_payload", userClaims.Limits.Payload)
+	limitRecord.Set("connection_types", nonNilStrings(userClaims.AllowedConnectionTypes))
+	limitRecord.Set("src", nonNilStrings(userClaims.Limits.Src))
+	limitRecord.Set("times", times)
+	limitRecord.Set("locale", userClaims.Limits.Locale)
+	return saveImportedRecord(dao, limitRecord)
+}
+
+// setImportedKeys stores the seeds found for an imported operator or account.
+// The first signing key with a known seed is used for signing, the identity key otherwise.
+func (m *NATSAuthModule) setImportedKeys(record *core.Record, keys importKeyStore, publicKey string, signingKeys []string) error {
+	seed := keys.seed(publicKey)
+	if seed != "" {
+		kp, err := nkeys.FromSeed([]byte(seed))
+		if err != nil {
+			return err
+		}
+		privateKey, err := kp.PrivateKey()
+		if err != nil {
+			return err
+		}
+		err = m.keyRing.setSecrets(record, map[string]string{
+			"seed":        seed,
+			"private_key": string(privateKey),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	signPublicKey := publicKey
+	signSeed := seed
+	for _, signingKey := range signingKeys {
+		if s := keys.seed(signingKey); s != "" {
+			signPublicKey = signingKey
+			signSeed = s
+			break
+		}
+	}
+	if signSeed == "" {
+		return nil
+	}
+
+	kp, err := nkeys.FromSeed([]byte(signSeed))
+	if err != nil {
+		return err
+	}
+	signPrivateKey, err := kp.PrivateKey()
+	if err != nil {
+		return err
+	}
+	record.Set("sign_public_key", signPublicKey)
+	return m.keyRing.setSecrets(record, map[string]string{
+		"sign_private_key": string(signPrivateKey),
+		"sign_seed":        signSeed,
+	})
+}
+
+// saveImportedRecord stores a record without triggering the hooks
+func saveImportedRecord(dao core.App, record *core.Record) error {
+	if err := dao.Validate(record); err != nil {
+		return err
+	}
+	if record.Id == "" {
+		record.Id = core.GenerateDefaultRandomId()
+	}
+	return dao.UnsafeWithoutHooks().Save(record)
+}
+
+// importKeyStore looks up seeds in a nsc keys directory.
+// Keys are stored as keys/<first char>/<second and third char>/<public key>.nk
+type importKeyStore string
+
+func (k importKeyStore) seed(publicKey string) string {
+	if k == "" || len(publicKey) < 3 {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(string(k), "keys", publicKey[0:1], publicKey[1:3], publicKey+".nk"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,68 @@
+package natsauth
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func Test_ImportFromServer(t *testing.T) {
+	const url = "tls://127.0.0.1:14243"
+	ctx := context.Background()
+	certs := newTestTLS(t)
+
+	source := newTestModule(t, url)
+	operator, err := source.GetOperator(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to GetOperator: %v", err)
+	}
+	if _, err := source.UpdateOperatorConnection(ctx, operator.ID, certs.connection()); err != nil {
+		t.Fatalf("Failed to UpdateOperatorConnection: %v", err)
+	}
+	startTestServer(t, source, url, 14243, certs.serverOptions(t))
+
+	account, err := source.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	waitForPublication(t, source, account.ID)
+	sysUser, err := source.GetSysUserByURL(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to GetSysUserByURL: %v", err)
+	}
+
+	natsModule := newTestModule(t)
+	opts := ImportOptions{
+		URL:      url,
+		SysCreds: sysUser.Creds,
+	}
+	if _, err := natsModule.ImportFromServer(ctx, operator.JWT, opts); err == nil {
+		t.Fatalf("Import without the TLS settings of the server succeeded")
+	}
+
+	opts.Connection = certs.connection()
+	report, err := natsModule.ImportFromServer(ctx, operator.JWT, opts)
+	if err != nil {
+		t.Fatalf("Failed to ImportFromServer: %v", err)
+	}
+	if !slices.Contains(report.Accounts, "A") || !slices.Contains(report.Users, "SYS/sys") {
+		t.Errorf("Import report is %+v", report)
+	}
+
+	// the imported installation is reached with the TLS settings of the import
+	imported, err := natsModule.GetOperatorByID(ctx, report.OperatorID)
+	if err != nil {
+		t.Fatalf("Failed to GetOperatorByID: %v", err)
+	}
+	if conn := imported.Connection; conn.TLSCA != certs.CA || conn.TLSCert != certs.ClientCert ||
+		conn.TLSKey != certs.ClientKey || !conn.TLSHandshakeFirst {
+		t.Errorf("Imported installation has the connection settings %+v", imported.Connection)
+	}
+	nc, err := natsModule.SysConn(ctx, report.OperatorID)
+	if err != nil {
+		t.Fatalf("Failed to connect to the imported installation: %v", err)
+	}
+	if !nc.IsConnected() {
+		t.Errorf("Connection is %s", nc.Status())
+	}
+}
@@ -0,0 +1,207 @@
+package natsauth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	jwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func GetImportFromRecord(record *core.Record, exportRecord *core.Record) *application.AccountImport {
+	return &application.AccountImport{
+		ID:           record.Id,
+		AccountID:    record.GetString("account"),
+		ExportID:     record.GetString("export"),
+		Name:         record.GetString("name"),
+		LocalSubject: record.GetString("local_subject"),
+		Subject:      exportRecord.GetString("subject"),
+		Type:         exportRecord.GetString("type"),
+		Private:      exportRecord.GetBool("private"),
+	}
+}
+
+func (m *NATSAuthModule) GetImportsByAccountID(_ context.Context, accountID string) ([]*application.AccountImport, error) {
+	importRecords, err := m.cfg.App.FindAllRecords("nats_auth_imports",
+		dbx.HashExp{
+			"account": accountID,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*application.AccountImport
+	for _, importRecord := range importRecords {
+		exportRecord, err := m.cfg.App.FindRecordById("nats_auth_exports", importRecord.GetString("export"))
+		if err != nil {
+			return nil, err
+		}
+		exportAccountRecord, err := m.cfg.App.FindRecordById("nats_auth_accounts", exportRecord.GetString("account"))
+		if err != nil {
+			return nil, err
+		}
+		imp := GetImportFromRecord(importRecord, exportRecord)
+		imp.ExportAccountName = exportAccountRecord.GetString("name")
+		res = append(res, imp)
+	}
+	return res, nil
+}
+
+// UpsertAccountImport creates or updates the import with the same name in the account.
+// The export has to belong to another account of the same operator,
+// private exports only allow the importing accounts chosen by the exporter.
+// The account JWT is updated through the record hooks.
+func (m *NATSAuthModule) UpsertAccountImport(ctx context.Context,
+	accountID string, imp application.AccountImport) (*application.AccountImport, error) {
+	logger := m.logger.With(slog.String("account_id", accountID), slog.String("name", imp.Name))
+
+	var res *application.AccountImport
+	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		accountRecord, err := txDao.FindRecordById("nats_auth_accounts", accountID)
+		if err != nil {
+			return err
+		}
+
+		exportRecord, err := txDao.FindRecordById("nats_auth_exports", imp.ExportID)
+		if err != nil {
+			return err
+		}
+
+		exportAccountRecord, err := txDao.FindRecordById("nats_auth_accounts", exportRecord.GetString("account"))
+		if err != nil {
+			return err
+		}
+
+		if exportAccountRecord.Id == accountRecord.Id {
+			return fmt.Errorf("an account can not import its own export")
+		}
+		if exportAccountRecord.GetString("operator") != accountRecord.GetString("operator") {
+			return fmt.Errorf("export belongs to a different installation")
+		}
+		if !canImportExport(exportRecord, accountRecord.Id) {
+			return fmt.Errorf("account %s is not allowed to import the private export %s",
+				accountRecord.GetString("name"), exportRecord.GetString("name"))
+		}
+
+		importRecords, err := txDao.FindAllRecords("nats_auth_imports",
+			dbx.HashExp{
+				"account": accountID,
+				"name":    imp.Name,
+			})
+		if err != nil {
+			return err
+		}
+
+		var record *core.Record
+		if len(importRecords) == 0 {
+			logger.InfoContext(ctx, "Creating import...")
+			record = core.NewRecord(m.NATSImportCollection)
+			record.Set("account", accountID)
+			record.Set("name", imp.Name)
+		} else {
+			logger.InfoContext(ctx, "Updating import...")
+			record = importRecords[0]
+		}
+		record.Set("export", exportRecord.Id)
+		record.Set("local_subject", imp.LocalSubject)
+
+		if err := txDao.SaveWithContext(ctx, record); err != nil {
+			logger.ErrorContext(ctx, "Could not save import", slog.String("error", err.Error()))
+			return err
+		}
+
+		res = GetImportFromRecord(record, exportRecord)
+		res.ExportAccountName = exportAccountRecord.GetString("name")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (m *NATSAuthModule) DeleteAccountImport(ctx context.Context, importID string) error {
+	record, err := m.cfg.App.FindRecordById("nats_auth_imports", importID)
+	if err != nil {
+		return err
+	}
+	m.logger.InfoContext(ctx, "Deleting import...",
+		slog.String("account_id", record.GetString("account")),
+		slog.String("name", record.GetString("name")))
+	return m.cfg.App.DeleteWithContext(ctx, record)
+}
+
+// getAccountImports transforms the imports stored for an account into jwt.Imports.
+// Imports of private exports get an activation token signed by the exporting account,
+// if the exporting account allows the account to import it.
+func (m *NATSAuthModule) getAccountImports(ctx context.Context, dao core.App, accRec *core.Record) (jwt.Imports, error) {
+	importRecords, err := dao.FindAllRecords("nats_auth_imports",
+		dbx.HashExp{
+			"account": accRec.Id,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var imports jwt.Imports
+	for _, importRecord := range importRecords {
+		exportRecord, err := dao.FindRecordById("nats_auth_exports", importRecord.GetString("export"))
+		if err != nil {
+			return nil, err
+		}
+		exportAccountRecord, err := dao.FindRecordById("nats_auth_accounts", exportRecord.GetString("account"))
+		if err != nil {
+			return nil, err
+		}
+
+		imp := &jwt.Import{
+			Name:         importRecord.GetString("name"),
+			Subject:      jwt.Subject(exportRecord.GetString("subject")),
+			Account:      exportAccountRecord.GetString("public_key"),
+			LocalSubject: jwt.RenamingSubject(importRecord.GetString("local_subject")),
+			Type:         jwt.Stream,
+		}
+		if exportRecord.GetString("type") == "service" {
+			imp.Type = jwt.Service
+		}
+
+		if !canImportExport(exportRecord, accRec.Id) {
+			// the exporter removed the account from the importers, it gets no activation token
+			m.logger.WarnContext(ctx, "Leaving out import of a private export the account is not allowed to import",
+				slog.String("account_id", accRec.Id),
+				slog.String("import", importRecord.GetString("name")))
+			continue
+		}
+		if exportRecord.GetBool("private") {
+			exportAccountKP, err := m.signingKeyPair(ctx, dao, exportAccountRecord, "sign_public_key")
+			if err != nil {
+				return nil, err
+			}
+			token, err := generateActivationToken(exportAccountRecord, exportAccountKP, accRec.GetString("public_key"), imp)
+			if err != nil {
+				return nil, err
+			}
+			imp.Token = token
+		}
+		imports = append(imports, imp)
+	}
+
+	return imports, nil
+}
+
+// generateActivationToken creates the activation token that allows the importing account
+// to use a private export. It is signed with the signing key of the exporting account.
+func generateActivationToken(exportAccountRecord *core.Record, exportAccountKP nkeys.KeyPair,
+	importerPublicKey string, imp *jwt.Import) (string, error) {
+	activation := jwt.NewActivationClaims(importerPublicKey)
+	activation.Name = imp.Name
+	activation.ImportSubject = imp.Subject
+	activation.ImportType = imp.Type
+	activation.IssuerAccount = exportAccountRecord.GetString("public_key")
+
+	return activation.Encode(exportAccountKP)
+}
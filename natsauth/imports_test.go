@@ -0,0 +1,88 @@
+package natsauth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-tower/nats-tower/application"
+)
+
+func Test_ImportPrivateExport(t *testing.T) {
+	const url = "nats://127.0.0.1:14242"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+
+	accounts := map[string]*application.AccountAuth{}
+	for _, name := range []string{"A", "B", "C"} {
+		account, err := natsModule.UpsertAccountAuth(ctx, url, name, "", UpsertAccountAuthOptions{})
+		if err != nil {
+			t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+		}
+		accounts[name] = account
+	}
+
+	export := application.AccountExport{
+		Name:      "orders",
+		Subject:   "orders.>",
+		Type:      "stream",
+		Private:   true,
+		Importers: []string{accounts["B"].ID},
+	}
+	created, err := natsModule.UpsertAccountExport(ctx, accounts["A"].ID, export)
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountExport: %v", err)
+	}
+	export.ID = created.ID
+
+	// the exporting account can not be its own importer
+	selfImport := export
+	selfImport.Importers = []string{accounts["A"].ID}
+	if _, err := natsModule.UpsertAccountExport(ctx, accounts["A"].ID, selfImport); err == nil {
+		t.Errorf("Exporting account was added to the importers")
+	}
+
+	imp := application.AccountImport{Name: "orders", ExportID: export.ID}
+	if _, err := natsModule.UpsertAccountImport(ctx, accounts["C"].ID, imp); err == nil {
+		t.Errorf("Account not allowed by the exporter imported the private export")
+	}
+	if _, err := natsModule.UpsertAccountImport(ctx, accounts["B"].ID, imp); err != nil {
+		t.Fatalf("Failed to UpsertAccountImport: %v", err)
+	}
+
+	accountImports := func(name string) jwt.Imports {
+		record, err := natsModule.cfg.App.FindRecordById("nats_auth_accounts", accounts[name].ID)
+		if err != nil {
+			t.Fatalf("Failed to find account: %v", err)
+		}
+		claims, err := jwt.DecodeAccountClaims(record.GetString("jwt"))
+		if err != nil {
+			t.Fatalf("Failed to DecodeAccountClaims: %v", err)
+		}
+		return claims.Imports
+	}
+
+	imports := accountImports("B")
+	if len(imports) != 1 || imports[0].Token == "" {
+		t.Fatalf("Account B has imports %+v, want one with an activation token", imports)
+	}
+	activation, err := jwt.DecodeActivationClaims(imports[0].Token)
+	if err != nil {
+		t.Fatalf("Failed to DecodeActivationClaims: %v", err)
+	}
+	if activation.Subject != accounts["B"].PublicKey || activation.IssuerAccount != accounts["A"].PublicKey {
+		t.Errorf("Activation token is for %s issued by %s", activation.Subject, activation.IssuerAccount)
+	}
+	if imports := accountImports("C"); len(imports) != 0 {
+		t.Errorf("Account C has imports %+v", imports)
+	}
+
+	// removing the importer drops its activation token
+	export.Importers = nil
+	if _, err := natsModule.UpsertAccountExport(ctx, accounts["A"].ID, export); err != nil {
+		t.Fatalf("Failed to UpsertAccountExport: %v", err)
+	}
+	if imports := accountImports("B"); len(imports) != 0 {
+		t.Errorf("Account B still has imports %+v after it was removed from the importers", imports)
+	}
+}
@@ -2,13 +2,292 @@ package natsauth
 
 import (
 	"context"
+	"fmt"
+	"slices"
 
 	jwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-tower/nats-tower/application"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 )
 
-func (m *NATSAuthModule) getAccountLimits(_ context.Context, dao core.App, accRec *core.Record) (*jwt.OperatorLimits, error) {
+// optionalLimitFields are the number fields of nats_auth_limits besides the original
+// max_connections, jetstream_max_memory and jetstream_max_disk
+var optionalLimitFields = []string{
+	"max_leafnode_connections",
+	"max_subscriptions",
+	"max_data",
+	"max_payload",
+	"max_imports",
+	"max_exports",
+	"jetstream_max_streams",
+	"jetstream_max_consumers",
+	"jetstream_max_ack_pending",
+	"jetstream_memory_max_stream_bytes",
+	"jetstream_disk_max_stream_bytes",
+}
+
+// JetStreamTiers are the replica tiers which can be limited separately
+var JetStreamTiers = []string{"R1", "R3"}
+
+func GetLimitsFromRecord(record *core.Record) *application.Limits {
+	var tiers map[string]application.JetStreamTierLimits
+	_ = record.UnmarshalJSONField("jetstream_tiers", &tiers)
+	if len(tiers) == 0 {
+		tiers = nil
+	}
+
+	return &application.Limits{
+		ID:                            record.Id,
+		Name:                          record.GetString("name"),
+		Default:                       record.GetBool("default"),
+		MaxConnections:                int64(record.GetFloat("max_connections")),
+		MaxLeafNodeConnections:        int64(record.GetFloat("max_leafnode_connections")),
+		MaxSubscriptions:              int64(record.GetFloat("max_subscriptions")),
+		MaxData:                       int64(record.GetFloat("max_data")),
+		MaxPayload:                    int64(record.GetFloat("max_payload")),
+		MaxImports:                    int64(record.GetFloat("max_imports")),
+		MaxExports:                    int64(record.GetFloat("max_exports")),
+		DisallowWildcardExports:       record.GetBool("disallow_wildcard_exports"),
+		DisallowBearer:                record.GetBool("disallow_bearer"),
+		JetStreamMaxMemory:            int64(record.GetFloat("jetstream_max_memory")),
+		JetStreamMaxDisk:              int64(record.GetFloat("jetstream_max_disk")),
+		JetStreamMaxStreams:           int64(record.GetFloat("jetstream_max_streams")),
+		JetStreamMaxConsumers:         int64(record.GetFloat("jetstream_max_consumers")),
+		JetStreamMaxAckPending:        int64(record.GetFloat("jetstream_max_ack_pending")),
+		JetStreamMemoryMaxStreamBytes: int64(record.GetFloat("jetstream_memory_max_stream_bytes")),
+		JetStreamDiskMaxStreamBytes:   int64(record.GetFloat("jetstream_disk_max_stream_bytes")),
+		JetStreamMaxBytesRequired:     record.GetBool("jetstream_max_bytes_required"),
+		JetStreamTiers:                tiers,
+	}
+}
+
+// UnlimitedLimits are applied to accounts without limits if there is no default limit record
+func UnlimitedLimits() *application.Limits {
+	return &application.Limits{
+		Name:                          "unlimited",
+		MaxConnections:                jwt.NoLimit,
+		MaxLeafNodeConnections:        jwt.NoLimit,
+		MaxSubscriptions:              jwt.NoLimit,
+		MaxData:                       jwt.NoLimit,
+		MaxPayload:                    jwt.NoLimit,
+		MaxImports:                    jwt.NoLimit,
+		MaxExports:                    jwt.NoLimit,
+		JetStreamMaxMemory:            jwt.NoLimit,
+		JetStreamMaxDisk:              jwt.NoLimit,
+		JetStreamMaxStreams:           jwt.NoLimit,
+		JetStreamMaxConsumers:         jwt.NoLimit,
+		JetStreamMaxAckPending:        jwt.NoLimit,
+		JetStreamMemoryMaxStreamBytes: jwt.NoLimit,
+		JetStreamDiskMaxStreamBytes:   jwt.NoLimit,
+	}
+}
+
+// toOperatorLimits transforms the limits into the jwt representation
+func toOperatorLimits(limits *application.Limits) *jwt.OperatorLimits {
+	// the max stream bytes use 0 instead of -1 for unlimited
+	maxStreamBytes := func(v int64) int64 {
+		if v < 0 {
+			return 0
+		}
+		return v
+	}
+
+	res := &jwt.OperatorLimits{
+		JetStreamLimits: jwt.JetStreamLimits{
+			DiskStorage:          limits.JetStreamMaxDisk,
+			MemoryStorage:        limits.JetStreamMaxMemory,
+			MaxAckPending:        limits.JetStreamMaxAckPending,
+			MemoryMaxStreamBytes: maxStreamBytes(limits.JetStreamMemoryMaxStreamBytes),
+			DiskMaxStreamBytes:   maxStreamBytes(limits.JetStreamDiskMaxStreamBytes),
+			MaxBytesRequired:     limits.JetStreamMaxBytesRequired,
+			Consumer:             limits.JetStreamMaxConsumers,
+			Streams:              limits.JetStreamMaxStreams,
+		},
+		AccountLimits: jwt.AccountLimits{
+			Conn:            limits.MaxConnections,
+			LeafNodeConn:    limits.MaxLeafNodeConnections,
+			Imports:         limits.MaxImports,
+			Exports:         limits.MaxExports,
+			WildcardExports: !limits.DisallowWildcardExports,
+			DisallowBearer:  limits.DisallowBearer,
+		},
+		NatsLimits: jwt.NatsLimits{
+			Subs:    limits.MaxSubscriptions,
+			Data:    limits.MaxData,
+			Payload: limits.MaxPayload,
+		},
+	}
+
+	// global and tiered JetStream limits are mutually exclusive
+	if len(limits.JetStreamTiers) > 0 {
+		res.JetStreamTieredLimits = jwt.JetStreamTieredLimits{}
+		for tier, tierLimits := range limits.JetStreamTiers {
+			tierJetStreamLimits := res.JetStreamLimits
+			tierJetStreamLimits.MemoryStorage = tierLimits.MaxMemory
+			tierJetStreamLimits.DiskStorage = tierLimits.MaxDisk
+			tierJetStreamLimits.Streams = tierLimits.MaxStreams
+			tierJetStreamLimits.Consumer = tierLimits.MaxConsumers
+			res.JetStreamTieredLimits[tier] = tierJetStreamLimits
+		}
+		res.JetStreamLimits = jwt.JetStreamLimits{}
+	}
+	return res
+}
+
+func (m *NATSAuthModule) GetLimits(_ context.Context) ([]*application.Limits, error) {
+	limitRecords, err := m.cfg.App.FindRecordsByFilter("nats_auth_limits", "", "name", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*application.Limits
+	for _, limitRecord := range limitRecords {
+		res = append(res, GetLimitsFromRecord(limitRecord))
+	}
+	return res, nil
+}
+
+func (m *NATSAuthModule) GetLimitsByID(_ context.Context, id string) (*application.Limits, error) {
+	limitRecord, err := m.cfg.App.FindRecordById("nats_auth_limits", id)
+	if err != nil {
+		return nil, err
+	}
+	return GetLimitsFromRecord(limitRecord), nil
+}
+
+// UpsertLimits creates a new limit record or updates the one with limits.ID.
+// Accounts using the limits are re-signed through the record hooks.
+func (m *NATSAuthModule) UpsertLimits(ctx context.Context, limits application.Limits) (*application.Limits, error) {
+	if limits.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	for tier := range limits.JetStreamTiers {
+		if !slices.Contains(JetStreamTiers, tier) {
+			return nil, fmt.Errorf("unknown JetStream tier %s", tier)
+		}
+	}
+	// max_connections, jetstream_max_memory and jetstream_max_disk are required fields
+	// and pocketbase treats 0 as missing
+	if limits.MaxConnections == 0 || limits.JetStreamMaxMemory == 0 || limits.JetStreamMaxDisk == 0 {
+		return nil, fmt.Errorf("connections, JetStream memory and disk must not be 0")
+	}
+
+	var res *application.Limits
+	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		var record *core.Record
+		if limits.ID == "" {
+			collection, err := txDao.FindCollectionByNameOrId("nats_auth_limits")
+			if err != nil {
+				return err
+			}
+			record = core.NewRecord(collection)
+			record.Set("type", "account")
+		} else {
+			var err error
+			record, err = txDao.FindRecordById("nats_auth_limits", limits.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		if limits.Default {
+			// there can only be one default
+			defaultRecords, err := txDao.FindAllRecords("nats_auth_limits",
+				dbx.HashExp{
+					"default": true,
+					"type":    "account",
+				})
+			if err != nil {
+				return err
+			}
+			for _, defaultRecord := range defaultRecords {
+				if defaultRecord.Id == record.Id {
+					continue
+				}
+				defaultRecord.Set("default", false)
+				if err := txDao.SaveWithContext(ctx, defaultRecord); err != nil {
+					return err
+				}
+			}
+		}
+
+		record.Set("name", limits.Name)
+		record.Set("default", limits.Default)
+		record.Set("max_connections", limits.MaxConnections)
+		record.Set("max_leafnode_connections", limits.MaxLeafNodeConnections)
+		record.Set("max_subscriptions", limits.MaxSubscriptions)
+		record.Set("max_data", limits.MaxData)
+		record.Set("max_payload", limits.MaxPayload)
+		record.Set("max_imports", limits.MaxImports)
+		record.Set("max_exports", limits.MaxExports)
+		record.Set("disallow_wildcard_exports", limits.DisallowWildcardExports)
+		record.Set("disallow_bearer", limits.DisallowBearer)
+		record.Set("jetstream_max_memory", limits.JetStreamMaxMemory)
+		record.Set("jetstream_max_disk", limits.JetStreamMaxDisk)
+		record.Set("jetstream_max_streams", limits.JetStreamMaxStreams)
+		record.Set("jetstream_max_consumers", limits.JetStreamMaxConsumers)
+		record.Set("jetstream_max_ack_pending", limits.JetStreamMaxAckPending)
+		record.Set("jetstream_memory_max_stream_bytes", limits.JetStreamMemoryMaxStreamBytes)
+		record.Set("jetstream_disk_max_stream_bytes", limits.JetStreamDiskMaxStreamBytes)
+		record.Set("jetstream_max_bytes_required", limits.JetStreamMaxBytesRequired)
+		record.Set("jetstream_tiers", limits.JetStreamTiers)
+
+		if err := txDao.SaveWithContext(ctx, record); err != nil {
+			return err
+		}
+		res = GetLimitsFromRecord(record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (m *NATSAuthModule) DeleteLimits(ctx context.Context, id string) error {
+	record, err := m.cfg.App.FindRecordById("nats_auth_limits", id)
+	if err != nil {
+		return err
+	}
+	return m.cfg.App.DeleteWithContext(ctx, record)
+}
+
+// SetAccountLimits assigns a limit record to an account. An empty limitsID applies the default limits.
+func (m *NATSAuthModule) SetAccountLimits(ctx context.Context, accountID, limitsID string) error {
+	accountRecord, err := m.cfg.App.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		return err
+	}
+	if limitsID != "" {
+		_, err := m.cfg.App.FindRecordById("nats_auth_limits", limitsID)
+		if err != nil {
+			return err
+		}
+	}
+	accountRecord.Set("limits", limitsID)
+	// triggers the account update hook which re-signs the account
+	return m.cfg.App.SaveWithContext(ctx, accountRecord)
+}
+
+// GetAccountLimits returns the limits applied to an account
+func (m *NATSAuthModule) GetAccountLimits(ctx context.Context, accountID string) (*application.Limits, error) {
+	accountRecord, err := m.cfg.App.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		return nil, err
+	}
+	return m.getAccountLimitsRecord(ctx, m.cfg.App, accountRecord)
+}
+
+func (m *NATSAuthModule) getAccountLimits(ctx context.Context, dao core.App, accRec *core.Record) (*jwt.OperatorLimits, error) {
+	limits, err := m.getAccountLimitsRecord(ctx, dao, accRec)
+	if err != nil {
+		return nil, err
+	}
+	return toOperatorLimits(limits), nil
+}
+
+func (m *NATSAuthModule) getAccountLimitsRecord(_ context.Context, dao core.App, accRec *core.Record) (*application.Limits, error) {
 
 	limitID := accRec.GetString("limits")
 
@@ -19,32 +298,7 @@ func (m *NATSAuthModule) getAccountLimits(_ context.Context, dao core.App, accRe
 			return nil, err
 		}
 
-		// transform to jwt.OperatorLimits
-		limits := &jwt.OperatorLimits{
-			JetStreamLimits: jwt.JetStreamLimits{
-				DiskStorage:          int64(accountLimitRecord.GetFloat("jetstream_max_disk")),
-				MemoryStorage:        int64(accountLimitRecord.GetFloat("jetstream_max_memory")),
-				MaxAckPending:        jwt.NoLimit,
-				MemoryMaxStreamBytes: 0,
-				DiskMaxStreamBytes:   0,
-				Consumer:             jwt.NoLimit,
-				Streams:              jwt.NoLimit,
-			},
-			AccountLimits: jwt.AccountLimits{
-				Conn:            int64(accountLimitRecord.GetFloat("max_connections")),
-				LeafNodeConn:    jwt.NoLimit,
-				Imports:         jwt.NoLimit,
-				Exports:         jwt.NoLimit,
-				WildcardExports: true,
-			},
-			NatsLimits: jwt.NatsLimits{
-				Subs:    jwt.NoLimit,
-				Data:    jwt.NoLimit,
-				Payload: jwt.NoLimit,
-			},
-		}
-
-		return limits, nil
+		return GetLimitsFromRecord(accountLimitRecord), nil
 	}
 
 	// check if we have a default limit record
@@ -57,57 +311,9 @@ func (m *NATSAuthModule) getAccountLimits(_ context.Context, dao core.App, accRe
 		return nil, err
 	}
 	if len(defaultAccountLimitRecord) == 0 {
-
 		// no default limit record found => return no limits
-		return &jwt.OperatorLimits{
-			JetStreamLimits: jwt.JetStreamLimits{
-				DiskStorage:          jwt.NoLimit,
-				MemoryStorage:        jwt.NoLimit,
-				MaxAckPending:        jwt.NoLimit,
-				MemoryMaxStreamBytes: 0,
-				DiskMaxStreamBytes:   0,
-				Consumer:             jwt.NoLimit,
-				Streams:              jwt.NoLimit,
-			},
-			AccountLimits: jwt.AccountLimits{
-				Conn:            jwt.NoLimit,
-				LeafNodeConn:    jwt.NoLimit,
-				Imports:         jwt.NoLimit,
-				Exports:         jwt.NoLimit,
-				WildcardExports: true,
-			},
-			NatsLimits: jwt.NatsLimits{
-				Subs:    jwt.NoLimit,
-				Data:    jwt.NoLimit,
-				Payload: jwt.NoLimit,
-			},
-		}, nil
-	}
-
-	// transform to jwt.OperatorLimits
-	limits := &jwt.OperatorLimits{
-		JetStreamLimits: jwt.JetStreamLimits{
-			DiskStorage:          int64(defaultAccountLimitRecord[0].GetFloat("jetstream_max_disk")),
-			MemoryStorage:        int64(defaultAccountLimitRecord[0].GetFloat("jetstream_max_memory")),
-			MaxAckPending:        jwt.NoLimit,
-			MemoryMaxStreamBytes: 0,
-			DiskMaxStreamBytes:   0,
-			Consumer:             jwt.NoLimit,
-			Streams:              jwt.NoLimit,
-		},
-		AccountLimits: jwt.AccountLimits{
-			Conn:            int64(defaultAccountLimitRecord[0].GetFloat("max_connections")),
-			LeafNodeConn:    jwt.NoLimit,
-			Imports:         jwt.NoLimit,
-			Exports:         jwt.NoLimit,
-			WildcardExports: true,
-		},
-		NatsLimits: jwt.NatsLimits{
-			Subs:    jwt.NoLimit,
-			Data:    jwt.NoLimit,
-			Payload: jwt.NoLimit,
-		},
+		return UnlimitedLimits(), nil
 	}
 
-	return limits, nil
+	return GetLimitsFromRecord(defaultAccountLimitRecord[0]), nil
 }
@@ -0,0 +1,145 @@
+package natsauth
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-tower/nats-tower/application"
+)
+
+func Test_toOperatorLimits(t *testing.T) {
+	unlimited := toOperatorLimits(UnlimitedLimits())
+	if !unlimited.IsUnlimited() {
+		t.Errorf("Unlimited limits are %+v", unlimited)
+	}
+	// 0 is unlimited for the max stream bytes
+	if unlimited.MemoryMaxStreamBytes != 0 || unlimited.DiskMaxStreamBytes != 0 {
+		t.Errorf("Max stream bytes are %d and %d", unlimited.MemoryMaxStreamBytes, unlimited.DiskMaxStreamBytes)
+	}
+
+	tiered := UnlimitedLimits()
+	tiered.JetStreamMaxAckPending = 1000
+	tiered.JetStreamTiers = map[string]application.JetStreamTierLimits{
+		"R1": {MaxMemory: 1024, MaxDisk: 2048, MaxStreams: 10, MaxConsumers: 100},
+		"R3": {MaxMemory: -1, MaxDisk: 4096, MaxStreams: 5, MaxConsumers: -1},
+	}
+	limits := toOperatorLimits(tiered)
+	if limits.JetStreamLimits != (jwt.JetStreamLimits{}) {
+		t.Errorf("Global JetStream limits are set besides the tiers: %+v", limits.JetStreamLimits)
+	}
+	want := jwt.JetStreamLimits{MemoryStorage: -1, DiskStorage: 4096, Streams: 5, Consumer: -1, MaxAckPending: 1000}
+	if got := limits.JetStreamTieredLimits["R3"]; got != want {
+		t.Errorf("R3 limits are %+v, want %+v", got, want)
+	}
+	vr := jwt.CreateValidationResults()
+	limits.Validate(vr)
+	if len(vr.Errors()) > 0 {
+		t.Errorf("Tiered limits are invalid: %v", vr.Errors())
+	}
+}
+
+func Test_AccountLimits(t *testing.T) {
+	const url = "nats://127.0.0.1:14251"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+
+	if _, err := natsModule.UpsertLimits(ctx, application.Limits{
+		Name:               "invalid",
+		MaxConnections:     1,
+		JetStreamMaxMemory: 1,
+		JetStreamMaxDisk:   1,
+		JetStreamTiers:     map[string]application.JetStreamTierLimits{"R5": {}},
+	}); err == nil {
+		t.Errorf("Limits with an unknown tier were saved")
+	}
+
+	limits := application.Limits{
+		Name:                          "small",
+		MaxConnections:                10,
+		MaxLeafNodeConnections:        1,
+		MaxSubscriptions:              100,
+		MaxData:                       1 << 20,
+		MaxPayload:                    1 << 10,
+		MaxImports:                    2,
+		MaxExports:                    3,
+		DisallowWildcardExports:       true,
+		DisallowBearer:                true,
+		JetStreamMaxMemory:            1 << 20,
+		JetStreamMaxDisk:              1 << 30,
+		JetStreamMaxStreams:           4,
+		JetStreamMaxConsumers:         8,
+		JetStreamMaxAckPending:        1000,
+		JetStreamMemoryMaxStreamBytes: 1 << 10,
+		JetStreamDiskMaxStreamBytes:   1 << 20,
+		JetStreamMaxBytesRequired:     true,
+	}
+	created, err := natsModule.UpsertLimits(ctx, limits)
+	if err != nil {
+		t.Fatalf("Failed to UpsertLimits: %v", err)
+	}
+	limits.ID = created.ID
+	stored, err := natsModule.GetLimitsByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Failed to GetLimitsByID: %v", err)
+	}
+	if !reflect.DeepEqual(*stored, limits) {
+		t.Errorf("Stored limits are %+v, want %+v", *stored, limits)
+	}
+
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	if err := natsModule.SetAccountLimits(ctx, account.ID, created.ID); err != nil {
+		t.Fatalf("Failed to SetAccountLimits: %v", err)
+	}
+	accountClaims := func() *jwt.AccountClaims {
+		record, err := natsModule.cfg.App.FindRecordById("nats_auth_accounts", account.ID)
+		if err != nil {
+			t.Fatalf("Failed to find account: %v", err)
+		}
+		claims, err := jwt.DecodeAccountClaims(record.GetString("jwt"))
+		if err != nil {
+			t.Fatalf("Failed to DecodeAccountClaims: %v", err)
+		}
+		return claims
+	}
+	if got, want := accountClaims().Limits, *toOperatorLimits(&limits); !reflect.DeepEqual(got, want) {
+		t.Errorf("Account JWT has the limits %+v, want %+v", got, want)
+	}
+
+	// changing the limits re-signs the accounts using them
+	limits.JetStreamTiers = map[string]application.JetStreamTierLimits{
+		"R1": {MaxMemory: 1 << 20, MaxDisk: 1 << 30, MaxStreams: 4, MaxConsumers: 8},
+		"R3": {MaxMemory: 0, MaxDisk: 1 << 29, MaxStreams: 2, MaxConsumers: 4},
+	}
+	if _, err := natsModule.UpsertLimits(ctx, limits); err != nil {
+		t.Fatalf("Failed to UpsertLimits: %v", err)
+	}
+	claims := accountClaims()
+	if !claims.Limits.IsJSEnabled() || len(claims.Limits.JetStreamTieredLimits) != 2 {
+		t.Fatalf("Account JWT has the JetStream limits %+v", claims.Limits.JetStreamTieredLimits)
+	}
+	if r3 := claims.Limits.JetStreamTieredLimits["R3"]; r3.DiskStorage != 1<<29 || r3.Streams != 2 || r3.Consumer != 4 {
+		t.Errorf("Account JWT has the R3 limits %+v", r3)
+	}
+
+	// accounts without limits get the default
+	defaultLimits := limits
+	defaultLimits.ID = ""
+	defaultLimits.Name = "default"
+	defaultLimits.Default = true
+	defaultLimits.JetStreamTiers = nil
+	defaultLimits.MaxConnections = 20
+	if _, err := natsModule.UpsertLimits(ctx, defaultLimits); err != nil {
+		t.Fatalf("Failed to UpsertLimits: %v", err)
+	}
+	if err := natsModule.SetAccountLimits(ctx, account.ID, ""); err != nil {
+		t.Fatalf("Failed to SetAccountLimits: %v", err)
+	}
+	if conn := accountClaims().Limits.Conn; conn != 20 {
+		t.Errorf("Account JWT allows %d connections, want the default 20", conn)
+	}
+}
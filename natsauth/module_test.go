@@ -0,0 +1,192 @@
+package natsauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/pocketbase/core"
+	_ "github.com/pocketbase/pocketbase/migrations"
+)
+
+// newTestModule creates the module on an empty app with an operator per URL
+func newTestModule(t *testing.T, urls ...string) *NATSAuthModule {
+	return newTestModuleWithConfig(t, NATSAuthModuleConfig{BootstrapURLs: urls})
+}
+
+// newTestModuleWithConfig creates the module with the config on an empty app
+func newTestModuleWithConfig(t *testing.T, cfg NATSAuthModuleConfig) *NATSAuthModule {
+	app := core.NewBaseApp(core.BaseAppConfig{DataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("Failed to bootstrap app: %v", err)
+	}
+	// the app is not reset, the background jobs of the module may still be running a query after the cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	var handler slog.Handler = slog.NewTextHandler(io.Discard, nil)
+	if os.Getenv("TRACE") == "TRUE" {
+		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+	}
+	cfg.App = app
+	cfg.DisableNATSCLIContexts = true
+	natsModule, err := CreateNATSAuthModule(ctx, slog.New(handler), cfg)
+	if err != nil {
+		t.Fatalf("Failed to create NatsModule: %v", err)
+	}
+	return natsModule
+}
+
+// startTestServer starts a NATS server with a full resolver on the port, which trusts the current operator JWT
+func startTestServer(t *testing.T, natsModule *NATSAuthModule, url string, port int, options ...func(*server.Options)) *server.Server {
+	ctx := context.Background()
+	operator, err := natsModule.GetOperator(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to GetOperator: %v", err)
+	}
+	sysAccount, err := natsModule.GetSysAccountByURL(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to GetSysAccount: %v", err)
+	}
+
+	resolver, err := server.NewDirAccResolver(t.TempDir(), 10000, time.Minute*2, server.RenameDeleted, server.FetchTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("Failed to create NewDirAccResolver: %v", err)
+	}
+	if err := resolver.Store(sysAccount.PublicKey, sysAccount.JWT); err != nil {
+		t.Fatalf("Failed to Store Sysaccount: %v", err)
+	}
+	opc, err := jwt.DecodeOperatorClaims(operator.JWT)
+	if err != nil {
+		t.Fatalf("Failed to DecodeOperatorClaims: %v", err)
+	}
+
+	opts := &server.Options{
+		ServerName:       fmt.Sprintf("test-%d", port),
+		Host:             "127.0.0.1",
+		Port:             port,
+		AccountResolver:  resolver,
+		TrustedOperators: []*jwt.OperatorClaims{opc},
+		SystemAccount:    sysAccount.PublicKey,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	ns, err := server.NewServer(opts)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		t.Fatalf("Server is not ready for connections")
+	}
+	t.Cleanup(ns.Shutdown)
+	return ns
+}
+
+// testTLS are the PEM encoded certificates of a test CA, a server on 127.0.0.1 and a client
+type testTLS struct {
+	CA         string
+	ServerCert string
+	ServerKey  string
+	ClientCert string
+	ClientKey  string
+}
+
+func newTestTLS(t *testing.T) *testTLS {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+
+	issue := func(serial int64, usage x509.ExtKeyUsage) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "127.0.0.1"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}, caTemplate, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("Failed to create certificate: %v", err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatalf("Failed to marshal key: %v", err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+			string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	}
+
+	res := &testTLS{CA: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))}
+	res.ServerCert, res.ServerKey = issue(2, x509.ExtKeyUsageServerAuth)
+	res.ClientCert, res.ClientKey = issue(3, x509.ExtKeyUsageClientAuth)
+	return res
+}
+
+// connection returns the connection settings of a client of the test servers
+func (c *testTLS) connection() application.OperatorConnection {
+	return application.OperatorConnection{
+		TLSCA:             c.CA,
+		TLSCert:           c.ClientCert,
+		TLSKey:            c.ClientKey,
+		TLSHandshakeFirst: true,
+	}
+}
+
+// serverOptions makes a test server require TLS with verified client certificates and the handshake first
+func (c *testTLS) serverOptions(t *testing.T) func(*server.Options) {
+	cert, err := tls.X509KeyPair([]byte(c.ServerCert), []byte(c.ServerKey))
+	if err != nil {
+		t.Fatalf("Failed to load server certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM([]byte(c.CA))
+	return func(opts *server.Options) {
+		opts.TLS = true
+		opts.TLSVerify = true
+		opts.TLSHandshakeFirst = true
+		opts.TLSTimeout = 2
+		opts.TLSConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+			ClientCAs:    pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		}
+	}
+}
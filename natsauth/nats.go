@@ -8,13 +8,15 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/nats-io/jsm.go/natscontext"
 	"github.com/nats-io/jwt/v2"
-	"github.com/nats-io/nkeys"
-	"github.com/nats-tower/nats-tower/application"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/application"
 )
 
 var (
@@ -25,15 +27,49 @@ type NATSAuthModule struct {
 	ctx                    context.Context
 	logger                 *slog.Logger
 	cfg                    NATSAuthModuleConfig
+	signer                 Signer
 	NATSOperatorCollection *core.Collection
 	NATSAccountCollection  *core.Collection
-	NATSUserCollection     *core.Collection
+	// signing keys of accounts in addition to their sign_seed
+	NATSAccountSigningKeyCollection *core.Collection
+	NATSUserCollection              *core.Collection
+	NATSPermissionCollection        *core.Collection
+	NATSUserLimitCollection         *core.Collection
+	// history of the issued user JWTs
+	NATSUserCredentialCollection *core.Collection
+	NATSExportCollection         *core.Collection
+	NATSImportCollection         *core.Collection
+	AuditLogCollection           *core.Collection
+	WebhookCollection            *core.Collection
+	WebhookDeliveryCollection    *core.Collection
+	// account changes waiting to be pushed to the servers
+	NATSOutboxCollection *core.Collection
+
+	// actors of the changes via the record API of PocketBase, by record
+	requestActors sync.Map
+	// signals new audit log entries with events to publish
+	auditEventWake chan struct{}
+	// signals new webhook deliveries
+	webhookWake chan struct{}
+	// signals new account changes in the outbox
+	outboxWake chan struct{}
+	// operators whose account changes are being published, so a slow operator does not hold up the others
+	outboxPublishing sync.Map
+	// latest drift report by operator
+	driftReports sync.Map
+	// shared connections of the sys users by operator
+	sysConns map[string]*sysConn
+	// dials of the shared connections by operator, so an unreachable operator only blocks itself
+	sysConnDials map[string]*sync.Mutex
+	// guards both maps, never held while dialing
+	sysConnsMu sync.Mutex
+	// encrypts the secret fields of all records, nil stores them in plaintext
+	keyRing *KeyRing
 }
 
 type NATSAuthModuleConfig struct {
 	App           core.App
 	BootstrapURLs []string
-	APIToken      string
 
 	// used for semi controlled environments
 	// in case we only got a NATS URL and an account to sign new users
@@ -43,15 +79,51 @@ type NATSAuthModuleConfig struct {
 	InitialAccountSigningSeed string
 
 	DisableNATSCLIContexts bool
+
+	// If set, user JWTs with a TTL are re-issued in this interval before they expire
+	CredentialRenewalInterval time.Duration
+
+	// If set, the accounts are compared with the resolvers of the servers in this interval
+	DriftCheckInterval time.Duration
+
+	// If set, seeds and private keys are encrypted at rest
+	KeyRing *KeyRing
+
+	// If set, keys without a seed in the database are signed with by this signer
+	Signer Signer
+
+	// If set, the changes of the audit log are published as events into the account
+	// with this name of the installation
+	AuditEventAccount string
+
+	// If set, installations in memory mode may write their resolver preload to a file within this directory
+	ResolverConfigDir string
 }
 
 func CreateNATSAuthModule(ctx context.Context,
 	logger *slog.Logger,
 	cfg NATSAuthModuleConfig) (*NATSAuthModule, error) {
 	t := &NATSAuthModule{
-		ctx:    ctx,
-		logger: logger,
-		cfg:    cfg,
+		ctx:          ctx,
+		logger:       logger,
+		cfg:          cfg,
+		webhookWake:  make(chan struct{}, 1),
+		outboxWake:   make(chan struct{}, 1),
+		sysConns:     map[string]*sysConn{},
+		sysConnDials: map[string]*sync.Mutex{},
+		keyRing:      cfg.KeyRing,
+	}
+	t.signer = DBSigner{KeyRing: cfg.KeyRing}
+	if cfg.Signer != nil {
+		t.signer = chainSigner{DBSigner{KeyRing: cfg.KeyRing}, cfg.Signer}
+	}
+
+	t.bindAuditHooks()
+	t.bindOutboxHooks()
+	t.bindSysConnHooks()
+	if cfg.AuditEventAccount != "" {
+		t.auditEventWake = make(chan struct{}, 1)
+		t.bindAuditEventHooks()
 	}
 
 	t.cfg.App.OnRecordCreate().BindFunc(func(e *core.RecordEvent) error {
@@ -61,11 +133,12 @@ func CreateNATSAuthModule(ctx context.Context,
 
 		if e.Record.TableName() == "nats_auth_operators" {
 			record := e.Record
-			if record.GetString("sign_seed") == "" {
+			// imported operators come with their public key but not necessarily with a seed
+			if record.GetString("sign_seed") == "" && record.GetString("public_key") == "" {
 				logger.InfoContext(ctx, "Creating nats operator...",
 					slog.String("url", record.GetString("url")))
 				// new operator
-				_, err := generateOperatorRecord(ctx, record, record.GetString("url"))
+				_, err := t.generateOperatorRecord(ctx, record, record.GetString("url"))
 				if err != nil {
 					return err
 				}
@@ -81,7 +154,11 @@ func CreateNATSAuthModule(ctx context.Context,
 					return err
 				}
 
-				if operatorRecord.GetString("sign_seed") == "" {
+				canSign, err := t.canSign(ctx, e.App, operatorRecord, "sign_public_key")
+				if err != nil {
+					return err
+				}
+				if !canSign {
 					logger.ErrorContext(ctx, "Operator has no signing seed. Seems like the operator is not under our control and you may only be allowed to create new user records",
 						slog.String("url", operatorRecord.GetString("url")))
 
@@ -95,11 +172,16 @@ func CreateNATSAuthModule(ctx context.Context,
 					return err
 				}
 
+				operatorKP, err := t.signingKeyPair(ctx, e.App, operatorRecord, "sign_public_key")
+				if err != nil {
+					return err
+				}
+
 				// new account
-				_, err = generateAccountRecord(ctx,
+				_, err = t.generateAccountRecord(ctx,
 					record,
 					operatorRecord.Id,
-					operatorRecord.GetString("sign_seed"),
+					operatorKP,
 					record.GetString("name"),
 					record.GetString("description"),
 					*limits)
@@ -119,12 +201,16 @@ func CreateNATSAuthModule(ctx context.Context,
 				if err != nil {
 					return err
 				}
+				accountKP, err := t.signingKeyPair(ctx, e.App, accountRecord, "sign_public_key")
+				if err != nil {
+					return err
+				}
 				// new operator
-				_, err = generateUserRecord(ctx,
+				_, err = t.generateUserRecord(ctx,
 					record,
 					accountRecord.Id,
 					accountRecord.GetString("public_key"),
-					accountRecord.GetString("sign_seed"),
+					accountKP,
 					record.GetString("name"))
 				if err != nil {
 					return err
@@ -143,6 +229,12 @@ func CreateNATSAuthModule(ctx context.Context,
 
 	handleLimitAndAccountUpdate := func(logger *slog.Logger, dao core.App, record *core.Record, revokeUsers ...*core.Record) error {
 
+		if record.GetBool("read_only") {
+			logger.InfoContext(ctx, "Account is read-only. Skipping account update...",
+				slog.String("name", record.GetString("name")))
+			return nil
+		}
+
 		// find operator to sign these updates
 		operatorRecord, err := dao.FindRecordById("nats_auth_operators", record.GetString("operator"))
 		if err != nil {
@@ -151,19 +243,40 @@ func CreateNATSAuthModule(ctx context.Context,
 			return err
 		}
 
-		operatorKP, err := nkeys.FromSeed([]byte(operatorRecord.GetString("sign_seed")))
+		canSign, err := t.canSign(ctx, dao, operatorRecord, "sign_public_key")
+		if err != nil {
+			return err
+		}
+		if !canSign {
+			logger.InfoContext(ctx, "Operator has no signing seed. Skipping account update...",
+				slog.String("name", record.GetString("name")))
+			return nil
+		}
+
+		operatorKP, err := t.signingKeyPair(ctx, dao, operatorRecord, "sign_public_key")
 		if err != nil {
 			return err
 		}
 
 		accountClaims := jwt.NewAccountClaims(record.GetString("public_key"))
 		accountClaims.Name = record.GetString("name")
+		// revocations are stored with the account, so they survive the next update
+		revocations := getAccountRevocations(record)
 		for _, v := range revokeUsers {
 			logger.InfoContext(ctx, "Revoking user...",
 				slog.String("name", v.GetString("name")))
-			accountClaims.Revoke(v.GetString("public_key"))
+			revocations[v.GetString("public_key")] = time.Now().Unix()
+		}
+		for publicKey, revokedAt := range revocations {
+			accountClaims.RevokeAt(publicKey, time.Unix(revokedAt, 0))
+		}
+		record.Set("revocations", revocations)
+		err = t.applyAccountSigningKeys(ctx, dao, record, accountClaims)
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not get account signing keys",
+				slog.String("error", err.Error()))
+			return err
 		}
-		accountClaims.SigningKeys.Add(record.GetString("sign_public_key"))
 
 		limits, err := t.getAccountLimits(ctx, dao, record)
 		if err != nil {
@@ -174,6 +287,22 @@ func CreateNATSAuthModule(ctx context.Context,
 
 		accountClaims.Limits = *limits
 
+		exports, err := t.getAccountExports(ctx, dao, record)
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not get account exports",
+				slog.String("error", err.Error()))
+			return err
+		}
+		accountClaims.Exports = exports
+
+		imports, err := t.getAccountImports(ctx, dao, record)
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not get account imports",
+				slog.String("error", err.Error()))
+			return err
+		}
+		accountClaims.Imports = imports
+
 		jwtValue, err := accountClaims.Encode(operatorKP)
 		if err != nil {
 			return err
@@ -188,13 +317,13 @@ func CreateNATSAuthModule(ctx context.Context,
 			return err
 		}
 
-		// send account to nats
-		logger.InfoContext(ctx, "Publishing updated account...",
+		// queue the account for nats, it is published in the background once the change is committed
+		logger.InfoContext(ctx, "Queueing updated account...",
 			slog.String("name", record.GetString("name")))
 
-		err = t.publishAccountRecord(ctx, dao, record)
+		_, err = t.queueAccountPublish(ctx, dao, record, accountPublishUpdate, time.Now())
 		if err != nil {
-			logger.ErrorContext(ctx, "Could not publish updated account",
+			logger.ErrorContext(ctx, "Could not queue updated account",
 				slog.String("error", err.Error()))
 			return err
 		}
@@ -223,7 +352,7 @@ func CreateNATSAuthModule(ctx context.Context,
 			false,
 			natscontext.WithDescription(fmt.Sprintf("%s - %s - User %s(%s) for account %s",
 				op.GetString("url"), op.GetString("description"), record.GetString("name"), record.Id, acc.GetString("name"))),
-			natscontext.WithServerURL(op.GetString("url")))
+			natscontext.WithServerURL(serverURLs(op)))
 
 		if err != nil {
 			logger.ErrorContext(ctx, "Could not create nats context for user",
@@ -243,14 +372,25 @@ func CreateNATSAuthModule(ctx context.Context,
 		parent := filepath.Dir(p)
 		credPath := filepath.Join(parent, record.Id)
 
-		err = os.WriteFile(credPath, []byte(record.GetString("creds")), 0600)
+		creds, err := t.keyRing.getSecret(record, "creds")
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(credPath, []byte(creds), 0600)
 		if err != nil {
 			logger.ErrorContext(ctx, "Could not save user creds for user",
 				slog.String("error", err.Error()))
 			return err
 		}
 
-		nCtx, err = natscontext.NewFromFile(p, natscontext.WithCreds(credPath))
+		tlsOpts, err := t.natsContextTLSOptions(parent, record.Id, op)
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not save TLS files for user",
+				slog.String("error", err.Error()))
+			return err
+		}
+
+		nCtx, err = natscontext.NewFromFile(p, append(tlsOpts, natscontext.WithCreds(credPath))...)
 		if err != nil {
 			logger.ErrorContext(ctx, "Could not reload nats context for user",
 				slog.String("error", err.Error()))
@@ -267,41 +407,197 @@ func CreateNATSAuthModule(ctx context.Context,
 		return nil
 	}
 
+	// handleUserClaimsUpdate re-signs the user of a permission or user limit record
+	handleUserClaimsUpdate := func(ctx context.Context, logger *slog.Logger, dao core.App, record *core.Record) error {
+		logger = logger.With(slog.String("user_id", record.GetString("user")))
+
+		userRecord, err := dao.FindRecordById("nats_auth_users", record.GetString("user"))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				logger.InfoContext(ctx, "User not found. Skipping user update...")
+				return nil
+			}
+			logger.ErrorContext(ctx, "Could not find user",
+				slog.String("error", err.Error()))
+			return err
+		}
+
+		logger.InfoContext(ctx, "Re-signing user...")
+
+		err = t.signUserRecord(ctx, dao, userRecord)
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not sign user",
+				slog.String("error", err.Error()))
+			return err
+		}
+
+		// triggers the user update hook which refreshes the nats context
+		if err := dao.SaveWithContext(ctx, userRecord); err != nil {
+			logger.ErrorContext(ctx, "Could not save user",
+				slog.String("error", err.Error()))
+			return err
+		}
+		return nil
+	}
+
+	handleImportUpdate := func(logger *slog.Logger, dao core.App, record *core.Record) error {
+		logger = logger.With(slog.String("account_id", record.GetString("account")))
+
+		accountRecord, err := dao.FindRecordById("nats_auth_accounts", record.GetString("account"))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				logger.InfoContext(ctx, "Account for import not found. Skipping account update...")
+				return nil
+			}
+			logger.ErrorContext(ctx, "Could not find account for import",
+				slog.String("error", err.Error()))
+			return err
+		}
+
+		return handleLimitAndAccountUpdate(logger, dao, accountRecord)
+	}
+
+	handleSigningKeyUpdate := func(logger *slog.Logger, dao core.App, record *core.Record) error {
+		logger = logger.With(slog.String("account_id", record.GetString("account")))
+
+		accountRecord, err := dao.FindRecordById("nats_auth_accounts", record.GetString("account"))
+		if err == sql.ErrNoRows {
+			// the account was deleted together with its signing keys
+			return nil
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not find account for signing key",
+				slog.String("error", err.Error()))
+			return err
+		}
+		return handleLimitAndAccountUpdate(logger, dao, accountRecord)
+	}
+
+	handleExportUpdate := func(logger *slog.Logger, dao core.App, record *core.Record) error {
+		logger = logger.With(slog.String("account_id", record.GetString("account")))
+
+		accountRecord, err := dao.FindRecordById("nats_auth_accounts", record.GetString("account"))
+		if err != nil && err != sql.ErrNoRows {
+			logger.ErrorContext(ctx, "Could not find account for export",
+				slog.String("error", err.Error()))
+			return err
+		}
+		if err == nil {
+			err = handleLimitAndAccountUpdate(logger, dao, accountRecord)
+			if err != nil {
+				return err
+			}
+		}
+
+		// importing accounts embed the export subject and activation token
+		importRecords, err := dao.FindAllRecords("nats_auth_imports",
+			dbx.HashExp{
+				"export": record.Id,
+			})
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not find imports of export",
+				slog.String("error", err.Error()))
+			return err
+		}
+		for _, importRecord := range importRecords {
+			err := handleImportUpdate(logger, dao, importRecord)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	handleLimitsChange := func(logger *slog.Logger, dao core.App, record *core.Record, includeDefault bool) error {
+		// find any account that uses these limits
+		accountRecords, err := dao.FindAllRecords("nats_auth_accounts",
+			dbx.HashExp{
+				"limits": record.Id,
+			})
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not find accounts with limits",
+				slog.String("error", err.Error()))
+			return err
+		}
+		if includeDefault {
+			// accounts without limits use the default limits
+			defaultAccountRecords, err := dao.FindAllRecords("nats_auth_accounts",
+				dbx.HashExp{
+					"limits": "",
+				})
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not find accounts with default limits",
+					slog.String("error", err.Error()))
+				return err
+			}
+			accountRecords = append(accountRecords, defaultAccountRecords...)
+		}
+		// update the JWT of the accounts
+		for _, account := range accountRecords {
+			// SYS account does not use limits
+			if account.GetString("name") == "SYS" {
+				continue
+			}
+
+			logger.InfoContext(ctx, "Updating account with new limits...",
+				slog.String("operator_id", account.GetString("operator")), slog.String("account_id", account.Id))
+
+			err := handleLimitAndAccountUpdate(logger, dao, account)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update account with new limits",
+					slog.String("account_id", account.Id),
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+		return nil
+	}
+
 	t.cfg.App.OnRecordAfterUpdateSuccess().BindFunc(func(e *core.RecordEvent) error {
 		logger := logger.With(slog.String("hook", "OnModelAfterUpdate"),
 			slog.String("collection", e.Record.TableName()),
 			slog.String("record_id", e.Record.Id))
 
-		if e.Record.TableName() == "nats_auth_limits" {
+		if e.Record.TableName() == "nats_auth_operators" && !cfg.DisableNATSCLIContexts {
 			record := e.Record
-			logger = logger.With(slog.String("limit_id", record.Id))
+			if connectionSettings(record) == connectionSettings(record.Original()) {
+				return e.Next()
+			}
 
-			logger.InfoContext(ctx, "Limits changed...")
+			logger.InfoContext(ctx, "Connection settings changed, updating user contexts...")
 
-			// find any account that uses these limits
-			accountRecords, err := e.App.FindAllRecords("nats_auth_accounts",
-				dbx.HashExp{
-					"limits": record.Id,
-				})
+			userRecords, err := e.App.FindRecordsByFilter("nats_auth_users",
+				"account.operator = {:operator}", "", 0, 0,
+				dbx.Params{"operator": record.Id})
 			if err != nil {
-				logger.ErrorContext(ctx, "Could not find accounts with limits",
+				logger.ErrorContext(ctx, "Could not find users of operator",
 					slog.String("error", err.Error()))
 				return err
 			}
-			// update the JWT of the accounts
-			for _, account := range accountRecords {
-
-				logger.InfoContext(ctx, "Updating account with new limits...",
-					slog.String("operator_id", account.GetString("operator")), slog.String("account_id", account.Id))
-
-				err := handleLimitAndAccountUpdate(logger, e.App, account)
+			for _, userRecord := range userRecords {
+				err := handleNatsContextUpsert(logger, e.App, userRecord)
 				if err != nil {
-					logger.ErrorContext(ctx, "Could not update account with new limits",
-						slog.String("account_id", account.Id),
+					logger.ErrorContext(ctx, "Could not update user context",
 						slog.String("error", err.Error()))
 					return err
 				}
 			}
+			return e.Next()
+		}
+		if e.Record.TableName() == "nats_auth_limits" {
+			record := e.Record
+			logger = logger.With(slog.String("limit_id", record.Id))
+
+			logger.InfoContext(ctx, "Limits changed...")
+
+			t.queueWebhookEvent(ctx, e.App, application.WebhookEventLimitsChanged, record,
+				webhookLimits{Limits: GetLimitsFromRecord(record)})
+
+			err := handleLimitsChange(logger, e.App, record,
+				record.GetBool("default") || record.Original().GetBool("default"))
+			if err != nil {
+				return err
+			}
 
 			return nil
 		}
@@ -317,6 +613,15 @@ func CreateNATSAuthModule(ctx context.Context,
 
 			logger.InfoContext(ctx, "Updating account...")
 
+			if record.GetString("limits") != record.Original().GetString("limits") {
+				limits, err := t.getAccountLimitsRecord(ctx, e.App, record)
+				if err != nil {
+					return err
+				}
+				t.queueWebhookEvent(ctx, e.App, application.WebhookEventLimitsChanged, record,
+					webhookLimits{Limits: limits, Account: newWebhookAccount(record)})
+			}
+
 			err := handleLimitAndAccountUpdate(logger, e.App, record)
 			if err != nil {
 				logger.ErrorContext(ctx, "Could not update account",
@@ -330,6 +635,24 @@ func CreateNATSAuthModule(ctx context.Context,
 			record := e.Record
 			logger = logger.With(slog.String("account_id", record.GetString("account")))
 
+			if record.GetString("jwt") != record.Original().GetString("jwt") {
+				reason := "reissued"
+				if record.GetString("public_key") != record.Original().GetString("public_key") {
+					reason = "rotated"
+				}
+				err := t.addUserCredential(e.App, record, reason)
+				if err != nil {
+					logger.ErrorContext(ctx, "Could not add user credential to history",
+						slog.String("error", err.Error()))
+					return err
+				}
+				if reason == "rotated" {
+					user := newWebhookUser(record)
+					user.OldPublicKey = record.Original().GetString("public_key")
+					t.queueWebhookEvent(ctx, e.App, application.WebhookEventCredentialsRotated, record, user)
+				}
+			}
+
 			err := handleNatsContextUpsert(logger, e.App, record)
 			if err != nil {
 				logger.ErrorContext(ctx, "Could not update user context",
@@ -337,6 +660,46 @@ func CreateNATSAuthModule(ctx context.Context,
 				return err
 			}
 		}
+		if e.Record.TableName() == "nats_auth_permissions" {
+			err := handleUserClaimsUpdate(e.Context, logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update user after permissions changed",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+		if e.Record.TableName() == "nats_auth_user_limits" {
+			err := handleUserClaimsUpdate(e.Context, logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update user after limits changed",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+		if e.Record.TableName() == "nats_auth_account_signing_keys" {
+			err := handleSigningKeyUpdate(logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update account after signing key changed",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+		if e.Record.TableName() == "nats_auth_exports" {
+			err := handleExportUpdate(logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update accounts after export changed",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+		if e.Record.TableName() == "nats_auth_imports" {
+			err := handleImportUpdate(logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update account after import changed",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
 		return e.Next()
 	})
 
@@ -345,6 +708,19 @@ func CreateNATSAuthModule(ctx context.Context,
 			slog.String("collection", e.Record.TableName()),
 			slog.String("record_id", e.Record.Id))
 
+		if e.Record.TableName() == "nats_auth_limits" && e.Record.GetBool("default") {
+			logger.Info("Default limits deleted. Working on account update...")
+
+			t.queueWebhookEvent(ctx, e.App, application.WebhookEventLimitsChanged, e.Record,
+				webhookLimits{Limits: GetLimitsFromRecord(e.Record)})
+
+			// accounts referencing the limits are updated when the relation is removed
+			err := handleLimitsChange(logger, e.App, e.Record, true)
+			if err != nil {
+				return err
+			}
+		}
+
 		if e.Record.TableName() == "nats_auth_accounts" {
 			logger.Info("Account deleted. Working on account update...")
 			record := e.Record
@@ -354,7 +730,13 @@ func CreateNATSAuthModule(ctx context.Context,
 				return nil
 			}
 
-			err := t.publishAccountRecordRemoval(ctx, e.App, record)
+			t.queueWebhookEvent(ctx, e.App, application.WebhookEventAccountDeleted, record, newWebhookAccount(record))
+
+			// accounts deleted with their installation have no servers to remove them from
+			if _, err := e.App.FindRecordById("nats_auth_operators", record.GetString("operator")); err != nil {
+				return nil
+			}
+			err := t.publishAccountChange(ctx, e.App, record, accountPublishDelete)
 			if err != nil {
 				logger.ErrorContext(ctx, "Could not publish removed account",
 					slog.String("error", err.Error()))
@@ -367,6 +749,8 @@ func CreateNATSAuthModule(ctx context.Context,
 			record := e.Record
 			logger = logger.With(slog.String("account_id", record.GetString("account")))
 
+			t.queueWebhookEvent(ctx, e.App, application.WebhookEventUserDeleted, record, newWebhookUser(record))
+
 			accRecord, err := e.App.FindRecordById("nats_auth_accounts", record.GetString("account"))
 			if err != nil {
 				if err == sql.ErrNoRows {
@@ -414,6 +798,60 @@ func CreateNATSAuthModule(ctx context.Context,
 				}
 			}
 		}
+
+		if e.Record.TableName() == "nats_auth_permissions" {
+			logger.Info("Permissions deleted. Working on user update...")
+
+			err := handleUserClaimsUpdate(e.Context, logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update user after permissions were removed",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+
+		if e.Record.TableName() == "nats_auth_user_limits" {
+			logger.Info("User limits deleted. Working on user update...")
+
+			err := handleUserClaimsUpdate(e.Context, logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update user after limits were removed",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+
+		if e.Record.TableName() == "nats_auth_account_signing_keys" {
+			logger.Info("Signing key deleted. Working on account update...")
+
+			err := handleSigningKeyUpdate(logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update account after signing key was removed",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+		if e.Record.TableName() == "nats_auth_exports" {
+			logger.Info("Export deleted. Working on account update...")
+
+			err := handleExportUpdate(logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update accounts after export was removed",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+
+		if e.Record.TableName() == "nats_auth_imports" {
+			logger.Info("Import deleted. Working on account update...")
+
+			err := handleImportUpdate(logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update account after import was removed",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
 		return e.Next()
 	})
 
@@ -424,6 +862,18 @@ func CreateNATSAuthModule(ctx context.Context,
 			slog.String("collection", e.Record.TableName()),
 			slog.String("record_id", e.Record.Id))
 
+		if e.Record.TableName() == "nats_auth_limits" && e.Record.GetBool("default") {
+			logger.InfoContext(ctx, "Default limits created...")
+
+			t.queueWebhookEvent(ctx, e.App, application.WebhookEventLimitsChanged, e.Record,
+				webhookLimits{Limits: GetLimitsFromRecord(e.Record)})
+
+			err := handleLimitsChange(logger, e.App, e.Record, true)
+			if err != nil {
+				return err
+			}
+		}
+
 		if e.Record.TableName() == "nats_auth_accounts" {
 			record := e.Record
 			logger = logger.With(slog.String("operator_id", record.GetString("operator")))
@@ -433,8 +883,10 @@ func CreateNATSAuthModule(ctx context.Context,
 				return nil
 			}
 
-			// send account to nats
-			err := t.publishAccountRecord(ctx, e.App, record)
+			t.queueWebhookEvent(ctx, e.App, application.WebhookEventAccountCreated, record, newWebhookAccount(record))
+
+			// send account to nats, it is retried in the background if the servers are not reachable
+			err := t.publishAccountChange(ctx, e.App, record, accountPublishUpdate)
 			if err != nil {
 				logger.ErrorContext(ctx, "Could not publish created account",
 					slog.String("error", err.Error()))
@@ -442,6 +894,16 @@ func CreateNATSAuthModule(ctx context.Context,
 			}
 			return nil
 		}
+		if e.Record.TableName() == "nats_auth_users" {
+			t.queueWebhookEvent(ctx, e.App, application.WebhookEventUserCreated, e.Record, newWebhookUser(e.Record))
+
+			err := t.addUserCredential(e.App, e.Record, "created")
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not add user credential to history",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
 		if e.Record.TableName() == "nats_auth_users" && !cfg.DisableNATSCLIContexts { // only create user contexts if not disabled
 			record := e.Record
 			logger = logger.With(slog.String("account_id", record.GetString("account")))
@@ -453,6 +915,46 @@ func CreateNATSAuthModule(ctx context.Context,
 				return err
 			}
 		}
+		if e.Record.TableName() == "nats_auth_permissions" {
+			err := handleUserClaimsUpdate(e.Context, logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update user after permissions were created",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+		if e.Record.TableName() == "nats_auth_user_limits" {
+			err := handleUserClaimsUpdate(e.Context, logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update user after limits were created",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+		if e.Record.TableName() == "nats_auth_account_signing_keys" {
+			err := handleSigningKeyUpdate(logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update account after signing key was created",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+		if e.Record.TableName() == "nats_auth_exports" {
+			err := handleExportUpdate(logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update account after export was created",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+		if e.Record.TableName() == "nats_auth_imports" {
+			err := handleImportUpdate(logger, e.App, e.Record)
+			if err != nil {
+				logger.ErrorContext(ctx, "Could not update account after import was created",
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
 		return e.Next()
 	})
 
@@ -463,7 +965,7 @@ func CreateNATSAuthModule(ctx context.Context,
 			return nil, err
 		}
 		if err == ErrNotFound {
-			record, err := generateOperatorRecord(ctx,
+			record, err := t.generateOperatorRecord(ctx,
 				core.NewRecord(t.NATSOperatorCollection),
 				bootstrapURL)
 			if err != nil {
@@ -476,9 +978,9 @@ func CreateNATSAuthModule(ctx context.Context,
 					slog.String("error", err.Error()))
 				return nil, err
 			}
-			operator = &application.OperatorAuth{
-				ID:          record.Id,
-				SigningSeed: record.GetString("sign_seed"),
+			operator, err = t.GetOperatorFromRecord(record)
+			if err != nil {
+				return nil, err
 			}
 		}
 		oLogger = oLogger.With(slog.String("operator_id", operator.ID))
@@ -488,10 +990,14 @@ func CreateNATSAuthModule(ctx context.Context,
 			return nil, err
 		}
 		if err == ErrNotFound {
-			record, err := generateAccountRecord(ctx,
+			operatorKP, err := t.signer.KeyPair(ctx, t.cfg.App, operator.SigningPublicKey)
+			if err != nil {
+				return nil, err
+			}
+			record, err := t.generateAccountRecord(ctx,
 				core.NewRecord(t.NATSAccountCollection),
 				operator.ID,
-				operator.SigningSeed,
+				operatorKP,
 				"SYS",
 				"Automatically created system account",
 				jwt.OperatorLimits{
@@ -511,10 +1017,9 @@ func CreateNATSAuthModule(ctx context.Context,
 					slog.String("error", err.Error()))
 				return nil, err
 			}
-			sysAccount = &application.AccountAuth{
-				ID:          record.Id,
-				PublicKey:   record.GetString("public_key"),
-				SigningSeed: record.GetString("sign_seed"),
+			sysAccount, err = t.GetAccountFromRecord(record, bootstrapURL)
+			if err != nil {
+				return nil, err
 			}
 		}
 		oLogger = oLogger.With(slog.String("account_id", sysAccount.ID))
@@ -524,11 +1029,15 @@ func CreateNATSAuthModule(ctx context.Context,
 			return nil, err
 		}
 		if err == ErrNotFound {
-			record, err := generateUserRecord(ctx,
+			accountKP, err := t.signer.KeyPair(ctx, t.cfg.App, sysAccount.SigningPublicKey)
+			if err != nil {
+				return nil, err
+			}
+			record, err := t.generateUserRecord(ctx,
 				core.NewRecord(t.NATSUserCollection),
 				sysAccount.ID,
 				sysAccount.PublicKey,
-				sysAccount.SigningSeed,
+				accountKP,
 				"sys")
 			if err != nil {
 				return nil, err
@@ -570,5 +1079,18 @@ func CreateNATSAuthModule(ctx context.Context,
 		logger.InfoContext(ctx, "NATS CLI contexts are disabled...")
 	}
 
+	if cfg.CredentialRenewalInterval > 0 {
+		go t.runCredentialRenewal(ctx, cfg.CredentialRenewalInterval)
+	}
+	if cfg.DriftCheckInterval > 0 {
+		go t.runDriftCheck(ctx, cfg.DriftCheckInterval)
+	}
+	if cfg.AuditEventAccount != "" {
+		go t.runAuditEventPublisher(ctx)
+	}
+	go t.runWebhookDelivery(ctx)
+	go t.runAccountPublisher(ctx)
+	go t.closeSysConns(ctx)
+
 	return t, nil
 }
@@ -6,17 +6,19 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/nats-io/nkeys"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/nats-tower/nats-tower/application"
 )
 
 func (m *NATSAuthModule) initNATSAuthCollections(app core.App) error {
 
-	apiRule := "@request.auth.id != ''"
-	if m.cfg.APIToken != "" {
-		apiRule = fmt.Sprintf("@request.auth.id != '' || @request.headers.x_token = '%s'", m.cfg.APIToken)
-	}
+	// the collection API exposes seeds and bypasses the roles, so only superusers may use it.
+	// Members use the web UI and API tokens /api/v1, which both check the roles.
+	var apiRule *string
 
 	limitCollection, err := initNATSAuthLimitsCollection(m.ctx,
 		app,
@@ -43,11 +45,53 @@ func (m *NATSAuthModule) initNATSAuthCollections(app core.App) error {
 		m.cfg.InitialOperatorURLs,
 		m.cfg.InitialAccountName,
 		m.cfg.InitialAccountPublicKey,
-		m.cfg.InitialAccountSigningSeed)
+		m.cfg.InitialAccountSigningSeed,
+		m.keyRing)
+	if err != nil {
+		return err
+	}
+	signingKeyCollection, err := initNATSAuthAccountSigningKeysCollection(m.ctx,
+		app,
+		m.logger,
+		apiRule,
+		accountCollection)
 	if err != nil {
 		return err
 	}
 	userCollection, err := initNATSAuthUsersCollection(m.ctx,
+		app,
+		m.logger,
+		apiRule,
+		accountCollection,
+		signingKeyCollection)
+	if err != nil {
+		return err
+	}
+	permissionCollection, err := initNATSAuthPermissionsCollection(m.ctx,
+		app,
+		m.logger,
+		apiRule,
+		userCollection)
+	if err != nil {
+		return err
+	}
+	userLimitCollection, err := initNATSAuthUserLimitsCollection(m.ctx,
+		app,
+		m.logger,
+		apiRule,
+		userCollection)
+	if err != nil {
+		return err
+	}
+	credentialCollection, err := initNATSAuthUserCredentialsCollection(m.ctx,
+		app,
+		m.logger,
+		apiRule,
+		userCollection)
+	if err != nil {
+		return err
+	}
+	exportCollection, err := initNATSAuthExportsCollection(m.ctx,
 		app,
 		m.logger,
 		apiRule,
@@ -55,16 +99,61 @@ func (m *NATSAuthModule) initNATSAuthCollections(app core.App) error {
 	if err != nil {
 		return err
 	}
+	importCollection, err := initNATSAuthImportsCollection(m.ctx,
+		app,
+		m.logger,
+		apiRule,
+		accountCollection,
+		exportCollection)
+	if err != nil {
+		return err
+	}
+	auditLogCollection, err := initAuditLogCollection(m.ctx,
+		app,
+		m.logger)
+	if err != nil {
+		return err
+	}
+	webhookCollection, err := initWebhooksCollection(m.ctx,
+		app,
+		m.logger)
+	if err != nil {
+		return err
+	}
+	webhookDeliveryCollection, err := initWebhookDeliveriesCollection(m.ctx,
+		app,
+		m.logger,
+		webhookCollection)
+	if err != nil {
+		return err
+	}
+	outboxCollection, err := initNATSAuthOutboxCollection(m.ctx,
+		app,
+		m.logger,
+		operatorCollection)
+	if err != nil {
+		return err
+	}
 	m.NATSOperatorCollection = operatorCollection
 	m.NATSAccountCollection = accountCollection
+	m.NATSAccountSigningKeyCollection = signingKeyCollection
 	m.NATSUserCollection = userCollection
+	m.NATSPermissionCollection = permissionCollection
+	m.NATSUserLimitCollection = userLimitCollection
+	m.NATSUserCredentialCollection = credentialCollection
+	m.NATSExportCollection = exportCollection
+	m.NATSImportCollection = importCollection
+	m.AuditLogCollection = auditLogCollection
+	m.WebhookCollection = webhookCollection
+	m.WebhookDeliveryCollection = webhookDeliveryCollection
+	m.NATSOutboxCollection = outboxCollection
 
 	return nil
 }
 
 func initNATSAuthOperatorsCollection(ctx context.Context, app core.App,
 	logger *slog.Logger,
-	rule string,
+	rule *string,
 	initialOperatorURLs string) (*core.Collection, error) {
 
 	collection, err := app.FindCollectionByNameOrId("nats_auth_operators")
@@ -76,11 +165,11 @@ func initNATSAuthOperatorsCollection(ctx context.Context, app core.App,
 		return nil, err
 	}
 
-	collection.ListRule = types.Pointer(rule)
-	collection.ViewRule = types.Pointer(rule)
-	collection.CreateRule = types.Pointer(rule)
-	collection.UpdateRule = types.Pointer(rule)
-	collection.DeleteRule = types.Pointer(rule)
+	collection.ListRule = rule
+	collection.ViewRule = rule
+	collection.CreateRule = rule
+	collection.UpdateRule = rule
+	collection.DeleteRule = rule
 	collection.Indexes = types.JSONArray[string]{
 		"create unique index nats_operators_unique_url on keys (url)",
 		"create unique index nats_operators_unique_public_key on keys (public_key)",
@@ -122,6 +211,60 @@ func initNATSAuthOperatorsCollection(ctx context.Context, app core.App,
 		Name:     "sign_seed",
 		Required: false,
 	})
+	// signing key rotation: the next key is trusted by the operator JWT before accounts are signed with it,
+	// the retiring key stays trusted until all servers acknowledged the re-signed accounts
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "next_sign_public_key",
+		Required: false,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "next_sign_private_key",
+		Required: false,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "next_sign_seed",
+		Required: false,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "retiring_sign_public_key",
+		Required: false,
+	})
+	// connection settings, the url stays the identifier of the installation
+	addOrUpdateField(collection, &core.JSONField{
+		Name:    "seed_urls",
+		MaxSize: 1024 * 1024, // 1MB
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "tls_ca",
+		Required: false,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "tls_cert",
+		Required: false,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "tls_key",
+		Required: false,
+	})
+	addOrUpdateField(collection, &core.BoolField{
+		Name: "tls_handshake_first",
+	})
+	// resolver mode, empty is a full resolver
+	addOrUpdateField(collection, &core.SelectField{
+		Name: "resolver_mode",
+		Values: []string{
+			string(application.ResolverFull),
+			string(application.ResolverMemory),
+		},
+		MaxSelect: 1,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "config_path",
+		Required: false,
+	})
+	addOrUpdateField(collection, &core.BoolField{
+		Name: "config_reload_required",
+	})
 
 	// validate and submit (internally it calls app.SaveCollection(collection) in a transaction)
 	if err := app.Save(collection); err != nil {
@@ -156,13 +299,14 @@ func initNATSAuthOperatorsCollection(ctx context.Context, app core.App,
 func initNATSAuthAccountsCollection(ctx context.Context,
 	app core.App,
 	logger *slog.Logger,
-	rule string,
+	rule *string,
 	operatorCollection *core.Collection,
 	limitCollection *core.Collection,
 	initialOperatorURLs string,
 	InitialAccountName string,
 	InitialAccountPublicKey string,
-	InitialAccountSigningSeed string) (*core.Collection, error) {
+	InitialAccountSigningSeed string,
+	keyRing *KeyRing) (*core.Collection, error) {
 
 	collection, err := app.FindCollectionByNameOrId("nats_auth_accounts")
 
@@ -172,11 +316,11 @@ func initNATSAuthAccountsCollection(ctx context.Context,
 	if err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
-	collection.ListRule = types.Pointer(rule)
-	collection.ViewRule = types.Pointer(rule)
-	collection.CreateRule = types.Pointer(rule)
-	collection.UpdateRule = types.Pointer(rule)
-	collection.DeleteRule = types.Pointer(rule)
+	collection.ListRule = rule
+	collection.ViewRule = rule
+	collection.CreateRule = rule
+	collection.UpdateRule = rule
+	collection.DeleteRule = rule
 	collection.Indexes = types.JSONArray[string]{
 		"create unique index nats_accounts_unique_name_operator on keys (name,operator)",
 		"create unique index nats_accounts_unique_public_key on keys (public_key)",
@@ -230,6 +374,15 @@ func initNATSAuthAccountsCollection(ctx context.Context,
 		Required:     false,
 		MaxSelect:    1,
 	})
+	// accounts imported without their signing seed
+	addOrUpdateField(collection, &core.BoolField{
+		Name: "read_only",
+	})
+	// revoked user public keys with the unix time of the revocation
+	addOrUpdateField(collection, &core.JSONField{
+		Name:    "revocations",
+		MaxSize: 1024 * 1024, // 1MB
+	})
 
 	// validate and submit (internally it calls app.SaveCollection(collection) in a transaction)
 	if err := app.Save(collection); err != nil {
@@ -273,7 +426,20 @@ func initNATSAuthAccountsCollection(ctx context.Context,
 			record.Set("operator", operatorID)
 			record.Set("name", InitialAccountName)
 			record.Set("public_key", InitialAccountPublicKey)
-			record.Set("sign_seed", InitialAccountSigningSeed)
+			signingKP, err := nkeys.FromSeed([]byte(InitialAccountSigningSeed))
+			if err != nil {
+				return nil, err
+			}
+			signPubKey, err := signingKP.PublicKey()
+			if err != nil {
+				return nil, err
+			}
+			// the signer looks up the seed by its public key
+			record.Set("sign_public_key", signPubKey)
+			err = keyRing.setSecret(record, "sign_seed", InitialAccountSigningSeed)
+			if err != nil {
+				return nil, err
+			}
 			err = app.Save(record)
 			if err != nil {
 				return nil, err
@@ -285,12 +451,91 @@ func initNATSAuthAccountsCollection(ctx context.Context,
 	return collection, nil
 }
 
-func initNATSAuthUsersCollection(_ context.Context,
+// initNATSAuthAccountSigningKeysCollection holds the signing keys of an account in addition to the sign_seed of the account
+func initNATSAuthAccountSigningKeysCollection(_ context.Context,
 	app core.App,
 	_ *slog.Logger,
-	rule string,
+	rule *string,
 	accountCollection *core.Collection) (*core.Collection, error) {
 
+	collection, err := app.FindCollectionByNameOrId("nats_auth_account_signing_keys")
+
+	if err == sql.ErrNoRows {
+		collection = core.NewBaseCollection("nats_auth_account_signing_keys")
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	collection.ListRule = rule
+	collection.ViewRule = rule
+	collection.CreateRule = rule
+	collection.UpdateRule = rule
+	collection.DeleteRule = rule
+	collection.Indexes = types.JSONArray[string]{
+		"create unique index nats_auth_account_signing_keys_unique_public_key on nats_auth_account_signing_keys (public_key)",
+		"create index nats_auth_account_signing_keys_account on nats_auth_account_signing_keys (account)",
+	}
+
+	addOrUpdateField(collection, &core.RelationField{
+		Name:          "account",
+		Required:      true,
+		CollectionId:  accountCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "description",
+		Required: false,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "public_key",
+		Required: true,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "private_key",
+		Required: false,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "seed",
+		Required: true,
+	})
+	addOrUpdateField(collection, &core.BoolField{
+		Name:     "scoped",
+		Required: false,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "role",
+		Required: false,
+	})
+	// permissions applied to all users signed with a scoped key
+	addOrUpdateField(collection, &core.JSONField{
+		Name:     "template",
+		Required: false,
+	})
+	// set on a rotated key until the servers in memory mode reloaded their config, replaced_by is
+	// the key replacing it, empty for the account signing key
+	addOrUpdateField(collection, &core.BoolField{
+		Name: "retiring",
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name: "replaced_by",
+	})
+
+	// validate and submit (internally it calls app.SaveCollection(collection) in a transaction)
+	if err := app.Save(collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func initNATSAuthUsersCollection(_ context.Context,
+	app core.App,
+	_ *slog.Logger,
+	rule *string,
+	accountCollection *core.Collection,
+	signingKeyCollection *core.Collection) (*core.Collection, error) {
+
 	collection, err := app.FindCollectionByNameOrId("nats_auth_users")
 
 	if err == sql.ErrNoRows {
@@ -300,11 +545,11 @@ func initNATSAuthUsersCollection(_ context.Context,
 		return nil, err
 	}
 
-	collection.ListRule = types.Pointer(rule)
-	collection.ViewRule = types.Pointer(rule)
-	collection.CreateRule = types.Pointer(rule)
-	collection.UpdateRule = types.Pointer(rule)
-	collection.DeleteRule = types.Pointer(rule)
+	collection.ListRule = rule
+	collection.ViewRule = rule
+	collection.CreateRule = rule
+	collection.UpdateRule = rule
+	collection.DeleteRule = rule
 	collection.Indexes = types.JSONArray[string]{
 		"create unique index nats_users_unique_name_account on keys (name,account)",
 		"create unique index nats_users_unique_public_key on keys (public_key)",
@@ -349,6 +594,23 @@ func initNATSAuthUsersCollection(_ context.Context,
 		Name:     "creds",
 		Required: false,
 	})
+	// lifetime of the user JWT in milliseconds, 0 means the JWT does not expire
+	addOrUpdateField(collection, &core.NumberField{
+		Name:     "ttl",
+		Required: false,
+		OnlyInt:  true,
+	})
+	addOrUpdateField(collection, &core.DateField{
+		Name:     "expires",
+		Required: false,
+	})
+	// signing key of the account the user is signed with, empty for the sign_seed of the account
+	addOrUpdateField(collection, &core.RelationField{
+		Name:         "signing_key",
+		Required:     false,
+		CollectionId: signingKeyCollection.Id,
+		MaxSelect:    1,
+	})
 
 	// validate and submit (internally it calls app.SaveCollection(collection) in a transaction)
 	if err := app.Save(collection); err != nil {
@@ -360,7 +622,7 @@ func initNATSAuthUsersCollection(_ context.Context,
 func initNATSAuthLimitsCollection(_ context.Context,
 	app core.App,
 	_ *slog.Logger,
-	rule string) (*core.Collection, error) {
+	rule *string) (*core.Collection, error) {
 
 	collection, err := app.FindCollectionByNameOrId("nats_auth_limits")
 
@@ -371,11 +633,11 @@ func initNATSAuthLimitsCollection(_ context.Context,
 		return nil, err
 	}
 
-	collection.ListRule = types.Pointer(rule)
-	collection.ViewRule = types.Pointer(rule)
-	collection.CreateRule = types.Pointer(rule)
-	collection.UpdateRule = types.Pointer(rule)
-	collection.DeleteRule = types.Pointer(rule)
+	collection.ListRule = rule
+	collection.ViewRule = rule
+	collection.CreateRule = rule
+	collection.UpdateRule = rule
+	collection.DeleteRule = rule
 	collection.Indexes = types.JSONArray[string]{
 		"create unique index nats_auth_limits_unique_name on nats_auth_limits (name)",
 	}
@@ -416,6 +678,411 @@ func initNATSAuthLimitsCollection(_ context.Context,
 		Required: false,
 	})
 
+	// all other limits are optional, -1 means unlimited
+	var addedLimitFields []string
+	for _, name := range optionalLimitFields {
+		if collection.Fields.GetByName(name) == nil {
+			addedLimitFields = append(addedLimitFields, name)
+		}
+		addOrUpdateField(collection, &core.NumberField{
+			Name:    name,
+			OnlyInt: true,
+		})
+	}
+	addOrUpdateField(collection, &core.BoolField{
+		Name: "disallow_wildcard_exports",
+	})
+	addOrUpdateField(collection, &core.BoolField{
+		Name: "disallow_bearer",
+	})
+	addOrUpdateField(collection, &core.BoolField{
+		Name: "jetstream_max_bytes_required",
+	})
+	addOrUpdateField(collection, &core.JSONField{
+		Name:    "jetstream_tiers",
+		MaxSize: 1024 * 1024, // 1MB
+	})
+
+	// validate and submit (internally it calls app.SaveCollection(collection) in a transaction)
+	if err := app.Save(collection); err != nil {
+		return nil, err
+	}
+
+	// existing limit records were unlimited for the new fields, keep it that way
+	for _, name := range addedLimitFields {
+		_, err := app.DB().NewQuery(fmt.Sprintf("UPDATE nats_auth_limits SET [[%s]] = -1", name)).Execute()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return collection, nil
+}
+
+func initNATSAuthPermissionsCollection(_ context.Context,
+	app core.App,
+	_ *slog.Logger,
+	rule *string,
+	userCollection *core.Collection) (*core.Collection, error) {
+
+	collection, err := app.FindCollectionByNameOrId("nats_auth_permissions")
+
+	if err == sql.ErrNoRows {
+		collection = core.NewBaseCollection("nats_auth_permissions")
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	collection.ListRule = rule
+	collection.ViewRule = rule
+	collection.CreateRule = rule
+	collection.UpdateRule = rule
+	collection.DeleteRule = rule
+	collection.Indexes = types.JSONArray[string]{
+		"create unique index nats_auth_permissions_unique_user on nats_auth_permissions (user)",
+	}
+
+	addOrUpdateField(collection, &core.RelationField{
+		Name:          "user",
+		Required:      true,
+		CollectionId:  userCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	addOrUpdateField(collection, &core.JSONField{
+		Name:    "pub_allow",
+		MaxSize: 1024 * 1024, // 1MB
+	})
+	addOrUpdateField(collection, &core.JSONField{
+		Name:    "pub_deny",
+		MaxSize: 1024 * 1024, // 1MB
+	})
+	addOrUpdateField(collection, &core.JSONField{
+		Name:    "sub_allow",
+		MaxSize: 1024 * 1024, // 1MB
+	})
+	addOrUpdateField(collection, &core.JSONField{
+		Name:    "sub_deny",
+		MaxSize: 1024 * 1024, // 1MB
+	})
+	addOrUpdateField(collection, &core.BoolField{
+		Name:     "allow_responses",
+		Required: false,
+	})
+	addOrUpdateField(collection, &core.NumberField{
+		Name:     "responses_max",
+		Required: false,
+		OnlyInt:  true,
+	})
+	// in milliseconds
+	addOrUpdateField(collection, &core.NumberField{
+		Name:     "responses_ttl",
+		Required: false,
+		OnlyInt:  true,
+	})
+
+	// validate and submit (internally it calls app.SaveCollection(collection) in a transaction)
+	if err := app.Save(collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func initNATSAuthUserLimitsCollection(_ context.Context,
+	app core.App,
+	_ *slog.Logger,
+	rule *string,
+	userCollection *core.Collection) (*core.Collection, error) {
+
+	collection, err := app.FindCollectionByNameOrId("nats_auth_user_limits")
+
+	if err == sql.ErrNoRows {
+		collection = core.NewBaseCollection("nats_auth_user_limits")
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	collection.ListRule = rule
+	collection.ViewRule = rule
+	collection.CreateRule = rule
+	collection.UpdateRule = rule
+	collection.DeleteRule = rule
+	collection.Indexes = types.JSONArray[string]{
+		"create unique index nats_auth_user_limits_unique_user on nats_auth_user_limits (user)",
+	}
+
+	addOrUpdateField(collection, &core.RelationField{
+		Name:          "user",
+		Required:      true,
+		CollectionId:  userCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	// -1 means unlimited
+	addOrUpdateField(collection, &core.NumberField{
+		Name:     "max_subscriptions",
+		Required: false,
+		OnlyInt:  true,
+	})
+	addOrUpdateField(collection, &core.NumberField{
+		Name:     "max_data",
+		Required: false,
+		OnlyInt:  true,
+	})
+	addOrUpdateField(collection, &core.NumberField{
+		Name:     "max_payload",
+		Required: false,
+		OnlyInt:  true,
+	})
+	addOrUpdateField(collection, &core.JSONField{
+		Name:    "connection_types",
+		MaxSize: 1024 * 1024, // 1MB
+	})
+	// CIDRs the user may connect from
+	addOrUpdateField(collection, &core.JSONField{
+		Name:    "src",
+		MaxSize: 1024 * 1024, // 1MB
+	})
+	// time windows the user may connect in
+	addOrUpdateField(collection, &core.JSONField{
+		Name:    "times",
+		MaxSize: 1024 * 1024, // 1MB
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "locale",
+		Required: false,
+	})
+
+	// validate and submit (internally it calls app.SaveCollection(collection) in a transaction)
+	if err := app.Save(collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+// initNATSAuthUserCredentialsCollection holds the history of the JWTs issued for a user
+func initNATSAuthUserCredentialsCollection(_ context.Context,
+	app core.App,
+	_ *slog.Logger,
+	rule *string,
+	userCollection *core.Collection) (*core.Collection, error) {
+
+	collection, err := app.FindCollectionByNameOrId("nats_auth_user_credentials")
+
+	if err == sql.ErrNoRows {
+		collection = core.NewBaseCollection("nats_auth_user_credentials")
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	collection.ListRule = rule
+	collection.ViewRule = rule
+	collection.CreateRule = rule
+	collection.UpdateRule = rule
+	collection.DeleteRule = rule
+	collection.Indexes = types.JSONArray[string]{
+		"create index nats_auth_user_credentials_user on nats_auth_user_credentials (user)",
+	}
+
+	addOrUpdateField(collection, &core.RelationField{
+		Name:          "user",
+		Required:      true,
+		CollectionId:  userCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "public_key",
+		Required: true,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "jwt",
+		Required: true,
+	})
+	addOrUpdateField(collection, &core.DateField{
+		Name:     "issued",
+		Required: true,
+	})
+	addOrUpdateField(collection, &core.DateField{
+		Name:     "expires",
+		Required: false,
+	})
+	addOrUpdateField(collection, &core.SelectField{
+		Name:     "reason",
+		Required: true,
+		Values: []string{
+			"created",
+			"reissued",
+			"rotated",
+		},
+		MaxSelect: 1,
+	})
+	addOrUpdateField(collection, &core.AutodateField{
+		Name:     "created",
+		OnCreate: true,
+	})
+
+	// validate and submit (internally it calls app.SaveCollection(collection) in a transaction)
+	if err := app.Save(collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func initNATSAuthExportsCollection(_ context.Context,
+	app core.App,
+	_ *slog.Logger,
+	rule *string,
+	accountCollection *core.Collection) (*core.Collection, error) {
+
+	collection, err := app.FindCollectionByNameOrId("nats_auth_exports")
+
+	if err == sql.ErrNoRows {
+		collection = core.NewBaseCollection("nats_auth_exports")
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	collection.ListRule = rule
+	collection.ViewRule = rule
+	collection.CreateRule = rule
+	collection.UpdateRule = rule
+	collection.DeleteRule = rule
+	collection.Indexes = types.JSONArray[string]{
+		"create unique index nats_auth_exports_unique_name_account on nats_auth_exports (name,account)",
+	}
+
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "name",
+		Required: true,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "description",
+		Required: false,
+	})
+	addOrUpdateField(collection, &core.RelationField{
+		Name:          "account",
+		Required:      true,
+		CollectionId:  accountCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "subject",
+		Required: true,
+	})
+	addOrUpdateField(collection, &core.SelectField{
+		Name:     "type",
+		Required: true,
+		Values: []string{
+			"stream",
+			"service",
+		},
+		MaxSelect: 1,
+	})
+	addOrUpdateField(collection, &core.BoolField{
+		Name:     "private",
+		Required: false,
+	})
+	// accounts allowed to import a private export
+	addedImporters := err == nil && collection.Fields.GetByName("importers") == nil
+	addOrUpdateField(collection, &core.RelationField{
+		Name:         "importers",
+		Required:     false,
+		CollectionId: accountCollection.Id,
+		MaxSelect:    999,
+	})
+	addOrUpdateField(collection, &core.SelectField{
+		Name:     "response_type",
+		Required: false,
+		Values: []string{
+			"Singleton",
+			"Stream",
+			"Chunked",
+		},
+		MaxSelect: 1,
+	})
+
+	// validate and submit (internally it calls app.SaveCollection(collection) in a transaction)
+	if err := app.Save(collection); err != nil {
+		return nil, err
+	}
+
+	// existing private exports stay importable by the accounts already importing them
+	if addedImporters {
+		exportRecords, err := app.FindAllRecords(collection, dbx.HashExp{"private": true})
+		if err != nil {
+			return nil, err
+		}
+		for _, exportRecord := range exportRecords {
+			var importers []string
+			err := app.DB().NewQuery("SELECT DISTINCT account FROM nats_auth_imports WHERE export = {:export}").
+				Bind(dbx.Params{"export": exportRecord.Id}).
+				Column(&importers)
+			if err != nil {
+				return nil, err
+			}
+			exportRecord.Set("importers", importers)
+			if err := app.UnsafeWithoutHooks().Save(exportRecord); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return collection, nil
+}
+
+func initNATSAuthImportsCollection(_ context.Context,
+	app core.App,
+	_ *slog.Logger,
+	rule *string,
+	accountCollection *core.Collection,
+	exportCollection *core.Collection) (*core.Collection, error) {
+
+	collection, err := app.FindCollectionByNameOrId("nats_auth_imports")
+
+	if err == sql.ErrNoRows {
+		collection = core.NewBaseCollection("nats_auth_imports")
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	collection.ListRule = rule
+	collection.ViewRule = rule
+	collection.CreateRule = rule
+	collection.UpdateRule = rule
+	collection.DeleteRule = rule
+	collection.Indexes = types.JSONArray[string]{
+		"create unique index nats_auth_imports_unique_name_account on nats_auth_imports (name,account)",
+	}
+
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "name",
+		Required: true,
+	})
+	// the importing account
+	addOrUpdateField(collection, &core.RelationField{
+		Name:          "account",
+		Required:      true,
+		CollectionId:  accountCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	addOrUpdateField(collection, &core.RelationField{
+		Name:          "export",
+		Required:      true,
+		CollectionId:  exportCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "local_subject",
+		Required: false,
+	})
+
 	// validate and submit (internally it calls app.SaveCollection(collection) in a transaction)
 	if err := app.Save(collection); err != nil {
 		return nil, err
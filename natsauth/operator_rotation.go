@@ -0,0 +1,361 @@
+package natsauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	jwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// serverDiscoveryTimeout is how long to wait for the NATS servers to answer a ping
+const serverDiscoveryTimeout = 2 * time.Second
+
+// accountAckTimeout is how long to wait for all NATS servers to acknowledge an account
+const accountAckTimeout = 5 * time.Second
+
+// signOperatorRecord re-issues the operator JWT with all signing keys of the operator record
+func (m *NATSAuthModule) signOperatorRecord(ctx context.Context, dao core.App, record *core.Record) error {
+	canSign, err := m.canSign(ctx, dao, record, "public_key")
+	if err != nil {
+		return err
+	}
+	if !canSign {
+		return fmt.Errorf("operator has no seed. Only operators created by NATS Tower can rotate their signing key")
+	}
+
+	operatorClaims, err := jwt.DecodeOperatorClaims(record.GetString("jwt"))
+	if err != nil {
+		return err
+	}
+
+	operatorClaims.SigningKeys = jwt.StringList{}
+	for _, field := range []string{"sign_public_key", "next_sign_public_key", "retiring_sign_public_key"} {
+		if record.GetString(field) != "" {
+			operatorClaims.SigningKeys.Add(record.GetString(field))
+		}
+	}
+
+	operatorKP, err := m.signingKeyPair(ctx, dao, record, "public_key")
+	if err != nil {
+		return err
+	}
+
+	jwtValue, err := operatorClaims.Encode(operatorKP)
+	if err != nil {
+		return err
+	}
+	record.Set("jwt", jwtValue)
+	return nil
+}
+
+// StartOperatorSigningKeyRotation adds a new signing key to the operator JWT.
+// The NATS servers have to be configured with the new operator JWT before the rotation can be completed.
+func (m *NATSAuthModule) StartOperatorSigningKeyRotation(ctx context.Context, operatorID string) (*application.OperatorAuth, error) {
+	var res *application.OperatorAuth
+	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		record, err := txDao.FindRecordById("nats_auth_operators", operatorID)
+		if err != nil {
+			return err
+		}
+		if record.GetString("next_sign_public_key") != "" || record.GetString("retiring_sign_public_key") != "" {
+			return fmt.Errorf("a signing key rotation is already in progress")
+		}
+		canSign, err := m.canSign(ctx, txDao, record, "sign_public_key")
+		if err != nil {
+			return err
+		}
+		if !canSign {
+			return fmt.Errorf("operator has no signing seed")
+		}
+
+		signingKP, err := nkeys.CreatePair(nkeys.PrefixByteOperator)
+		if err != nil {
+			return err
+		}
+		signPubKey, err := signingKP.PublicKey()
+		if err != nil {
+			return err
+		}
+		signPrivateKey, err := signingKP.PrivateKey()
+		if err != nil {
+			return err
+		}
+		signSeed, err := signingKP.Seed()
+		if err != nil {
+			return err
+		}
+
+		m.logger.InfoContext(ctx, "Starting operator signing key rotation...",
+			slog.String("operator_id", operatorID),
+			slog.String("public_key", signPubKey))
+
+		record.Set("next_sign_public_key", signPubKey)
+		err = m.keyRing.setSecrets(record, map[string]string{
+			"next_sign_private_key": string(signPrivateKey),
+			"next_sign_seed":        string(signSeed),
+		})
+		if err != nil {
+			return err
+		}
+		if err := m.signOperatorRecord(ctx, txDao, record); err != nil {
+			return err
+		}
+		if err := txDao.SaveWithContext(ctx, record); err != nil {
+			return err
+		}
+
+		res, err = m.GetOperatorFromRecord(record)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// CompleteOperatorSigningKeyRotation signs all accounts of the operator with the new signing key and queues them
+// for the servers. The old signing key is retired once all servers acknowledged the accounts.
+func (m *NATSAuthModule) CompleteOperatorSigningKeyRotation(ctx context.Context, operatorID string) (*application.OperatorAuth, error) {
+	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		record, err := txDao.FindRecordById("nats_auth_operators", operatorID)
+		if err != nil {
+			return err
+		}
+		if record.GetString("next_sign_public_key") == "" {
+			return fmt.Errorf("no signing key rotation was started")
+		}
+
+		logger := m.logger.With(slog.String("operator_id", operatorID))
+		logger.InfoContext(ctx, "Switching operator signing key...",
+			slog.String("old_public_key", record.GetString("sign_public_key")),
+			slog.String("public_key", record.GetString("next_sign_public_key")))
+
+		record.Set("retiring_sign_public_key", record.GetString("sign_public_key"))
+		record.Set("sign_public_key", record.GetString("next_sign_public_key"))
+		// encrypted secrets are bound to their field, so they are encrypted again
+		secrets, err := m.keyRing.getSecrets(record, "next_sign_private_key", "next_sign_seed")
+		if err != nil {
+			return err
+		}
+		err = m.keyRing.setSecrets(record, map[string]string{
+			"sign_private_key": secrets["next_sign_private_key"],
+			"sign_seed":        secrets["next_sign_seed"],
+		})
+		if err != nil {
+			return err
+		}
+		record.Set("next_sign_public_key", "")
+		record.Set("next_sign_private_key", "")
+		record.Set("next_sign_seed", "")
+		if err := m.signOperatorRecord(ctx, txDao, record); err != nil {
+			return err
+		}
+		if err := txDao.SaveWithContext(ctx, record); err != nil {
+			return err
+		}
+
+		operatorKP, err := m.signingKeyPair(ctx, txDao, record, "sign_public_key")
+		if err != nil {
+			return err
+		}
+
+		accountRecords, err := txDao.FindAllRecords("nats_auth_accounts",
+			dbx.HashExp{
+				"operator": operatorID,
+			})
+		if err != nil {
+			return err
+		}
+		for _, accountRecord := range accountRecords {
+			if accountRecord.GetString("jwt") == "" {
+				continue
+			}
+			// re-sign the existing claims, so accounts without a signing seed keep their content
+			accountClaims, err := jwt.DecodeAccountClaims(accountRecord.GetString("jwt"))
+			if err != nil {
+				return err
+			}
+			jwtValue, err := accountClaims.Encode(operatorKP)
+			if err != nil {
+				return err
+			}
+			accountRecord.Set("jwt", jwtValue)
+			if err := txDao.UnsafeWithoutHooks().Save(accountRecord); err != nil {
+				return err
+			}
+
+			// published by the outbox once the transaction is committed, so the servers
+			// never hold accounts signed with a key that was rolled back
+			logger.InfoContext(ctx, "Queueing re-signed account...",
+				slog.String("name", accountRecord.GetString("name")))
+			if _, err := m.queueAccountPublish(ctx, txDao, accountRecord, accountPublishUpdate, time.Now()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m.RetireOperatorSigningKey(ctx, operatorID)
+}
+
+// RetireOperatorSigningKey removes the old signing key from the operator JWT
+// after all servers acknowledged the accounts signed with the new key.
+func (m *NATSAuthModule) RetireOperatorSigningKey(ctx context.Context, operatorID string) (*application.OperatorAuth, error) {
+	record, err := m.cfg.App.FindRecordById("nats_auth_operators", operatorID)
+	if err != nil {
+		return nil, err
+	}
+	if record.GetString("retiring_sign_public_key") == "" {
+		return nil, fmt.Errorf("no signing key is waiting to be retired")
+	}
+
+	accountRecords, err := m.cfg.App.FindAllRecords("nats_auth_accounts",
+		dbx.HashExp{
+			"operator": operatorID,
+		})
+	if err != nil {
+		return nil, err
+	}
+	if err := m.awaitAccountAcknowledgements(ctx, m.cfg.App, record, accountRecords); err != nil {
+		return nil, err
+	}
+
+	m.logger.InfoContext(ctx, "Retiring operator signing key...",
+		slog.String("operator_id", operatorID),
+		slog.String("public_key", record.GetString("retiring_sign_public_key")))
+
+	record.Set("retiring_sign_public_key", "")
+	if err := m.signOperatorRecord(ctx, m.cfg.App, record); err != nil {
+		return nil, err
+	}
+	if err := m.cfg.App.SaveWithContext(ctx, record); err != nil {
+		return nil, err
+	}
+	return m.GetOperatorFromRecord(record)
+}
+
+type accountUpdateResponse struct {
+	Server struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"server"`
+	Data *struct {
+		Code int `json:"code"`
+	} `json:"data"`
+	Error *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// awaitAccountAcknowledgements sends the accounts to all NATS servers of the operator
+// and returns an error unless every server accepted every account
+func (m *NATSAuthModule) awaitAccountAcknowledgements(ctx context.Context, dao core.App,
+	operatorRecord *core.Record, accountRecords []*core.Record) error {
+	if resolverMode(operatorRecord) == application.ResolverMemory {
+		// memory resolvers can not be asked, the re-signed accounts reach them with the next config reload
+		return m.markResolverConfigChanged(ctx, dao, operatorRecord)
+	}
+
+	nc, err := m.connectSysUser(ctx, dao, operatorRecord)
+	if err != nil {
+		return err
+	}
+
+	// find all servers of the installation
+	servers := map[string]string{}
+	err = requestAll(nc, "$SYS.REQ.SERVER.PING", nil, serverDiscoveryTimeout, func(msg *nats.Msg) bool {
+		var resp accountUpdateResponse
+		if err := json.Unmarshal(msg.Data, &resp); err == nil && resp.Server.ID != "" {
+			servers[resp.Server.ID] = resp.Server.Name
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		return fmt.Errorf("no NATS server answered")
+	}
+
+	for _, accountRecord := range accountRecords {
+		if accountRecord.GetString("jwt") == "" {
+			continue
+		}
+		acked := map[string]bool{}
+		var failures []string
+		err := requestAll(nc, "$SYS.REQ.CLAIMS.UPDATE", []byte(accountRecord.GetString("jwt")), accountAckTimeout, func(msg *nats.Msg) bool {
+			var resp accountUpdateResponse
+			if err := json.Unmarshal(msg.Data, &resp); err != nil {
+				return false
+			}
+			if resp.Error != nil {
+				failures = append(failures, fmt.Sprintf("%s: %s", resp.Server.Name, resp.Error.Description))
+				return false
+			}
+			acked[resp.Server.ID] = true
+			return len(acked) == len(servers)
+		})
+		if err != nil {
+			return err
+		}
+		if len(failures) > 0 {
+			return fmt.Errorf("account %s was rejected: %s", accountRecord.GetString("name"), strings.Join(failures, ", "))
+		}
+
+		var missing []string
+		for id, name := range servers {
+			if !acked[id] {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("account %s was not acknowledged by %s", accountRecord.GetString("name"), strings.Join(missing, ", "))
+		}
+
+		m.logger.InfoContext(ctx, "Account acknowledged by all servers",
+			slog.String("name", accountRecord.GetString("name")),
+			slog.Int("servers", len(servers)))
+	}
+	return nil
+}
+
+// requestAll sends a request and passes every response to handle until handle returns true or the timeout is reached
+func requestAll(nc *nats.Conn, subject string, data []byte, timeout time.Duration, handle func(*nats.Msg) bool) error {
+	inbox := nc.NewRespInbox()
+	sub, err := nc.SubscribeSync(inbox)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	if err := nc.PublishRequest(subject, inbox, data); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		msg, err := sub.NextMsg(time.Until(deadline))
+		if err == nats.ErrTimeout {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if handle(msg) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package natsauth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+)
+
+func Test_OperatorSigningKeyRotation(t *testing.T) {
+	const url = "nats://127.0.0.1:14231"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+
+	operator, err := natsModule.GetOperator(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to GetOperator: %v", err)
+	}
+	oldSigningKey := operator.SigningPublicKey
+
+	operator, err = natsModule.StartOperatorSigningKeyRotation(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to StartOperatorSigningKeyRotation: %v", err)
+	}
+	// the server is configured with the operator JWT trusting both keys
+	startTestServer(t, natsModule, url, 14231)
+
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+
+	operator, err = natsModule.CompleteOperatorSigningKeyRotation(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to CompleteOperatorSigningKeyRotation: %v", err)
+	}
+	if operator.SigningPublicKey == oldSigningKey || operator.NextSigningPublicKey != "" || operator.RetiringSigningPublicKey != "" {
+		t.Fatalf("Rotation did not complete: %+v", operator)
+	}
+
+	accountRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_accounts", account.ID)
+	if err != nil {
+		t.Fatalf("Failed to find account: %v", err)
+	}
+	claims, err := jwt.DecodeAccountClaims(accountRecord.GetString("jwt"))
+	if err != nil {
+		t.Fatalf("Failed to DecodeAccountClaims: %v", err)
+	}
+	if claims.Issuer != operator.SigningPublicKey {
+		t.Errorf("Account is signed by %s, want %s", claims.Issuer, operator.SigningPublicKey)
+	}
+
+	outboxRecord, err := natsModule.cfg.App.FindFirstRecordByData("nats_auth_outbox", "account", account.ID)
+	if err != nil {
+		t.Fatalf("Re-signed account was not queued: %v", err)
+	}
+	if outboxRecord.GetString("action") != string(accountPublishUpdate) {
+		t.Errorf("Queued action is %s", outboxRecord.GetString("action"))
+	}
+}
@@ -25,21 +25,39 @@ func (m *NATSAuthModule) getOperator(_ context.Context,
 		return nil, ErrNotFound
 	}
 
-	return GetOperatorFromRecord(operatorRecord[0])
+	return m.GetOperatorFromRecord(operatorRecord[0])
 }
 
-func GetOperatorFromRecord(record *core.Record) (*application.OperatorAuth, error) {
+func (m *NATSAuthModule) GetOperatorFromRecord(record *core.Record) (*application.OperatorAuth, error) {
+	secrets, err := m.keyRing.getSecrets(record, "private_key", "seed", "sign_private_key", "sign_seed", "tls_key")
+	if err != nil {
+		return nil, err
+	}
 	return &application.OperatorAuth{
 		ID:                record.Id,
 		URL:               record.GetString("url"),
 		Description:       record.GetString("description"),
 		PublicKey:         record.GetString("public_key"),
-		PrivateKey:        record.GetString("private_key"),
-		Seed:              record.GetString("seed"),
+		PrivateKey:        secrets["private_key"],
+		Seed:              secrets["seed"],
 		SigningPublicKey:  record.GetString("sign_public_key"),
-		SigningPrivateKey: record.GetString("sign_private_key"),
-		SigningSeed:       record.GetString("sign_seed"),
+		SigningPrivateKey: secrets["sign_private_key"],
+		SigningSeed:       secrets["sign_seed"],
 		JWT:               record.GetString("jwt"),
+
+		NextSigningPublicKey:     record.GetString("next_sign_public_key"),
+		RetiringSigningPublicKey: record.GetString("retiring_sign_public_key"),
+
+		Connection: application.OperatorConnection{
+			SeedURLs:          record.GetStringSlice("seed_urls"),
+			TLSCA:             record.GetString("tls_ca"),
+			TLSCert:           record.GetString("tls_cert"),
+			TLSKey:            secrets["tls_key"],
+			TLSHandshakeFirst: record.GetBool("tls_handshake_first"),
+		},
+		ResolverMode:         resolverMode(record),
+		ConfigPath:           record.GetString("config_path"),
+		ConfigReloadRequired: record.GetBool("config_reload_required"),
 	}, nil
 }
 
@@ -49,5 +67,45 @@ func (m *NATSAuthModule) GetOperatorByID(_ context.Context, id string) (*applica
 		return nil, err
 	}
 
-	return GetOperatorFromRecord(operatorRecord)
+	return m.GetOperatorFromRecord(operatorRecord)
+}
+
+// UpdateOperatorConnection sets the seed URLs and TLS settings of an operator.
+// An empty TLS key keeps the current key as long as a client certificate is set.
+func (m *NATSAuthModule) UpdateOperatorConnection(ctx context.Context, id string,
+	conn application.OperatorConnection) (*application.OperatorAuth, error) {
+	operatorRecord, err := m.cfg.App.FindRecordById("nats_auth_operators", id)
+	if err != nil {
+		return nil, err
+	}
+
+	if conn.TLSKey == "" && conn.TLSCert != "" {
+		conn.TLSKey, err = m.keyRing.getSecret(operatorRecord, "tls_key")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conn.TLSCert == "" {
+		conn.TLSKey = ""
+	}
+	for _, seedURL := range conn.SeedURLs {
+		if err := validateServerURL(seedURL); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tlsConfig(conn); err != nil {
+		return nil, err
+	}
+
+	operatorRecord.Set("seed_urls", nonNilStrings(conn.SeedURLs))
+	operatorRecord.Set("tls_ca", conn.TLSCA)
+	operatorRecord.Set("tls_cert", conn.TLSCert)
+	operatorRecord.Set("tls_handshake_first", conn.TLSHandshakeFirst)
+	if err := m.keyRing.setSecret(operatorRecord, "tls_key", conn.TLSKey); err != nil {
+		return nil, err
+	}
+	if err := m.cfg.App.SaveWithContext(ctx, operatorRecord); err != nil {
+		return nil, err
+	}
+	return m.GetOperatorFromRecord(operatorRecord)
 }
@@ -0,0 +1,381 @@
+package natsauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+type accountPublishAction string
+
+const (
+	// push the current JWT of the account
+	accountPublishUpdate accountPublishAction = "update"
+	// remove the account from the servers
+	accountPublishDelete accountPublishAction = "delete"
+)
+
+const (
+	// publications are given up after this many attempts
+	accountPublishMaxAttempts = 10
+	// the delay before a retry doubles with every attempt up to accountPublishMaxRetryDelay
+	accountPublishRetryDelay    = 5 * time.Second
+	accountPublishMaxRetryDelay = 10 * time.Minute
+	// pending publications are checked in this interval, new changes are published right away
+	accountPublishPollInterval = 5 * time.Second
+)
+
+// initNATSAuthOutboxCollection creates the outbox of the account changes to push to the servers.
+// It holds one record per account with the latest change, earlier changes are superseded by it.
+func initNATSAuthOutboxCollection(_ context.Context,
+	app core.App,
+	_ *slog.Logger,
+	operatorCollection *core.Collection) (*core.Collection, error) {
+
+	collection, err := app.FindCollectionByNameOrId("nats_auth_outbox")
+
+	if err == sql.ErrNoRows {
+		collection = core.NewBaseCollection("nats_auth_outbox")
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// the outbox is managed by NATS Tower, only admins may access the records directly
+	collection.ListRule = nil
+	collection.ViewRule = nil
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = nil
+	collection.Indexes = types.JSONArray[string]{
+		"create unique index nats_auth_outbox_account on nats_auth_outbox (account)",
+		"create index nats_auth_outbox_pending on nats_auth_outbox (status, next_attempt)",
+	}
+
+	addOrUpdateField(collection, &core.RelationField{
+		Name:          "operator",
+		Required:      true,
+		CollectionId:  operatorCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	// no relation, the record outlives the account until its removal is published
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "account",
+		Required: true,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name: "name",
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "public_key",
+		Required: true,
+	})
+	addOrUpdateField(collection, &core.SelectField{
+		Name:     "action",
+		Required: true,
+		Values: []string{
+			string(accountPublishUpdate),
+			string(accountPublishDelete),
+		},
+		MaxSelect: 1,
+	})
+	addOrUpdateField(collection, &core.SelectField{
+		Name:     "status",
+		Required: true,
+		Values: []string{
+			string(application.AccountPublishPublished),
+			string(application.AccountPublishPending),
+			string(application.AccountPublishFailed),
+		},
+		MaxSelect: 1,
+	})
+	// incremented with every queued change, so a publication does not overwrite a newer change
+	addOrUpdateField(collection, &core.NumberField{
+		Name:    "revision",
+		OnlyInt: true,
+	})
+	addOrUpdateField(collection, &core.NumberField{
+		Name:    "attempts",
+		OnlyInt: true,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name: "error",
+	})
+	addOrUpdateField(collection, &core.DateField{
+		Name: "next_attempt",
+	})
+	addOrUpdateField(collection, &core.AutodateField{
+		Name:     "created",
+		OnCreate: true,
+	})
+	addOrUpdateField(collection, &core.AutodateField{
+		Name:     "updated",
+		OnCreate: true,
+		OnUpdate: true,
+	})
+
+	if err := app.Save(collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func getAccountPublicationFromRecord(record *core.Record) *application.AccountPublication {
+	return &application.AccountPublication{
+		AccountID:   record.GetString("account"),
+		Status:      application.AccountPublishStatus(record.GetString("status")),
+		Attempts:    record.GetInt("attempts"),
+		Error:       record.GetString("error"),
+		NextAttempt: record.GetDateTime("next_attempt").Time(),
+		Updated:     record.GetDateTime("updated").Time(),
+	}
+}
+
+// GetAccountPublications returns the publication state of the accounts of an operator by account ID.
+// Accounts which were never published by the outbox are missing.
+func (m *NATSAuthModule) GetAccountPublications(_ context.Context, operatorID string) (map[string]*application.AccountPublication, error) {
+	records, err := m.cfg.App.FindAllRecords("nats_auth_outbox",
+		dbx.HashExp{
+			"operator": operatorID,
+			"action":   string(accountPublishUpdate),
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]*application.AccountPublication{}
+	for _, record := range records {
+		publication := getAccountPublicationFromRecord(record)
+		res[publication.AccountID] = publication
+	}
+	return res, nil
+}
+
+// RetryAccountPublish queues the current JWT of the account again with a new set of attempts
+func (m *NATSAuthModule) RetryAccountPublish(ctx context.Context, accountID string) error {
+	accountRecord, err := m.cfg.App.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		return err
+	}
+	return m.publishAccountChange(ctx, m.cfg.App, accountRecord, accountPublishUpdate)
+}
+
+// publishAccountChange queues the change of an account and tries to publish it right away.
+// Failed attempts are retried in the background. It must not run inside a transaction.
+func (m *NATSAuthModule) publishAccountChange(ctx context.Context, dao core.App,
+	accountRecord *core.Record, action accountPublishAction) error {
+	// the publisher picks the change up if this attempt does not finish in time
+	record, err := m.queueAccountPublish(ctx, dao, accountRecord, action, time.Now().Add(accountPublishRetryDelay))
+	if err != nil {
+		return err
+	}
+	return m.publishOutboxRecord(ctx, record)
+}
+
+// queueAccountPublish queues the change of an account for the servers of its operator.
+// It replaces a change of the account which was not published yet.
+func (m *NATSAuthModule) queueAccountPublish(ctx context.Context, dao core.App,
+	accountRecord *core.Record, action accountPublishAction, nextAttempt time.Time) (*core.Record, error) {
+	record, err := dao.FindFirstRecordByData("nats_auth_outbox", "account", accountRecord.Id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if record == nil {
+		collection, err := dao.FindCollectionByNameOrId("nats_auth_outbox")
+		if err != nil {
+			return nil, err
+		}
+		record = core.NewRecord(collection)
+		record.Set("account", accountRecord.Id)
+	}
+
+	record.Set("operator", accountRecord.GetString("operator"))
+	record.Set("name", accountRecord.GetString("name"))
+	record.Set("public_key", accountRecord.GetString("public_key"))
+	record.Set("action", string(action))
+	record.Set("status", string(application.AccountPublishPending))
+	record.Set("revision", record.GetInt("revision")+1)
+	record.Set("attempts", 0)
+	record.Set("error", "")
+	record.Set("next_attempt", nextAttempt)
+	if err := dao.SaveWithContext(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// bindOutboxHooks publishes queued changes which are due right away. The hooks run after
+// the change is committed, before that the publisher would not see it.
+func (m *NATSAuthModule) bindOutboxHooks() {
+	wake := func(e *core.RecordEvent) error {
+		if e.Record.GetString("status") == string(application.AccountPublishPending) &&
+			!e.Record.GetDateTime("next_attempt").Time().After(time.Now()) {
+			select {
+			case m.outboxWake <- struct{}{}:
+			default:
+			}
+		}
+		return e.Next()
+	}
+	m.cfg.App.OnRecordAfterCreateSuccess("nats_auth_outbox").BindFunc(wake)
+	m.cfg.App.OnRecordAfterUpdateSuccess("nats_auth_outbox").BindFunc(wake)
+}
+
+// runAccountPublisher publishes the pending account changes until the context is done
+func (m *NATSAuthModule) runAccountPublisher(ctx context.Context) {
+	ticker := time.NewTicker(accountPublishPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.outboxWake:
+		}
+		if err := m.publishPendingAccounts(ctx); err != nil {
+			m.logger.ErrorContext(ctx, "Could not publish pending accounts",
+				slog.String("error", err.Error()))
+		}
+	}
+}
+
+// publishPendingAccounts publishes the due account changes. The changes of each operator are published
+// in their own goroutine, an operator still busy with earlier changes is picked up again by the next poll.
+func (m *NATSAuthModule) publishPendingAccounts(ctx context.Context) error {
+	records, err := m.cfg.App.FindRecordsByFilter("nats_auth_outbox",
+		"status = {:status} && next_attempt <= {:now}",
+		"next_attempt",
+		0,
+		0,
+		dbx.Params{
+			"status": string(application.AccountPublishPending),
+			"now":    types.NowDateTime().String(),
+		})
+	if err != nil {
+		return err
+	}
+
+	var operatorIDs []string
+	byOperator := map[string][]*core.Record{}
+	for _, record := range records {
+		operatorID := record.GetString("operator")
+		if _, ok := byOperator[operatorID]; !ok {
+			operatorIDs = append(operatorIDs, operatorID)
+		}
+		byOperator[operatorID] = append(byOperator[operatorID], record)
+	}
+	for _, operatorID := range operatorIDs {
+		if _, busy := m.outboxPublishing.LoadOrStore(operatorID, struct{}{}); busy {
+			continue
+		}
+		go m.publishOperatorOutbox(ctx, operatorID, byOperator[operatorID])
+	}
+	return nil
+}
+
+// publishOperatorOutbox publishes the due account changes of an operator one after the other
+func (m *NATSAuthModule) publishOperatorOutbox(ctx context.Context, operatorID string, records []*core.Record) {
+	defer m.outboxPublishing.Delete(operatorID)
+	for _, record := range records {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := m.publishOutboxRecord(ctx, record); err != nil {
+			m.logger.ErrorContext(ctx, "Could not publish account change",
+				slog.String("operator_id", operatorID),
+				slog.String("error", err.Error()))
+			return
+		}
+	}
+}
+
+// publishOutboxRecord pushes a queued change to the servers and schedules a retry if it fails
+func (m *NATSAuthModule) publishOutboxRecord(ctx context.Context, record *core.Record) error {
+	logger := m.logger.With(slog.String("account_id", record.GetString("account")),
+		slog.String("name", record.GetString("name")),
+		slog.String("action", record.GetString("action")))
+
+	var publishErr error
+	accountDeleted := false
+	switch accountPublishAction(record.GetString("action")) {
+	case accountPublishUpdate:
+		accountRecord, err := m.cfg.App.FindRecordById("nats_auth_accounts", record.GetString("account"))
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// the account was deleted without queueing its removal, e.g. with its installation
+			accountDeleted = true
+		case err != nil:
+			return err
+		default:
+			publishErr = m.publishAccountRecord(ctx, m.cfg.App, accountRecord)
+		}
+	case accountPublishDelete:
+		operatorRecord, err := m.cfg.App.FindRecordById("nats_auth_operators", record.GetString("operator"))
+		if err != nil {
+			return err
+		}
+		publishErr = m.publishAccountRemoval(ctx, m.cfg.App, operatorRecord, record.GetString("public_key"))
+	}
+
+	return m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		current, err := txDao.FindRecordById("nats_auth_outbox", record.Id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if current.GetInt("revision") != record.GetInt("revision") ||
+			current.GetString("status") != string(application.AccountPublishPending) {
+			// a newer change was queued while publishing or the change was published concurrently
+			return nil
+		}
+
+		attempts := current.GetInt("attempts") + 1
+		current.Set("attempts", attempts)
+		current.Set("error", "")
+		switch {
+		case accountDeleted:
+			return txDao.DeleteWithContext(ctx, current)
+		case publishErr == nil && current.GetString("action") == string(accountPublishDelete):
+			logger.InfoContext(ctx, "Account removal published")
+			return txDao.DeleteWithContext(ctx, current)
+		case publishErr == nil:
+			current.Set("status", string(application.AccountPublishPublished))
+		case attempts >= accountPublishMaxAttempts:
+			logger.ErrorContext(ctx, "Account publication failed, giving up",
+				slog.Int("attempts", attempts),
+				slog.String("error", publishErr.Error()))
+			current.Set("status", string(application.AccountPublishFailed))
+			current.Set("error", publishErr.Error())
+		default:
+			delay := accountPublishRetryBackoff(attempts)
+			logger.WarnContext(ctx, "Account publication failed, retrying",
+				slog.Int("attempts", attempts),
+				slog.Duration("delay", delay),
+				slog.String("error", publishErr.Error()))
+			current.Set("error", publishErr.Error())
+			current.Set("next_attempt", time.Now().Add(delay))
+		}
+		return txDao.SaveWithContext(ctx, current)
+	})
+}
+
+// accountPublishRetryBackoff returns the delay before the next attempt after the failed attempts
+func accountPublishRetryBackoff(attempts int) time.Duration {
+	delay := accountPublishRetryDelay << (attempts - 1)
+	if delay > accountPublishMaxRetryDelay || delay <= 0 {
+		return accountPublishMaxRetryDelay
+	}
+	return delay
+}
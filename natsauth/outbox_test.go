@@ -0,0 +1,140 @@
+package natsauth
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func Test_accountPublishRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{3, 20 * time.Second},
+		{7, 320 * time.Second},
+		{8, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := accountPublishRetryBackoff(tt.attempts); got != tt.want {
+			t.Errorf("accountPublishRetryBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func getTestOutboxRecord(t *testing.T, natsModule *NATSAuthModule, accountID string) *core.Record {
+	record, err := natsModule.cfg.App.FindFirstRecordByData("nats_auth_outbox", "account", accountID)
+	if err != nil {
+		t.Fatalf("Failed to find outbox record: %v", err)
+	}
+	return record
+}
+
+func Test_OutboxRetry(t *testing.T) {
+	// nothing listens on the port, so every publication fails
+	const url = "nats://127.0.0.1:14246"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	record := getTestOutboxRecord(t, natsModule, account.ID)
+	if record.GetString("status") != string(application.AccountPublishPending) || record.GetInt("attempts") != 1 ||
+		record.GetString("error") == "" {
+		t.Fatalf("Failed publication is %v", record.FieldsData())
+	}
+	if delay := time.Until(record.GetDateTime("next_attempt").Time()); delay < 4*time.Second || delay > accountPublishRetryDelay {
+		t.Errorf("Next attempt is in %s, want %s", delay, accountPublishRetryDelay)
+	}
+
+	// an attempt of an older revision does not overwrite the newer change
+	accountRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_accounts", account.ID)
+	if err != nil {
+		t.Fatalf("Failed to find account: %v", err)
+	}
+	if _, err := natsModule.queueAccountPublish(ctx, natsModule.cfg.App, accountRecord, accountPublishUpdate, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to queueAccountPublish: %v", err)
+	}
+	if err := natsModule.publishOutboxRecord(ctx, record); err != nil {
+		t.Fatalf("Failed to publishOutboxRecord: %v", err)
+	}
+	queued := getTestOutboxRecord(t, natsModule, account.ID)
+	if queued.GetInt("revision") != record.GetInt("revision")+1 || queued.GetInt("attempts") != 0 ||
+		queued.GetString("error") != "" {
+		t.Errorf("Attempt of an older revision changed the queued change: %v", queued.FieldsData())
+	}
+
+	// the last attempt gives up
+	queued.Set("attempts", accountPublishMaxAttempts-1)
+	if err := natsModule.cfg.App.Save(queued); err != nil {
+		t.Fatalf("Failed to save outbox record: %v", err)
+	}
+	if err := natsModule.publishOutboxRecord(ctx, queued); err != nil {
+		t.Fatalf("Failed to publishOutboxRecord: %v", err)
+	}
+	failed := getTestOutboxRecord(t, natsModule, account.ID)
+	if failed.GetString("status") != string(application.AccountPublishFailed) || failed.GetInt("attempts") != accountPublishMaxAttempts {
+		t.Errorf("Last attempt is %v", failed.FieldsData())
+	}
+}
+
+func Test_OutboxPublishesOperatorsIndependently(t *testing.T) {
+	// accepts connections but never sends the INFO of a server, so publications hang until they time out
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+
+	hangingURL := "nats://" + ln.Addr().String()
+	const url = "nats://127.0.0.1:14247"
+	ctx := context.Background()
+	natsModule := newTestModule(t, hangingURL, url)
+
+	hanging, err := natsModule.UpsertAccountAuth(ctx, hangingURL, "H", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	// the server is started after the first attempt failed
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	startTestServer(t, natsModule, url, 14247)
+
+	// both changes are due, the one of the hanging operator first
+	for i, accountID := range []string{hanging.ID, account.ID} {
+		record := getTestOutboxRecord(t, natsModule, accountID)
+		record.Set("next_attempt", time.Now().Add(time.Duration(i-10)*time.Second))
+		if err := natsModule.cfg.App.Save(record); err != nil {
+			t.Fatalf("Failed to save outbox record: %v", err)
+		}
+	}
+
+	start := time.Now()
+	waitForPublication(t, natsModule, account.ID)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Publication waited %s for the hanging operator", elapsed)
+	}
+	if status := getTestOutboxRecord(t, natsModule, hanging.ID).GetString("status"); status != string(application.AccountPublishPending) {
+		t.Errorf("Publication of the hanging operator is %s", status)
+	}
+}
@@ -0,0 +1,129 @@
+package natsauth
+
+import (
+	"context"
+	"time"
+
+	jwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func GetPermissionsFromRecord(record *core.Record) *application.UserPermissions {
+	return &application.UserPermissions{
+		ID:             record.Id,
+		UserID:         record.GetString("user"),
+		PubAllow:       record.GetStringSlice("pub_allow"),
+		PubDeny:        record.GetStringSlice("pub_deny"),
+		SubAllow:       record.GetStringSlice("sub_allow"),
+		SubDeny:        record.GetStringSlice("sub_deny"),
+		AllowResponses: record.GetBool("allow_responses"),
+		ResponsesMax:   record.GetInt("responses_max"),
+		ResponsesTTL:   time.Duration(record.GetInt("responses_ttl")) * time.Millisecond,
+	}
+}
+
+func (m *NATSAuthModule) GetUserPermissions(ctx context.Context, userID string) (*application.UserPermissions, error) {
+	return m.getUserPermissionsByUserID(ctx, m.cfg.App, userID)
+}
+
+func (m *NATSAuthModule) getUserPermissionsByUserID(_ context.Context, dao core.App, userID string) (*application.UserPermissions, error) {
+	permissionRecords, err := dao.FindAllRecords("nats_auth_permissions",
+		dbx.HashExp{
+			"user": userID,
+		})
+	if err != nil {
+		return nil, err
+	}
+	if len(permissionRecords) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return GetPermissionsFromRecord(permissionRecords[0]), nil
+}
+
+// UpsertUserPermissions stores the permissions of a user.
+// Saving the record re-signs the user JWT through the record hooks.
+func (m *NATSAuthModule) UpsertUserPermissions(ctx context.Context,
+	userID string, perms application.UserPermissions) (*application.UserPermissions, error) {
+	var res *application.UserPermissions
+	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		permissionRecords, err := txDao.FindAllRecords("nats_auth_permissions",
+			dbx.HashExp{
+				"user": userID,
+			})
+		if err != nil {
+			return err
+		}
+
+		var record *core.Record
+		if len(permissionRecords) == 0 {
+			record = core.NewRecord(m.NATSPermissionCollection)
+			record.Set("user", userID)
+		} else {
+			record = permissionRecords[0]
+		}
+
+		record.Set("pub_allow", nonNilStrings(perms.PubAllow))
+		record.Set("pub_deny", nonNilStrings(perms.PubDeny))
+		record.Set("sub_allow", nonNilStrings(perms.SubAllow))
+		record.Set("sub_deny", nonNilStrings(perms.SubDeny))
+		record.Set("allow_responses", perms.AllowResponses)
+		record.Set("responses_max", perms.ResponsesMax)
+		record.Set("responses_ttl", perms.ResponsesTTL.Milliseconds())
+
+		if err := txDao.SaveWithContext(ctx, record); err != nil {
+			return err
+		}
+
+		res = GetPermissionsFromRecord(record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// getUserPermissions transforms the permissions stored for a user into jwt.Permissions.
+// Users without a permission record get the default (allow all) permissions.
+func (m *NATSAuthModule) getUserPermissions(ctx context.Context, dao core.App, userRec *core.Record) (*jwt.Permissions, error) {
+	perms, err := m.getUserPermissionsByUserID(ctx, dao, userRec.Id)
+	if err == ErrNotFound {
+		return &jwt.Permissions{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return toJWTPermissions(perms), nil
+}
+
+func toJWTPermissions(perms *application.UserPermissions) *jwt.Permissions {
+	res := &jwt.Permissions{
+		Pub: jwt.Permission{
+			Allow: perms.PubAllow,
+			Deny:  perms.PubDeny,
+		},
+		Sub: jwt.Permission{
+			Allow: perms.SubAllow,
+			Deny:  perms.SubDeny,
+		},
+	}
+	if perms.AllowResponses {
+		res.Resp = &jwt.ResponsePermission{
+			MaxMsgs: perms.ResponsesMax,
+			Expires: perms.ResponsesTTL,
+		}
+	}
+	return res
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
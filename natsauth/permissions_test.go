@@ -0,0 +1,102 @@
+package natsauth
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-tower/nats-tower/application"
+)
+
+func Test_UserPermissions(t *testing.T) {
+	const url = "nats://127.0.0.1:14254"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+	ns := startTestServer(t, natsModule, url, 14254)
+
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	user, err := natsModule.UpsertUserAuth(ctx, url, "A", "service", "", application.UserOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertUserAuth: %v", err)
+	}
+	waitForPublication(t, natsModule, account.ID)
+
+	perms := application.UserPermissions{
+		PubAllow:       []string{"team.>"},
+		PubDeny:        []string{"team.secret"},
+		SubAllow:       []string{"team.>", "_INBOX.>"},
+		SubDeny:        []string{},
+		AllowResponses: true,
+		ResponsesMax:   1,
+		ResponsesTTL:   time.Minute,
+	}
+	stored, err := natsModule.UpsertUserPermissions(ctx, user.ID, perms)
+	if err != nil {
+		t.Fatalf("Failed to UpsertUserPermissions: %v", err)
+	}
+	perms.ID = stored.ID
+	perms.UserID = user.ID
+	got, err := natsModule.GetUserPermissions(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to GetUserPermissions: %v", err)
+	}
+	if !reflect.DeepEqual(*got, perms) {
+		t.Errorf("Stored permissions are %+v, want %+v", *got, perms)
+	}
+
+	// saving the permissions re-signs the user and its creds
+	resigned := getTestUser(t, natsModule, user.ID)
+	if resigned.JWT == user.JWT || !strings.Contains(resigned.Creds, resigned.JWT) {
+		t.Fatalf("User JWT and creds were not renewed")
+	}
+	claims, err := jwt.DecodeUserClaims(resigned.JWT)
+	if err != nil {
+		t.Fatalf("Failed to DecodeUserClaims: %v", err)
+	}
+	if !claims.Pub.Allow.Contains("team.>") || !claims.Pub.Deny.Contains("team.secret") || len(claims.Sub.Allow) != 2 {
+		t.Errorf("User JWT has the permissions %+v", claims.Permissions)
+	}
+	if claims.Resp == nil || claims.Resp.MaxMsgs != 1 || claims.Resp.Expires != time.Minute {
+		t.Errorf("User JWT has the response permission %+v", claims.Resp)
+	}
+
+	// the server enforces the permissions
+	violations := make(chan error, 10)
+	nc, err := nats.Connect(ns.ClientURL(), nats.UserJWTAndSeed(resigned.JWT, resigned.Seed),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			violations <- err
+		}))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(nc.Close)
+	if err := nc.Publish("team.orders", nil); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	if err := nc.Publish("team.secret", nil); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	select {
+	case err := <-violations:
+		if !strings.Contains(err.Error(), "team.secret") {
+			t.Errorf("Publish error is %v, want a violation for team.secret", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Publishing to a denied subject succeeded")
+	}
+	select {
+	case err := <-violations:
+		t.Errorf("Unexpected error %v", err)
+	default:
+	}
+}
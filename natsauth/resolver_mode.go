@@ -0,0 +1,180 @@
+package natsauth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+// resolverMode returns the resolver mode of an operator, full if it is not set
+func resolverMode(operatorRecord *core.Record) application.ResolverType {
+	if operatorRecord.GetString("resolver_mode") == string(application.ResolverMemory) {
+		return application.ResolverMemory
+	}
+	return application.ResolverFull
+}
+
+// GetResolverPreload returns the resolver_preload block with all accounts of an operator
+func (m *NATSAuthModule) GetResolverPreload(_ context.Context, operatorID string) (string, error) {
+	return resolverPreloadOfOperator(m.cfg.App, operatorID)
+}
+
+func resolverPreloadOfOperator(dao core.App, operatorID string) (string, error) {
+	accountRecords, err := dao.FindRecordsByFilter("nats_auth_accounts",
+		"operator = {:operator}", "name", 0, 0,
+		dbx.Params{"operator": operatorID})
+	if err != nil {
+		return "", err
+	}
+	return resolverPreload(accountRecords), nil
+}
+
+// UpdateOperatorResolver sets the resolver mode of an operator and the file the preload is written to.
+// Switching to memory writes the preload right away, switching to full pushes all accounts to the servers.
+func (m *NATSAuthModule) UpdateOperatorResolver(ctx context.Context, id string,
+	mode application.ResolverType, configPath string) (*application.OperatorAuth, error) {
+	switch mode {
+	case application.ResolverFull, application.ResolverMemory:
+	default:
+		return nil, fmt.Errorf("unknown resolver mode %q", mode)
+	}
+	if configPath != "" {
+		if _, err := m.resolveConfigPath(configPath); err != nil {
+			return nil, err
+		}
+		configPath = filepath.Clean(configPath)
+	}
+
+	operatorRecord, err := m.cfg.App.FindRecordById("nats_auth_operators", id)
+	if err != nil {
+		return nil, err
+	}
+	previous := resolverMode(operatorRecord)
+
+	operatorRecord.Set("resolver_mode", string(mode))
+	operatorRecord.Set("config_path", configPath)
+	if mode == application.ResolverFull {
+		operatorRecord.Set("config_reload_required", false)
+	}
+	if err := m.cfg.App.SaveWithContext(ctx, operatorRecord); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case mode == application.ResolverMemory:
+		if err := m.markResolverConfigChanged(ctx, m.cfg.App, operatorRecord); err != nil {
+			return nil, err
+		}
+	case previous == application.ResolverMemory:
+		// the changes since switching to memory were never pushed
+		if err := m.RepushAccounts(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return m.GetOperatorFromRecord(operatorRecord)
+}
+
+// ConfirmResolverConfigReload clears the flag of an operator that the servers need a config reload.
+// The servers trust the rotated account signing keys now, so the rotations are completed,
+// which needs another reload to remove the old keys.
+func (m *NATSAuthModule) ConfirmResolverConfigReload(ctx context.Context, operatorID string) error {
+	operatorRecord, err := m.cfg.App.FindRecordById("nats_auth_operators", operatorID)
+	if err != nil {
+		return err
+	}
+	operatorRecord.Set("config_reload_required", false)
+	if err := m.cfg.App.SaveWithContext(ctx, operatorRecord); err != nil {
+		return err
+	}
+	return m.completeAccountSigningKeyRotations(ctx, operatorID)
+}
+
+// markResolverConfigChanged flags that the servers of an operator in memory mode need a config reload
+// and writes the new preload to the config path of the operator
+func (m *NATSAuthModule) markResolverConfigChanged(ctx context.Context, dao core.App, operatorRecord *core.Record) error {
+	logger := m.logger.With(slog.String("operator_id", operatorRecord.Id),
+		slog.String("operator_url", operatorRecord.GetString("url")))
+
+	if configPath := operatorRecord.GetString("config_path"); configPath != "" {
+		// resolved again, the directory or the links within it may have changed since the path was saved
+		configPath, err := m.resolveConfigPath(configPath)
+		if err != nil {
+			logger.ErrorContext(ctx, "Could not write resolver preload", slog.String("error", err.Error()))
+			return err
+		}
+		preload, err := resolverPreloadOfOperator(dao, operatorRecord.Id)
+		if err != nil {
+			return err
+		}
+		content := fmt.Sprintf("# generated by NATS Tower at %s, include it in the server config and reload the servers\n%s",
+			time.Now().UTC().Format(time.RFC3339), preload)
+		// written next to the file and renamed, so a reload never reads a partial file
+		tmpPath := configPath + ".tmp"
+		if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+			logger.ErrorContext(ctx, "Could not write resolver preload",
+				slog.String("path", configPath),
+				slog.String("error", err.Error()))
+			return err
+		}
+		if err := os.Rename(tmpPath, configPath); err != nil {
+			return err
+		}
+		logger.InfoContext(ctx, "Resolver preload written", slog.String("path", configPath))
+	}
+
+	if operatorRecord.GetBool("config_reload_required") {
+		return nil
+	}
+	logger.InfoContext(ctx, "Accounts changed, the servers need a config reload")
+	operatorRecord.Set("config_reload_required", true)
+	// an internal flag, not a change of the installation for the audit log
+	return dao.UnsafeWithoutHooks().SaveWithContext(ctx, operatorRecord)
+}
+
+// resolveConfigPath returns the file a config path refers to. Relative paths are relative to the
+// resolver config directory, and the file must be within it after following all links.
+func (m *NATSAuthModule) resolveConfigPath(configPath string) (string, error) {
+	if m.cfg.ResolverConfigDir == "" {
+		return "", fmt.Errorf("writing the resolver preload is disabled, RESOLVER_CONFIG_DIR is not set")
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Clean(m.cfg.ResolverConfigDir))
+	if err != nil {
+		return "", fmt.Errorf("invalid RESOLVER_CONFIG_DIR: %w", err)
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	configPath = filepath.Clean(configPath)
+	if !filepath.IsAbs(configPath) {
+		configPath = filepath.Join(m.cfg.ResolverConfigDir, configPath)
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(configPath))
+	if err != nil {
+		return "", fmt.Errorf("invalid config path %q: %w", configPath, err)
+	}
+	parent, err = filepath.Abs(parent)
+	if err != nil {
+		return "", err
+	}
+	resolved := filepath.Join(parent, filepath.Base(configPath))
+
+	rel, err := filepath.Rel(dir, resolved)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("config path %q is not within %s", configPath, m.cfg.ResolverConfigDir)
+	}
+	if info, err := os.Lstat(resolved); err == nil && !info.Mode().IsRegular() {
+		return "", fmt.Errorf("config path %q is not a regular file", configPath)
+	}
+	return resolved, nil
+}
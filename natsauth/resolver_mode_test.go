@@ -0,0 +1,151 @@
+package natsauth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+func Test_resolveConfigPath(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "nats"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "target.conf"), filepath.Join(dir, "link.conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	natsModule := &NATSAuthModule{cfg: NATSAuthModuleConfig{ResolverConfigDir: dir}}
+	tests := []struct {
+		name       string
+		configPath string
+		want       string
+	}{
+		{"relative file", "preload.conf", filepath.Join(dir, "preload.conf")},
+		{"file in a sub directory", "nats/preload.conf", filepath.Join(dir, "nats", "preload.conf")},
+		{"absolute path within the directory", filepath.Join(dir, "preload.conf"), filepath.Join(dir, "preload.conf")},
+		{"path leaving the directory", "../preload.conf", ""},
+		{"path leaving the directory and coming back", "nats/../../" + filepath.Base(dir) + "/preload.conf", filepath.Join(dir, "preload.conf")},
+		{"absolute path outside of the directory", filepath.Join(outside, "preload.conf"), ""},
+		{"binary of the server", "/usr/bin/nats-tower", ""},
+		{"directory itself", dir, ""},
+		{"link to a directory outside", "escape/preload.conf", ""},
+		{"link to a file outside", "link.conf", ""},
+		{"missing directory", "missing/preload.conf", ""},
+		{"sub directory", "nats", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := natsModule.resolveConfigPath(tt.configPath)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("resolveConfigPath(%q) = %q, want an error", tt.configPath, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveConfigPath(%q) error = %v", tt.configPath, err)
+			}
+			want, _ := filepath.EvalSymlinks(filepath.Dir(tt.want))
+			if got != filepath.Join(want, filepath.Base(tt.want)) {
+				t.Errorf("resolveConfigPath(%q) = %q, want %q", tt.configPath, got, tt.want)
+			}
+		})
+	}
+
+	disabled := &NATSAuthModule{}
+	if _, err := disabled.resolveConfigPath("preload.conf"); err == nil {
+		t.Errorf("Config path was accepted without RESOLVER_CONFIG_DIR")
+	}
+}
+
+func Test_MemoryResolver(t *testing.T) {
+	// no server is listening, every push would fail
+	const url = "nats://127.0.0.1:14233"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+	dir := t.TempDir()
+	natsModule.cfg.ResolverConfigDir = dir
+
+	operator, err := natsModule.GetOperator(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to GetOperator: %v", err)
+	}
+	if _, err := natsModule.UpdateOperatorResolver(ctx, operator.ID, application.ResolverMemory, "/etc/nats/preload.conf"); err == nil {
+		t.Fatalf("Config path outside of RESOLVER_CONFIG_DIR was accepted")
+	}
+	operator, err = natsModule.UpdateOperatorResolver(ctx, operator.ID, application.ResolverMemory, "preload.conf")
+	if err != nil {
+		t.Fatalf("Failed to UpdateOperatorResolver: %v", err)
+	}
+	if operator.ResolverMode != application.ResolverMemory {
+		t.Fatalf("Resolver mode is %s", operator.ResolverMode)
+	}
+	if err := natsModule.ConfirmResolverConfigReload(ctx, operator.ID); err != nil {
+		t.Fatalf("Failed to ConfirmResolverConfigReload: %v", err)
+	}
+
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+
+	// the outbox succeeds without connecting to the servers
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		publications, err := natsModule.GetAccountPublications(ctx, operator.ID)
+		if err != nil {
+			t.Fatalf("Failed to GetAccountPublications: %v", err)
+		}
+		if publication, ok := publications[account.ID]; ok && publication.Status == application.AccountPublishPublished {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Account was not published: %+v", publications[account.ID])
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if health := natsModule.GetSysConnHealth(ctx, operator.ID); health != nil {
+		t.Errorf("Memory resolver connected to the servers: %+v", health)
+	}
+
+	operator, err = natsModule.GetOperatorByID(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to GetOperatorByID: %v", err)
+	}
+	if !operator.ConfigReloadRequired {
+		t.Errorf("New account did not require a config reload")
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "preload.conf"))
+	if err != nil {
+		t.Fatalf("Resolver preload was not written: %v", err)
+	}
+	preload, err := natsModule.GetResolverPreload(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to GetResolverPreload: %v", err)
+	}
+	if !strings.HasSuffix(string(content), preload) || !strings.Contains(preload, account.PublicKey+": "+account.JWT) {
+		t.Errorf("Resolver preload does not contain the account:\n%s", content)
+	}
+
+	if err := natsModule.ConfirmResolverConfigReload(ctx, operator.ID); err != nil {
+		t.Fatalf("Failed to ConfirmResolverConfigReload: %v", err)
+	}
+	operator, err = natsModule.GetOperatorByID(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to GetOperatorByID: %v", err)
+	}
+	if operator.ConfigReloadRequired {
+		t.Errorf("Config reload is still required after the confirmation")
+	}
+}
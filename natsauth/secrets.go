@@ -0,0 +1,303 @@
+package natsauth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/nats-io/nkeys"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// encryptedPrefix marks values that are encrypted with a master key of the key ring
+const encryptedPrefix = "enc:v1:"
+
+// secretFields are the fields of each collection that hold seeds, private keys or other secrets.
+// The creds of users contain the user seed as well.
+var secretFields = map[string][]string{
+	"nats_auth_operators": {"private_key", "seed", "sign_private_key", "sign_seed",
+		"next_sign_private_key", "next_sign_seed", "tls_key"},
+	"nats_auth_accounts":             {"private_key", "seed", "sign_private_key", "sign_seed"},
+	"nats_auth_account_signing_keys": {"private_key", "seed"},
+	"nats_auth_users":                {"private_key", "seed", "creds"},
+	"webhooks":                       {"secret"},
+}
+
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// KeyRing holds the master keys used to encrypt seeds and private keys at rest.
+// Every value is encrypted with its own data key, which is wrapped with the first master key.
+// Secret fields are bound to their collection, record and field, so a value copied
+// into another record or field can not be decrypted.
+// The other master keys are only used to decrypt values written before a key rotation.
+// A nil key ring stores the secrets in plaintext.
+type KeyRing struct {
+	keys []masterKey
+}
+
+// NewKeyRing creates a key ring from 32 byte master keys, the first key is used for encryption
+func NewKeyRing(keys ...[]byte) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one master key is required")
+	}
+	res := &KeyRing{}
+	for _, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("master keys must be 32 bytes long, got %d bytes", len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(key)
+		res.keys = append(res.keys, masterKey{
+			id:   hex.EncodeToString(sum[:4]),
+			aead: aead,
+		})
+	}
+	return res, nil
+}
+
+// ParseKeyRing creates a key ring from base64 encoded master keys separated by commas or newlines.
+// An empty string results in a nil key ring.
+func ParseKeyRing(s string) (*KeyRing, error) {
+	var keys [][]byte
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		field = strings.TrimSpace(field)
+		if field == "" || strings.HasPrefix(field, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(field)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode master key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return NewKeyRing(keys...)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+func open(aead cipher.AEAD, ciphertext, associatedData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, associatedData)
+}
+
+// secretAssociatedData binds the value of a secret field to its collection, record and field
+func secretAssociatedData(record *core.Record, field string) []byte {
+	return []byte(record.TableName() + "\x00" + record.Id + "\x00" + field)
+}
+
+// Encrypt encrypts the value with a new data key and the current master key.
+// The associated data is authenticated, the value can only be decrypted with the same associated data.
+func (r *KeyRing) Encrypt(value string, associatedData []byte) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dataAEAD, []byte(value), associatedData)
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := seal(r.keys[0].aead, dataKey, associatedData)
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + r.keys[0].id + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt decrypts a value created by Encrypt with any master key of the key ring
+func (r *KeyRing) Decrypt(value string, associatedData []byte) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	for _, key := range r.keys {
+		if key.id != parts[0] {
+			continue
+		}
+		wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return "", err
+		}
+		ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return "", err
+		}
+		dataKey, err := open(key.aead, wrappedKey, associatedData)
+		if err != nil {
+			return "", fmt.Errorf("could not unwrap data key: %w", err)
+		}
+		dataAEAD, err := newAEAD(dataKey)
+		if err != nil {
+			return "", err
+		}
+		plaintext, err := open(dataAEAD, ciphertext, associatedData)
+		if err != nil {
+			return "", fmt.Errorf("could not decrypt value: %w", err)
+		}
+		return string(plaintext), nil
+	}
+	return "", fmt.Errorf("value is encrypted with unknown master key %s", parts[0])
+}
+
+// isCurrent reports whether the value is encrypted with the current master key
+func (r *KeyRing) isCurrent(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix+r.keys[0].id+":")
+}
+
+// getSecret returns the plaintext of a secret field. Values written before
+// encryption was enabled are returned as they are.
+func (r *KeyRing) getSecret(record *core.Record, field string) (string, error) {
+	value := record.GetString(field)
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	if r == nil {
+		return "", fmt.Errorf("field %s of %s is encrypted, but no master key is configured", field, record.TableName())
+	}
+	res, err := r.Decrypt(value, secretAssociatedData(record, field))
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt field %s of %s: %w", field, record.TableName(), err)
+	}
+	return res, nil
+}
+
+// getSecrets returns the plaintext of several secret fields by field name
+func (r *KeyRing) getSecrets(record *core.Record, fields ...string) (map[string]string, error) {
+	res := make(map[string]string, len(fields))
+	for _, field := range fields {
+		value, err := r.getSecret(record, field)
+		if err != nil {
+			return nil, err
+		}
+		res[field] = value
+	}
+	return res, nil
+}
+
+// keyPairFromSecret returns the key pair of a seed stored in a secret field
+func (r *KeyRing) keyPairFromSecret(record *core.Record, field string) (nkeys.KeyPair, error) {
+	seed, err := r.getSecret(record, field)
+	if err != nil {
+		return nil, err
+	}
+	return nkeys.FromSeed([]byte(seed))
+}
+
+// setSecret stores the value of a secret field encrypted if a master key is configured.
+// New records get their ID here, as it is part of the associated data.
+func (r *KeyRing) setSecret(record *core.Record, field, value string) error {
+	if r == nil || value == "" {
+		record.Set(field, value)
+		return nil
+	}
+	if record.Id == "" {
+		record.Id = core.GenerateDefaultRandomId()
+	}
+	encrypted, err := r.Encrypt(value, secretAssociatedData(record, field))
+	if err != nil {
+		return err
+	}
+	record.Set(field, encrypted)
+	return nil
+}
+
+// setSecrets stores several secret fields by field name, see setSecret
+func (r *KeyRing) setSecrets(record *core.Record, secrets map[string]string) error {
+	for field, value := range secrets {
+		if err := r.setSecret(record, field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncryptSecrets encrypts all seeds and private keys of the app that are still stored in plaintext
+// or with an old master key of the key ring. It returns the number of updated records.
+// It only needs the app, so it runs without the hooks and background jobs of the module.
+func EncryptSecrets(ctx context.Context, logger *slog.Logger, app core.App, keyRing *KeyRing) (int, error) {
+	if keyRing == nil {
+		return 0, fmt.Errorf("no master key configured")
+	}
+
+	updated := 0
+	err := app.RunInTransaction(func(txDao core.App) error {
+		for collection, fields := range secretFields {
+			records, err := txDao.FindAllRecords(collection)
+			if err != nil {
+				return err
+			}
+			for _, record := range records {
+				changed := false
+				for _, field := range fields {
+					value := record.GetString(field)
+					if value == "" || keyRing.isCurrent(value) {
+						continue
+					}
+					plaintext, err := keyRing.getSecret(record, field)
+					if err != nil {
+						return err
+					}
+					if err := keyRing.setSecret(record, field, plaintext); err != nil {
+						return err
+					}
+					changed = true
+				}
+				if !changed {
+					continue
+				}
+				// the plaintext does not change, so nothing needs to be re-signed or published
+				if err := txDao.UnsafeWithoutHooks().Save(record); err != nil {
+					return err
+				}
+				updated++
+			}
+			logger.InfoContext(ctx, "Encrypted secrets of collection",
+				slog.String("collection", collection))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
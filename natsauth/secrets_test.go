@@ -0,0 +1,213 @@
+package natsauth
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func Test_KeyRing(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	oldRing, err := NewKeyRing(oldKey)
+	if err != nil {
+		t.Fatalf("Failed to NewKeyRing: %v", err)
+	}
+	rotatedRing, err := NewKeyRing(newKey, oldKey)
+	if err != nil {
+		t.Fatalf("Failed to NewKeyRing: %v", err)
+	}
+	if _, err := NewKeyRing(bytes.Repeat([]byte{1}, 16)); err == nil {
+		t.Errorf("Short master key was accepted")
+	}
+
+	collection := core.NewBaseCollection("nats_auth_users")
+	collection.Fields.Add(&core.TextField{Name: "seed"}, &core.TextField{Name: "private_key"})
+
+	const seed = "SUAIBDPBAUTWCWBKIO6XHQNINK5FWJW4OHLXC3HQ2KFE4PEJUA44CNHTC4"
+	record := core.NewRecord(collection)
+	if err := oldRing.setSecret(record, "seed", seed); err != nil {
+		t.Fatalf("Failed to setSecret: %v", err)
+	}
+	encrypted := record.GetString("seed")
+	if !strings.HasPrefix(encrypted, encryptedPrefix) || strings.Contains(encrypted, seed) {
+		t.Fatalf("Seed was not encrypted: %s", encrypted)
+	}
+
+	tests := []struct {
+		name    string
+		keyRing *KeyRing
+		value   string
+		want    string
+	}{
+		{"round trip", oldRing, encrypted, seed},
+		{"old master key after a rotation", rotatedRing, encrypted, seed},
+		{"legacy plaintext", oldRing, seed, seed},
+		{"legacy plaintext without a key ring", nil, seed, seed},
+		{"encrypted value without a key ring", nil, encrypted, ""},
+		{"unknown master key", func() *KeyRing { r, _ := NewKeyRing(newKey); return r }(), encrypted, ""},
+		{"tampered value", oldRing, encrypted[:len(encrypted)-2] + "AA", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record.Set("seed", tt.value)
+			got, err := tt.keyRing.getSecret(record, "seed")
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("getSecret() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getSecret() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("getSecret() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// encrypted values are bound to their record and field
+	otherRecord := core.NewRecord(collection)
+	otherRecord.Id = "other"
+	otherRecord.Set("seed", encrypted)
+	if got, err := oldRing.getSecret(otherRecord, "seed"); err == nil {
+		t.Errorf("Value moved to another record was decrypted: %q", got)
+	}
+	record.Set("private_key", encrypted)
+	if got, err := oldRing.getSecret(record, "private_key"); err == nil {
+		t.Errorf("Value moved to another field was decrypted: %q", got)
+	}
+
+	if !oldRing.isCurrent(encrypted) || rotatedRing.isCurrent(encrypted) {
+		t.Errorf("isCurrent() does not match the first master key")
+	}
+
+	var plaintextRing *KeyRing
+	if err := plaintextRing.setSecret(record, "seed", seed); err != nil || record.GetString("seed") != seed {
+		t.Errorf("Nil key ring did not store the plaintext: %s, %v", record.GetString("seed"), err)
+	}
+}
+
+func Test_EncryptSecrets(t *testing.T) {
+	ctx := context.Background()
+	natsModule := newTestModule(t, "nats://127.0.0.1:14234")
+	app := natsModule.cfg.App
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	operators, err := app.FindAllRecords("nats_auth_operators")
+	if err != nil || len(operators) != 1 {
+		t.Fatalf("Failed to find the operator: %v", err)
+	}
+	seed := operators[0].GetString("seed")
+	if seed == "" || strings.HasPrefix(seed, encryptedPrefix) {
+		t.Fatalf("Operator seed is not stored in plaintext: %s", seed)
+	}
+
+	keyRing, err := NewKeyRing(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("Failed to NewKeyRing: %v", err)
+	}
+	if _, err := EncryptSecrets(ctx, logger, app, nil); err == nil {
+		t.Errorf("EncryptSecrets without a key ring succeeded")
+	}
+	updated, err := EncryptSecrets(ctx, logger, app, keyRing)
+	if err != nil {
+		t.Fatalf("Failed to EncryptSecrets: %v", err)
+	}
+	if updated == 0 {
+		t.Fatalf("No records were encrypted")
+	}
+
+	operator, err := app.FindRecordById("nats_auth_operators", operators[0].Id)
+	if err != nil {
+		t.Fatalf("Failed to find the operator: %v", err)
+	}
+	if !keyRing.isCurrent(operator.GetString("seed")) {
+		t.Errorf("Operator seed was not encrypted: %s", operator.GetString("seed"))
+	}
+	got, err := keyRing.getSecret(operator, "seed")
+	if err != nil || got != seed {
+		t.Errorf("getSecret() = %q, %v, want the original seed", got, err)
+	}
+
+	// a second run has nothing left to encrypt
+	updated, err = EncryptSecrets(ctx, logger, app, keyRing)
+	if err != nil || updated != 0 {
+		t.Errorf("EncryptSecrets() = %d, %v, want no updates", updated, err)
+	}
+}
+
+func Test_RotateSigningKeysEncrypted(t *testing.T) {
+	// no server is needed, the installation is in memory mode
+	const url = "nats://127.0.0.1:14249"
+	ctx := context.Background()
+	keyRing, err := NewKeyRing(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("Failed to NewKeyRing: %v", err)
+	}
+	natsModule := newTestModuleWithConfig(t, NATSAuthModuleConfig{
+		BootstrapURLs: []string{url},
+		KeyRing:       keyRing,
+	})
+
+	operator, err := natsModule.GetOperator(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to GetOperator: %v", err)
+	}
+	if _, err := natsModule.UpdateOperatorResolver(ctx, operator.ID, application.ResolverMemory, ""); err != nil {
+		t.Fatalf("Failed to UpdateOperatorResolver: %v", err)
+	}
+
+	// the next operator signing key is encrypted again when it becomes the signing key
+	if _, err := natsModule.StartOperatorSigningKeyRotation(ctx, operator.ID); err != nil {
+		t.Fatalf("Failed to StartOperatorSigningKeyRotation: %v", err)
+	}
+	operator, err = natsModule.CompleteOperatorSigningKeyRotation(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to CompleteOperatorSigningKeyRotation: %v", err)
+	}
+	operatorRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_operators", operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to find operator: %v", err)
+	}
+	assertSigningSeed := func(record *core.Record, field, publicKey string) {
+		t.Helper()
+		if !keyRing.isCurrent(record.GetString(field)) {
+			t.Errorf("Field %s of %s is not encrypted", field, record.TableName())
+		}
+		kp, err := keyRing.keyPairFromSecret(record, field)
+		if err != nil {
+			t.Fatalf("Failed to decrypt field %s of %s: %v", field, record.TableName(), err)
+		}
+		if pub, _ := kp.PublicKey(); pub != publicKey {
+			t.Errorf("Field %s of %s holds the seed of %s, want %s", field, record.TableName(), pub, publicKey)
+		}
+	}
+	assertSigningSeed(operatorRecord, "sign_seed", operator.SigningPublicKey)
+
+	// the account signing key is encrypted again for the record of the old key
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	accountRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_accounts", account.ID)
+	if err != nil {
+		t.Fatalf("Failed to find account: %v", err)
+	}
+	oldSigningKey := accountRecord.GetString("sign_public_key")
+	if err := natsModule.RotateAccountSigningKey(ctx, account.ID, ""); err != nil {
+		t.Fatalf("Failed to RotateAccountSigningKey: %v", err)
+	}
+	keyRecord, err := natsModule.cfg.App.FindFirstRecordByData("nats_auth_account_signing_keys", "public_key", oldSigningKey)
+	if err != nil {
+		t.Fatalf("Failed to find the old key: %v", err)
+	}
+	assertSigningSeed(keyRecord, "seed", oldSigningKey)
+}
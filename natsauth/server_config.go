@@ -0,0 +1,340 @@
+package natsauth
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+// serverConfigImage is the NATS server image of the generated docker-compose files
+const serverConfigImage = "nats:2.10"
+
+var serverNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// DefaultServerConfigOptions returns the options of a single server with JetStream and a full resolver
+func DefaultServerConfigOptions() application.ServerConfigOptions {
+	return application.ServerConfigOptions{
+		ServerNames:  []string{"nats-1"},
+		ClusterName:  "nats",
+		ClientPort:   4222,
+		ClusterPort:  6222,
+		HTTPPort:     8222,
+		JetStream:    true,
+		ResolverType: application.ResolverFull,
+	}
+}
+
+func validateServerConfigOptions(opts application.ServerConfigOptions) error {
+	if len(opts.ServerNames) == 0 {
+		return fmt.Errorf("at least one server name is required")
+	}
+	for i, name := range opts.ServerNames {
+		if !serverNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid server name %q: only letters, digits, _ and - are allowed", name)
+		}
+		if slices.Contains(opts.ServerNames[:i], name) {
+			return fmt.Errorf("server name %q is used twice", name)
+		}
+	}
+	if len(opts.ServerNames) > 1 && !serverNamePattern.MatchString(opts.ClusterName) {
+		return fmt.Errorf("invalid cluster name %q", opts.ClusterName)
+	}
+	switch opts.ResolverType {
+	case application.ResolverFull, application.ResolverCache, application.ResolverMemory:
+	default:
+		return fmt.Errorf("unknown resolver type %q", opts.ResolverType)
+	}
+	if opts.MQTTPort > 0 && !opts.JetStream {
+		return fmt.Errorf("MQTT requires JetStream")
+	}
+	if (opts.TLSCert == "") != (opts.TLSKey == "") {
+		return fmt.Errorf("TLS needs both a certificate and a key")
+	}
+	if opts.TLSVerify && opts.TLSCA == "" {
+		return fmt.Errorf("verifying clients needs a CA")
+	}
+	ports := map[int]string{}
+	for name, port := range map[string]int{
+		"client":    opts.ClientPort,
+		"cluster":   opts.ClusterPort,
+		"http":      opts.HTTPPort,
+		"leafnode":  opts.LeafNodePort,
+		"websocket": opts.WebsocketPort,
+		"mqtt":      opts.MQTTPort,
+	} {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("invalid %s port %d", name, port)
+		}
+		if port == 0 {
+			continue
+		}
+		if other, ok := ports[port]; ok {
+			return fmt.Errorf("the %s and %s listeners use the same port %d", other, name, port)
+		}
+		ports[port] = name
+	}
+	if opts.ClientPort == 0 {
+		return fmt.Errorf("the client port is required")
+	}
+	if len(opts.ServerNames) > 1 && opts.ClusterPort == 0 {
+		return fmt.Errorf("the cluster port is required for more than one server")
+	}
+	return nil
+}
+
+// GenerateServerConfigBundle generates a config per server of the options and a docker-compose file running them.
+// The configs trust the operator and preload the SYS account, in memory mode all accounts.
+func (m *NATSAuthModule) GenerateServerConfigBundle(_ context.Context, operatorID string,
+	opts application.ServerConfigOptions) (*application.ServerConfigBundle, error) {
+	if err := validateServerConfigOptions(opts); err != nil {
+		return nil, err
+	}
+
+	operatorRecord, err := m.cfg.App.FindRecordById("nats_auth_operators", operatorID)
+	if err != nil {
+		return nil, err
+	}
+	accountRecords, err := m.cfg.App.FindAllRecords("nats_auth_accounts",
+		dbx.HashExp{
+			"operator": operatorID,
+		})
+	if err != nil {
+		return nil, err
+	}
+	var sysAccountRecord *core.Record
+	for _, accountRecord := range accountRecords {
+		if accountRecord.GetString("name") == "SYS" {
+			sysAccountRecord = accountRecord
+		}
+	}
+	if sysAccountRecord == nil {
+		return nil, ErrNotFound
+	}
+
+	preloaded := []*core.Record{sysAccountRecord}
+	if opts.ResolverType == application.ResolverMemory {
+		preloaded = accountRecords
+	}
+
+	bundle := &application.ServerConfigBundle{}
+	for _, name := range opts.ServerNames {
+		bundle.Files = append(bundle.Files, application.ServerConfigFile{
+			Name:    name + ".conf",
+			Content: serverConfig(name, opts, operatorRecord, sysAccountRecord, preloaded),
+		})
+	}
+	bundle.Files = append(bundle.Files, application.ServerConfigFile{
+		Name:    "docker-compose.yml",
+		Content: serverConfigCompose(opts),
+	})
+	return bundle, nil
+}
+
+func serverConfig(name string, opts application.ServerConfigOptions,
+	operatorRecord, sysAccountRecord *core.Record, preloaded []*core.Record) string {
+	var b strings.Builder
+	tlsEnabled := opts.TLSCert != ""
+
+	fmt.Fprintf(&b, "# NATS server %s of %s\n", name, serverConfigComment(operatorRecord.GetString("url")))
+	fmt.Fprintf(&b, "server_name: %q\n", name)
+	fmt.Fprintf(&b, "listen: \"0.0.0.0:%d\"\n", opts.ClientPort)
+	if opts.HTTPPort > 0 {
+		fmt.Fprintf(&b, "http_port: %d\n", opts.HTTPPort)
+	}
+
+	if tlsEnabled {
+		b.WriteString("\ntls {\n")
+		writeServerConfigTLS(&b, opts, "  ")
+		if opts.TLSVerify {
+			b.WriteString("  verify: true\n")
+		}
+		b.WriteString("}\n")
+	}
+
+	if opts.JetStream {
+		b.WriteString("\njetstream {\n")
+		b.WriteString("  store_dir: \"/data/jetstream\"\n")
+		if opts.JetStreamMaxMemory > 0 {
+			fmt.Fprintf(&b, "  max_memory_store: %d\n", opts.JetStreamMaxMemory)
+		}
+		if opts.JetStreamMaxStore > 0 {
+			fmt.Fprintf(&b, "  max_file_store: %d\n", opts.JetStreamMaxStore)
+		}
+		b.WriteString("}\n")
+	}
+
+	if len(opts.ServerNames) > 1 {
+		b.WriteString("\ncluster {\n")
+		fmt.Fprintf(&b, "  name: %q\n", opts.ClusterName)
+		fmt.Fprintf(&b, "  listen: \"0.0.0.0:%d\"\n", opts.ClusterPort)
+		b.WriteString("  routes: [\n")
+		for _, route := range serverConfigRoutes(opts) {
+			fmt.Fprintf(&b, "    %q\n", route)
+		}
+		b.WriteString("  ]\n")
+		if tlsEnabled {
+			b.WriteString("  tls {\n")
+			writeServerConfigTLS(&b, opts, "    ")
+			b.WriteString("  }\n")
+		}
+		b.WriteString("}\n")
+	}
+
+	if opts.LeafNodePort > 0 {
+		b.WriteString("\nleafnodes {\n")
+		fmt.Fprintf(&b, "  port: %d\n", opts.LeafNodePort)
+		if tlsEnabled {
+			b.WriteString("  tls {\n")
+			writeServerConfigTLS(&b, opts, "    ")
+			b.WriteString("  }\n")
+		}
+		b.WriteString("}\n")
+	}
+
+	if opts.WebsocketPort > 0 {
+		b.WriteString("\nwebsocket {\n")
+		fmt.Fprintf(&b, "  port: %d\n", opts.WebsocketPort)
+		if tlsEnabled {
+			b.WriteString("  tls {\n")
+			writeServerConfigTLS(&b, opts, "    ")
+			b.WriteString("  }\n")
+		} else {
+			b.WriteString("  no_tls: true\n")
+		}
+		b.WriteString("}\n")
+	}
+
+	if opts.MQTTPort > 0 {
+		b.WriteString("\nmqtt {\n")
+		fmt.Fprintf(&b, "  port: %d\n", opts.MQTTPort)
+		if tlsEnabled {
+			b.WriteString("  tls {\n")
+			writeServerConfigTLS(&b, opts, "    ")
+			b.WriteString("  }\n")
+		}
+		b.WriteString("}\n")
+	}
+
+	fmt.Fprintf(&b, "\noperator: %s\n", operatorRecord.GetString("jwt"))
+	fmt.Fprintf(&b, "system_account: %s\n", sysAccountRecord.GetString("public_key"))
+
+	b.WriteString("\n")
+	switch opts.ResolverType {
+	case application.ResolverFull:
+		b.WriteString(`resolver {
+  type: full
+  dir: "/data/jwt"
+  # allows NATS Tower to delete accounts, deleted JWTs are renamed to *.delete
+  allow_delete: true
+  # interval in which the resolvers of the cluster exchange missing JWTs
+  interval: "2m"
+  limit: 1000
+}
+`)
+	case application.ResolverCache:
+		b.WriteString(`# the JWTs are fetched from the full resolvers of the cluster
+resolver {
+  type: cache
+  dir: "/data/jwt"
+  ttl: "1h"
+  limit: 1000
+}
+`)
+	case application.ResolverMemory:
+		b.WriteString("# updates of the accounts need a new config and a reload of the server\n")
+		b.WriteString("resolver: MEMORY\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(resolverPreload(preloaded))
+	return b.String()
+}
+
+func writeServerConfigTLS(b *strings.Builder, opts application.ServerConfigOptions, indent string) {
+	fmt.Fprintf(b, "%scert_file: %q\n", indent, opts.TLSCert)
+	fmt.Fprintf(b, "%skey_file: %q\n", indent, opts.TLSKey)
+	if opts.TLSCA != "" {
+		fmt.Fprintf(b, "%sca_file: %q\n", indent, opts.TLSCA)
+	}
+}
+
+// serverConfigRoutes returns the routes of the options or routes to all servers of the bundle
+func serverConfigRoutes(opts application.ServerConfigOptions) []string {
+	if len(opts.Routes) > 0 {
+		return opts.Routes
+	}
+	scheme := "nats"
+	if opts.TLSCert != "" {
+		scheme = "tls"
+	}
+	var routes []string
+	for _, name := range opts.ServerNames {
+		routes = append(routes, fmt.Sprintf("%s://%s:%d", scheme, name, opts.ClusterPort))
+	}
+	return routes
+}
+
+// serverConfigComment removes the control characters of a value written into a comment,
+// so a line break can not end the comment and add settings to the config
+func serverConfigComment(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// resolverPreload returns the resolver_preload block of the accounts with a JWT
+func resolverPreload(accountRecords []*core.Record) string {
+	var b strings.Builder
+	b.WriteString("resolver_preload: {\n")
+	for _, accountRecord := range accountRecords {
+		if accountRecord.GetString("jwt") == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "  # %s\n", serverConfigComment(accountRecord.GetString("name")))
+		fmt.Fprintf(&b, "  %s: %s\n", accountRecord.GetString("public_key"), accountRecord.GetString("jwt"))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// serverConfigCompose returns a docker-compose file running the servers of the options.
+// The ports of the n-th server are published with an offset of n on the host.
+func serverConfigCompose(opts application.ServerConfigOptions) string {
+	var b strings.Builder
+	b.WriteString("# Runs the servers of the bundle for local testing: docker compose up\n")
+	b.WriteString("services:\n")
+	for i, name := range opts.ServerNames {
+		fmt.Fprintf(&b, "  %s:\n", name)
+		fmt.Fprintf(&b, "    image: %s\n", serverConfigImage)
+		fmt.Fprintf(&b, "    hostname: %s\n", name)
+		b.WriteString("    command: [\"-c\", \"/etc/nats/nats-server.conf\"]\n")
+		b.WriteString("    volumes:\n")
+		fmt.Fprintf(&b, "      - ./%s.conf:/etc/nats/nats-server.conf:ro\n", name)
+		fmt.Fprintf(&b, "      - %s-data:/data\n", name)
+		if opts.TLSCert != "" {
+			b.WriteString("      # the TLS files have to be mounted at the paths of the config\n")
+		}
+		b.WriteString("    ports:\n")
+		for _, port := range []int{opts.ClientPort, opts.HTTPPort, opts.LeafNodePort, opts.WebsocketPort, opts.MQTTPort} {
+			if port > 0 {
+				fmt.Fprintf(&b, "      - \"%d:%d\"\n", port+i, port)
+			}
+		}
+	}
+	b.WriteString("volumes:\n")
+	for _, name := range opts.ServerNames {
+		fmt.Fprintf(&b, "  %s-data: {}\n", name)
+	}
+	return b.String()
+}
@@ -0,0 +1,139 @@
+package natsauth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-tower/nats-tower/application"
+)
+
+func Test_validateServerConfigOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(opts *application.ServerConfigOptions)
+		wantErr bool
+	}{
+		{"defaults", func(opts *application.ServerConfigOptions) {}, false},
+		{"cluster", func(opts *application.ServerConfigOptions) {
+			opts.ServerNames = []string{"nats-1", "nats-2", "nats-3"}
+		}, false},
+		{"no servers", func(opts *application.ServerConfigOptions) { opts.ServerNames = nil }, true},
+		{"server name with a line break", func(opts *application.ServerConfigOptions) {
+			opts.ServerNames = []string{"nats-1\nlisten: 0.0.0.0:1"}
+		}, true},
+		{"server name used twice", func(opts *application.ServerConfigOptions) {
+			opts.ServerNames = []string{"nats-1", "nats-1"}
+		}, true},
+		{"invalid cluster name", func(opts *application.ServerConfigOptions) {
+			opts.ServerNames = []string{"nats-1", "nats-2"}
+			opts.ClusterName = "a b"
+		}, true},
+		{"cluster without port", func(opts *application.ServerConfigOptions) {
+			opts.ServerNames = []string{"nats-1", "nats-2"}
+			opts.ClusterPort = 0
+		}, true},
+		{"unknown resolver", func(opts *application.ServerConfigOptions) { opts.ResolverType = "url" }, true},
+		{"MQTT without JetStream", func(opts *application.ServerConfigOptions) {
+			opts.MQTTPort = 1883
+			opts.JetStream = false
+		}, true},
+		{"TLS without key", func(opts *application.ServerConfigOptions) { opts.TLSCert = "/etc/nats/cert.pem" }, true},
+		{"verify without CA", func(opts *application.ServerConfigOptions) {
+			opts.TLSCert = "/etc/nats/cert.pem"
+			opts.TLSKey = "/etc/nats/key.pem"
+			opts.TLSVerify = true
+		}, true},
+		{"port used twice", func(opts *application.ServerConfigOptions) { opts.HTTPPort = opts.ClientPort }, true},
+		{"invalid port", func(opts *application.ServerConfigOptions) { opts.WebsocketPort = 70000 }, true},
+		{"no client port", func(opts *application.ServerConfigOptions) { opts.ClientPort = 0 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultServerConfigOptions()
+			tt.change(&opts)
+			if err := validateServerConfigOptions(opts); (err != nil) != tt.wantErr {
+				t.Errorf("validateServerConfigOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_GenerateServerConfigBundle(t *testing.T) {
+	const url = "nats://127.0.0.1:14241"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+
+	operator, err := natsModule.GetOperator(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to GetOperator: %v", err)
+	}
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	// names are written into comments of the config and must not add settings
+	accountRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_accounts", account.ID)
+	if err != nil {
+		t.Fatalf("Failed to find account: %v", err)
+	}
+	accountRecord.Set("name", "A\nlisten: \"0.0.0.0:1\"")
+	if err := natsModule.cfg.App.UnsafeWithoutHooks().Save(accountRecord); err != nil {
+		t.Fatalf("Failed to save account: %v", err)
+	}
+
+	opts := DefaultServerConfigOptions()
+	opts.ServerNames = []string{"nats-1", "nats-2"}
+	opts.ResolverType = application.ResolverMemory
+	bundle, err := natsModule.GenerateServerConfigBundle(ctx, operator.ID, opts)
+	if err != nil {
+		t.Fatalf("Failed to GenerateServerConfigBundle: %v", err)
+	}
+
+	var names []string
+	for _, file := range bundle.Files {
+		names = append(names, file.Name)
+	}
+	if len(names) != 3 || names[0] != "nats-1.conf" || names[1] != "nats-2.conf" || names[2] != "docker-compose.yml" {
+		t.Fatalf("Bundle files are %v", names)
+	}
+
+	path := filepath.Join(t.TempDir(), bundle.Files[1].Name)
+	if err := os.WriteFile(path, []byte(bundle.Files[1].Content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	serverOpts, err := server.ProcessConfigFile(path)
+	if err != nil {
+		t.Fatalf("Config is invalid: %v\n%s", err, bundle.Files[1].Content)
+	}
+	if serverOpts.ServerName != "nats-2" || serverOpts.Port != opts.ClientPort || serverOpts.Cluster.Name != opts.ClusterName {
+		t.Errorf("Config has server %s, port %d and cluster %s", serverOpts.ServerName, serverOpts.Port, serverOpts.Cluster.Name)
+	}
+	if len(serverOpts.Routes) != 2 {
+		t.Errorf("Config has routes %v", serverOpts.Routes)
+	}
+	if len(serverOpts.TrustedOperators) != 1 || serverOpts.TrustedOperators[0].Subject != operator.PublicKey {
+		t.Errorf("Config does not trust the operator")
+	}
+
+	// the memory resolver is filled with the preloaded accounts when the server is created
+	ns, err := server.NewServer(serverOpts)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	for _, record := range []struct{ publicKey, jwt string }{
+		{account.PublicKey, account.JWT},
+		{serverOpts.SystemAccount, ""},
+	} {
+		preloaded, err := ns.AccountResolver().Fetch(record.publicKey)
+		if err != nil {
+			t.Errorf("Account %s is not preloaded: %v", record.publicKey, err)
+			continue
+		}
+		if record.jwt != "" && preloaded != record.jwt {
+			t.Errorf("Account %s is preloaded with another JWT", record.publicKey)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package natsauth
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/nats-io/nkeys"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ErrUnknownKey is returned by signers that do not hold the key of a public key
+var ErrUnknownKey = errors.New("signing key not available")
+
+// ErrRemoteKey is returned when the seed of a key held by an external signer is requested
+var ErrRemoteKey = errors.New("the key is held by an external signer")
+
+// Signer provides the key pairs operator, account and user JWTs are signed with.
+// Key pairs of external signers only support PublicKey, Sign and Verify,
+// so their seeds never have to be stored in NATS Tower.
+type Signer interface {
+	// KeyPair returns the key pair of the public key or ErrUnknownKey.
+	// dao is the transaction the signature is created in.
+	KeyPair(ctx context.Context, dao core.App, publicKey string) (nkeys.KeyPair, error)
+}
+
+// signingKeyFields maps public key fields to the seed fields stored alongside them
+var signingKeyFields = []struct {
+	collection     string
+	publicKeyField string
+	seedField      string
+}{
+	{"nats_auth_operators", "sign_public_key", "sign_seed"},
+	{"nats_auth_operators", "next_sign_public_key", "next_sign_seed"},
+	{"nats_auth_operators", "public_key", "seed"},
+	{"nats_auth_accounts", "sign_public_key", "sign_seed"},
+	{"nats_auth_accounts", "public_key", "seed"},
+	{"nats_auth_account_signing_keys", "public_key", "seed"},
+}
+
+// DBSigner signs with the seeds stored in the database
+type DBSigner struct {
+	// decrypts the seeds, nil if they are stored in plaintext
+	KeyRing *KeyRing
+}
+
+func (s DBSigner) KeyPair(_ context.Context, dao core.App, publicKey string) (nkeys.KeyPair, error) {
+	if publicKey == "" || dao == nil {
+		return nil, ErrUnknownKey
+	}
+	for _, f := range signingKeyFields {
+		records, err := dao.FindAllRecords(f.collection,
+			dbx.HashExp{f.publicKeyField: publicKey},
+			dbx.NewExp(f.seedField+" != ''"))
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			continue
+		}
+		return s.KeyRing.keyPairFromSecret(records[0], f.seedField)
+	}
+	return nil, ErrUnknownKey
+}
+
+// FileSigner signs with seeds stored in a nsc keys directory.
+// It stands in for an external signer in tests and small setups.
+type FileSigner struct {
+	KeysDir string
+}
+
+func (s FileSigner) KeyPair(_ context.Context, _ core.App, publicKey string) (nkeys.KeyPair, error) {
+	seed := importKeyStore(s.KeysDir).seed(publicKey)
+	if seed == "" {
+		return nil, ErrUnknownKey
+	}
+	return nkeys.FromSeed([]byte(seed))
+}
+
+// chainSigner returns the key pair of the first signer that holds the key
+type chainSigner []Signer
+
+func (c chainSigner) KeyPair(ctx context.Context, dao core.App, publicKey string) (nkeys.KeyPair, error) {
+	for _, signer := range c {
+		kp, err := signer.KeyPair(ctx, dao, publicKey)
+		if errors.Is(err, ErrUnknownKey) {
+			continue
+		}
+		return kp, err
+	}
+	return nil, ErrUnknownKey
+}
+
+// signerRequest is sent by a SocketSigner as one JSON line per connection
+type signerRequest struct {
+	PublicKey string `json:"public_key"`
+	// Data is signed, an empty Data only checks whether the signer holds the key
+	Data []byte `json:"data,omitempty"`
+}
+
+type signerResponse struct {
+	Signature []byte `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Unknown is set if the signer does not hold the key
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// SocketSigner signs through an external signing process listening on a local socket,
+// see ServeSigner for the other side of the socket.
+type SocketSigner struct {
+	Network string
+	Address string
+	Timeout time.Duration
+}
+
+// NewSocketSigner creates a signer for the unix socket at path
+func NewSocketSigner(path string) *SocketSigner {
+	return &SocketSigner{
+		Network: "unix",
+		Address: path,
+		Timeout: 5 * time.Second,
+	}
+}
+
+func (s *SocketSigner) request(ctx context.Context, req signerRequest) (*signerResponse, error) {
+	dialer := net.Dialer{Timeout: s.Timeout}
+	conn, err := dialer.DialContext(ctx, s.Network, s.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(s.Timeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var res signerResponse
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		return nil, err
+	}
+	if res.Unknown {
+		return nil, ErrUnknownKey
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("signer: %s", res.Error)
+	}
+	return &res, nil
+}
+
+func (s *SocketSigner) KeyPair(ctx context.Context, _ core.App, publicKey string) (nkeys.KeyPair, error) {
+	if publicKey == "" {
+		return nil, ErrUnknownKey
+	}
+	if _, err := s.request(ctx, signerRequest{PublicKey: publicKey}); err != nil {
+		return nil, err
+	}
+	return &remoteKeyPair{
+		publicKey: publicKey,
+		sign: func(input []byte) ([]byte, error) {
+			res, err := s.request(ctx, signerRequest{PublicKey: publicKey, Data: input})
+			if err != nil {
+				return nil, err
+			}
+			return res.Signature, nil
+		},
+	}, nil
+}
+
+// remoteKeyPair is a key pair whose seed stays with an external signer
+type remoteKeyPair struct {
+	publicKey string
+	sign      func(input []byte) ([]byte, error)
+}
+
+func (kp *remoteKeyPair) Seed() ([]byte, error) {
+	return nil, ErrRemoteKey
+}
+
+func (kp *remoteKeyPair) PublicKey() (string, error) {
+	return kp.publicKey, nil
+}
+
+func (kp *remoteKeyPair) PrivateKey() ([]byte, error) {
+	return nil, ErrRemoteKey
+}
+
+func (kp *remoteKeyPair) Sign(input []byte) ([]byte, error) {
+	return kp.sign(input)
+}
+
+func (kp *remoteKeyPair) Verify(input []byte, sig []byte) error {
+	pub, err := nkeys.FromPublicKey(kp.publicKey)
+	if err != nil {
+		return err
+	}
+	return pub.Verify(input, sig)
+}
+
+func (kp *remoteKeyPair) Wipe() {}
+
+func (kp *remoteKeyPair) Seal(_ []byte, _ string) ([]byte, error) {
+	return nil, nkeys.ErrInvalidNKeyOperation
+}
+
+func (kp *remoteKeyPair) SealWithRand(_ []byte, _ string, _ io.Reader) ([]byte, error) {
+	return nil, nkeys.ErrInvalidNKeyOperation
+}
+
+func (kp *remoteKeyPair) Open(_ []byte, _ string) ([]byte, error) {
+	return nil, nkeys.ErrInvalidNKeyOperation
+}
+
+// ServeSigner answers the requests of SocketSigners with the keys of signer until the listener is closed
+func ServeSigner(ctx context.Context, logger *slog.Logger, listener net.Listener, signer Signer) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go serveSignerConn(ctx, logger, conn, signer)
+	}
+}
+
+func serveSignerConn(ctx context.Context, logger *slog.Logger, conn net.Conn, signer Signer) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Minute))
+
+	var req signerRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		logger.ErrorContext(ctx, "Could not read signer request", slog.String("error", err.Error()))
+		return
+	}
+
+	var res signerResponse
+	kp, err := signer.KeyPair(ctx, nil, req.PublicKey)
+	switch {
+	case errors.Is(err, ErrUnknownKey):
+		res.Unknown = true
+	case err != nil:
+		res.Error = err.Error()
+	case len(req.Data) > 0:
+		logger.InfoContext(ctx, "Signing...", slog.String("public_key", req.PublicKey))
+		res.Signature, err = kp.Sign(req.Data)
+		if err != nil {
+			res.Error = err.Error()
+		}
+	}
+
+	if err := json.NewEncoder(conn).Encode(res); err != nil {
+		logger.ErrorContext(ctx, "Could not write signer response", slog.String("error", err.Error()))
+	}
+}
+
+// signingKeyPair returns the key pair for the public key in publicKeyField of the record
+func (m *NATSAuthModule) signingKeyPair(ctx context.Context, dao core.App,
+	record *core.Record, publicKeyField string) (nkeys.KeyPair, error) {
+	kp, err := m.signer.KeyPair(ctx, dao, record.GetString(publicKeyField))
+	if errors.Is(err, ErrUnknownKey) {
+		return nil, fmt.Errorf("no signing key for %s of %s %s: %w",
+			publicKeyField, record.TableName(), record.Id, err)
+	}
+	return kp, err
+}
+
+// canSign reports whether the signer holds the key for the public key in publicKeyField of the record
+func (m *NATSAuthModule) canSign(ctx context.Context, dao core.App,
+	record *core.Record, publicKeyField string) (bool, error) {
+	_, err := m.signer.KeyPair(ctx, dao, record.GetString(publicKeyField))
+	if errors.Is(err, ErrUnknownKey) {
+		return false, nil
+	}
+	return err == nil, err
+}
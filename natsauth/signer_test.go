@@ -0,0 +1,161 @@
+package natsauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/nats-tower/nats-tower/application"
+)
+
+// writeTestKey stores the seed of a new key pair in a nsc keys directory and returns its public key
+func writeTestKey(t *testing.T, keysDir string, kp nkeys.KeyPair) string {
+	publicKey, err := kp.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := kp.Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(keysDir, "keys", publicKey[0:1], publicKey[1:3])
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, publicKey+".nk"), seed, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return publicKey
+}
+
+// startTestSigner serves the keys of the keys directory on a unix socket
+func startTestSigner(t *testing.T, keysDir string) *SocketSigner {
+	path := filepath.Join(t.TempDir(), "signer.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeSigner(context.Background(), logger, listener, FileSigner{KeysDir: keysDir})
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		if err := <-done; err != nil {
+			t.Errorf("ServeSigner() error = %v", err)
+		}
+	})
+	return NewSocketSigner(path)
+}
+
+func Test_Signers(t *testing.T) {
+	ctx := context.Background()
+	keysDir := t.TempDir()
+	kp, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := writeTestKey(t, keysDir, kp)
+	unknown, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownKey, _ := unknown.PublicKey()
+
+	tests := []struct {
+		name   string
+		signer Signer
+		remote bool
+	}{
+		{"file", FileSigner{KeysDir: keysDir}, false},
+		{"socket", startTestSigner(t, keysDir), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signerKP, err := tt.signer.KeyPair(ctx, nil, publicKey)
+			if err != nil {
+				t.Fatalf("KeyPair() error = %v", err)
+			}
+			if pub, _ := signerKP.PublicKey(); pub != publicKey {
+				t.Errorf("PublicKey() = %s, want %s", pub, publicKey)
+			}
+			data := []byte("payload")
+			sig, err := signerKP.Sign(data)
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if err := kp.Verify(data, sig); err != nil {
+				t.Errorf("Signature does not verify: %v", err)
+			}
+			if _, err := signerKP.Seed(); tt.remote != errors.Is(err, ErrRemoteKey) {
+				t.Errorf("Seed() error = %v, remote %v", err, tt.remote)
+			}
+
+			if _, err := tt.signer.KeyPair(ctx, nil, unknownKey); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("KeyPair() of an unknown key error = %v, want ErrUnknownKey", err)
+			}
+		})
+	}
+
+	// a signer that is not running is an error, not an unknown key
+	stopped := NewSocketSigner(filepath.Join(t.TempDir(), "signer.sock"))
+	if _, err := stopped.KeyPair(ctx, nil, publicKey); err == nil || errors.Is(err, ErrUnknownKey) {
+		t.Errorf("KeyPair() of a stopped signer error = %v", err)
+	}
+}
+
+func Test_SocketSignerUsers(t *testing.T) {
+	const url = "nats://127.0.0.1:14250"
+	ctx := context.Background()
+	keysDir := t.TempDir()
+	natsModule := newTestModuleWithConfig(t, NATSAuthModuleConfig{
+		BootstrapURLs: []string{url},
+		Signer:        startTestSigner(t, keysDir),
+	})
+
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+
+	// the account signing key is only held by the external signer
+	accountRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_accounts", account.ID)
+	if err != nil {
+		t.Fatalf("Failed to find account: %v", err)
+	}
+	kp, err := nkeys.FromSeed([]byte(accountRecord.GetString("sign_seed")))
+	if err != nil {
+		t.Fatalf("Failed to read the account signing key: %v", err)
+	}
+	signingKey := writeTestKey(t, keysDir, kp)
+	accountRecord.Set("sign_seed", "")
+	accountRecord.Set("sign_private_key", "")
+	if err := natsModule.cfg.App.UnsafeWithoutHooks().Save(accountRecord); err != nil {
+		t.Fatalf("Failed to save account: %v", err)
+	}
+
+	user, err := natsModule.UpsertUserAuth(ctx, url, "A", "u", "", application.UserOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertUserAuth: %v", err)
+	}
+	claims, err := jwt.DecodeUserClaims(user.JWT)
+	if err != nil {
+		t.Fatalf("Failed to DecodeUserClaims: %v", err)
+	}
+	if claims.Issuer != signingKey {
+		t.Errorf("User is signed by %s, want %s", claims.Issuer, signingKey)
+	}
+	vr := jwt.CreateValidationResults()
+	claims.Validate(vr)
+	if len(vr.Errors()) > 0 {
+		t.Errorf("User JWT is invalid: %v", vr.Errors())
+	}
+}
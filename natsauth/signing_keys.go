@@ -0,0 +1,545 @@
+package natsauth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	jwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func (m *NATSAuthModule) GetAccountSigningKeyFromRecord(record *core.Record) (*application.AccountSigningKey, error) {
+	var template application.UserPermissions
+	_ = record.UnmarshalJSONField("template", &template)
+
+	secrets, err := m.keyRing.getSecrets(record, "private_key", "seed")
+	if err != nil {
+		return nil, err
+	}
+	return &application.AccountSigningKey{
+		ID:          record.Id,
+		AccountID:   record.GetString("account"),
+		Description: record.GetString("description"),
+		PublicKey:   record.GetString("public_key"),
+		PrivateKey:  secrets["private_key"],
+		Seed:        secrets["seed"],
+		Scoped:      record.GetBool("scoped"),
+		Role:        record.GetString("role"),
+		Template:    template,
+		Retiring:    record.GetBool("retiring"),
+	}, nil
+}
+
+// GetAccountSigningKeys returns the signing keys of an account in addition to its sign_seed
+func (m *NATSAuthModule) GetAccountSigningKeys(_ context.Context, accountID string) ([]*application.AccountSigningKey, error) {
+	keyRecords, err := m.cfg.App.FindRecordsByFilter("nats_auth_account_signing_keys",
+		"account = {:account}",
+		"role,public_key",
+		0,
+		0,
+		dbx.Params{"account": accountID})
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*application.AccountSigningKey
+	for _, keyRecord := range keyRecords {
+		key, err := m.GetAccountSigningKeyFromRecord(keyRecord)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, key)
+	}
+	return res, nil
+}
+
+// findSigningKeyAccount returns the account whose signing keys can be managed by NATS Tower
+func findSigningKeyAccount(dao core.App, accountID string) (*core.Record, error) {
+	accountRecord, err := dao.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		return nil, err
+	}
+	if accountRecord.GetBool("read_only") {
+		return nil, fmt.Errorf("account %s is read-only", accountRecord.GetString("name"))
+	}
+	if accountRecord.GetString("name") == "SYS" {
+		return nil, fmt.Errorf("signing keys of the system account can not be changed")
+	}
+	return accountRecord, nil
+}
+
+func validateSigningKeyOptions(dao core.App, accountID, keyID string, opts application.AccountSigningKeyOptions) error {
+	if !opts.Scoped {
+		return nil
+	}
+	if opts.Role == "" {
+		return fmt.Errorf("scoped signing keys need a role")
+	}
+	keyRecords, err := dao.FindAllRecords("nats_auth_account_signing_keys",
+		dbx.HashExp{
+			"account": accountID,
+			"role":    opts.Role,
+		})
+	if err != nil {
+		return err
+	}
+	for _, keyRecord := range keyRecords {
+		if keyRecord.Id != keyID {
+			return fmt.Errorf("role %s already exists", opts.Role)
+		}
+	}
+	return nil
+}
+
+func setSigningKeyOptions(record *core.Record, opts application.AccountSigningKeyOptions) {
+	template := opts.Template
+	template.PubAllow = nonNilStrings(template.PubAllow)
+	template.PubDeny = nonNilStrings(template.PubDeny)
+	template.SubAllow = nonNilStrings(template.SubAllow)
+	template.SubDeny = nonNilStrings(template.SubDeny)
+
+	record.Set("description", opts.Description)
+	record.Set("role", opts.Role)
+	if opts.Scoped {
+		record.Set("template", template)
+	} else {
+		record.Set("template", nil)
+	}
+}
+
+// setSigningKeyPair stores a new key pair in the signing key record
+func (m *NATSAuthModule) setSigningKeyPair(record *core.Record, publicKeyField, privateKeyField, seedField string) (string, error) {
+	signingKP, err := nkeys.CreateAccount()
+	if err != nil {
+		return "", err
+	}
+	pubKey, err := signingKP.PublicKey()
+	if err != nil {
+		return "", err
+	}
+	privateKey, err := signingKP.PrivateKey()
+	if err != nil {
+		return "", err
+	}
+	seed, err := signingKP.Seed()
+	if err != nil {
+		return "", err
+	}
+
+	record.Set(publicKeyField, pubKey)
+	err = m.keyRing.setSecrets(record, map[string]string{
+		privateKeyField: string(privateKey),
+		seedField:       string(seed),
+	})
+	if err != nil {
+		return "", err
+	}
+	return pubKey, nil
+}
+
+// AddAccountSigningKey creates a new signing key for an account.
+// Saving the record re-signs the account JWT through the record hooks.
+func (m *NATSAuthModule) AddAccountSigningKey(ctx context.Context,
+	accountID string, opts application.AccountSigningKeyOptions) (*application.AccountSigningKey, error) {
+	var res *application.AccountSigningKey
+	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		if _, err := findSigningKeyAccount(txDao, accountID); err != nil {
+			return err
+		}
+		if err := validateSigningKeyOptions(txDao, accountID, "", opts); err != nil {
+			return err
+		}
+
+		record := core.NewRecord(m.NATSAccountSigningKeyCollection)
+		record.Set("account", accountID)
+		record.Set("scoped", opts.Scoped)
+		setSigningKeyOptions(record, opts)
+		pubKey, err := m.setSigningKeyPair(record, "public_key", "private_key", "seed")
+		if err != nil {
+			return err
+		}
+
+		m.logger.InfoContext(ctx, "Adding account signing key...",
+			slog.String("account_id", accountID),
+			slog.String("public_key", pubKey))
+
+		if err := txDao.SaveWithContext(ctx, record); err != nil {
+			return err
+		}
+
+		res, err = m.GetAccountSigningKeyFromRecord(record)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// UpdateAccountSigningKey changes the description, role and template of a signing key.
+// Whether a key is scoped can not be changed, since the users signed with it would need different claims.
+func (m *NATSAuthModule) UpdateAccountSigningKey(ctx context.Context,
+	keyID string, opts application.AccountSigningKeyOptions) (*application.AccountSigningKey, error) {
+	var res *application.AccountSigningKey
+	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		record, err := txDao.FindRecordById("nats_auth_account_signing_keys", keyID)
+		if err != nil {
+			return err
+		}
+		if _, err := findSigningKeyAccount(txDao, record.GetString("account")); err != nil {
+			return err
+		}
+
+		opts.Scoped = record.GetBool("scoped")
+		if err := validateSigningKeyOptions(txDao, record.GetString("account"), keyID, opts); err != nil {
+			return err
+		}
+		setSigningKeyOptions(record, opts)
+
+		if err := txDao.SaveWithContext(ctx, record); err != nil {
+			return err
+		}
+
+		res, err = m.GetAccountSigningKeyFromRecord(record)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DeleteAccountSigningKey removes a signing key, which is not used by any user, from its account
+func (m *NATSAuthModule) DeleteAccountSigningKey(ctx context.Context, keyID string) error {
+	return m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		record, err := txDao.FindRecordById("nats_auth_account_signing_keys", keyID)
+		if err != nil {
+			return err
+		}
+		if _, err := findSigningKeyAccount(txDao, record.GetString("account")); err != nil {
+			return err
+		}
+
+		userRecords, err := txDao.FindAllRecords("nats_auth_users",
+			dbx.HashExp{
+				"signing_key": keyID,
+			})
+		if err != nil {
+			return err
+		}
+		if len(userRecords) > 0 {
+			return fmt.Errorf("signing key is used by %d users", len(userRecords))
+		}
+
+		return txDao.DeleteWithContext(ctx, record)
+	})
+}
+
+// SetUserSigningKey signs a user with a signing key of its account. An empty keyID selects the account signing key.
+func (m *NATSAuthModule) SetUserSigningKey(ctx context.Context, userID, keyID string) (*application.UserAuth, error) {
+	var res *application.UserAuth
+	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		userRecord, err := txDao.FindRecordById("nats_auth_users", userID)
+		if err != nil {
+			return err
+		}
+		if keyID != "" {
+			keyRecord, err := txDao.FindRecordById("nats_auth_account_signing_keys", keyID)
+			if err != nil {
+				return err
+			}
+			if keyRecord.GetString("account") != userRecord.GetString("account") {
+				return fmt.Errorf("signing key does not belong to the account of the user")
+			}
+		}
+
+		userRecord.Set("signing_key", keyID)
+		if err := m.signUserRecord(ctx, txDao, userRecord); err != nil {
+			return err
+		}
+		if err := txDao.SaveWithContext(ctx, userRecord); err != nil {
+			return err
+		}
+
+		res, err = m.GetUserFromRecord(userRecord, "")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// RotateAccountSigningKey replaces a signing key of an account. An empty keyID rotates the account signing key.
+// The rotation is staged, so the servers never hold users signed with a key the account does not trust:
+// the account with both keys is published first, then all users signed with the old key are re-signed
+// and the old key is removed from the account, which the outbox publishes once it is committed.
+// Servers with a memory resolver only trust the new key after a config reload, so for them the
+// rotation stops after the first stage and ConfirmResolverConfigReload completes it.
+// JWTs signed with the old key stop working.
+func (m *NATSAuthModule) RotateAccountSigningKey(ctx context.Context, accountID, keyID string) error {
+	logger := m.logger.With(slog.String("account_id", accountID))
+
+	var oldKeyRecord *core.Record
+	// users signed with the account signing key have no signing_key set
+	newKeyID := ""
+	memoryResolver := false
+	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		accountRecord, err := findSigningKeyAccount(txDao, accountID)
+		if err != nil {
+			return err
+		}
+
+		if keyID == "" {
+			// keep the old account signing key valid until all users are re-signed
+			oldKeyRecord = core.NewRecord(m.NATSAccountSigningKeyCollection)
+			oldKeyRecord.Set("account", accountID)
+			oldKeyRecord.Set("description", "Rotated account signing key")
+			oldKeyRecord.Set("public_key", accountRecord.GetString("sign_public_key"))
+			// encrypted secrets are bound to their record, so they are encrypted again for the key record
+			secrets, err := m.keyRing.getSecrets(accountRecord, "sign_private_key", "sign_seed")
+			if err != nil {
+				return err
+			}
+			err = m.keyRing.setSecrets(oldKeyRecord, map[string]string{
+				"private_key": secrets["sign_private_key"],
+				"seed":        secrets["sign_seed"],
+			})
+			if err != nil {
+				return err
+			}
+			if err := txDao.SaveWithContext(ctx, oldKeyRecord); err != nil {
+				return err
+			}
+
+			// the users keep their JWTs, they are only bound to the record of the old key,
+			// so they stay consistent if the rotation stops before they are re-signed
+			userRecords, err := txDao.FindAllRecords("nats_auth_users",
+				dbx.HashExp{
+					"account":     accountID,
+					"signing_key": "",
+				})
+			if err != nil {
+				return err
+			}
+			for _, userRecord := range userRecords {
+				userRecord.Set("signing_key", oldKeyRecord.Id)
+				if err := txDao.UnsafeWithoutHooks().Save(userRecord); err != nil {
+					return err
+				}
+			}
+
+			pubKey, err := m.setSigningKeyPair(accountRecord, "sign_public_key", "sign_private_key", "sign_seed")
+			if err != nil {
+				return err
+			}
+			logger.InfoContext(ctx, "Rotating account signing key...",
+				slog.String("old_public_key", oldKeyRecord.GetString("public_key")),
+				slog.String("public_key", pubKey))
+
+			if err := txDao.SaveWithContext(ctx, accountRecord); err != nil {
+				return err
+			}
+		} else {
+			oldKeyRecord, err = txDao.FindRecordById("nats_auth_account_signing_keys", keyID)
+			if err != nil {
+				return err
+			}
+			if oldKeyRecord.GetString("account") != accountID {
+				return fmt.Errorf("signing key does not belong to the account")
+			}
+			if oldKeyRecord.GetBool("retiring") {
+				// the key was rotated while the installation was in memory mode, the rotation is resumed
+				newKeyID = oldKeyRecord.GetString("replaced_by")
+			} else {
+				newKeyRecord := core.NewRecord(m.NATSAccountSigningKeyCollection)
+				newKeyRecord.Set("account", accountID)
+				newKeyRecord.Set("description", oldKeyRecord.GetString("description"))
+				newKeyRecord.Set("scoped", oldKeyRecord.GetBool("scoped"))
+				newKeyRecord.Set("role", oldKeyRecord.GetString("role"))
+				newKeyRecord.Set("template", oldKeyRecord.Get("template"))
+				pubKey, err := m.setSigningKeyPair(newKeyRecord, "public_key", "private_key", "seed")
+				if err != nil {
+					return err
+				}
+				logger.InfoContext(ctx, "Rotating account signing key...",
+					slog.String("old_public_key", oldKeyRecord.GetString("public_key")),
+					slog.String("public_key", pubKey))
+
+				// the role is taken over by the new key
+				oldKeyRecord.Set("role", "")
+				if err := txDao.UnsafeWithoutHooks().Save(oldKeyRecord); err != nil {
+					return err
+				}
+				if err := txDao.SaveWithContext(ctx, newKeyRecord); err != nil {
+					return err
+				}
+				newKeyID = newKeyRecord.Id
+			}
+		}
+
+		operatorRecord, err := txDao.FindRecordById("nats_auth_operators", accountRecord.GetString("operator"))
+		if err != nil {
+			return err
+		}
+		if resolverMode(operatorRecord) != application.ResolverMemory {
+			return nil
+		}
+		// the old key is retired by ConfirmResolverConfigReload
+		memoryResolver = true
+		oldKeyRecord.Set("retiring", true)
+		oldKeyRecord.Set("replaced_by", newKeyID)
+		return txDao.UnsafeWithoutHooks().Save(oldKeyRecord)
+	})
+	if err != nil {
+		return err
+	}
+
+	// the servers have to trust the new key before any user is signed with it
+	accountRecord, err := m.cfg.App.FindRecordById("nats_auth_accounts", accountID)
+	if err != nil {
+		return err
+	}
+	if err := m.publishAccountChange(ctx, m.cfg.App, accountRecord, accountPublishUpdate); err != nil {
+		return err
+	}
+	if memoryResolver {
+		logger.InfoContext(ctx, "Account signing key rotation waits for the config reload of the servers",
+			slog.String("old_public_key", oldKeyRecord.GetString("public_key")))
+		return nil
+	}
+	outboxRecord, err := m.cfg.App.FindFirstRecordByData("nats_auth_outbox", "account", accountID)
+	if err != nil {
+		return err
+	}
+	if outboxRecord.GetString("status") != string(application.AccountPublishPublished) {
+		return fmt.Errorf("account with the new signing key could not be published, "+
+			"the users are still signed with the old key %s: %s",
+			oldKeyRecord.GetString("public_key"), outboxRecord.GetString("error"))
+	}
+
+	return m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		return m.retireAccountSigningKey(ctx, txDao, oldKeyRecord, newKeyID)
+	})
+}
+
+// completeAccountSigningKeyRotations retires the signing keys of the accounts of an operator
+// which were rotated while waiting for the config reload of the servers
+func (m *NATSAuthModule) completeAccountSigningKeyRotations(ctx context.Context, operatorID string) error {
+	return m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		keyRecords, err := txDao.FindRecordsByFilter("nats_auth_account_signing_keys",
+			"retiring = true && account.operator = {:operator}", "", 0, 0,
+			dbx.Params{"operator": operatorID})
+		if err != nil {
+			return err
+		}
+		for _, keyRecord := range keyRecords {
+			m.logger.InfoContext(ctx, "Completing account signing key rotation...",
+				slog.String("account_id", keyRecord.GetString("account")),
+				slog.String("old_public_key", keyRecord.GetString("public_key")))
+			if err := m.retireAccountSigningKey(ctx, txDao, keyRecord, keyRecord.GetString("replaced_by")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// retireAccountSigningKey re-signs all users of the old key with the new key and removes the old key.
+// An empty newKeyID is the account signing key.
+func (m *NATSAuthModule) retireAccountSigningKey(ctx context.Context, txDao core.App, oldKeyRecord *core.Record, newKeyID string) error {
+	accountID := oldKeyRecord.GetString("account")
+	userRecords, err := txDao.FindAllRecords("nats_auth_users",
+		dbx.HashExp{
+			"account":     accountID,
+			"signing_key": oldKeyRecord.Id,
+		})
+	if err != nil {
+		return err
+	}
+	for _, userRecord := range userRecords {
+		userRecord.Set("signing_key", newKeyID)
+		if err := m.signUserRecord(ctx, txDao, userRecord); err != nil {
+			return err
+		}
+		if err := txDao.SaveWithContext(ctx, userRecord); err != nil {
+			return err
+		}
+	}
+
+	// activation tokens of private exports are signed with the account signing key
+	if newKeyID == "" {
+		if err := resignImportingAccounts(ctx, txDao, accountID); err != nil {
+			return err
+		}
+	}
+
+	// removes the old key from the account JWT, the outbox publishes it after the commit
+	return txDao.DeleteWithContext(ctx, oldKeyRecord)
+}
+
+// resignImportingAccounts saves all accounts importing a private export of the account,
+// so the record hooks re-sign them with new activation tokens
+func resignImportingAccounts(ctx context.Context, dao core.App, accountID string) error {
+	exportRecords, err := dao.FindAllRecords("nats_auth_exports",
+		dbx.HashExp{
+			"account": accountID,
+			"private": true,
+		})
+	if err != nil {
+		return err
+	}
+	for _, exportRecord := range exportRecords {
+		importRecords, err := dao.FindAllRecords("nats_auth_imports",
+			dbx.HashExp{
+				"export": exportRecord.Id,
+			})
+		if err != nil {
+			return err
+		}
+		for _, importRecord := range importRecords {
+			importingAccountRecord, err := dao.FindRecordById("nats_auth_accounts", importRecord.GetString("account"))
+			if err != nil {
+				return err
+			}
+			if err := dao.SaveWithContext(ctx, importingAccountRecord); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyAccountSigningKeys adds the account signing key and all additional signing keys to the account claims
+func (m *NATSAuthModule) applyAccountSigningKeys(_ context.Context, dao core.App,
+	accountRecord *core.Record, accountClaims *jwt.AccountClaims) error {
+	accountClaims.SigningKeys.Add(accountRecord.GetString("sign_public_key"))
+
+	keyRecords, err := dao.FindAllRecords("nats_auth_account_signing_keys",
+		dbx.HashExp{
+			"account": accountRecord.Id,
+		})
+	if err != nil {
+		return err
+	}
+	for _, keyRecord := range keyRecords {
+		if !keyRecord.GetBool("scoped") {
+			accountClaims.SigningKeys.Add(keyRecord.GetString("public_key"))
+			continue
+		}
+		key, err := m.GetAccountSigningKeyFromRecord(keyRecord)
+		if err != nil {
+			return err
+		}
+		scope := jwt.NewUserScope()
+		scope.Key = key.PublicKey
+		scope.Role = key.Role
+		scope.Template.Permissions = *toJWTPermissions(&key.Template)
+		accountClaims.SigningKeys.AddScopedSigner(scope)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package natsauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-tower/nats-tower/application"
+)
+
+// waitForPublication waits until the outbox published the current state of the account
+func waitForPublication(t *testing.T, natsModule *NATSAuthModule, accountID string) {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		record, err := natsModule.cfg.App.FindFirstRecordByData("nats_auth_outbox", "account", accountID)
+		if err == nil && record.GetString("status") == string(application.AccountPublishPublished) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Account was not published: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func getTestUser(t *testing.T, natsModule *NATSAuthModule, userID string) *application.UserAuth {
+	record, err := natsModule.cfg.App.FindRecordById("nats_auth_users", userID)
+	if err != nil {
+		t.Fatalf("Failed to find user: %v", err)
+	}
+	user, err := natsModule.GetUserFromRecord(record, "")
+	if err != nil {
+		t.Fatalf("Failed to GetUserFromRecord: %v", err)
+	}
+	return user
+}
+
+func Test_RotateAccountSigningKey(t *testing.T) {
+	const url = "nats://127.0.0.1:14237"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+	ns := startTestServer(t, natsModule, url, 14237)
+
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	oldUser, err := natsModule.UpsertUserAuth(ctx, url, "A", "u", "", application.UserOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertUserAuth: %v", err)
+	}
+	waitForPublication(t, natsModule, account.ID)
+
+	if err := natsModule.RotateAccountSigningKey(ctx, account.ID, ""); err != nil {
+		t.Fatalf("Failed to RotateAccountSigningKey: %v", err)
+	}
+	waitForPublication(t, natsModule, account.ID)
+
+	accountRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_accounts", account.ID)
+	if err != nil {
+		t.Fatalf("Failed to find account: %v", err)
+	}
+	newSigningKey := accountRecord.GetString("sign_public_key")
+	claims, err := jwt.DecodeAccountClaims(accountRecord.GetString("jwt"))
+	if err != nil {
+		t.Fatalf("Failed to DecodeAccountClaims: %v", err)
+	}
+	if len(claims.SigningKeys) != 1 || !claims.SigningKeys.Contains(newSigningKey) {
+		t.Errorf("Account signing keys are %v, want only %s", claims.SigningKeys.Keys(), newSigningKey)
+	}
+
+	user := getTestUser(t, natsModule, oldUser.ID)
+	if user.SigningKeyID != "" {
+		t.Errorf("User is bound to signing key %s", user.SigningKeyID)
+	}
+	userClaims, err := jwt.DecodeUserClaims(user.JWT)
+	if err != nil {
+		t.Fatalf("Failed to DecodeUserClaims: %v", err)
+	}
+	if userClaims.Issuer != newSigningKey {
+		t.Errorf("User is signed by %s, want %s", userClaims.Issuer, newSigningKey)
+	}
+
+	nc, err := nats.Connect(ns.ClientURL(), nats.UserJWTAndSeed(user.JWT, user.Seed))
+	if err != nil {
+		t.Fatalf("Re-signed user could not connect: %v", err)
+	}
+	nc.Close()
+	if nc, err := nats.Connect(ns.ClientURL(), nats.UserJWTAndSeed(oldUser.JWT, oldUser.Seed)); err == nil {
+		nc.Close()
+		t.Errorf("User signed with the old key could connect")
+	}
+}
+
+func Test_RotateAccountSigningKeyUnpublished(t *testing.T) {
+	// no server is listening, the account with both keys can not be published
+	const url = "nats://127.0.0.1:14238"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	oldUser, err := natsModule.UpsertUserAuth(ctx, url, "A", "u", "", application.UserOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertUserAuth: %v", err)
+	}
+
+	if err := natsModule.RotateAccountSigningKey(ctx, account.ID, ""); err == nil {
+		t.Fatalf("Rotation succeeded without publishing the account")
+	}
+
+	// the user keeps its JWT and is bound to the old key, which the account still trusts
+	user := getTestUser(t, natsModule, oldUser.ID)
+	if user.JWT != oldUser.JWT {
+		t.Errorf("User was re-signed before the account was published")
+	}
+	keyRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_account_signing_keys", user.SigningKeyID)
+	if err != nil {
+		t.Fatalf("User is not bound to the old key: %v", err)
+	}
+	userClaims, err := jwt.DecodeUserClaims(user.JWT)
+	if err != nil {
+		t.Fatalf("Failed to DecodeUserClaims: %v", err)
+	}
+	if keyRecord.GetString("public_key") != userClaims.Issuer {
+		t.Errorf("User is bound to %s, but signed by %s", keyRecord.GetString("public_key"), userClaims.Issuer)
+	}
+
+	accountRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_accounts", account.ID)
+	if err != nil {
+		t.Fatalf("Failed to find account: %v", err)
+	}
+	claims, err := jwt.DecodeAccountClaims(accountRecord.GetString("jwt"))
+	if err != nil {
+		t.Fatalf("Failed to DecodeAccountClaims: %v", err)
+	}
+	if !claims.SigningKeys.Contains(userClaims.Issuer) || !claims.SigningKeys.Contains(accountRecord.GetString("sign_public_key")) {
+		t.Errorf("Account does not trust both keys: %v", claims.SigningKeys.Keys())
+	}
+}
+
+func Test_RotateAccountSigningKeyMemoryResolver(t *testing.T) {
+	const url = "nats://127.0.0.1:14248"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+
+	operator, err := natsModule.GetOperator(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to GetOperator: %v", err)
+	}
+	if _, err := natsModule.UpdateOperatorResolver(ctx, operator.ID, application.ResolverMemory, ""); err != nil {
+		t.Fatalf("Failed to UpdateOperatorResolver: %v", err)
+	}
+	account, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	oldUser, err := natsModule.UpsertUserAuth(ctx, url, "A", "u", "", application.UserOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertUserAuth: %v", err)
+	}
+	waitForPublication(t, natsModule, account.ID)
+	if err := natsModule.ConfirmResolverConfigReload(ctx, operator.ID); err != nil {
+		t.Fatalf("Failed to ConfirmResolverConfigReload: %v", err)
+	}
+
+	if err := natsModule.RotateAccountSigningKey(ctx, account.ID, ""); err != nil {
+		t.Fatalf("Failed to RotateAccountSigningKey: %v", err)
+	}
+
+	// the users stay with the old key until the servers trust the new one
+	user := getTestUser(t, natsModule, oldUser.ID)
+	if user.JWT != oldUser.JWT {
+		t.Errorf("User was re-signed before the config reload")
+	}
+	keyRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_account_signing_keys", user.SigningKeyID)
+	if err != nil {
+		t.Fatalf("User is not bound to the old key: %v", err)
+	}
+	if !keyRecord.GetBool("retiring") {
+		t.Errorf("Old key is not retiring")
+	}
+	operator, err = natsModule.GetOperatorByID(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to GetOperatorByID: %v", err)
+	}
+	if !operator.ConfigReloadRequired {
+		t.Errorf("Rotation does not require a config reload")
+	}
+
+	if err := natsModule.ConfirmResolverConfigReload(ctx, operator.ID); err != nil {
+		t.Fatalf("Failed to ConfirmResolverConfigReload: %v", err)
+	}
+
+	accountRecord, err := natsModule.cfg.App.FindRecordById("nats_auth_accounts", account.ID)
+	if err != nil {
+		t.Fatalf("Failed to find account: %v", err)
+	}
+	newSigningKey := accountRecord.GetString("sign_public_key")
+	user = getTestUser(t, natsModule, oldUser.ID)
+	if user.SigningKeyID != "" {
+		t.Errorf("User is bound to signing key %s", user.SigningKeyID)
+	}
+	userClaims, err := jwt.DecodeUserClaims(user.JWT)
+	if err != nil {
+		t.Fatalf("Failed to DecodeUserClaims: %v", err)
+	}
+	if userClaims.Issuer != newSigningKey {
+		t.Errorf("User is signed by %s, want %s", userClaims.Issuer, newSigningKey)
+	}
+	if _, err := natsModule.cfg.App.FindRecordById("nats_auth_account_signing_keys", keyRecord.Id); err == nil {
+		t.Errorf("Old key was not removed")
+	}
+	claims, err := jwt.DecodeAccountClaims(accountRecord.GetString("jwt"))
+	if err != nil {
+		t.Fatalf("Failed to DecodeAccountClaims: %v", err)
+	}
+	if len(claims.SigningKeys) != 1 || !claims.SigningKeys.Contains(newSigningKey) {
+		t.Errorf("Account signing keys are %v, want only %s", claims.SigningKeys.Keys(), newSigningKey)
+	}
+
+	// removing the old key needs another reload
+	waitForPublication(t, natsModule, account.ID)
+	operator, err = natsModule.GetOperatorByID(ctx, operator.ID)
+	if err != nil {
+		t.Fatalf("Failed to GetOperatorByID: %v", err)
+	}
+	if !operator.ConfigReloadRequired {
+		t.Errorf("Completed rotation does not require a config reload")
+	}
+}
@@ -0,0 +1,188 @@
+package natsauth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	jwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-tower/nats-tower/application"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// UserConnectionTypes are the connection types a user can be restricted to
+var UserConnectionTypes = []string{
+	jwt.ConnectionTypeStandard,
+	jwt.ConnectionTypeWebsocket,
+	jwt.ConnectionTypeMqtt,
+	jwt.ConnectionTypeMqttWS,
+	jwt.ConnectionTypeLeafnode,
+	jwt.ConnectionTypeLeafnodeWS,
+}
+
+func GetUserLimitsFromRecord(record *core.Record) *application.UserLimits {
+	var times []application.UserTimeRange
+	_ = record.UnmarshalJSONField("times", &times)
+
+	return &application.UserLimits{
+		ID:               record.Id,
+		UserID:           record.GetString("user"),
+		MaxSubscriptions: int64(record.GetFloat("max_subscriptions")),
+		MaxData:          int64(record.GetFloat("max_data")),
+		MaxPayload:       int64(record.GetFloat("max_payload")),
+		ConnectionTypes:  record.GetStringSlice("connection_types"),
+		Src:              record.GetStringSlice("src"),
+		Times:            times,
+		Locale:           record.GetString("locale"),
+	}
+}
+
+// UnlimitedUserLimits are applied to users without a limit record
+func UnlimitedUserLimits() *application.UserLimits {
+	return &application.UserLimits{
+		MaxSubscriptions: jwt.NoLimit,
+		MaxData:          jwt.NoLimit,
+		MaxPayload:       jwt.NoLimit,
+	}
+}
+
+func (m *NATSAuthModule) GetUserLimits(ctx context.Context, userID string) (*application.UserLimits, error) {
+	return m.getUserLimitsByUserID(ctx, m.cfg.App, userID)
+}
+
+func (m *NATSAuthModule) getUserLimitsByUserID(_ context.Context, dao core.App, userID string) (*application.UserLimits, error) {
+	limitRecords, err := dao.FindAllRecords("nats_auth_user_limits",
+		dbx.HashExp{
+			"user": userID,
+		})
+	if err != nil {
+		return nil, err
+	}
+	if len(limitRecords) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return GetUserLimitsFromRecord(limitRecords[0]), nil
+}
+
+// ValidateUserLimits checks the limits the same way the NATS server will
+func ValidateUserLimits(limits application.UserLimits) error {
+	for _, connectionType := range limits.ConnectionTypes {
+		if !slices.Contains(UserConnectionTypes, connectionType) {
+			return fmt.Errorf("unknown connection type %s", connectionType)
+		}
+	}
+
+	claimLimits := toUserClaimLimits(&limits)
+	vr := jwt.ValidationResults{}
+	claimLimits.Validate(&vr)
+	if errs := vr.Errors(); len(errs) > 0 {
+		var msgs []string
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return fmt.Errorf("%s", strings.Join(msgs, ", "))
+	}
+	return nil
+}
+
+// UpsertUserLimits stores the limits of a user.
+// Saving the record re-signs the user JWT through the record hooks.
+func (m *NATSAuthModule) UpsertUserLimits(ctx context.Context,
+	userID string, limits application.UserLimits) (*application.UserLimits, error) {
+	if err := ValidateUserLimits(limits); err != nil {
+		return nil, err
+	}
+
+	var res *application.UserLimits
+	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
+		var err error
+		res, err = m.upsertUserLimits(ctx, txDao, userID, limits)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (m *NATSAuthModule) upsertUserLimits(ctx context.Context, dao core.App,
+	userID string, limits application.UserLimits) (*application.UserLimits, error) {
+	limitRecords, err := dao.FindAllRecords("nats_auth_user_limits",
+		dbx.HashExp{
+			"user": userID,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var record *core.Record
+	if len(limitRecords) == 0 {
+		record = core.NewRecord(m.NATSUserLimitCollection)
+		record.Set("user", userID)
+	} else {
+		record = limitRecords[0]
+	}
+
+	times := limits.Times
+	if times == nil {
+		times = []application.UserTimeRange{}
+	}
+
+	record.Set("max_subscriptions", limits.MaxSubscriptions)
+	record.Set("max_data", limits.MaxData)
+	record.Set("max_payload", limits.MaxPayload)
+	record.Set("connection_types", nonNilStrings(limits.ConnectionTypes))
+	record.Set("src", nonNilStrings(limits.Src))
+	record.Set("times", times)
+	record.Set("locale", limits.Locale)
+
+	if err := dao.SaveWithContext(ctx, record); err != nil {
+		return nil, err
+	}
+
+	return GetUserLimitsFromRecord(record), nil
+}
+
+// getUserLimits returns the limits stored for a user.
+// Users without a limit record are unlimited.
+func (m *NATSAuthModule) getUserLimits(ctx context.Context, dao core.App, userRec *core.Record) (*application.UserLimits, error) {
+	limits, err := m.getUserLimitsByUserID(ctx, dao, userRec.Id)
+	if err == ErrNotFound {
+		return UnlimitedUserLimits(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+func toUserClaimLimits(limits *application.UserLimits) jwt.Limits {
+	res := jwt.Limits{
+		UserLimits: jwt.UserLimits{
+			Src:    jwt.CIDRList(nonNilStrings(limits.Src)),
+			Locale: limits.Locale,
+		},
+		NatsLimits: jwt.NatsLimits{
+			Subs:    limits.MaxSubscriptions,
+			Data:    limits.MaxData,
+			Payload: limits.MaxPayload,
+		},
+	}
+	for _, timeRange := range limits.Times {
+		res.Times = append(res.Times, jwt.TimeRange{
+			Start: timeRange.Start,
+			End:   timeRange.End,
+		})
+	}
+	return res
+}
+
+// applyUserLimits sets the limits and allowed connection types of the user claims
+func applyUserLimits(userClaims *jwt.UserClaims, limits *application.UserLimits) {
+	userClaims.Limits = toUserClaimLimits(limits)
+	userClaims.AllowedConnectionTypes = jwt.StringList(limits.ConnectionTypes)
+}
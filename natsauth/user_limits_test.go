@@ -0,0 +1,105 @@
+package natsauth
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-tower/nats-tower/application"
+)
+
+func Test_ValidateUserLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  application.UserLimits
+		wantErr bool
+	}{
+		{"unlimited", *UnlimitedUserLimits(), false},
+		{"restricted", application.UserLimits{
+			MaxSubscriptions: 10,
+			ConnectionTypes:  []string{jwt.ConnectionTypeMqtt},
+			Src:              []string{"10.0.0.0/8", "192.168.1.1/32"},
+			Times:            []application.UserTimeRange{{Start: "08:00:00", End: "18:00:00"}},
+			Locale:           "Europe/Berlin",
+		}, false},
+		{"unknown connection type", application.UserLimits{ConnectionTypes: []string{"CARRIER_PIGEON"}}, true},
+		{"invalid CIDR", application.UserLimits{Src: []string{"10.0.0.0/33"}}, true},
+		{"invalid time", application.UserLimits{Times: []application.UserTimeRange{{Start: "8 am", End: "18:00:00"}}}, true},
+		{"invalid locale", application.UserLimits{Locale: "Mars/Olympus_Mons"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateUserLimits(tt.limits); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateUserLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_UserLimits(t *testing.T) {
+	const url = "nats://127.0.0.1:14252"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+
+	if _, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{}); err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+	user, err := natsModule.UpsertUserAuth(ctx, url, "A", "device", "", application.UserOptions{})
+	if err != nil {
+		t.Fatalf("Failed to UpsertUserAuth: %v", err)
+	}
+	userClaims := func() *jwt.UserClaims {
+		claims, err := jwt.DecodeUserClaims(getTestUser(t, natsModule, user.ID).JWT)
+		if err != nil {
+			t.Fatalf("Failed to DecodeUserClaims: %v", err)
+		}
+		return claims
+	}
+	if claims := userClaims(); claims.Subs != jwt.NoLimit || len(claims.AllowedConnectionTypes) != 0 {
+		t.Errorf("User without limits is restricted: %+v", claims.Limits)
+	}
+
+	limits := application.UserLimits{
+		MaxSubscriptions: 10,
+		MaxData:          1 << 20,
+		MaxPayload:       1 << 10,
+		ConnectionTypes:  []string{jwt.ConnectionTypeMqtt},
+		Src:              []string{"10.0.0.0/8"},
+		Times:            []application.UserTimeRange{{Start: "08:00:00", End: "18:00:00"}},
+		Locale:           "Europe/Berlin",
+	}
+	if _, err := natsModule.UpsertUserLimits(ctx, user.ID, application.UserLimits{Src: []string{"not a CIDR"}}); err == nil {
+		t.Errorf("Invalid user limits were saved")
+	}
+	stored, err := natsModule.UpsertUserLimits(ctx, user.ID, limits)
+	if err != nil {
+		t.Fatalf("Failed to UpsertUserLimits: %v", err)
+	}
+	limits.ID = stored.ID
+	limits.UserID = user.ID
+	got, err := natsModule.GetUserLimits(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to GetUserLimits: %v", err)
+	}
+	if !reflect.DeepEqual(*got, limits) {
+		t.Errorf("Stored user limits are %+v, want %+v", *got, limits)
+	}
+
+	// saving the limits re-signs the user
+	claims := userClaims()
+	if !reflect.DeepEqual(claims.Limits, toUserClaimLimits(&limits)) {
+		t.Errorf("User JWT has the limits %+v, want %+v", claims.Limits, toUserClaimLimits(&limits))
+	}
+	if !claims.AllowedConnectionTypes.Contains(jwt.ConnectionTypeMqtt) || len(claims.AllowedConnectionTypes) != 1 {
+		t.Errorf("User JWT allows the connection types %v", claims.AllowedConnectionTypes)
+	}
+
+	// the limits are kept when the user is updated
+	if _, err := natsModule.UpsertUserAuth(ctx, url, "A", "device", "", application.UserOptions{}); err != nil {
+		t.Fatalf("Failed to UpsertUserAuth: %v", err)
+	}
+	if claims := userClaims(); claims.Subs != 10 || claims.Locale != "Europe/Berlin" {
+		t.Errorf("User JWT lost its limits after an update: %+v", claims.Limits)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"time"
 
 	jwt "github.com/nats-io/jwt/v2"
 	"github.com/nats-io/nkeys"
@@ -44,7 +45,7 @@ func (m *NATSAuthModule) GetSysUserByURL(ctx context.Context,
 		return nil, ErrNotFound
 	}
 
-	return GetUserFromRecord(userRecord[0], url)
+	return m.GetUserFromRecord(userRecord[0], url)
 }
 
 func (m *NATSAuthModule) GetSysUserByID(ctx context.Context,
@@ -79,7 +80,7 @@ func (m *NATSAuthModule) GetSysUserByID(ctx context.Context,
 		return nil, err
 	}
 
-	return GetUserFromRecord(userRecord[0], operatorRecord.GetString("url"))
+	return m.GetUserFromRecord(userRecord[0], operatorRecord.GetString("url"))
 }
 
 func (m *NATSAuthModule) GetSysAccountAndUserByID(ctx context.Context,
@@ -114,11 +115,11 @@ func (m *NATSAuthModule) GetSysAccountAndUserByID(ctx context.Context,
 		return nil, nil, err
 	}
 
-	account, err := GetAccountFromRecord(accountRecord[0], operatorRecord.GetString("url"))
+	account, err := m.GetAccountFromRecord(accountRecord[0], operatorRecord.GetString("url"))
 	if err != nil {
 		return nil, nil, err
 	}
-	user, err := GetUserFromRecord(userRecord[0], operatorRecord.GetString("url"))
+	user, err := m.GetUserFromRecord(userRecord[0], operatorRecord.GetString("url"))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -130,6 +131,12 @@ func (m *NATSAuthModule) UpsertUserAuth(ctx context.Context,
 	url, account, name, description string, opts application.UserOptions) (*application.UserAuth, error) {
 	var res application.UserAuth
 
+	if opts.Limits != nil {
+		if err := ValidateUserLimits(*opts.Limits); err != nil {
+			return nil, err
+		}
+	}
+
 	err := m.cfg.App.RunInTransaction(func(txDao core.App) error {
 		operator, err := m.getOperator(ctx, txDao, url)
 		if err != nil {
@@ -163,6 +170,10 @@ func (m *NATSAuthModule) UpsertUserAuth(ctx context.Context,
 			// does not exist yet => create
 			m.logger.InfoContext(ctx, "User in account does not exist yet", slog.String("account", account), slog.String("name", name))
 
+			if accRecords[0].GetBool("read_only") {
+				return fmt.Errorf("account %s is read-only", account)
+			}
+
 			userKP, err := nkeys.CreateUser()
 			if err != nil {
 				return err
@@ -187,8 +198,15 @@ func (m *NATSAuthModule) UpsertUserAuth(ctx context.Context,
 			userClaims.IssuerAccount = accRecords[0].GetString("public_key")
 			userClaims.Name = name
 			userClaims.BearerToken = opts.BearerToken
+			if opts.Limits != nil {
+				applyUserLimits(userClaims, opts.Limits)
+			}
+
+			record := core.NewRecord(m.NATSUserCollection)
+			record.Set("ttl", opts.TTL.Milliseconds())
+			applyUserTTL(record, userClaims)
 
-			accountKP, err := nkeys.FromSeed([]byte(accRecords[0].GetString("sign_seed")))
+			accountKP, err := m.signingKeyPair(ctx, txDao, accRecords[0], "sign_public_key")
 			if err != nil {
 				return err
 			}
@@ -203,21 +221,32 @@ func (m *NATSAuthModule) UpsertUserAuth(ctx context.Context,
 				return err
 			}
 
-			record := core.NewRecord(m.NATSUserCollection)
 			record.Set("name", name)
 			record.Set("description", description)
 			record.Set("account", accRecords[0].Id)
+			record.Set("bearer", opts.BearerToken)
 			record.Set("public_key", pubKey)
-			record.Set("private_key", string(privateKey))
-			record.Set("seed", string(seed))
 			record.Set("jwt", jwtValue)
-			record.Set("creds", creds)
+			err = m.keyRing.setSecrets(record, map[string]string{
+				"private_key": string(privateKey),
+				"seed":        string(seed),
+				"creds":       string(creds),
+			})
+			if err != nil {
+				return err
+			}
 
 			m.logger.InfoContext(ctx, "Creating user in account", slog.String("account", account), slog.String("name", name))
-			if err := txDao.Save(record); err != nil {
+			if err := txDao.SaveWithContext(ctx, record); err != nil {
 				m.logger.ErrorContext(ctx, "Could not save user", slog.String("error", err.Error()))
 				return err
 			}
+			if opts.Limits != nil {
+				if _, err := m.upsertUserLimits(ctx, txDao, record.Id, *opts.Limits); err != nil {
+					m.logger.ErrorContext(ctx, "Could not save user limits", slog.String("error", err.Error()))
+					return err
+				}
+			}
 			res.ID = record.Id
 			res.URL = url
 			res.PublicKey = pubKey
@@ -225,16 +254,22 @@ func (m *NATSAuthModule) UpsertUserAuth(ctx context.Context,
 			res.Seed = string(seed)
 			res.JWT = jwtValue
 			res.Creds = string(creds)
+			res.TTL = opts.TTL
+			res.Expires = record.GetDateTime("expires").Time()
 		} else {
 			// exists
 			m.logger.InfoContext(ctx, "User in account already exists", slog.String("account", account), slog.String("name", name))
+			secrets, err := m.keyRing.getSecrets(userRecords[0], "private_key", "seed", "creds")
+			if err != nil {
+				return err
+			}
 			res.ID = userRecords[0].Id
 			res.URL = url
 			res.PublicKey = userRecords[0].GetString("public_key")
-			res.PrivateKey = userRecords[0].GetString("private_key")
-			res.Seed = userRecords[0].GetString("seed")
+			res.PrivateKey = secrets["private_key"]
+			res.Seed = secrets["seed"]
 			res.JWT = userRecords[0].GetString("jwt")
-			res.Creds = userRecords[0].GetString("creds")
+			res.Creds = secrets["creds"]
 			res.Name = userRecords[0].GetString("name")
 			res.Description = userRecords[0].GetString("description")
 		}
@@ -284,7 +319,7 @@ func (m *NATSAuthModule) DeleteUserAuth(ctx context.Context,
 		} else {
 			// exists
 			m.logger.InfoContext(ctx, "User in account will be deleted", slog.String("account", account), slog.String("name", name))
-			return txDao.Delete(userRecords[0])
+			return txDao.DeleteWithContext(ctx, userRecords[0])
 		}
 	})
 	if err != nil {
@@ -315,7 +350,7 @@ func (m *NATSAuthModule) GetUsersByAccountID(ctx context.Context,
 
 	var res []*application.UserAuth
 	for _, userRecord := range userRecords {
-		user, err := GetUserFromRecord(userRecord, operator.URL)
+		user, err := m.GetUserFromRecord(userRecord, operator.URL)
 		if err != nil {
 			return nil, err
 		}
@@ -325,16 +360,97 @@ func (m *NATSAuthModule) GetUsersByAccountID(ctx context.Context,
 	return res, nil
 }
 
-func GetUserFromRecord(record *core.Record, url string) (*application.UserAuth, error) {
+func (m *NATSAuthModule) GetUserFromRecord(record *core.Record, url string) (*application.UserAuth, error) {
+	secrets, err := m.keyRing.getSecrets(record, "private_key", "seed", "creds")
+	if err != nil {
+		return nil, err
+	}
 	return &application.UserAuth{
 		ID:          record.Id,
 		URL:         url,
 		PublicKey:   record.GetString("public_key"),
-		PrivateKey:  record.GetString("private_key"),
-		Seed:        record.GetString("seed"),
-		Creds:       record.GetString("creds"),
+		PrivateKey:  secrets["private_key"],
+		Seed:        secrets["seed"],
+		Creds:       secrets["creds"],
 		JWT:         record.GetString("jwt"),
 		Name:        record.GetString("name"),
 		Description: record.GetString("description"),
+		BearerToken: record.GetBool("bearer"),
+		TTL:         time.Duration(record.GetInt("ttl")) * time.Millisecond,
+		Expires:     record.GetDateTime("expires").Time(),
+
+		SigningKeyID: record.GetString("signing_key"),
 	}, nil
 }
+
+// userSigningKey returns the record and the public key field of the key the user is signed with,
+// which is the signing key record bound to the user or else the signing key of the account
+func userSigningKey(dao core.App, accountRecord, record *core.Record) (*core.Record, string, error) {
+	keyID := record.GetString("signing_key")
+	if keyID == "" {
+		return accountRecord, "sign_public_key", nil
+	}
+	keyRecord, err := dao.FindRecordById("nats_auth_account_signing_keys", keyID)
+	if err != nil {
+		return nil, "", err
+	}
+	return keyRecord, "public_key", nil
+}
+
+// signUserRecord re-issues the JWT and creds of an existing user record with
+// the signing key of its account and the permissions stored for the user.
+func (m *NATSAuthModule) signUserRecord(ctx context.Context, dao core.App, record *core.Record) error {
+	accountRecord, err := dao.FindRecordById("nats_auth_accounts", record.GetString("account"))
+	if err != nil {
+		return err
+	}
+
+	userClaims := jwt.NewUserClaims(record.GetString("public_key"))
+	userClaims.Name = record.GetString("name")
+	userClaims.IssuerAccount = accountRecord.GetString("public_key")
+	userClaims.BearerToken = record.GetBool("bearer")
+
+	permissions, err := m.getUserPermissions(ctx, dao, record)
+	if err != nil {
+		return err
+	}
+	userClaims.Permissions = *permissions
+
+	limits, err := m.getUserLimits(ctx, dao, record)
+	if err != nil {
+		return err
+	}
+	applyUserLimits(userClaims, limits)
+	applyUserTTL(record, userClaims)
+
+	signingRecord, signingField, err := userSigningKey(dao, accountRecord, record)
+	if err != nil {
+		return err
+	}
+	// scoped users get their permissions and limits from the template of the signing key
+	if record.GetString("signing_key") != "" && signingRecord.GetBool("scoped") {
+		userClaims.SetScoped(true)
+	}
+
+	accountKP, err := m.signingKeyPair(ctx, dao, signingRecord, signingField)
+	if err != nil {
+		return err
+	}
+
+	jwtValue, err := userClaims.Encode(accountKP)
+	if err != nil {
+		return err
+	}
+
+	seed, err := m.keyRing.getSecret(record, "seed")
+	if err != nil {
+		return err
+	}
+	creds, err := jwt.FormatUserConfig(jwtValue, []byte(seed))
+	if err != nil {
+		return err
+	}
+
+	record.Set("jwt", jwtValue)
+	return m.keyRing.setSecret(record, "creds", string(creds))
+}
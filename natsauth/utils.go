@@ -101,10 +101,12 @@ func RequestMultipleChannel(ctx context.Context,
 		}
 	})
 	if err != nil {
+		cancel()
 		return nil, err
 	}
+	// the connection is shared, so the subscription has to end with the request
 	go func() {
-		<-ctx.Done()
+		<-subCtx.Done()
 		_ = sub.Unsubscribe()
 	}()
 
@@ -112,6 +114,7 @@ func RequestMultipleChannel(ctx context.Context,
 		respSubject,
 		data)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 	return resCh, nil
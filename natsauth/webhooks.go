@@ -0,0 +1,535 @@
+package natsauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+const (
+	webhookSecretPrefix = "whsec_"
+	// time a webhook has to respond
+	webhookTimeout = 10 * time.Second
+	// deliveries are given up after this many attempts
+	webhookMaxAttempts = 8
+	// the delay before a retry doubles with every attempt up to webhookMaxRetryDelay
+	webhookRetryDelay    = 30 * time.Second
+	webhookMaxRetryDelay = time.Hour
+	// pending deliveries are checked in this interval, new events are delivered right away
+	webhookPollInterval = 10 * time.Second
+	// finished deliveries are deleted after this time
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+)
+
+// webhookAccount is an account in the webhook payloads
+type webhookAccount struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+}
+
+// webhookUser is a user in the webhook payloads
+type webhookUser struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	AccountID string `json:"account_id"`
+	PublicKey string `json:"public_key"`
+	// public key before the rotation, credentials issued for it are revoked
+	OldPublicKey string `json:"old_public_key,omitempty"`
+}
+
+// webhookLimits are changed limits in the webhook payloads, with the account if they were assigned to one
+type webhookLimits struct {
+	Limits  *application.Limits `json:"limits"`
+	Account *webhookAccount     `json:"account,omitempty"`
+}
+
+func newWebhookAccount(record *core.Record) *webhookAccount {
+	return &webhookAccount{
+		ID:        record.Id,
+		Name:      record.GetString("name"),
+		PublicKey: record.GetString("public_key"),
+	}
+}
+
+func newWebhookUser(record *core.Record) *webhookUser {
+	return &webhookUser{
+		ID:        record.Id,
+		Name:      record.GetString("name"),
+		AccountID: record.GetString("account"),
+		PublicKey: record.GetString("public_key"),
+	}
+}
+
+func initWebhooksCollection(_ context.Context,
+	app core.App,
+	_ *slog.Logger) (*core.Collection, error) {
+
+	collection, err := app.FindCollectionByNameOrId("webhooks")
+
+	if err == sql.ErrNoRows {
+		collection = core.NewBaseCollection("webhooks")
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// webhooks are managed in the UI, only admins may access the records directly
+	collection.ListRule = nil
+	collection.ViewRule = nil
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = nil
+
+	events := make([]string, 0, len(application.WebhookEvents))
+	for _, event := range application.WebhookEvents {
+		events = append(events, string(event))
+	}
+
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "name",
+		Required: true,
+	})
+	addOrUpdateField(collection, &core.URLField{
+		Name:     "url",
+		Required: true,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "secret",
+		Required: true,
+		Hidden:   true,
+	})
+	addOrUpdateField(collection, &core.SelectField{
+		Name:      "events",
+		Required:  true,
+		Values:    events,
+		MaxSelect: len(events),
+	})
+	addOrUpdateField(collection, &core.AutodateField{
+		Name:     "created",
+		OnCreate: true,
+	})
+
+	// validate and submit (internally it calls app.SaveCollection(collection) in a transaction)
+	if err := app.Save(collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func initWebhookDeliveriesCollection(_ context.Context,
+	app core.App,
+	_ *slog.Logger,
+	webhookCollection *core.Collection) (*core.Collection, error) {
+
+	collection, err := app.FindCollectionByNameOrId("webhook_deliveries")
+
+	if err == sql.ErrNoRows {
+		collection = core.NewBaseCollection("webhook_deliveries")
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	collection.ListRule = nil
+	collection.ViewRule = nil
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = nil
+	collection.Indexes = types.JSONArray[string]{
+		"create index webhook_deliveries_webhook on webhook_deliveries (webhook)",
+		"create index webhook_deliveries_pending on webhook_deliveries (status, next_attempt)",
+	}
+
+	addOrUpdateField(collection, &core.RelationField{
+		Name:          "webhook",
+		Required:      true,
+		CollectionId:  webhookCollection.Id,
+		MaxSelect:     1,
+		CascadeDelete: true,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name:     "event",
+		Required: true,
+	})
+	addOrUpdateField(collection, &core.JSONField{
+		Name:    "payload",
+		MaxSize: 1024 * 1024, // 1MB
+	})
+	addOrUpdateField(collection, &core.SelectField{
+		Name:     "status",
+		Required: true,
+		Values: []string{
+			string(application.WebhookDeliveryPending),
+			string(application.WebhookDeliveryDelivered),
+			string(application.WebhookDeliveryFailed),
+		},
+		MaxSelect: 1,
+	})
+	addOrUpdateField(collection, &core.NumberField{
+		Name:    "attempts",
+		OnlyInt: true,
+	})
+	addOrUpdateField(collection, &core.NumberField{
+		Name:    "response_status",
+		OnlyInt: true,
+	})
+	addOrUpdateField(collection, &core.TextField{
+		Name: "error",
+	})
+	addOrUpdateField(collection, &core.DateField{
+		Name: "next_attempt",
+	})
+	addOrUpdateField(collection, &core.AutodateField{
+		Name:     "created",
+		OnCreate: true,
+	})
+	addOrUpdateField(collection, &core.AutodateField{
+		Name:     "updated",
+		OnCreate: true,
+		OnUpdate: true,
+	})
+
+	if err := app.Save(collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func getWebhookFromRecord(record *core.Record) *application.Webhook {
+	webhook := &application.Webhook{
+		ID:      record.Id,
+		Name:    record.GetString("name"),
+		URL:     record.GetString("url"),
+		Created: record.GetDateTime("created").Time(),
+	}
+	for _, event := range record.GetStringSlice("events") {
+		webhook.Events = append(webhook.Events, application.WebhookEvent(event))
+	}
+	return webhook
+}
+
+func getWebhookDeliveryFromRecord(record *core.Record) *application.WebhookDelivery {
+	return &application.WebhookDelivery{
+		ID:             record.Id,
+		WebhookID:      record.GetString("webhook"),
+		Event:          application.WebhookEvent(record.GetString("event")),
+		Payload:        json.RawMessage(record.GetString("payload")),
+		Status:         application.WebhookDeliveryStatus(record.GetString("status")),
+		Attempts:       record.GetInt("attempts"),
+		ResponseStatus: record.GetInt("response_status"),
+		Error:          record.GetString("error"),
+		NextAttempt:    record.GetDateTime("next_attempt").Time(),
+		Created:        record.GetDateTime("created").Time(),
+		Updated:        record.GetDateTime("updated").Time(),
+	}
+}
+
+// GetWebhooks returns all webhooks with the status of their latest delivery
+func (m *NATSAuthModule) GetWebhooks(_ context.Context) ([]*application.Webhook, error) {
+	records, err := m.cfg.App.FindRecordsByFilter("webhooks", "", "name", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*application.Webhook
+	for _, record := range records {
+		webhook := getWebhookFromRecord(record)
+		deliveryRecords, err := m.cfg.App.FindRecordsByFilter("webhook_deliveries",
+			"webhook = {:webhook}", "-created", 1, 0, dbx.Params{"webhook": record.Id})
+		if err != nil {
+			return nil, err
+		}
+		if len(deliveryRecords) > 0 {
+			webhook.LastDeliveryStatus = application.WebhookDeliveryStatus(deliveryRecords[0].GetString("status"))
+		}
+		res = append(res, webhook)
+	}
+	return res, nil
+}
+
+func (m *NATSAuthModule) GetWebhookByID(_ context.Context, id string) (*application.Webhook, error) {
+	record, err := m.cfg.App.FindRecordById("webhooks", id)
+	if err != nil {
+		return nil, err
+	}
+	return getWebhookFromRecord(record), nil
+}
+
+// CreateWebhook creates a webhook and returns it with its secret, which is only shown once
+func (m *NATSAuthModule) CreateWebhook(ctx context.Context, opts application.WebhookOptions) (*application.Webhook, string, error) {
+	collection, err := m.cfg.App.FindCollectionByNameOrId("webhooks")
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret := webhookSecretPrefix + security.RandomString(32)
+	record := core.NewRecord(collection)
+	record.Set("name", opts.Name)
+	record.Set("url", opts.URL)
+	events := make([]string, 0, len(opts.Events))
+	for _, event := range opts.Events {
+		events = append(events, string(event))
+	}
+	record.Set("events", events)
+	if err := m.keyRing.setSecret(record, "secret", secret); err != nil {
+		return nil, "", err
+	}
+	if err := m.cfg.App.SaveWithContext(ctx, record); err != nil {
+		return nil, "", err
+	}
+	return getWebhookFromRecord(record), secret, nil
+}
+
+// DeleteWebhook deletes a webhook with its deliveries
+func (m *NATSAuthModule) DeleteWebhook(ctx context.Context, id string) error {
+	record, err := m.cfg.App.FindRecordById("webhooks", id)
+	if err != nil {
+		return err
+	}
+	return m.cfg.App.DeleteWithContext(ctx, record)
+}
+
+// GetWebhookDeliveries returns the latest deliveries of a webhook, newest first
+func (m *NATSAuthModule) GetWebhookDeliveries(_ context.Context, webhookID string, limit int) ([]*application.WebhookDelivery, error) {
+	records, err := m.cfg.App.FindRecordsByFilter("webhook_deliveries",
+		"webhook = {:webhook}", "-created", limit, 0, dbx.Params{"webhook": webhookID})
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*application.WebhookDelivery
+	for _, record := range records {
+		res = append(res, getWebhookDeliveryFromRecord(record))
+	}
+	return res, nil
+}
+
+// RedeliverWebhookDelivery sends a delivery again with a new set of attempts
+func (m *NATSAuthModule) RedeliverWebhookDelivery(ctx context.Context, deliveryID string) error {
+	record, err := m.cfg.App.FindRecordById("webhook_deliveries", deliveryID)
+	if err != nil {
+		return err
+	}
+	record.Set("status", string(application.WebhookDeliveryPending))
+	record.Set("attempts", 0)
+	record.Set("next_attempt", time.Now())
+	if err := m.cfg.App.SaveWithContext(ctx, record); err != nil {
+		return err
+	}
+	m.wakeWebhookDelivery()
+	return nil
+}
+
+// queueWebhookEvent creates a delivery of the event for every webhook subscribed to it.
+// Webhooks must not fail the change, so errors are only logged.
+func (m *NATSAuthModule) queueWebhookEvent(ctx context.Context, dao core.App,
+	event application.WebhookEvent, record *core.Record, data any) {
+	logger := m.logger.With(slog.String("event", string(event)),
+		slog.String("record_id", record.Id))
+
+	webhookRecords, err := dao.FindAllRecords("webhooks",
+		dbx.NewExp("EXISTS (SELECT 1 FROM json_each(events) WHERE value = {:event})",
+			dbx.Params{"event": string(event)}))
+	if err != nil {
+		logger.ErrorContext(ctx, "Could not find webhooks", slog.String("error", err.Error()))
+		return
+	}
+	if len(webhookRecords) == 0 {
+		return
+	}
+
+	collection, err := dao.FindCollectionByNameOrId("webhook_deliveries")
+	if err != nil {
+		logger.ErrorContext(ctx, "Could not find webhook deliveries", slog.String("error", err.Error()))
+		return
+	}
+
+	installationID, accountID, _ := auditScope(dao, record)
+	for _, webhookRecord := range webhookRecords {
+		deliveryRecord := core.NewRecord(collection)
+		deliveryRecord.Id = core.GenerateDefaultRandomId()
+		deliveryRecord.Set("webhook", webhookRecord.Id)
+		deliveryRecord.Set("event", string(event))
+		deliveryRecord.Set("payload", application.WebhookPayload{
+			ID:             deliveryRecord.Id,
+			Event:          event,
+			InstallationID: installationID,
+			AccountID:      accountID,
+			Data:           data,
+			Created:        time.Now().UTC(),
+		})
+		deliveryRecord.Set("status", string(application.WebhookDeliveryPending))
+		deliveryRecord.Set("next_attempt", time.Now())
+		if err := dao.SaveWithContext(ctx, deliveryRecord); err != nil {
+			logger.ErrorContext(ctx, "Could not queue webhook delivery",
+				slog.String("webhook_id", webhookRecord.Id),
+				slog.String("error", err.Error()))
+		}
+	}
+	m.wakeWebhookDelivery()
+}
+
+// wakeWebhookDelivery delivers the pending deliveries without waiting for the next poll
+func (m *NATSAuthModule) wakeWebhookDelivery() {
+	select {
+	case m.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// runWebhookDelivery delivers the pending webhook deliveries until the context is done
+func (m *NATSAuthModule) runWebhookDelivery(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	client := &http.Client{Timeout: webhookTimeout}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.webhookWake:
+		}
+		if err := m.deliverWebhooks(ctx, client); err != nil {
+			m.logger.ErrorContext(ctx, "Could not deliver webhooks",
+				slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (m *NATSAuthModule) deliverWebhooks(ctx context.Context, client *http.Client) error {
+	records, err := m.cfg.App.FindRecordsByFilter("webhook_deliveries",
+		"status = {:status} && next_attempt <= {:now}",
+		"next_attempt",
+		0,
+		0,
+		dbx.Params{
+			"status": string(application.WebhookDeliveryPending),
+			"now":    types.NowDateTime().String(),
+		})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := m.deliverWebhook(ctx, client, record); err != nil {
+			return err
+		}
+	}
+
+	_, err = m.cfg.App.DB().Delete("webhook_deliveries", dbx.And(
+		dbx.NewExp("status != {:status}", dbx.Params{"status": string(application.WebhookDeliveryPending)}),
+		dbx.NewExp("updated < {:before}", dbx.Params{
+			"before": types.NowDateTime().Add(-webhookDeliveryRetention).String(),
+		}),
+	)).Execute()
+	return err
+}
+
+// deliverWebhook posts the payload of a delivery to its webhook and schedules a retry if it fails
+func (m *NATSAuthModule) deliverWebhook(ctx context.Context, client *http.Client, record *core.Record) error {
+	webhookRecord, err := m.cfg.App.FindRecordById("webhooks", record.GetString("webhook"))
+	if err != nil {
+		return err
+	}
+	logger := m.logger.With(slog.String("webhook_id", webhookRecord.Id),
+		slog.String("delivery_id", record.Id),
+		slog.String("event", record.GetString("event")))
+
+	status, deliveryErr := m.postWebhook(ctx, client, webhookRecord, record)
+
+	attempts := record.GetInt("attempts") + 1
+	record.Set("attempts", attempts)
+	record.Set("response_status", status)
+	record.Set("error", "")
+	switch {
+	case deliveryErr == nil:
+		logger.InfoContext(ctx, "Webhook delivered", slog.Int("status", status))
+		record.Set("status", string(application.WebhookDeliveryDelivered))
+	case attempts >= webhookMaxAttempts:
+		logger.ErrorContext(ctx, "Webhook delivery failed, giving up",
+			slog.Int("attempts", attempts),
+			slog.String("error", deliveryErr.Error()))
+		record.Set("status", string(application.WebhookDeliveryFailed))
+		record.Set("error", deliveryErr.Error())
+	default:
+		delay := webhookRetryBackoff(attempts)
+		logger.WarnContext(ctx, "Webhook delivery failed, retrying",
+			slog.Int("attempts", attempts),
+			slog.Duration("delay", delay),
+			slog.String("error", deliveryErr.Error()))
+		record.Set("error", deliveryErr.Error())
+		record.Set("next_attempt", time.Now().Add(delay))
+	}
+	return m.cfg.App.SaveWithContext(ctx, record)
+}
+
+// webhookRetryBackoff returns the delay before the next attempt after the failed attempts
+func webhookRetryBackoff(attempts int) time.Duration {
+	delay := webhookRetryDelay << (attempts - 1)
+	if delay > webhookMaxRetryDelay || delay <= 0 {
+		return webhookMaxRetryDelay
+	}
+	return delay
+}
+
+// postWebhook sends the payload and returns the HTTP status of the response
+func (m *NATSAuthModule) postWebhook(ctx context.Context, client *http.Client,
+	webhookRecord, record *core.Record) (int, error) {
+	secret, err := m.keyRing.getSecret(webhookRecord, "secret")
+	if err != nil {
+		return 0, err
+	}
+	body := []byte(record.GetString("payload"))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookRecord.GetString("url"), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "NATS-Tower-Webhook")
+	req.Header.Set("X-Tower-Event", record.GetString("event"))
+	req.Header.Set("X-Tower-Delivery", record.Id)
+	req.Header.Set("X-Tower-Signature", "t="+timestamp+",v1="+signWebhookPayload(secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhookPayload returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>"
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
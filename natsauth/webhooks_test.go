@@ -0,0 +1,132 @@
+package natsauth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-tower/nats-tower/application"
+)
+
+func Test_signWebhookPayload(t *testing.T) {
+	got := signWebhookPayload("whsec_test", "1700000000", []byte(`{"event":"account.created"}`))
+	want := "949d3cca7549a05c4152ecfa880f1e9d5ba9b7083016031cc913f3b9da60c156"
+	if got != want {
+		t.Errorf("signWebhookPayload() = %s, want %s", got, want)
+	}
+	if signWebhookPayload("whsec_test", "1700000001", []byte(`{"event":"account.created"}`)) == want {
+		t.Errorf("Signature does not cover the timestamp")
+	}
+}
+
+func Test_webhookRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := webhookRetryBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookRetryBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func Test_WebhookDelivery(t *testing.T) {
+	const url = "nats://127.0.0.1:14240"
+	ctx := context.Background()
+	natsModule := newTestModule(t, url)
+
+	var secret string
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, signature, _ := strings.Cut(strings.TrimPrefix(r.Header.Get("X-Tower-Signature"), "t="), ",v1=")
+		if signature != signWebhookPayload(secret, timestamp, body) {
+			received <- "invalid signature"
+		} else {
+			received <- r.Header.Get("X-Tower-Event")
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(server.Close)
+
+	webhook, webhookSecret, err := natsModule.CreateWebhook(ctx, application.WebhookOptions{
+		Name:   "test",
+		URL:    server.URL,
+		Events: []application.WebhookEvent{application.WebhookEventAccountCreated},
+	})
+	if err != nil {
+		t.Fatalf("Failed to CreateWebhook: %v", err)
+	}
+	secret = webhookSecret
+
+	if _, err := natsModule.UpsertAccountAuth(ctx, url, "A", "", UpsertAccountAuthOptions{}); err != nil {
+		t.Fatalf("Failed to UpsertAccountAuth: %v", err)
+	}
+
+	waitForDelivery := func() *application.WebhookDelivery {
+		select {
+		case event := <-received:
+			if event != string(application.WebhookEventAccountCreated) {
+				t.Fatalf("Webhook received %s", event)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Webhook was not called")
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			deliveries, err := natsModule.GetWebhookDeliveries(ctx, webhook.ID, 0)
+			if err != nil {
+				t.Fatalf("Failed to GetWebhookDeliveries: %v", err)
+			}
+			if len(deliveries) == 1 && deliveries[0].Attempts > 0 {
+				return deliveries[0]
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Delivery was not updated: %+v", deliveries)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	// a failed attempt is retried with a delay
+	delivery := waitForDelivery()
+	if delivery.Status != application.WebhookDeliveryPending || delivery.Attempts != 1 || delivery.ResponseStatus != http.StatusInternalServerError {
+		t.Fatalf("Failed delivery is %+v", delivery)
+	}
+	if delay := time.Until(delivery.NextAttempt); delay < 20*time.Second || delay > webhookRetryDelay {
+		t.Errorf("Next attempt is in %s, want %s", delay, webhookRetryDelay)
+	}
+
+	status.Store(http.StatusOK)
+	if err := natsModule.RedeliverWebhookDelivery(ctx, delivery.ID); err != nil {
+		t.Fatalf("Failed to RedeliverWebhookDelivery: %v", err)
+	}
+	delivery = waitForDelivery()
+	if delivery.Status != application.WebhookDeliveryDelivered || delivery.ResponseStatus != http.StatusOK {
+		t.Fatalf("Redelivery is %+v", delivery)
+	}
+
+	var payload application.WebhookPayload
+	if err := json.Unmarshal([]byte(delivery.Payload), &payload); err != nil {
+		t.Fatalf("Failed to unmarshal payload: %v", err)
+	}
+	if payload.ID != delivery.ID || payload.Event != application.WebhookEventAccountCreated {
+		t.Errorf("Payload is %+v", payload)
+	}
+}